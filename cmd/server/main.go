@@ -1,15 +1,33 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
 	"log"
 	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
+	"time"
 
 	"go-storage-api/internal/api"
+	"go-storage-api/internal/auth"
 	"go-storage-api/internal/config"
+	"go-storage-api/internal/policy"
+	"go-storage-api/internal/share"
+	"go-storage-api/internal/storage"
+	"go-storage-api/internal/storage/ftp"
 	"go-storage-api/internal/storage/local"
+	"go-storage-api/internal/storage/memory"
+	"go-storage-api/internal/storage/s3"
+	"go-storage-api/internal/storage/sftp"
+	"go-storage-api/internal/storage/smb"
+	"go-storage-api/internal/storage/webdav"
+	"go-storage-api/internal/upload"
 )
 
 func main() {
@@ -20,17 +38,190 @@ func main() {
 		Level: level,
 	}))
 
-	store, err := local.New(cfg.Local.RootPath)
+	store, err := newStorage(cfg)
 	if err != nil {
-		log.Fatalf("create local storage backend: %v", err)
+		log.Fatalf("create %s storage backend: %v", cfg.StorageBackend, err)
+	}
+	if closer, ok := store.(io.Closer); ok {
+		defer closer.Close()
 	}
 
-	router := api.NewRouter(store, cfg.MaxUploadSize, logger)
+	uploads, err := upload.New(cfg.Uploads.Dir, cfg.Uploads.Expiry)
+	if err != nil {
+		log.Fatalf("create upload store: %v", err)
+	}
 
-	logger.Info("server started", "port", cfg.Port, "backend", cfg.StorageBackend)
+	authn, err := newAuthenticator(cfg)
+	if err != nil {
+		log.Fatalf("configure authentication: %v", err)
+	}
+	var pol *policy.Policy
+	if cfg.Auth.PolicyFile != "" {
+		if pol, err = policy.Load(cfg.Auth.PolicyFile); err != nil {
+			log.Fatalf("load policy: %v", err)
+		}
+	}
+
+	shares := api.ShareOptions{
+		MaxExpiry: cfg.Shares.MaxExpiry,
+		BaseURL:   cfg.Shares.BaseURL,
+		Presign:   cfg.Shares.S3Presign,
+	}
+	if cfg.Shares.Secret != "" {
+		if shares.Signer, err = share.New([]byte(cfg.Shares.Secret)); err != nil {
+			log.Fatalf("configure share links: %v", err)
+		}
+	}
 
-	if err := http.ListenAndServe(":"+cfg.Port, router); err != nil {
-		log.Fatalf("server exited: %v", err)
+	router := api.NewRouter(store, api.Options{
+		MaxUploadSize:    cfg.MaxUploadSize,
+		Uploads:          uploads,
+		MaxResumableSize: cfg.Uploads.MaxSize,
+		Extract:          api.ExtractLimits{MaxEntries: cfg.Extract.MaxEntries, MaxSize: cfg.Extract.MaxSize},
+		Logger:           logger,
+		Auth:             authn,
+		Policy:           pol,
+		Shares:           shares,
+	})
+	srv := &http.Server{Addr: ":" + cfg.Port, Handler: router}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	go sweepUploads(ctx, uploads, store, logger)
+	if rec, ok := store.(storage.Recoverer); ok {
+		go recoverStorage(ctx, rec, logger)
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+	}()
+
+	logger.Info("server started", "port", cfg.Port, "backend", cfg.StorageBackend, "auth", authn != nil)
+
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		logger.Error("server exited", "error", err)
+		return
+	}
+	logger.Info("server stopped")
+}
+
+// sweepInterval is how often expired uploads are removed.
+const sweepInterval = 10 * time.Minute
+
+// sweepUploads removes expired uploads, aborting their native multipart
+// uploads in store, until ctx is cancelled.
+func sweepUploads(ctx context.Context, uploads *upload.Store, store storage.Storage, logger *slog.Logger) {
+	t := time.NewTicker(sweepInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			n, err := uploads.Sweep(ctx, store)
+			if err != nil {
+				logger.Error("sweep expired uploads", "error", err)
+			} else if n > 0 {
+				logger.Info("removed expired uploads", "count", n)
+			}
+		}
+	}
+}
+
+// recoverStorage puts back files that a replacement cut short by a crash
+// left under their aside names. It walks the whole tree, so it runs in the
+// background rather than delaying startup.
+func recoverStorage(ctx context.Context, rec storage.Recoverer, logger *slog.Logger) {
+	n, err := rec.Recover(ctx)
+	if err != nil {
+		logger.Error("recover replaced files", "error", err, "restored", n)
+	} else if n > 0 {
+		logger.Info("restored files left aside by an interrupted replace", "count", n)
+	}
+}
+
+// newAuthenticator builds the authenticator for the configured credentials,
+// or returns nil to leave the API open.
+func newAuthenticator(cfg *config.Config) (auth.Authenticator, error) {
+	var authns []auth.Authenticator
+	// Tokens come first: the key store would report a JWT as an unknown
+	// key, while the JWT authenticator passes on anything else.
+	if c := cfg.Auth.JWT; c.JWKS != "" {
+		jwks, err := auth.LoadJWKS(context.Background(), c.JWKS, c.JWKSRefresh)
+		if err != nil {
+			return nil, err
+		}
+		tokens, err := auth.NewJWTAuthenticator(jwks, auth.JWTOptions{
+			Issuer:        c.Issuer,
+			Audience:      c.Audience,
+			ScopeClaim:    c.ScopeClaim,
+			ScopePrefix:   c.ScopePrefix,
+			PrefixesClaim: c.PrefixesClaim,
+		})
+		if err != nil {
+			return nil, err
+		}
+		authns = append(authns, tokens)
+	}
+	if cfg.Auth.APIKeysFile != "" {
+		keys, err := auth.LoadKeyStore(cfg.Auth.APIKeysFile)
+		if err != nil {
+			return nil, fmt.Errorf("load API keys: %w", err)
+		}
+		authns = append(authns, keys)
+	}
+
+	switch len(authns) {
+	case 0:
+		return nil, nil
+	case 1:
+		return authns[0], nil
+	}
+	return auth.Any(authns...), nil
+}
+
+// newStorage builds the backend selected by STORAGE_BACKEND.
+func newStorage(cfg *config.Config) (storage.Storage, error) {
+	switch cfg.StorageBackend {
+	case "local":
+		return local.New(cfg.Local.RootPath)
+	case "memory":
+		return memory.New(), nil
+	case "smb":
+		return smb.New(cfg.SMB.Host, cfg.SMB.Port, cfg.SMB.Share, cfg.SMB.User, cfg.SMB.Password)
+	case "ftp":
+		return ftp.New(cfg.FTP.Host, cfg.FTP.Port, cfg.FTP.User, cfg.FTP.Password, cfg.FTP.PoolSize)
+	case "s3":
+		return s3.New(context.Background(), s3.Options{
+			Bucket:       cfg.S3.Bucket,
+			Region:       cfg.S3.Region,
+			Prefix:       cfg.S3.Prefix,
+			Endpoint:     cfg.S3.Endpoint,
+			UsePathStyle: cfg.S3.UsePathStyle,
+		})
+	case "sftp":
+		return sftp.New(context.Background(), sftp.Options{
+			Host:                 cfg.SFTP.Host,
+			Port:                 cfg.SFTP.Port,
+			User:                 cfg.SFTP.User,
+			Password:             cfg.SFTP.Password,
+			PrivateKeyPath:       cfg.SFTP.PrivateKeyPath,
+			PrivateKeyPassphrase: cfg.SFTP.PrivateKeyPassphrase,
+			KnownHostsPath:       cfg.SFTP.KnownHostsPath,
+			RootPath:             cfg.SFTP.RootPath,
+		})
+	case "webdav":
+		return webdav.New(context.Background(), webdav.Options{
+			URL:      cfg.WebDAV.URL,
+			User:     cfg.WebDAV.User,
+			Password: cfg.WebDAV.Password,
+		})
+	default:
+		return nil, fmt.Errorf("storage backend %q is not implemented", cfg.StorageBackend)
 	}
 }
 
@@ -0,0 +1,127 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+
+	"go-storage-api/internal/auth"
+	"go-storage-api/internal/storage"
+	"go-storage-api/internal/upload"
+)
+
+// access declares what a route does to the storage paths in one of its
+// query parameters.
+type access struct {
+	param string
+	ops   []auth.Operation
+}
+
+func reads(param string) access   { return access{param, []auth.Operation{auth.Read}} }
+func writes(param string) access  { return access{param, []auth.Operation{auth.Write}} }
+func deletes(param string) access { return access{param, []auth.Operation{auth.Delete}} }
+
+// moves is the access of a move's source: it is read and then removed.
+func moves(param string) access {
+	return access{param, []auth.Operation{auth.Read, auth.Delete}}
+}
+
+// authorizer checks routes with check, which is auth.Check or, with a
+// policy, policy.Policy.Check. checkTree does the same for a path and
+// everything below it; auth.Check needs no extra work for that, since
+// credential prefixes always cover whole subtrees, while a policy may deny
+// paths below ones it allows.
+type authorizer struct {
+	check     func(ctx context.Context, op auth.Operation, path string) error
+	checkTree func(ctx context.Context, op auth.Operation, path string) error
+}
+
+type authorizerKey struct{}
+
+// authorize checks every path the request names against the caller's
+// permissions before next runs, and answers 403 if one is not allowed. A
+// parameter that is absent stands for the root, as it does for List and
+// Search. The authorizer goes into the request context, so handlers can
+// check the entries they reach below those paths with allowed and
+// authorizeBelow.
+func (a authorizer) authorize(next http.HandlerFunc, rules ...access) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := eachPath(r.URL.Query(), rules, func(op auth.Operation, p string) error {
+			return a.check(r.Context(), op, p)
+		}); err != nil {
+			writeError(w, http.StatusForbidden, err.Error())
+			return
+		}
+		next(w, r.WithContext(context.WithValue(r.Context(), authorizerKey{}, a)))
+	}
+}
+
+// eachPath calls fn for every operation of rules on every path they name
+// in q.
+func eachPath(q url.Values, rules []access, fn func(op auth.Operation, p string) error) error {
+	for _, rule := range rules {
+		paths := q[rule.param]
+		if len(paths) == 0 {
+			paths = []string{""}
+		}
+		for _, p := range paths {
+			for _, op := range rule.ops {
+				if err := fn(op, p); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// authorizerFrom returns the authorizer of the route, or one built on
+// auth.Check for handlers served without authorize, as in tests.
+func authorizerFrom(ctx context.Context) authorizer {
+	if a, ok := ctx.Value(authorizerKey{}).(authorizer); ok {
+		return a
+	}
+	return authorizer{check: auth.Check, checkTree: auth.Check}
+}
+
+// allowed checks op on a single path a handler reaches below the ones
+// authorize checked, such as an entry found by a walk or unpacked from an
+// archive.
+func allowed(ctx context.Context, op auth.Operation, p string) error {
+	return authorizerFrom(ctx).check(ctx, op, p)
+}
+
+// authorizeBelow repeats the checks of rules for everything below their
+// paths if the path in param is a directory, for operations that act on
+// its whole tree: a recursive delete, or a move or copy of a directory and
+// the tree it creates at the destination. Any path below that the caller
+// may not use refuses the whole operation. If param cannot be stat'ed, the
+// operation is left to report it.
+func authorizeBelow(r *http.Request, store storage.Storage, param string, rules ...access) error {
+	info, err := store.Stat(r.Context(), r.URL.Query().Get(param))
+	if err != nil || !info.IsDir {
+		return nil
+	}
+	a := authorizerFrom(r.Context())
+	return eachPath(r.URL.Query(), rules, func(op auth.Operation, p string) error {
+		return a.checkTree(r.Context(), op, p)
+	})
+}
+
+// authorizeUpload checks that the caller may write the target path of the
+// upload named in the URL, so an upload can only be continued, completed or
+// aborted by someone allowed to create it. Unknown uploads are left to next
+// to report.
+func (a authorizer) authorizeUpload(uploads *upload.Store, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if auth.FromContext(r.Context()) != nil {
+			if info, err := uploads.Get(r.PathValue("id")); err == nil {
+				if err := a.check(r.Context(), auth.Write, info.Path); err != nil {
+					writeError(w, http.StatusForbidden, err.Error())
+					return
+				}
+			}
+		}
+		next(w, r)
+	}
+}
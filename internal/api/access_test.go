@@ -0,0 +1,187 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go-storage-api/internal/auth"
+	"go-storage-api/internal/storage"
+	"go-storage-api/internal/storage/memory"
+	"go-storage-api/internal/upload"
+)
+
+// newAuthRouter returns a router over a memory store holding files, with
+// these API keys:
+//
+//	admin:  read, write, delete everywhere
+//	reader: read everywhere
+//	ci:     read, write under builds/
+func newAuthRouter(t *testing.T, files map[string]string) (http.Handler, storage.Storage) {
+	t.Helper()
+	keys, err := auth.NewKeyStore([]auth.Key{
+		{ID: "admin", Hash: auth.HashKey("admin-key"), Scopes: []string{"read", "write", "delete"}},
+		{ID: "reader", Hash: auth.HashKey("reader-key"), Scopes: []string{"read"}},
+		{ID: "ci", Hash: auth.HashKey("ci-key"), Scopes: []string{"read", "write"}, Prefixes: []string{"builds"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	uploads, err := upload.New(t.TempDir(), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store := memory.New()
+	for p, content := range files {
+		if err := store.Write(context.Background(), p, strings.NewReader(content)); err != nil {
+			t.Fatalf("Write(%q): %v", p, err)
+		}
+	}
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	return NewRouter(store, Options{
+		MaxUploadSize:    10 << 20,
+		Uploads:          uploads,
+		MaxResumableSize: 1024,
+		Logger:           logger,
+		Auth:             keys,
+	}), store
+}
+
+func serveAs(router http.Handler, key, method, target string, body io.Reader) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, body)
+	if key != "" {
+		req.Header.Set("X-API-Key", key)
+	}
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestAuth_RequiresKey(t *testing.T) {
+	router, _ := newAuthRouter(t, nil)
+
+	rr := serveAs(router, "", http.MethodGet, "/api/v1/files", nil)
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 without a key, got %d", rr.Code)
+	}
+	rr = serveAs(router, "wrong", http.MethodGet, "/api/v1/files", nil)
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 for an unknown key, got %d", rr.Code)
+	}
+	rr = serveAs(router, "", http.MethodGet, "/api/v1/health", nil)
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected health to be public, got %d", rr.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/files", nil)
+	req.Header.Set("Authorization", "Bearer reader-key")
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected 200 with a bearer key, got %d", rr.Code)
+	}
+}
+
+func TestAuth_Scopes(t *testing.T) {
+	router, store := newAuthRouter(t, map[string]string{"docs/a.txt": "alpha"})
+
+	rr := serveAs(router, "reader-key", http.MethodGet, "/api/v1/files/download?path=docs/a.txt", nil)
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected reader to download, got %d", rr.Code)
+	}
+
+	rr = serveAs(router, "reader-key", http.MethodPut, "/api/v1/files?path=docs/b.txt", strings.NewReader("beta"))
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("expected 403 for reader put, got %d", rr.Code)
+	}
+	var body ErrorResponse
+	json.NewDecoder(rr.Body).Decode(&body)
+	if body.Error != "forbidden: write not permitted on /docs/b.txt" {
+		t.Errorf("unexpected error %q", body.Error)
+	}
+	if _, err := store.Stat(context.Background(), "docs/b.txt"); err == nil {
+		t.Error("expected nothing to be written")
+	}
+
+	rr = serveAs(router, "reader-key", http.MethodDelete, "/api/v1/files?path=docs/a.txt", nil)
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("expected 403 for reader delete, got %d", rr.Code)
+	}
+	rr = serveAs(router, "admin-key", http.MethodDelete, "/api/v1/files?path=docs/a.txt", nil)
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected admin delete to succeed, got %d", rr.Code)
+	}
+}
+
+func TestAuth_Prefixes(t *testing.T) {
+	router, _ := newAuthRouter(t, map[string]string{
+		"builds/app.tar": "app",
+		"secret/key.pem": "key",
+	})
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		want   int
+	}{
+		{"read inside", http.MethodGet, "/api/v1/files/stat?path=/builds/app.tar", http.StatusOK},
+		{"read outside", http.MethodGet, "/api/v1/files/stat?path=secret/key.pem", http.StatusForbidden},
+		{"list root", http.MethodGet, "/api/v1/files", http.StatusForbidden},
+		{"list inside", http.MethodGet, "/api/v1/files?path=builds", http.StatusOK},
+		{"search root", http.MethodGet, "/api/v1/files/search?glob=*.pem", http.StatusForbidden},
+		{"archive one outside", http.MethodGet, "/api/v1/files/archive?path=builds&path=secret", http.StatusForbidden},
+		{"write inside", http.MethodPut, "/api/v1/files?path=builds/new.tar", http.StatusCreated},
+		{"copy out", http.MethodPost, "/api/v1/files/copy?from=builds/app.tar&to=public/app.tar", http.StatusForbidden},
+		{"copy in", http.MethodPost, "/api/v1/files/copy?from=secret/key.pem&to=builds/key.pem", http.StatusForbidden},
+		// Moving removes the source, which needs the delete scope.
+		{"move inside", http.MethodPost, "/api/v1/files/move?from=builds/app.tar&to=builds/old.tar", http.StatusForbidden},
+		{"copy inside", http.MethodPost, "/api/v1/files/copy?from=builds/app.tar&to=builds/copy.tar", http.StatusCreated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := serveAs(router, "ci-key", tt.method, tt.target, strings.NewReader("data"))
+			if rr.Code != tt.want {
+				t.Errorf("expected %d, got %d: %s", tt.want, rr.Code, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestAuth_UploadSessions(t *testing.T) {
+	router, _ := newAuthRouter(t, nil)
+
+	rr := serveAs(router, "ci-key", http.MethodPost, "/api/v1/uploads?path=secret/big.bin", nil)
+	if rr.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 creating a session outside the prefix, got %d", rr.Code)
+	}
+
+	rr = serveAs(router, "admin-key", http.MethodPost, "/api/v1/uploads?path=secret/big.bin", nil)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var session SessionResponse
+	json.NewDecoder(rr.Body).Decode(&session)
+
+	// Another key cannot touch the session, even knowing its ID.
+	rr = serveAs(router, "ci-key", http.MethodPut, "/api/v1/uploads/"+session.ID+"/parts/1", strings.NewReader("part"))
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("expected 403 uploading a part, got %d", rr.Code)
+	}
+	rr = serveAs(router, "reader-key", http.MethodDelete, "/api/v1/uploads/"+session.ID, nil)
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("expected 403 aborting, got %d", rr.Code)
+	}
+
+	rr = serveAs(router, "admin-key", http.MethodPut, "/api/v1/uploads/"+session.ID+"/parts/1", strings.NewReader("part"))
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected admin to upload a part, got %d: %s", rr.Code, rr.Body.String())
+	}
+}
@@ -0,0 +1,262 @@
+package api
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"go-storage-api/internal/auth"
+	"go-storage-api/internal/storage"
+)
+
+// archiveFormats maps the format query parameter of Archive to the response
+// content type and file name extension.
+var archiveFormats = map[string]struct{ contentType, ext string }{
+	"zip":    {"application/zip", ".zip"},
+	"tar.gz": {"application/gzip", ".tar.gz"},
+}
+
+// archiveWriter adds entries to an archive written straight to the client.
+// Entry names are slash-separated, relative and without a trailing slash.
+type archiveWriter interface {
+	dir(name string, modTime time.Time) error
+	file(name string, info storage.FileInfo, r io.Reader) error
+	Close() error
+}
+
+// Archive streams one or more files and directory trees, given as repeated
+// path parameters, as a zip (default) or tar.gz archive. Each selected path
+// becomes a top-level entry under its own name; selecting the root puts its
+// contents at the top level. Selections inside another selected directory
+// are already part of it and are skipped. Entries are read one at a time through Walk
+// and Read and compressed on the fly, so memory use does not depend on the
+// size of the tree and nothing touches the disk. All paths are checked
+// before the response starts; an error after that aborts the connection so
+// the client cannot mistake a truncated archive for a complete one.
+func (h *Handler) Archive(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	paths := q["path"]
+	if len(paths) == 0 {
+		writeError(w, http.StatusBadRequest, "path query parameter is required")
+		return
+	}
+	format := q.Get("format")
+	if format == "" {
+		format = "zip"
+	}
+	f, ok := archiveFormats[format]
+	if !ok {
+		writeError(w, http.StatusBadRequest, "format must be zip or tar.gz")
+		return
+	}
+
+	selected := make([]*storage.FileInfo, 0, len(paths))
+	for _, p := range paths {
+		info, err := h.store.Stat(r.Context(), p)
+		if err != nil {
+			handleStorageError(w, err)
+			return
+		}
+		selected = append(selected, info)
+	}
+	selected = outermost(selected)
+	names := map[string]bool{}
+	for _, info := range selected {
+		name := archiveName(info)
+		if names[name] {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("selection contains %q twice", name))
+			return
+		}
+		names[name] = true
+	}
+
+	filename := "archive"
+	if len(selected) == 1 && selected[0].Path != "" {
+		filename = selected[0].Name
+	}
+	w.Header().Set("Content-Type", f.contentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename + f.ext}))
+	w.WriteHeader(http.StatusOK)
+
+	var aw archiveWriter
+	if format == "zip" {
+		aw = &zipArchive{zw: zip.NewWriter(w), now: time.Now()}
+	} else {
+		aw = newTarArchive(w)
+	}
+	var err error
+	for _, info := range selected {
+		if err = h.archiveTree(r.Context(), aw, info); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = aw.Close()
+	}
+	if err != nil {
+		// The status line is gone; dropping the connection is the only way
+		// left to tell the client the archive is incomplete.
+		panic(http.ErrAbortHandler)
+	}
+}
+
+// archiveName is the top-level entry name of a selected path. The root has
+// none: its children are the top-level entries.
+func archiveName(info *storage.FileInfo) string {
+	if info.Path == "" {
+		return ""
+	}
+	return info.Name
+}
+
+// outermost drops selections that repeat an earlier one or lie inside a
+// selected directory, which already brings them into the archive. The root
+// contains every other path.
+func outermost(selected []*storage.FileInfo) []*storage.FileInfo {
+	kept := make([]*storage.FileInfo, 0, len(selected))
+	for i, info := range selected {
+		covered := false
+		for j, other := range selected {
+			if j == i {
+				continue
+			}
+			if other.Path == info.Path {
+				covered = j < i
+			} else {
+				covered = other.IsDir && (other.Path == "" || strings.HasPrefix(info.Path, other.Path+"/"))
+			}
+			if covered {
+				break
+			}
+		}
+		if !covered {
+			kept = append(kept, info)
+		}
+	}
+	return kept
+}
+
+// archiveTree adds a selected file, or a directory and everything below it
+// that the caller may read.
+func (h *Handler) archiveTree(ctx context.Context, aw archiveWriter, sel *storage.FileInfo) error {
+	prefix := archiveName(sel)
+	if !sel.IsDir {
+		return h.archiveFile(ctx, aw, prefix, *sel)
+	}
+	if prefix != "" {
+		if err := aw.dir(prefix, sel.ModTime); err != nil {
+			return err
+		}
+	}
+
+	return storage.Walk(ctx, h.store, sel.Path, func(f storage.FileInfo) error {
+		if allowed(ctx, auth.Read, f.Path) != nil {
+			return nil
+		}
+		name := f.Path
+		if sel.Path != "" {
+			name = path.Join(prefix, strings.TrimPrefix(f.Path, sel.Path+"/"))
+		}
+		if f.IsDir {
+			return aw.dir(name, f.ModTime)
+		}
+		return h.archiveFile(ctx, aw, name, f)
+	})
+}
+
+func (h *Handler) archiveFile(ctx context.Context, aw archiveWriter, name string, info storage.FileInfo) error {
+	rc, err := h.store.Read(ctx, info.Path)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	return aw.file(name, info, rc)
+}
+
+// zipArchive writes entries deflated, with sizes and CRC in data
+// descriptors after the data, so nothing has to be known in advance.
+type zipArchive struct {
+	zw  *zip.Writer
+	now time.Time
+}
+
+func (a *zipArchive) dir(name string, modTime time.Time) error {
+	_, err := a.zw.CreateHeader(&zip.FileHeader{Name: name + "/", Modified: orNow(modTime, a.now)})
+	return err
+}
+
+func (a *zipArchive) file(name string, info storage.FileInfo, r io.Reader) error {
+	fw, err := a.zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: orNow(info.ModTime, a.now)})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(fw, r)
+	return err
+}
+
+func (a *zipArchive) Close() error { return a.zw.Close() }
+
+// tarArchive writes a gzip-compressed tar stream. Tar headers carry the
+// file size up front, so the size reported by Stat or Walk must still hold
+// when the file is read.
+type tarArchive struct {
+	gz  *gzip.Writer
+	tw  *tar.Writer
+	now time.Time
+}
+
+func newTarArchive(w io.Writer) *tarArchive {
+	gz := gzip.NewWriter(w)
+	return &tarArchive{gz: gz, tw: tar.NewWriter(gz), now: time.Now()}
+}
+
+func (a *tarArchive) dir(name string, modTime time.Time) error {
+	return a.tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeDir,
+		Name:     name + "/",
+		Mode:     0o755,
+		ModTime:  orNow(modTime, a.now),
+	})
+}
+
+func (a *tarArchive) file(name string, info storage.FileInfo, r io.Reader) error {
+	err := a.tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Mode:     0o644,
+		Size:     info.Size,
+		ModTime:  orNow(info.ModTime, a.now),
+	})
+	if err != nil {
+		return err
+	}
+	n, err := io.Copy(a.tw, io.LimitReader(r, info.Size))
+	if err == nil && n != info.Size {
+		err = fmt.Errorf("%s: changed size while being archived", info.Path)
+	}
+	return err
+}
+
+func (a *tarArchive) Close() error {
+	if err := a.tw.Close(); err != nil {
+		return err
+	}
+	return a.gz.Close()
+}
+
+// orNow substitutes now for the zero modification time that backends
+// without one report, mostly for directories on object stores.
+func orNow(t, now time.Time) time.Time {
+	if t.IsZero() {
+		return now
+	}
+	return t
+}
@@ -0,0 +1,226 @@
+package api
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+
+	"go-storage-api/internal/storage"
+)
+
+// readArchive returns the entries of a zip or tar.gz archive by name, with
+// their contents. Directory names end in "/".
+func readArchive(t *testing.T, format string, data []byte) map[string]string {
+	t.Helper()
+	entries := map[string]string{}
+	if format == "zip" {
+		zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			t.Fatalf("open zip: %v", err)
+		}
+		for _, f := range zr.File {
+			rc, err := f.Open()
+			if err != nil {
+				t.Fatalf("open %s: %v", f.Name, err)
+			}
+			content, _ := io.ReadAll(rc)
+			rc.Close()
+			entries[f.Name] = string(content)
+		}
+		return entries
+	}
+
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("open gzip: %v", err)
+	}
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("read tar: %v", err)
+		}
+		content, _ := io.ReadAll(tr)
+		entries[hdr.Name] = string(content)
+	}
+	return entries
+}
+
+func entryNames(entries map[string]string) string {
+	names := make([]string, 0, len(entries))
+	for name := range entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ",")
+}
+
+func TestArchive_Formats(t *testing.T) {
+	h, store := newMemoryHandler(t, map[string]string{
+		"docs/a.txt":       "alpha",
+		"docs/sub/b.txt":   "beta",
+		"other/ignore.txt": "i",
+	})
+	store.Mkdir(context.Background(), "docs/empty")
+
+	for _, format := range []string{"zip", "tar.gz"} {
+		t.Run(format, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/files/archive?path=docs&format="+format, nil)
+			rr := httptest.NewRecorder()
+			h.Archive(rr, req)
+
+			if rr.Code != http.StatusOK {
+				t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+			}
+			if want := `attachment; filename=docs.` + format; rr.Header().Get("Content-Disposition") != want {
+				t.Errorf("Content-Disposition = %q, want %q", rr.Header().Get("Content-Disposition"), want)
+			}
+			entries := readArchive(t, format, rr.Body.Bytes())
+			if got := entryNames(entries); got != "docs/,docs/a.txt,docs/empty/,docs/sub/,docs/sub/b.txt" {
+				t.Errorf("entries = %s", got)
+			}
+			if entries["docs/a.txt"] != "alpha" || entries["docs/sub/b.txt"] != "beta" {
+				t.Errorf("contents = %v", entries)
+			}
+		})
+	}
+}
+
+func TestArchive_Selection(t *testing.T) {
+	h, _ := newMemoryHandler(t, map[string]string{
+		"docs/a.txt":       "alpha",
+		"docs/b.txt":       "beta",
+		"other/ignore.txt": "i",
+	})
+
+	tests := []struct {
+		query    string
+		filename string
+		entries  string
+	}{
+		{"path=docs/a.txt&path=other", "archive.zip", "a.txt,other/,other/ignore.txt"},
+		{"path=docs/b.txt", "b.txt.zip", "b.txt"},
+		{"path=/", "archive.zip", "docs/,docs/a.txt,docs/b.txt,other/,other/ignore.txt"},
+		{"path=/&path=docs&path=other/ignore.txt", "archive.zip", "docs/,docs/a.txt,docs/b.txt,other/,other/ignore.txt"},
+		{"path=docs/a.txt&path=docs&path=docs", "docs.zip", "docs/,docs/a.txt,docs/b.txt"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/files/archive?"+tt.query, nil)
+			rr := httptest.NewRecorder()
+			h.Archive(rr, req)
+
+			if rr.Code != http.StatusOK {
+				t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+			}
+			if got := rr.Header().Get("Content-Disposition"); got != "attachment; filename="+tt.filename {
+				t.Errorf("Content-Disposition = %q", got)
+			}
+			if got := entryNames(readArchive(t, "zip", rr.Body.Bytes())); got != tt.entries {
+				t.Errorf("entries = %s, want %s", got, tt.entries)
+			}
+		})
+	}
+}
+
+func TestArchive_NestedSelectionsOnce(t *testing.T) {
+	h, _ := newMemoryHandler(t, map[string]string{
+		"a.txt":      "a",
+		"docs/b.txt": "b",
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/files/archive?path=/&path=a.txt&path=docs&path=docs/b.txt", nil)
+	rr := httptest.NewRecorder()
+	h.Archive(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	// readArchive keys entries by name, which would hide duplicates.
+	data := rr.Body.Bytes()
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("open zip: %v", err)
+	}
+	var names []string
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+	}
+	sort.Strings(names)
+	if got := strings.Join(names, ","); got != "a.txt,docs/,docs/b.txt" {
+		t.Errorf("entries = %s", got)
+	}
+}
+
+func TestArchive_Errors(t *testing.T) {
+	h, _ := newMemoryHandler(t, map[string]string{
+		"a/x.txt": "1",
+		"b/x.txt": "2",
+	})
+
+	tests := []struct {
+		name  string
+		query string
+		want  int
+	}{
+		{"no path", "", http.StatusBadRequest},
+		{"unknown format", "path=a&format=rar", http.StatusBadRequest},
+		{"missing path", "path=a&path=missing", http.StatusNotFound},
+		{"duplicate name", "path=a/x.txt&path=b/x.txt", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/files/archive?"+tt.query, nil)
+			rr := httptest.NewRecorder()
+			h.Archive(rr, req)
+			if rr.Code != tt.want {
+				t.Errorf("expected %d, got %d: %s", tt.want, rr.Code, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestArchive_AbortsOnReadError(t *testing.T) {
+	store := &mockStorage{
+		statFn: func(_ context.Context, p string) (*storage.FileInfo, error) {
+			return &storage.FileInfo{Name: "docs", Path: "docs", IsDir: true}, nil
+		},
+		listFn: func(_ context.Context, _ string) ([]storage.FileInfo, error) {
+			return []storage.FileInfo{
+				{Name: "a.txt", Path: "docs/a.txt", Size: 1},
+				{Name: "b.txt", Path: "docs/b.txt", Size: 1},
+			}, nil
+		},
+		readFn: func(_ context.Context, p string) (io.ReadCloser, error) {
+			if p == "docs/b.txt" {
+				return nil, errors.New("connection lost")
+			}
+			return io.NopCloser(strings.NewReader("a")), nil
+		},
+	}
+	h := newTestHandler(store)
+
+	for _, format := range []string{"zip", "tar.gz"} {
+		t.Run(format, func(t *testing.T) {
+			defer func() {
+				if r := recover(); r != http.ErrAbortHandler {
+					t.Errorf("recovered %v, want http.ErrAbortHandler", r)
+				}
+			}()
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/files/archive?path=docs&format="+format, nil)
+			h.Archive(httptest.NewRecorder(), req)
+		})
+	}
+}
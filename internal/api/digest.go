@@ -0,0 +1,144 @@
+package api
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"strings"
+
+	"go-storage-api/internal/storage"
+)
+
+// errDigestMismatch is returned by a digestReader whose content does not
+// match an expected digest.
+var errDigestMismatch = errors.New("checksum mismatch")
+
+// contentDigestAlgorithms maps RFC 9530 algorithm keys to storage checksum
+// algorithms. Other keys are ignored.
+var contentDigestAlgorithms = map[string]string{
+	"sha-256": storage.SHA256,
+	"md5":     storage.MD5,
+	"crc32c":  storage.CRC32C,
+}
+
+// digestSizes holds the raw digest length of each algorithm.
+var digestSizes = map[string]int{
+	storage.SHA256: 32,
+	storage.MD5:    16,
+	storage.CRC32C: 4,
+}
+
+// parseDigests collects the expected digests of an upload from the
+// Content-Digest (RFC 9530), Content-MD5 and X-Checksum-SHA256 headers. It
+// returns nil if none are present. The error message is suitable for a 400
+// response.
+func parseDigests(h http.Header) (map[string][]byte, error) {
+	want := map[string][]byte{}
+	add := func(algo string, sum []byte) error {
+		if len(sum) != digestSizes[algo] {
+			return fmt.Errorf("invalid %s digest length", algo)
+		}
+		if prev, ok := want[algo]; ok && !bytes.Equal(prev, sum) {
+			return fmt.Errorf("conflicting %s digests", algo)
+		}
+		want[algo] = sum
+		return nil
+	}
+
+	if v := strings.Join(h.Values("Content-Digest"), ","); v != "" {
+		found := false
+		for _, member := range strings.Split(v, ",") {
+			key, value, ok := strings.Cut(strings.TrimSpace(member), "=")
+			if !ok {
+				return nil, errors.New("invalid Content-Digest header")
+			}
+			// Parameters carry no meaning for digests; drop them.
+			value, _, _ = strings.Cut(value, ";")
+			if len(value) < 2 || value[0] != ':' || value[len(value)-1] != ':' {
+				return nil, errors.New("invalid Content-Digest header")
+			}
+			algo, ok := contentDigestAlgorithms[strings.ToLower(key)]
+			if !ok {
+				continue
+			}
+			sum, err := base64.StdEncoding.DecodeString(value[1 : len(value)-1])
+			if err != nil {
+				return nil, errors.New("invalid Content-Digest header")
+			}
+			if err := add(algo, sum); err != nil {
+				return nil, err
+			}
+			found = true
+		}
+		if !found {
+			return nil, errors.New("Content-Digest has no supported algorithm (sha-256, md5, crc32c)")
+		}
+	}
+
+	if v := h.Get("Content-MD5"); v != "" {
+		sum, err := base64.StdEncoding.DecodeString(v)
+		if err != nil {
+			return nil, errors.New("invalid Content-MD5 header")
+		}
+		if err := add(storage.MD5, sum); err != nil {
+			return nil, err
+		}
+	}
+
+	// X-Checksum-SHA256 is hex-encoded by most tools, base64 by S3 clients.
+	if v := h.Get("X-Checksum-SHA256"); v != "" {
+		decode := base64.StdEncoding.DecodeString
+		if len(v) == hex.EncodedLen(digestSizes[storage.SHA256]) {
+			decode = hex.DecodeString
+		}
+		sum, err := decode(v)
+		if err != nil {
+			return nil, errors.New("invalid X-Checksum-SHA256 header")
+		}
+		if err := add(storage.SHA256, sum); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(want) == 0 {
+		return nil, nil
+	}
+	return want, nil
+}
+
+// digestReader hashes everything read through it. At the end of the stream
+// it returns errDigestMismatch instead of io.EOF unless every expected
+// digest matched, so the backend sees a failed upload and discards it.
+type digestReader struct {
+	r      io.Reader
+	want   map[string][]byte
+	hashes map[string]hash.Hash
+}
+
+func newDigestReader(r io.Reader, want map[string][]byte) *digestReader {
+	d := &digestReader{r: r, want: want, hashes: make(map[string]hash.Hash, len(want))}
+	for algo := range want {
+		d.hashes[algo], _ = storage.NewHash(algo)
+	}
+	return d
+}
+
+func (d *digestReader) Read(p []byte) (int, error) {
+	n, err := d.r.Read(p)
+	for _, h := range d.hashes {
+		h.Write(p[:n])
+	}
+	if err == io.EOF {
+		for _, algo := range storage.Algorithms {
+			if h, ok := d.hashes[algo]; ok && !bytes.Equal(h.Sum(nil), d.want[algo]) {
+				return n, fmt.Errorf("%w: %s", errDigestMismatch, algo)
+			}
+		}
+	}
+	return n, err
+}
@@ -0,0 +1,354 @@
+package api
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+
+	"go-storage-api/internal/auth"
+	"go-storage-api/internal/middleware"
+	"go-storage-api/internal/storage"
+)
+
+// errExtractLimit is returned when an archive holds more entries or more
+// uncompressed data than ExtractLimits allow.
+var errExtractLimit = errors.New("archive exceeds extraction limit")
+
+// ExtractLimits bounds what a single uploaded archive may expand to, so a
+// small archive cannot fill the backend (a zip bomb).
+type ExtractLimits struct {
+	// MaxEntries caps the number of files and directories.
+	MaxEntries int
+	// MaxSize caps the total uncompressed size of all files.
+	MaxSize int64
+}
+
+// DefaultExtractLimits are the limits NewRouter applies when Options leaves
+// them unset.
+var DefaultExtractLimits = ExtractLimits{MaxEntries: 10000, MaxSize: 1 << 30}
+
+// ExtractHandler unpacks uploaded archives into storage.
+type ExtractHandler struct {
+	store          storage.Storage
+	maxArchiveSize int64
+	limits         ExtractLimits
+}
+
+// NewExtractHandler creates an ExtractHandler that accepts archives of up to
+// maxArchiveSize bytes and unpacks them within limits.
+func NewExtractHandler(store storage.Storage, maxArchiveSize int64, limits ExtractLimits) *ExtractHandler {
+	return &ExtractHandler{store: store, maxArchiveSize: maxArchiveSize, limits: limits}
+}
+
+// ExtractResponse reports what an extraction wrote.
+type ExtractResponse struct {
+	Path        string `json:"path"`
+	Files       int    `json:"files"`
+	Directories int    `json:"directories"`
+}
+
+// entryError rejects an archive entry by name.
+type entryError struct {
+	name   string
+	reason string
+}
+
+func (e *entryError) Error() string {
+	return fmt.Sprintf("archive entry %q: %s", e.name, e.reason)
+}
+
+// archiveError marks a failure to read the archive itself, as opposed to a
+// failure of the backend it is extracted to.
+type archiveError struct{ err error }
+
+func (e *archiveError) Error() string { return e.err.Error() }
+func (e *archiveError) Unwrap() error { return e.err }
+
+// Extract unpacks a zip or tar.gz archive sent as the request body into the
+// directory named by the path query parameter, writing each file with
+// storage.Write. The format comes from the format query parameter or, failing
+// that, the Content-Type. Entry names pass the same checks as the path
+// query parameter (middleware.CheckPath) and must be relative, so no entry
+// can land outside the target; links and special files are refused. The
+// caller must be allowed to write every entry, not just the target.
+//
+// tar.gz is extracted while it streams in, so entries before a rejected one
+// are already written. zip keeps its index at the end, so the archive is
+// first spooled to a temporary file and every entry is checked before any is
+// written.
+func (h *ExtractHandler) Extract(w http.ResponseWriter, r *http.Request) {
+	target := r.URL.Query().Get("path")
+	if target == "" {
+		writeError(w, http.StatusBadRequest, "path query parameter is required")
+		return
+	}
+	// "/" and "" both name the root; entry paths are joined onto target.
+	target = strings.TrimPrefix(path.Clean("/"+target), "/")
+	format, ok := extractFormat(r)
+	if !ok {
+		writeError(w, http.StatusBadRequest, "format must be zip or tar.gz")
+		return
+	}
+	if target != "" {
+		info, err := h.store.Stat(r.Context(), target)
+		if err == nil && !info.IsDir {
+			writeError(w, http.StatusConflict, "path is not a directory")
+			return
+		}
+		if err != nil && !errors.Is(err, storage.ErrNotFound) {
+			handleStorageError(w, err)
+			return
+		}
+	}
+	if !limitBody(w, r, h.maxArchiveSize) {
+		return
+	}
+
+	x := &extraction{ctx: r.Context(), store: h.store, target: target, limits: h.limits, remaining: h.limits.MaxSize}
+	var err error
+	if format == "zip" {
+		err = x.zip(r.Body)
+	} else {
+		err = x.tarGz(r.Body)
+	}
+	if err != nil {
+		writeExtractError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, ExtractResponse{Path: target, Files: x.files, Directories: x.dirs})
+}
+
+// extractFormat picks the archive format from the query or Content-Type.
+func extractFormat(r *http.Request) (string, bool) {
+	switch r.URL.Query().Get("format") {
+	case "zip":
+		return "zip", true
+	case "tar.gz":
+		return "tar.gz", true
+	case "":
+	default:
+		return "", false
+	}
+	ct, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch ct {
+	case "application/zip", "application/x-zip-compressed":
+		return "zip", true
+	case "application/gzip", "application/x-gzip", "application/x-gtar":
+		return "tar.gz", true
+	}
+	return "", false
+}
+
+// writeExtractError answers an extraction failure: 413 past a limit or the
+// upload size, 400 for a rejected entry or a corrupt archive, 403 for an
+// entry the caller may not write, and the usual storage mapping otherwise.
+func writeExtractError(w http.ResponseWriter, err error) {
+	var entryErr *entryError
+	var archiveErr *archiveError
+	switch {
+	case errors.Is(err, errExtractLimit):
+		writeError(w, http.StatusRequestEntityTooLarge, err.Error())
+	case errors.Is(err, auth.ErrForbidden):
+		writeError(w, http.StatusForbidden, err.Error())
+	case errors.As(err, &entryErr):
+		writeError(w, http.StatusBadRequest, entryErr.Error())
+	case errors.As(err, &archiveErr):
+		if !writeBodyError(w, archiveErr.err) {
+			writeError(w, http.StatusBadRequest, "invalid archive: "+archiveErr.err.Error())
+		}
+	default:
+		handleStorageError(w, err)
+	}
+}
+
+// extraction writes the entries of one archive below target, keeping count
+// against the limits.
+type extraction struct {
+	ctx       context.Context
+	store     storage.Storage
+	target    string
+	limits    ExtractLimits
+	remaining int64
+	files     int
+	dirs      int
+}
+
+// entryPath returns where an entry is written, or "" for an entry naming the
+// target itself ("./").
+func (x *extraction) entryPath(name string) (string, error) {
+	if name == "" || strings.HasPrefix(name, "/") || strings.Contains(name, `\`) {
+		return "", &entryError{name, "name must be a relative slash-separated path"}
+	}
+	cleaned, ok := middleware.CheckPath(name)
+	if !ok {
+		return "", &entryError{name, "invalid path"}
+	}
+	if cleaned == "." {
+		return "", nil
+	}
+	p := path.Join(x.target, cleaned)
+	if err := allowed(x.ctx, auth.Write, p); err != nil {
+		return "", err
+	}
+	return p, nil
+}
+
+// count fails if one more entry would exceed MaxEntries.
+func (x *extraction) count() error {
+	if x.files+x.dirs >= x.limits.MaxEntries {
+		return fmt.Errorf("%w: more than %d entries", errExtractLimit, x.limits.MaxEntries)
+	}
+	return nil
+}
+
+func (x *extraction) mkdir(p string) error {
+	x.dirs++
+	if err := x.store.Mkdir(x.ctx, p); err != nil && !errors.Is(err, storage.ErrExist) {
+		return err
+	}
+	return nil
+}
+
+func (x *extraction) write(p string, r io.Reader) error {
+	x.files++
+	return x.store.Write(x.ctx, p, &budgetReader{r: r, x: x})
+}
+
+// budgetReader charges what it reads against the extraction's size limit
+// and marks read failures as archiveErrors.
+type budgetReader struct {
+	r io.Reader
+	x *extraction
+}
+
+func (b *budgetReader) Read(p []byte) (int, error) {
+	n, err := b.r.Read(p)
+	b.x.remaining -= int64(n)
+	if b.x.remaining < 0 {
+		return n, fmt.Errorf("%w: more than %d bytes uncompressed", errExtractLimit, b.x.limits.MaxSize)
+	}
+	if err != nil && err != io.EOF {
+		err = &archiveError{err}
+	}
+	return n, err
+}
+
+func (x *extraction) tarGz(body io.Reader) error {
+	gz, err := gzip.NewReader(body)
+	if err != nil {
+		return &archiveError{err}
+	}
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return &archiveError{err}
+		}
+		if hdr.Typeflag == tar.TypeXGlobalHeader {
+			continue // archive-wide PAX metadata, not an entry
+		}
+
+		p, err := x.entryPath(hdr.Name)
+		if err != nil {
+			return err
+		}
+		if err := x.count(); err != nil {
+			return err
+		}
+		switch {
+		case hdr.Typeflag == tar.TypeDir && p != "":
+			err = x.mkdir(p)
+		case hdr.Typeflag == tar.TypeDir:
+		case hdr.Typeflag == tar.TypeReg && p != "":
+			err = x.write(p, tr)
+		case hdr.Typeflag == tar.TypeSymlink || hdr.Typeflag == tar.TypeLink:
+			err = &entryError{hdr.Name, "links are not supported"}
+		default:
+			err = &entryError{hdr.Name, "unsupported entry type"}
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (x *extraction) zip(body io.Reader) error {
+	tmp, err := os.CreateTemp("", "extract-*.zip")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	size, err := io.Copy(tmp, body)
+	if err != nil {
+		return &archiveError{err}
+	}
+	zr, err := zip.NewReader(tmp, size)
+	if err != nil {
+		return &archiveError{err}
+	}
+
+	// Check every entry before writing any.
+	if len(zr.File) > x.limits.MaxEntries {
+		return fmt.Errorf("%w: more than %d entries", errExtractLimit, x.limits.MaxEntries)
+	}
+	var declared uint64
+	paths := make([]string, len(zr.File))
+	for i, f := range zr.File {
+		if paths[i], err = x.entryPath(f.Name); err != nil {
+			return err
+		}
+		switch mode := f.Mode(); {
+		case mode&fs.ModeSymlink != 0:
+			return &entryError{f.Name, "links are not supported"}
+		case !mode.IsDir() && !mode.IsRegular():
+			return &entryError{f.Name, "unsupported entry type"}
+		}
+		declared += f.UncompressedSize64
+	}
+	// Declared sizes can lie; budgetReader enforces the limit on what is
+	// actually inflated.
+	if declared > uint64(x.limits.MaxSize) {
+		return fmt.Errorf("%w: more than %d bytes uncompressed", errExtractLimit, x.limits.MaxSize)
+	}
+
+	for i, f := range zr.File {
+		p := paths[i]
+		if p == "" {
+			continue
+		}
+		if f.Mode().IsDir() {
+			err = x.mkdir(p)
+		} else {
+			err = x.zipFile(p, f)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (x *extraction) zipFile(p string, f *zip.File) error {
+	rc, err := f.Open()
+	if err != nil {
+		return &archiveError{err}
+	}
+	defer rc.Close()
+	return x.write(p, rc)
+}
@@ -0,0 +1,238 @@
+package api
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go-storage-api/internal/storage"
+)
+
+// testEntry is one entry of an archive built by buildZip or buildTarGz.
+// Names ending in "/" are directories; a non-empty link makes a symlink.
+type testEntry struct {
+	name, body, link string
+}
+
+func buildZip(t *testing.T, entries ...testEntry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, e := range entries {
+		hdr := &zip.FileHeader{Name: e.name, Method: zip.Deflate}
+		body := e.body
+		if e.link != "" {
+			hdr.SetMode(fs.ModeSymlink | 0o777)
+			body = e.link
+		}
+		fw, err := zw.CreateHeader(hdr)
+		if err != nil {
+			t.Fatalf("zip %s: %v", e.name, err)
+		}
+		fw.Write([]byte(body))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func buildTarGz(t *testing.T, entries ...testEntry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for _, e := range entries {
+		hdr := &tar.Header{Name: e.name, Mode: 0o644, Typeflag: tar.TypeReg, Size: int64(len(e.body))}
+		switch {
+		case e.link != "":
+			hdr.Typeflag, hdr.Linkname, hdr.Size = tar.TypeSymlink, e.link, 0
+		case strings.HasSuffix(e.name, "/"):
+			hdr.Typeflag, hdr.Size = tar.TypeDir, 0
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatalf("tar %s: %v", e.name, err)
+		}
+		if hdr.Size > 0 {
+			tw.Write([]byte(e.body))
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	gz.Close()
+	return buf.Bytes()
+}
+
+func buildArchive(t *testing.T, format string, entries ...testEntry) []byte {
+	t.Helper()
+	if format == "zip" {
+		return buildZip(t, entries...)
+	}
+	return buildTarGz(t, entries...)
+}
+
+func extractRequest(h *ExtractHandler, query, contentType string, body []byte) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/files/extract?"+query, bytes.NewReader(body))
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	rr := httptest.NewRecorder()
+	h.Extract(rr, req)
+	return rr
+}
+
+func newExtractHandler(t *testing.T, files map[string]string, limits ExtractLimits) (*ExtractHandler, storage.Storage) {
+	t.Helper()
+	_, store := newMemoryHandler(t, files)
+	return NewExtractHandler(store, 10<<20, limits), store
+}
+
+// --- Extract ---
+
+func TestExtract_Formats(t *testing.T) {
+	for format, contentType := range map[string]string{"zip": "application/zip", "tar.gz": "application/gzip"} {
+		t.Run(format, func(t *testing.T) {
+			h, store := newExtractHandler(t, nil, DefaultExtractLimits)
+			data := buildArchive(t, format,
+				testEntry{name: "./"},
+				testEntry{name: "docs/"},
+				testEntry{name: "docs/a.txt", body: "alpha"},
+				testEntry{name: "docs/sub/b.txt", body: "beta"},
+				testEntry{name: "empty/"},
+			)
+
+			rr := extractRequest(h, "path=/import", contentType, data)
+			if rr.Code != http.StatusCreated {
+				t.Fatalf("expected 201, got %d: %s", rr.Code, rr.Body.String())
+			}
+			var resp ExtractResponse
+			json.NewDecoder(rr.Body).Decode(&resp)
+			if resp != (ExtractResponse{Path: "import", Files: 2, Directories: 2}) {
+				t.Errorf("response = %+v", resp)
+			}
+			if got := readFile(t, store, "import/docs/a.txt"); got != "alpha" {
+				t.Errorf("a.txt = %q", got)
+			}
+			if got := readFile(t, store, "import/docs/sub/b.txt"); got != "beta" {
+				t.Errorf("b.txt = %q", got)
+			}
+			if info, err := store.Stat(context.Background(), "import/empty"); err != nil || !info.IsDir {
+				t.Errorf("Stat(import/empty) = %+v, %v", info, err)
+			}
+		})
+	}
+}
+
+func TestExtract_RejectsUnsafeEntries(t *testing.T) {
+	tests := []struct {
+		name  string
+		entry testEntry
+	}{
+		{"zip slip", testEntry{name: "../../etc/passwd", body: "x"}},
+		{"nested traversal", testEntry{name: "docs/../../x", body: "x"}},
+		{"absolute", testEntry{name: "/etc/passwd", body: "x"}},
+		{"backslash", testEntry{name: `..\x`, body: "x"}},
+		{"null byte", testEntry{name: "a\x00.txt", body: "x"}},
+		{"reserved name", testEntry{name: ".~upload-parts/abc/00001", body: "x"}},
+		{"symlink", testEntry{name: "link", link: "/etc/passwd"}},
+	}
+	for _, format := range []string{"zip", "tar.gz"} {
+		for _, tt := range tests {
+			if format == "tar.gz" && tt.name == "null byte" {
+				continue // archive/tar refuses to write such a name
+			}
+			t.Run(format+"/"+tt.name, func(t *testing.T) {
+				h, store := newExtractHandler(t, nil, DefaultExtractLimits)
+				data := buildArchive(t, format, tt.entry)
+
+				rr := extractRequest(h, "path=import&format="+format, "", data)
+				if rr.Code != http.StatusBadRequest {
+					t.Fatalf("expected 400, got %d: %s", rr.Code, rr.Body.String())
+				}
+				all, _ := store.List(context.Background(), "")
+				if len(all) != 0 {
+					t.Errorf("rejected archive wrote %v", all)
+				}
+			})
+		}
+	}
+}
+
+func TestExtract_ZipChecksEntriesFirst(t *testing.T) {
+	h, store := newExtractHandler(t, nil, DefaultExtractLimits)
+	data := buildZip(t, testEntry{name: "ok.txt", body: "1"}, testEntry{name: "../bad", body: "2"})
+
+	if rr := extractRequest(h, "path=import", "application/zip", data); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", rr.Code)
+	}
+	if _, err := store.Stat(context.Background(), "import/ok.txt"); err == nil {
+		t.Error("entry before the rejected one was written")
+	}
+}
+
+func TestExtract_Limits(t *testing.T) {
+	bomb := testEntry{name: "zeros", body: strings.Repeat("0", 1<<20)}
+	tests := []struct {
+		name    string
+		limits  ExtractLimits
+		entries []testEntry
+	}{
+		{"entries", ExtractLimits{MaxEntries: 2, MaxSize: 1 << 20}, []testEntry{{name: "a"}, {name: "b"}, {name: "c"}}},
+		{"size", ExtractLimits{MaxEntries: 10, MaxSize: 1024}, []testEntry{bomb}},
+		{"total size", ExtractLimits{MaxEntries: 10, MaxSize: 1024}, []testEntry{{name: "a", body: strings.Repeat("a", 600)}, {name: "b", body: strings.Repeat("b", 600)}}},
+	}
+	for _, format := range []string{"zip", "tar.gz"} {
+		for _, tt := range tests {
+			t.Run(format+"/"+tt.name, func(t *testing.T) {
+				h, _ := newExtractHandler(t, nil, tt.limits)
+				data := buildArchive(t, format, tt.entries...)
+				rr := extractRequest(h, "path=import&format="+format, "", data)
+				if rr.Code != http.StatusRequestEntityTooLarge {
+					t.Errorf("expected 413, got %d: %s", rr.Code, rr.Body.String())
+				}
+			})
+		}
+	}
+}
+
+func TestExtract_Errors(t *testing.T) {
+	h, _ := newExtractHandler(t, map[string]string{"file.txt": "x"}, DefaultExtractLimits)
+	valid := buildZip(t, testEntry{name: "a.txt", body: "a"})
+
+	tests := []struct {
+		name        string
+		query       string
+		contentType string
+		body        []byte
+		want        int
+	}{
+		{"no path", "", "application/zip", valid, http.StatusBadRequest},
+		{"unknown format", "path=x&format=rar", "", valid, http.StatusBadRequest},
+		{"no format", "path=x", "application/octet-stream", valid, http.StatusBadRequest},
+		{"target is a file", "path=file.txt", "application/zip", valid, http.StatusConflict},
+		{"corrupt zip", "path=x", "application/zip", []byte("not a zip"), http.StatusBadRequest},
+		{"corrupt tar.gz", "path=x", "application/gzip", []byte("not gzip"), http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := extractRequest(h, tt.query, tt.contentType, tt.body)
+			if rr.Code != tt.want {
+				t.Errorf("expected %d, got %d: %s", tt.want, rr.Code, rr.Body.String())
+			}
+		})
+	}
+
+	small := NewExtractHandler(h.store, 16, DefaultExtractLimits)
+	if rr := extractRequest(small, "path=x", "application/zip", valid); rr.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("archive over upload size: expected 413, got %d", rr.Code)
+	}
+}
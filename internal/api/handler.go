@@ -1,12 +1,20 @@
 package api
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"mime"
+	"mime/multipart"
 	"net/http"
+	"path"
 	"path/filepath"
+	"strconv"
+	"strings"
 
+	"go-storage-api/internal/auth"
 	"go-storage-api/internal/storage"
 )
 
@@ -26,23 +34,89 @@ func (h *Handler) Health(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, SuccessResponse{Message: "ok"})
 }
 
-// List returns the contents of a directory.
+// List returns the contents of a directory, optionally filtered by type and
+// name glob and sorted by name, size or modification time. With limit set,
+// at most that many entries are returned and the X-Next-Cursor header, if
+// present, fetches the next page.
 func (h *Handler) List(w http.ResponseWriter, r *http.Request) {
-	p := r.URL.Query().Get("path")
-	if p == "" {
-		p = "/"
+	q, err := parseListQuery(r.URL.Query())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
 	}
 
-	files, err := h.store.List(r.Context(), p)
+	var files []storage.FileInfo
+	var next string
+	if q.limit > 0 && q.streamed() {
+		files, next, err = h.listStreamed(r.Context(), q)
+	} else {
+		files, next, err = h.listSorted(r.Context(), q)
+	}
 	if err != nil {
 		handleStorageError(w, err)
 		return
 	}
 
+	if next != "" {
+		w.Header().Set("X-Next-Cursor", next)
+	}
 	writeJSON(w, http.StatusOK, files)
 }
 
-// Download streams a file to the client.
+// listStreamed fills a page from storage.ListPage, requesting no more than
+// the entries still missing so the page never overshoots the backend's
+// cursor. Filtered-out entries cost further requests, not memory.
+func (h *Handler) listStreamed(ctx context.Context, q *listQuery) ([]storage.FileInfo, string, error) {
+	files := []storage.FileInfo{}
+	token := q.token
+	for len(files) < q.limit {
+		page, err := storage.ListPage(ctx, h.store, q.path, token, q.limit-len(files))
+		if err != nil {
+			return nil, "", err
+		}
+		for _, f := range page.Entries {
+			if q.match(f) {
+				files = append(files, f)
+			}
+		}
+		token = page.Next
+		if token == "" {
+			return files, "", nil
+		}
+	}
+	return files, q.cursor(token, 0), nil
+}
+
+// listSorted lists the whole directory, then filters, sorts and slices it.
+// The cursor is an offset into the sorted result.
+func (h *Handler) listSorted(ctx context.Context, q *listQuery) ([]storage.FileInfo, string, error) {
+	all, err := h.store.List(ctx, q.path)
+	if err != nil {
+		return nil, "", err
+	}
+	files := all[:0]
+	for _, f := range all {
+		if q.match(f) {
+			files = append(files, f)
+		}
+	}
+	q.sortEntries(files)
+
+	if q.limit == 0 {
+		return files, "", nil
+	}
+	start := min(q.offset, len(files))
+	end := min(start+q.limit, len(files))
+	if end == len(files) {
+		return files[start:end], "", nil
+	}
+	return files[start:end], q.cursor("", end), nil
+}
+
+// Download streams a file to the client. Range, If-Range, If-None-Match,
+// If-Modified-Since and HEAD are handled by http.ServeContent; the file is
+// only opened once a body is actually sent, and only from the first byte of
+// the requested range.
 func (h *Handler) Download(w http.ResponseWriter, r *http.Request) {
 	p := r.URL.Query().Get("path")
 	if p == "" {
@@ -50,61 +124,216 @@ func (h *Handler) Download(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	rc, err := h.store.Read(r.Context(), p)
+	info, err := h.store.Stat(r.Context(), p)
 	if err != nil {
 		handleStorageError(w, err)
 		return
 	}
-	defer rc.Close()
+	if info.IsDir {
+		writeError(w, http.StatusBadRequest, "path is a directory")
+		return
+	}
 
 	ct := mime.TypeByExtension(filepath.Ext(p))
 	if ct == "" {
 		ct = "application/octet-stream"
 	}
 	w.Header().Set("Content-Type", ct)
+	w.Header().Set("ETag", storage.ETag(info))
+
+	content := &rangeReadSeeker{ctx: r.Context(), store: h.store, path: p, size: info.Size}
+	defer content.Close()
 
-	io.Copy(w, rc)
+	http.ServeContent(w, r, info.Name, info.ModTime, content)
 }
 
-// Upload receives a multipart file and writes it to storage.
+// Upload receives a multipart file and writes it to storage. The file part
+// is streamed to the backend as it arrives; other form fields are skipped.
+// Expected digests in the headers are checked while the file is written; on
+// a mismatch nothing is stored and 422 is returned. If-Match replaces the
+// file only if it still has the given ETag, and If-None-Match: * only
+// creates new files; otherwise nothing is stored and 412 is returned.
 func (h *Handler) Upload(w http.ResponseWriter, r *http.Request) {
 	p := r.URL.Query().Get("path")
 	if p == "" {
 		writeError(w, http.StatusBadRequest, "path query parameter is required")
 		return
 	}
+	if !limitBody(w, r, h.uploadLimit(r)) {
+		return
+	}
 
-	r.Body = http.MaxBytesReader(w, r.Body, h.maxUploadSize)
-
-	if err := r.ParseMultipartForm(32 << 20); err != nil {
+	mr, err := r.MultipartReader()
+	if err != nil {
 		writeError(w, http.StatusBadRequest, "invalid multipart form: "+err.Error())
 		return
 	}
+	part, err := nextFilePart(mr)
+	if err != nil {
+		if !writeBodyError(w, err) {
+			writeError(w, http.StatusBadRequest, "file field is required: "+err.Error())
+		}
+		return
+	}
+	defer part.Close()
+
+	// Digests describe the file content, so they may be sent either as
+	// request headers or as headers of the file part.
+	h.writeUpload(w, r, p, part, http.Header(part.Header))
+}
 
-	file, _, err := r.FormFile("file")
+// Put streams the raw request body to storage without any multipart
+// framing. Digest and precondition headers are handled as in Upload.
+func (h *Handler) Put(w http.ResponseWriter, r *http.Request) {
+	p := r.URL.Query().Get("path")
+	if p == "" {
+		writeError(w, http.StatusBadRequest, "path query parameter is required")
+		return
+	}
+	if !limitBody(w, r, h.uploadLimit(r)) {
+		return
+	}
+
+	h.writeUpload(w, r, p, r.Body, nil)
+}
+
+// uploadLimit is the largest body an upload may have: the server's limit,
+// or the caller's own if it is lower, as it is for share links with a size
+// cap.
+func (h *Handler) uploadLimit(r *http.Request) int64 {
+	if p := auth.FromContext(r.Context()); p != nil && p.MaxSize > 0 && p.MaxSize < h.maxUploadSize {
+		return p.MaxSize
+	}
+	return h.maxUploadSize
+}
+
+// limitBody caps the request body at limit bytes. A body that declares a
+// larger Content-Length is rejected with 413 before anything is read; one
+// without a length fails with 413 once it grows past the limit.
+func limitBody(w http.ResponseWriter, r *http.Request, limit int64) bool {
+	if r.ContentLength > limit {
+		writeError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("upload exceeds maximum size of %d bytes", limit))
+		return false
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, limit)
+	return true
+}
+
+// nextFilePart skips form fields until the part named "file".
+func nextFilePart(mr *multipart.Reader) (*multipart.Part, error) {
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			return nil, errors.New("no file part in form")
+		}
+		if err != nil {
+			return nil, err
+		}
+		if part.FormName() == "file" {
+			return part, nil
+		}
+		part.Close()
+	}
+}
+
+// writeUpload verifies any expected digests while streaming body to path.
+// partHeader holds the headers of the multipart file part, if any.
+func (h *Handler) writeUpload(w http.ResponseWriter, r *http.Request, p string, body io.Reader, partHeader http.Header) {
+	want, err := parseDigests(r.Header)
+	if err == nil && want == nil && partHeader != nil {
+		want, err = parseDigests(partHeader)
+	}
 	if err != nil {
-		writeError(w, http.StatusBadRequest, "file field is required: "+err.Error())
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	cond, err := parseCondition(r.Header)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
 		return
 	}
-	defer file.Close()
 
-	if err := h.store.Write(r.Context(), p, file); err != nil {
-		handleStorageError(w, err)
+	if want != nil {
+		body = newDigestReader(body, want)
+	}
+	if err := storage.WriteIf(r.Context(), h.store, p, body, cond); err != nil {
+		if errors.Is(err, errDigestMismatch) {
+			writeError(w, http.StatusUnprocessableEntity, errDigestMismatch.Error())
+			return
+		}
+		if !writeBodyError(w, err) {
+			handleStorageError(w, err)
+		}
 		return
 	}
 
 	writeJSON(w, http.StatusCreated, SuccessResponse{Message: "file uploaded"})
 }
 
-// Delete removes a file from storage.
+// writeBodyError answers errors caused by the request body rather than by
+// storage: 413 past the upload limit and 400 for a body that ended early. It
+// reports whether err was one of them.
+func writeBodyError(w http.ResponseWriter, err error) bool {
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooLarge):
+		writeError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("upload exceeds maximum size of %d bytes", tooLarge.Limit))
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		writeError(w, http.StatusBadRequest, "request body ended early")
+	default:
+		return false
+	}
+	return true
+}
+
+// Delete removes a file or empty directory from storage. With recursive=true
+// a directory is removed together with its contents. With If-Match, a file
+// is only removed if it still has the given ETag, and 412 is returned
+// otherwise.
 func (h *Handler) Delete(w http.ResponseWriter, r *http.Request) {
-	p := r.URL.Query().Get("path")
+	q := r.URL.Query()
+	p := q.Get("path")
 	if p == "" {
 		writeError(w, http.StatusBadRequest, "path query parameter is required")
 		return
 	}
 
-	if err := h.store.Delete(r.Context(), p); err != nil {
+	recursive := false
+	if v := q.Get("recursive"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "recursive must be true or false")
+			return
+		}
+		recursive = b
+	}
+
+	cond, err := parseCondition(r.Header)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if cond.IfNoneMatch || (cond.IfMatch != "" && recursive) {
+		writeError(w, http.StatusBadRequest, "delete only supports If-Match, and not with recursive")
+		return
+	}
+
+	if recursive {
+		if err := authorizeBelow(r, h.store, "path", deletes("path")); err != nil {
+			writeError(w, http.StatusForbidden, err.Error())
+			return
+		}
+	}
+
+	switch {
+	case recursive:
+		err = storage.DeleteAll(r.Context(), h.store, p)
+	case cond.IfMatch != "":
+		err = storage.DeleteIf(r.Context(), h.store, p, cond.IfMatch)
+	default:
+		err = h.store.Delete(r.Context(), p)
+	}
+	if err != nil {
 		handleStorageError(w, err)
 		return
 	}
@@ -112,7 +341,76 @@ func (h *Handler) Delete(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, SuccessResponse{Message: "file deleted"})
 }
 
-// Stat returns metadata for a file or directory.
+// Mkdir creates a directory and any missing parents.
+func (h *Handler) Mkdir(w http.ResponseWriter, r *http.Request) {
+	p := r.URL.Query().Get("path")
+	if p == "" {
+		writeError(w, http.StatusBadRequest, "path query parameter is required")
+		return
+	}
+
+	if err := h.store.Mkdir(r.Context(), p); err != nil {
+		handleStorageError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, SuccessResponse{Message: "directory created"})
+}
+
+// Move renames a file or directory from one path to another.
+func (h *Handler) Move(w http.ResponseWriter, r *http.Request) {
+	from, to, ok := transferPaths(w, r)
+	if !ok {
+		return
+	}
+
+	if err := authorizeBelow(r, h.store, "from", moves("from"), writes("to")); err != nil {
+		writeError(w, http.StatusForbidden, err.Error())
+		return
+	}
+
+	if err := storage.Move(r.Context(), h.store, from, to); err != nil {
+		handleStorageError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, SuccessResponse{Message: "file moved"})
+}
+
+// Copy duplicates a file or directory at another path.
+func (h *Handler) Copy(w http.ResponseWriter, r *http.Request) {
+	from, to, ok := transferPaths(w, r)
+	if !ok {
+		return
+	}
+
+	if err := authorizeBelow(r, h.store, "from", reads("from"), writes("to")); err != nil {
+		writeError(w, http.StatusForbidden, err.Error())
+		return
+	}
+
+	if err := storage.Copy(r.Context(), h.store, from, to); err != nil {
+		handleStorageError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, SuccessResponse{Message: "file copied"})
+}
+
+// transferPaths reads the from and to query parameters shared by Move and
+// Copy, writing a 400 response if either is missing.
+func transferPaths(w http.ResponseWriter, r *http.Request) (from, to string, ok bool) {
+	q := r.URL.Query()
+	from, to = q.Get("from"), q.Get("to")
+	if from == "" || to == "" {
+		writeError(w, http.StatusBadRequest, "from and to query parameters are required")
+		return "", "", false
+	}
+	return from, to, true
+}
+
+// Stat returns metadata for a file or directory. Files always carry an
+// ETag, usable in If-Match, even on backends that do not record one.
 func (h *Handler) Stat(w http.ResponseWriter, r *http.Request) {
 	p := r.URL.Query().Get("path")
 	if p == "" {
@@ -126,17 +424,215 @@ func (h *Handler) Stat(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !info.IsDir {
+		info.ETag = storage.ETag(info)
+	}
 	writeJSON(w, http.StatusOK, info)
 }
 
+// Checksum computes a digest of a file by streaming it through Read. algo
+// is sha256 (the default), md5 or crc32c. Digests recorded by the backend
+// are deliberately not used, so the result reflects the stored bytes.
+func (h *Handler) Checksum(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	p := q.Get("path")
+	if p == "" {
+		writeError(w, http.StatusBadRequest, "path query parameter is required")
+		return
+	}
+	algo := q.Get("algo")
+	if algo == "" {
+		algo = storage.SHA256
+	}
+	if _, err := storage.NewHash(algo); err != nil {
+		writeError(w, http.StatusBadRequest, "algo must be sha256, md5 or crc32c")
+		return
+	}
+
+	info, err := h.store.Stat(r.Context(), p)
+	if err != nil {
+		handleStorageError(w, err)
+		return
+	}
+	if info.IsDir {
+		writeError(w, http.StatusBadRequest, "path is a directory")
+		return
+	}
+
+	rc, err := h.store.Read(r.Context(), p)
+	if err != nil {
+		handleStorageError(w, err)
+		return
+	}
+	defer rc.Close()
+
+	sum, err := storage.Checksum(rc, algo)
+	if err != nil {
+		handleStorageError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, ChecksumResponse{Path: info.Path, Algorithm: algo, Checksum: sum})
+}
+
+// Search walks the tree below path and streams every entry that matches glob
+// as newline-delimited JSON, one FileInfo per line, flushing as it goes. A
+// glob without "/" matches entry names; one with "/" matches the path
+// relative to path. maxDepth limits how far below path the walk descends (1
+// is direct children only). The walk stops when the client goes away. An
+// error after the response has started is reported as a final ErrorResponse
+// line.
+func (h *Handler) Search(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	root := q.Get("path")
+	if root == "" {
+		root = "/"
+	}
+	glob := q.Get("glob")
+	if _, err := path.Match(glob, ""); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid glob pattern")
+		return
+	}
+	maxDepth := 0
+	if v := q.Get("maxDepth"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			writeError(w, http.StatusBadRequest, "maxDepth must be a positive integer")
+			return
+		}
+		maxDepth = n
+	}
+
+	info, err := h.store.Stat(r.Context(), root)
+	if err != nil {
+		handleStorageError(w, err)
+		return
+	}
+	if !info.IsDir {
+		writeError(w, http.StatusBadRequest, "path is not a directory")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	enc := json.NewEncoder(w)
+	rc := http.NewResponseController(w)
+
+	err = storage.Walk(r.Context(), h.store, root, func(f storage.FileInfo) error {
+		rel := f.Path
+		if info.Path != "" {
+			rel = strings.TrimPrefix(f.Path, info.Path+"/")
+		}
+		// Entries the caller may not read are left out, but walked into:
+		// the policy may allow paths below a denied one.
+		if matchGlob(glob, rel, f.Name) && allowed(r.Context(), auth.Read, f.Path) == nil {
+			if err := enc.Encode(f); err != nil {
+				return err
+			}
+			rc.Flush()
+		}
+		if f.IsDir && maxDepth > 0 && strings.Count(rel, "/")+1 >= maxDepth {
+			return storage.SkipDir
+		}
+		return nil
+	})
+	if err != nil && r.Context().Err() == nil {
+		_, msg := storageErrorStatus(err)
+		enc.Encode(ErrorResponse{Error: msg})
+	}
+}
+
+// matchGlob reports whether an entry matches a Search pattern. Patterns
+// containing "/" are matched against rel, all others against name.
+func matchGlob(glob, rel, name string) bool {
+	if glob == "" {
+		return true
+	}
+	target := name
+	if strings.Contains(glob, "/") {
+		target = rel
+	}
+	ok, _ := path.Match(glob, target)
+	return ok
+}
+
+// rangeReadSeeker adapts a storage file to the io.ReadSeeker expected by
+// http.ServeContent. Seeking only records the offset; the next Read opens
+// the file there with storage.ReadRange, so backends that support ranged
+// reads never transfer the bytes before the requested range.
+type rangeReadSeeker struct {
+	ctx    context.Context
+	store  storage.Storage
+	path   string
+	size   int64
+	offset int64
+	rc     io.ReadCloser
+}
+
+func (s *rangeReadSeeker) Read(p []byte) (int, error) {
+	if s.rc == nil {
+		rc, err := storage.ReadRange(s.ctx, s.store, s.path, s.offset, -1)
+		if err != nil {
+			return 0, err
+		}
+		s.rc = rc
+	}
+	n, err := s.rc.Read(p)
+	s.offset += int64(n)
+	return n, err
+}
+
+func (s *rangeReadSeeker) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += s.offset
+	case io.SeekEnd:
+		offset += s.size
+	}
+	if offset < 0 {
+		return 0, errors.New("seek before start of file")
+	}
+	if offset != s.offset {
+		s.Close()
+		s.offset = offset
+	}
+	return offset, nil
+}
+
+func (s *rangeReadSeeker) Close() error {
+	if s.rc == nil {
+		return nil
+	}
+	err := s.rc.Close()
+	s.rc = nil
+	return err
+}
+
 // handleStorageError maps storage sentinel errors to HTTP status codes.
 func handleStorageError(w http.ResponseWriter, err error) {
+	status, msg := storageErrorStatus(err)
+	writeError(w, status, msg)
+}
+
+// storageErrorStatus returns the status code and client-facing message for
+// a storage error.
+func storageErrorStatus(err error) (int, string) {
 	switch {
 	case errors.Is(err, storage.ErrNotFound):
-		writeError(w, http.StatusNotFound, "not found")
+		return http.StatusNotFound, "not found"
 	case errors.Is(err, storage.ErrPermission):
-		writeError(w, http.StatusForbidden, "permission denied")
+		return http.StatusForbidden, "permission denied"
+	case errors.Is(err, storage.ErrExist):
+		return http.StatusConflict, "already exists"
+	case errors.Is(err, storage.ErrNotEmpty):
+		return http.StatusConflict, "directory not empty"
+	case errors.Is(err, storage.ErrInvalid):
+		return http.StatusBadRequest, err.Error()
+	case errors.Is(err, storage.ErrPrecondition):
+		return http.StatusPreconditionFailed, "precondition failed"
+	case errors.Is(err, storage.ErrNotSupported):
+		return http.StatusNotImplemented, err.Error()
 	default:
-		writeError(w, http.StatusInternalServerError, "internal server error")
+		return http.StatusInternalServerError, "internal server error"
 	}
 }
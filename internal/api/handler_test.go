@@ -3,16 +3,21 @@ package api
 import (
 	"bytes"
 	"context"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"io"
 	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"path"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
 
 	"go-storage-api/internal/storage"
+	"go-storage-api/internal/storage/memory"
 )
 
 // mockStorage implements storage.Storage with function fields for per-test control.
@@ -22,6 +27,7 @@ type mockStorage struct {
 	writeFn  func(ctx context.Context, path string, r io.Reader) error
 	deleteFn func(ctx context.Context, path string) error
 	statFn   func(ctx context.Context, path string) (*storage.FileInfo, error)
+	mkdirFn  func(ctx context.Context, path string) error
 }
 
 func (m *mockStorage) List(ctx context.Context, path string) ([]storage.FileInfo, error) {
@@ -39,6 +45,9 @@ func (m *mockStorage) Delete(ctx context.Context, path string) error {
 func (m *mockStorage) Stat(ctx context.Context, path string) (*storage.FileInfo, error) {
 	return m.statFn(ctx, path)
 }
+func (m *mockStorage) Mkdir(ctx context.Context, path string) error {
+	return m.mkdirFn(ctx, path)
+}
 
 func newTestHandler(store *mockStorage) *Handler {
 	return NewHandler(store, 10<<20) // 10MB
@@ -130,16 +139,143 @@ func TestList_NotFound(t *testing.T) {
 	}
 }
 
+// listPages follows X-Next-Cursor from query until the last page and returns
+// the names of all entries and the number of pages fetched.
+func listPages(t *testing.T, h *Handler, query string) ([]string, int) {
+	t.Helper()
+	var names []string
+	cursor := ""
+	for pages := 1; ; pages++ {
+		target := "/api/v1/files?" + query
+		if cursor != "" {
+			target += "&cursor=" + cursor
+		}
+		rr := httptest.NewRecorder()
+		h.List(rr, httptest.NewRequest(http.MethodGet, target, nil))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("GET %s: expected 200, got %d: %s", target, rr.Code, rr.Body.String())
+		}
+
+		var files []storage.FileInfo
+		json.NewDecoder(rr.Body).Decode(&files)
+		for _, f := range files {
+			names = append(names, f.Name)
+		}
+		if cursor = rr.Header().Get("X-Next-Cursor"); cursor == "" {
+			return names, pages
+		}
+		if pages > 20 {
+			t.Fatalf("GET %s: no last page after %d pages", target, pages)
+		}
+	}
+}
+
+func newListHandler(t *testing.T) *Handler {
+	t.Helper()
+	h, _ := newMemoryHandler(t, map[string]string{
+		"docs/a.txt":       "aaaa",
+		"docs/b.md":        "b",
+		"docs/c.txt":       "cc",
+		"docs/d.txt":       "ddd",
+		"docs/e.md":        "eeeee",
+		"docs/sub/x.txt":   "x",
+		"docs/zdir/y.txt":  "y",
+		"other/ignore.txt": "i",
+	})
+	return h
+}
+
+func TestList_Paginated(t *testing.T) {
+	h := newListHandler(t)
+
+	names, pages := listPages(t, h, "path=docs&limit=2")
+	if got := strings.Join(names, ","); got != "a.txt,b.md,c.txt,d.txt,e.md,sub,zdir" {
+		t.Errorf("unexpected listing %s", got)
+	}
+	if pages != 4 {
+		t.Errorf("expected 4 pages, got %d", pages)
+	}
+}
+
+func TestList_SortFilterAndPaginate(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"type=file&glob=*.txt&limit=2", "a.txt,c.txt,d.txt"},
+		{"type=dir&limit=1", "sub,zdir"},
+		{"sort=size&type=file&limit=2", "b.md,c.txt,d.txt,a.txt,e.md"},
+		{"sort=size&order=desc&type=file&limit=3", "e.md,a.txt,d.txt,c.txt,b.md"},
+		{"order=desc&glob=*.md", "e.md,b.md"},
+		{"sort=name&order=desc&limit=4", "zdir,sub,e.md,d.txt,c.txt,b.md,a.txt"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			h := newListHandler(t)
+			names, _ := listPages(t, h, "path=docs&"+tt.query)
+			if got := strings.Join(names, ","); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestList_InvalidQuery(t *testing.T) {
+	h := newListHandler(t)
+
+	rr := httptest.NewRecorder()
+	h.List(rr, httptest.NewRequest(http.MethodGet, "/api/v1/files?path=docs&limit=2", nil))
+	cursor := rr.Header().Get("X-Next-Cursor")
+	if cursor == "" {
+		t.Fatal("expected a cursor on the first page")
+	}
+
+	for _, query := range []string{
+		"limit=0",
+		"limit=abc",
+		"limit=1001",
+		"sort=owner",
+		"order=up",
+		"type=link",
+		"glob=[",
+		"cursor=" + cursor,
+		"limit=2&cursor=not-a-cursor",
+		"limit=2&sort=size&cursor=" + cursor,
+	} {
+		t.Run(query, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			h.List(rr, httptest.NewRequest(http.MethodGet, "/api/v1/files?path=docs&"+query, nil))
+			if rr.Code != http.StatusBadRequest {
+				t.Errorf("expected 400, got %d: %s", rr.Code, rr.Body.String())
+			}
+		})
+	}
+}
+
 // --- Download ---
 
-func TestDownload_Success(t *testing.T) {
-	content := "file contents here"
-	store := &mockStorage{
+var downloadModTime = time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+// newDownloadStore serves content as a single file with a fixed ModTime and
+// records how many times it was opened.
+func newDownloadStore(content string, opens *int) *mockStorage {
+	return &mockStorage{
+		statFn: func(_ context.Context, p string) (*storage.FileInfo, error) {
+			return &storage.FileInfo{Name: path.Base(p), Path: p, Size: int64(len(content)), ModTime: downloadModTime}, nil
+		},
 		readFn: func(_ context.Context, _ string) (io.ReadCloser, error) {
+			if opens != nil {
+				*opens++
+			}
 			return io.NopCloser(strings.NewReader(content)), nil
 		},
 	}
-	h := newTestHandler(store)
+}
+
+func TestDownload_Success(t *testing.T) {
+	content := "file contents here"
+	h := newTestHandler(newDownloadStore(content, nil))
 
 	req := httptest.NewRequest(http.MethodGet, "/api/v1/files/download?path=readme.txt", nil)
 	rr := httptest.NewRecorder()
@@ -155,15 +291,22 @@ func TestDownload_Success(t *testing.T) {
 	if ct != "text/plain; charset=utf-8" {
 		t.Errorf("expected text/plain content-type, got %q", ct)
 	}
+	if got := rr.Header().Get("Content-Length"); got != "18" {
+		t.Errorf("expected Content-Length 18, got %q", got)
+	}
+	if got := rr.Header().Get("Last-Modified"); got != downloadModTime.Format(http.TimeFormat) {
+		t.Errorf("unexpected Last-Modified %q", got)
+	}
+	if got := rr.Header().Get("Accept-Ranges"); got != "bytes" {
+		t.Errorf("expected Accept-Ranges bytes, got %q", got)
+	}
+	if rr.Header().Get("ETag") == "" {
+		t.Error("expected ETag header")
+	}
 }
 
 func TestDownload_UnknownExtension(t *testing.T) {
-	store := &mockStorage{
-		readFn: func(_ context.Context, _ string) (io.ReadCloser, error) {
-			return io.NopCloser(strings.NewReader("binary")), nil
-		},
-	}
-	h := newTestHandler(store)
+	h := newTestHandler(newDownloadStore("binary", nil))
 
 	req := httptest.NewRequest(http.MethodGet, "/api/v1/files/download?path=data.xyz123", nil)
 	rr := httptest.NewRecorder()
@@ -189,7 +332,7 @@ func TestDownload_MissingPath(t *testing.T) {
 
 func TestDownload_NotFound(t *testing.T) {
 	store := &mockStorage{
-		readFn: func(_ context.Context, _ string) (io.ReadCloser, error) {
+		statFn: func(_ context.Context, _ string) (*storage.FileInfo, error) {
 			return nil, storage.ErrNotFound
 		},
 	}
@@ -204,6 +347,151 @@ func TestDownload_NotFound(t *testing.T) {
 	}
 }
 
+func TestDownload_Directory(t *testing.T) {
+	store := &mockStorage{
+		statFn: func(_ context.Context, _ string) (*storage.FileInfo, error) {
+			return &storage.FileInfo{Name: "docs", Path: "docs", IsDir: true}, nil
+		},
+	}
+	h := newTestHandler(store)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/files/download?path=docs", nil)
+	rr := httptest.NewRecorder()
+	h.Download(rr, req)
+
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400, got %d", rr.Code)
+	}
+}
+
+func TestDownload_Range(t *testing.T) {
+	h := newTestHandler(newDownloadStore("0123456789", nil))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/files/download?path=digits.txt", nil)
+	req.Header.Set("Range", "bytes=2-5")
+	rr := httptest.NewRecorder()
+	h.Download(rr, req)
+
+	if rr.Code != http.StatusPartialContent {
+		t.Fatalf("expected 206, got %d", rr.Code)
+	}
+	if rr.Body.String() != "2345" {
+		t.Errorf("expected body %q, got %q", "2345", rr.Body.String())
+	}
+	if got := rr.Header().Get("Content-Range"); got != "bytes 2-5/10" {
+		t.Errorf("expected Content-Range bytes 2-5/10, got %q", got)
+	}
+}
+
+func TestDownload_SuffixRange(t *testing.T) {
+	h := newTestHandler(newDownloadStore("0123456789", nil))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/files/download?path=digits.txt", nil)
+	req.Header.Set("Range", "bytes=-3")
+	rr := httptest.NewRecorder()
+	h.Download(rr, req)
+
+	if rr.Code != http.StatusPartialContent || rr.Body.String() != "789" {
+		t.Errorf("expected 206 with %q, got %d with %q", "789", rr.Code, rr.Body.String())
+	}
+}
+
+func TestDownload_RangeNotSatisfiable(t *testing.T) {
+	h := newTestHandler(newDownloadStore("0123456789", nil))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/files/download?path=digits.txt", nil)
+	req.Header.Set("Range", "bytes=20-30")
+	rr := httptest.NewRecorder()
+	h.Download(rr, req)
+
+	if rr.Code != http.StatusRequestedRangeNotSatisfiable {
+		t.Errorf("expected 416, got %d", rr.Code)
+	}
+	if got := rr.Header().Get("Content-Range"); got != "bytes */10" {
+		t.Errorf("expected Content-Range bytes */10, got %q", got)
+	}
+}
+
+func TestDownload_IfRangeMismatch(t *testing.T) {
+	h := newTestHandler(newDownloadStore("0123456789", nil))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/files/download?path=digits.txt", nil)
+	req.Header.Set("Range", "bytes=2-5")
+	req.Header.Set("If-Range", `"stale"`)
+	rr := httptest.NewRecorder()
+	h.Download(rr, req)
+
+	if rr.Code != http.StatusOK || rr.Body.String() != "0123456789" {
+		t.Errorf("expected full 200 response, got %d with %q", rr.Code, rr.Body.String())
+	}
+}
+
+func TestDownload_IfNoneMatch(t *testing.T) {
+	opens := 0
+	h := newTestHandler(newDownloadStore("0123456789", &opens))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/files/download?path=digits.txt", nil)
+	rr := httptest.NewRecorder()
+	h.Download(rr, req)
+	tag := rr.Header().Get("ETag")
+
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/files/download?path=digits.txt", nil)
+	req.Header.Set("If-None-Match", tag)
+	rr = httptest.NewRecorder()
+	h.Download(rr, req)
+
+	if rr.Code != http.StatusNotModified {
+		t.Errorf("expected 304, got %d", rr.Code)
+	}
+	if opens != 1 {
+		t.Errorf("expected the file to be opened once, got %d", opens)
+	}
+}
+
+func TestDownload_IfModifiedSince(t *testing.T) {
+	h := newTestHandler(newDownloadStore("0123456789", nil))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/files/download?path=digits.txt", nil)
+	req.Header.Set("If-Modified-Since", downloadModTime.Add(time.Hour).Format(http.TimeFormat))
+	rr := httptest.NewRecorder()
+	h.Download(rr, req)
+
+	if rr.Code != http.StatusNotModified {
+		t.Errorf("expected 304, got %d", rr.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/files/download?path=digits.txt", nil)
+	req.Header.Set("If-Modified-Since", downloadModTime.Add(-time.Hour).Format(http.TimeFormat))
+	rr = httptest.NewRecorder()
+	h.Download(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected 200, got %d", rr.Code)
+	}
+}
+
+func TestDownload_Head(t *testing.T) {
+	opens := 0
+	h := newTestHandler(newDownloadStore("0123456789", &opens))
+
+	req := httptest.NewRequest(http.MethodHead, "/api/v1/files/download?path=digits.txt", nil)
+	rr := httptest.NewRecorder()
+	h.Download(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected 200, got %d", rr.Code)
+	}
+	if got := rr.Header().Get("Content-Length"); got != "10" {
+		t.Errorf("expected Content-Length 10, got %q", got)
+	}
+	if rr.Body.Len() != 0 {
+		t.Errorf("expected empty body, got %q", rr.Body.String())
+	}
+	if opens != 0 {
+		t.Errorf("HEAD should not open the file, opened %d times", opens)
+	}
+}
+
 // --- Upload ---
 
 func createMultipartRequest(t *testing.T, path, filename, content string) *http.Request {
@@ -280,6 +568,355 @@ func TestUpload_MissingFile(t *testing.T) {
 	}
 }
 
+func TestUpload_SkipsOtherFields(t *testing.T) {
+	h, store := newMemoryHandler(t, nil)
+
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	w.WriteField("comment", "before the file")
+	part, _ := w.CreateFormFile("file", "upload.txt")
+	part.Write([]byte("uploaded data"))
+	w.WriteField("comment", "after the file")
+	w.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/files/upload?path=upload.txt", &buf)
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	rr := httptest.NewRecorder()
+	h.Upload(rr, req)
+
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+	rc, err := store.Read(context.Background(), "upload.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	if data, _ := io.ReadAll(rc); string(data) != "uploaded data" {
+		t.Errorf("stored %q, want %q", data, "uploaded data")
+	}
+}
+
+// TestUpload_Streams checks that the backend receives the file while the
+// request body is still arriving, rather than after the form is parsed.
+func TestUpload_Streams(t *testing.T) {
+	pr, pw := io.Pipe()
+	mw := multipart.NewWriter(pw)
+	firstChunk := make(chan struct{})
+
+	store := &mockStorage{
+		writeFn: func(_ context.Context, _ string, r io.Reader) error {
+			buf := make([]byte, 5)
+			if _, err := io.ReadFull(r, buf); err != nil {
+				return err
+			}
+			close(firstChunk)
+			_, err := io.Copy(io.Discard, r)
+			return err
+		},
+	}
+	h := newTestHandler(store)
+
+	go func() {
+		part, _ := mw.CreateFormFile("file", "big.bin")
+		part.Write([]byte("first"))
+		// Hold the rest back until the backend has seen the first bytes.
+		select {
+		case <-firstChunk:
+		case <-time.After(5 * time.Second):
+			t.Error("backend received nothing before the request body was complete")
+		}
+		part.Write([]byte("rest"))
+		mw.Close()
+		pw.Close()
+	}()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/files/upload?path=big.bin", pr)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	rr := httptest.NewRecorder()
+	h.Upload(rr, req)
+
+	if rr.Code != http.StatusCreated {
+		t.Errorf("expected 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestUpload_TooLarge(t *testing.T) {
+	h, store := newMemoryHandler(t, nil)
+	h.maxUploadSize = 1024
+
+	req := createMultipartRequest(t, "big.bin", "big.bin", strings.Repeat("x", 2048))
+	req.ContentLength = -1 // force the limit to trip while streaming
+	rr := httptest.NewRecorder()
+	h.Upload(rr, req)
+
+	if rr.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected 413, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if _, err := store.Stat(context.Background(), "big.bin"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("Stat after rejected upload error = %v, want ErrNotFound", err)
+	}
+}
+
+// Digests of "uploaded data".
+const (
+	uploadSHA256Hex    = "4ee72a90c13d9d0fc50db4a52e81f54a02ef1b600b061808c1573a4e7c53712f"
+	uploadSHA256Base64 = "TucqkME9nQ/FDbSlLoH1SgLvG2ALBhgIwVc6TnxTcS8="
+	uploadMD5Base64    = "2r4MGr6JRVlDRiLLTruUGQ=="
+	uploadCRC32CBase64 = "khXz9w=="
+)
+
+func TestUpload_Digest(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		value  string
+		want   int
+	}{
+		{"content-digest sha-256", "Content-Digest", "sha-256=:" + uploadSHA256Base64 + ":", http.StatusCreated},
+		{"content-digest several", "Content-Digest", "md5=:" + uploadMD5Base64 + ":, crc32c=:" + uploadCRC32CBase64 + ":", http.StatusCreated},
+		{"content-digest unknown ignored", "Content-Digest", "sha-512=:AAAA:, md5=:" + uploadMD5Base64 + ":", http.StatusCreated},
+		{"content-md5", "Content-MD5", uploadMD5Base64, http.StatusCreated},
+		{"sha256 hex", "X-Checksum-SHA256", uploadSHA256Hex, http.StatusCreated},
+		{"sha256 base64", "X-Checksum-SHA256", uploadSHA256Base64, http.StatusCreated},
+		{"content-digest mismatch", "Content-Digest", "sha-256=:" + base64Of(make([]byte, 32)) + ":", http.StatusUnprocessableEntity},
+		{"content-md5 mismatch", "Content-MD5", base64Of(make([]byte, 16)), http.StatusUnprocessableEntity},
+		{"one of several mismatches", "Content-Digest", "md5=:" + uploadMD5Base64 + ":, crc32c=:AAAAAA==:", http.StatusUnprocessableEntity},
+		{"content-digest malformed", "Content-Digest", "sha-256=" + uploadSHA256Base64, http.StatusBadRequest},
+		{"content-digest unsupported only", "Content-Digest", "sha-512=:AAAA:", http.StatusBadRequest},
+		{"content-md5 wrong length", "Content-MD5", "AAAA", http.StatusBadRequest},
+		{"sha256 not encoded", "X-Checksum-SHA256", "not a digest", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, store := newMemoryHandler(t, nil)
+			req := createMultipartRequest(t, "upload.txt", "upload.txt", "uploaded data")
+			req.Header.Set(tt.header, tt.value)
+			rr := httptest.NewRecorder()
+			h.Upload(rr, req)
+
+			if rr.Code != tt.want {
+				t.Fatalf("expected %d, got %d: %s", tt.want, rr.Code, rr.Body.String())
+			}
+			_, err := store.Stat(context.Background(), "upload.txt")
+			if stored := err == nil; stored != (tt.want == http.StatusCreated) {
+				t.Errorf("file stored = %v after status %d", stored, rr.Code)
+			}
+		})
+	}
+}
+
+func TestUpload_DigestInPartHeader(t *testing.T) {
+	for _, tc := range []struct {
+		digest string
+		want   int
+	}{
+		{uploadMD5Base64, http.StatusCreated},
+		{base64Of(make([]byte, 16)), http.StatusUnprocessableEntity},
+	} {
+		h, _ := newMemoryHandler(t, nil)
+
+		var buf bytes.Buffer
+		w := multipart.NewWriter(&buf)
+		part, err := w.CreatePart(map[string][]string{
+			"Content-Disposition": {`form-data; name="file"; filename="upload.txt"`},
+			"Content-Md5":         {tc.digest},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		part.Write([]byte("uploaded data"))
+		w.Close()
+
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/files/upload?path=upload.txt", &buf)
+		req.Header.Set("Content-Type", w.FormDataContentType())
+		rr := httptest.NewRecorder()
+		h.Upload(rr, req)
+
+		if rr.Code != tc.want {
+			t.Errorf("digest %s: expected %d, got %d: %s", tc.digest, tc.want, rr.Code, rr.Body.String())
+		}
+	}
+}
+
+func TestUpload_DigestMismatchKeepsOriginal(t *testing.T) {
+	h, store := newMemoryHandler(t, map[string]string{"upload.txt": "original"})
+
+	req := createMultipartRequest(t, "upload.txt", "upload.txt", "uploaded data")
+	req.Header.Set("Content-MD5", base64Of(make([]byte, 16)))
+	rr := httptest.NewRecorder()
+	h.Upload(rr, req)
+
+	if rr.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected 422, got %d", rr.Code)
+	}
+	var resp ErrorResponse
+	json.NewDecoder(rr.Body).Decode(&resp)
+	if resp.Error != "checksum mismatch" {
+		t.Errorf("error = %q, want %q", resp.Error, "checksum mismatch")
+	}
+
+	rc, err := store.Read(context.Background(), "upload.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	if data, _ := io.ReadAll(rc); string(data) != "original" {
+		t.Errorf("content after rejected upload = %q, want %q", data, "original")
+	}
+}
+
+func base64Of(b []byte) string {
+	return base64.StdEncoding.EncodeToString(b)
+}
+
+// --- Put ---
+
+func TestPut_Success(t *testing.T) {
+	h, store := newMemoryHandler(t, map[string]string{"docs/a.txt": "old"})
+
+	req := httptest.NewRequest(http.MethodPut, "/api/v1/files?path=docs/a.txt", strings.NewReader("raw body"))
+	req.Header.Set("X-Checksum-SHA256", "") // empty headers are ignored
+	rr := httptest.NewRecorder()
+	h.Put(rr, req)
+
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+	rc, err := store.Read(context.Background(), "docs/a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	if data, _ := io.ReadAll(rc); string(data) != "raw body" {
+		t.Errorf("stored %q, want %q", data, "raw body")
+	}
+}
+
+func TestPut_Errors(t *testing.T) {
+	tests := []struct {
+		name          string
+		url           string
+		body          string
+		contentLength int64
+		header        map[string]string
+		want          int
+	}{
+		{"missing path", "/api/v1/files", "data", 4, nil, http.StatusBadRequest},
+		{"declared length too large", "/api/v1/files?path=a.bin", "", 2048, nil, http.StatusRequestEntityTooLarge},
+		{"chunked body too large", "/api/v1/files?path=a.bin", strings.Repeat("x", 2048), -1, nil, http.StatusRequestEntityTooLarge},
+		{"body shorter than declared", "/api/v1/files?path=a.bin", "short", 100, nil, http.StatusBadRequest},
+		{"digest mismatch", "/api/v1/files?path=a.bin", "uploaded data", 13, map[string]string{"Content-MD5": base64Of(make([]byte, 16))}, http.StatusUnprocessableEntity},
+		{"bad digest header", "/api/v1/files?path=a.bin", "uploaded data", 13, map[string]string{"Content-Digest": "sha-256"}, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, store := newMemoryHandler(t, nil)
+			h.maxUploadSize = 1024
+
+			req := httptest.NewRequest(http.MethodPut, tt.url, strings.NewReader(tt.body))
+			req.ContentLength = tt.contentLength
+			if tt.contentLength >= 0 {
+				// Mimic the server, which stops the body at Content-Length
+				// and reports a shorter body as unexpected EOF.
+				req.Body = io.NopCloser(&exactReader{r: strings.NewReader(tt.body), n: tt.contentLength})
+			}
+			for k, v := range tt.header {
+				req.Header.Set(k, v)
+			}
+			rr := httptest.NewRecorder()
+			h.Put(rr, req)
+
+			if rr.Code != tt.want {
+				t.Errorf("expected %d, got %d: %s", tt.want, rr.Code, rr.Body.String())
+			}
+			if _, err := store.Stat(context.Background(), "a.bin"); !errors.Is(err, storage.ErrNotFound) {
+				t.Errorf("Stat after rejected upload error = %v, want ErrNotFound", err)
+			}
+		})
+	}
+}
+
+func TestPut_Preconditions(t *testing.T) {
+	h, store := newMemoryHandler(t, map[string]string{"a.txt": "v1"})
+	info, _ := store.Stat(context.Background(), "a.txt")
+	current := info.ETag
+
+	tests := []struct {
+		name   string
+		path   string
+		header map[string]string
+		want   int
+	}{
+		{"stale tag", "a.txt", map[string]string{"If-Match": `"0123"`}, http.StatusPreconditionFailed},
+		{"weak tag", "a.txt", map[string]string{"If-Match": "W/" + current}, http.StatusPreconditionFailed},
+		{"create-only on existing", "a.txt", map[string]string{"If-None-Match": "*"}, http.StatusPreconditionFailed},
+		{"If-Match on missing", "b.txt", map[string]string{"If-Match": "*"}, http.StatusPreconditionFailed},
+		{"tag list", "a.txt", map[string]string{"If-Match": current + `, "x"`}, http.StatusBadRequest},
+		{"unquoted tag", "a.txt", map[string]string{"If-Match": "abc"}, http.StatusBadRequest},
+		{"If-None-Match tag", "a.txt", map[string]string{"If-None-Match": current}, http.StatusBadRequest},
+		{"both headers", "a.txt", map[string]string{"If-Match": current, "If-None-Match": "*"}, http.StatusBadRequest},
+		{"current tag", "a.txt", map[string]string{"If-Match": current}, http.StatusCreated},
+		{"create-only on missing", "c.txt", map[string]string{"If-None-Match": "*"}, http.StatusCreated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPut, "/api/v1/files?path="+tt.path, strings.NewReader("v2"))
+			for k, v := range tt.header {
+				req.Header.Set(k, v)
+			}
+			rr := httptest.NewRecorder()
+			h.Put(rr, req)
+			if rr.Code != tt.want {
+				t.Errorf("expected %d, got %d: %s", tt.want, rr.Code, rr.Body.String())
+			}
+		})
+	}
+
+	if _, err := store.Stat(context.Background(), "b.txt"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("If-Match * created b.txt: Stat error = %v", err)
+	}
+}
+
+func TestUpload_PreconditionFailed(t *testing.T) {
+	h, store := newMemoryHandler(t, map[string]string{"a.txt": "old"})
+
+	req := createMultipartRequest(t, "a.txt", "a.txt", "new")
+	req.Header.Set("If-None-Match", "*")
+	rr := httptest.NewRecorder()
+	h.Upload(rr, req)
+
+	if rr.Code != http.StatusPreconditionFailed {
+		t.Fatalf("expected 412, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if got := readFile(t, store, "a.txt"); got != "old" {
+		t.Errorf("refused upload changed the file to %q", got)
+	}
+}
+
+// exactReader returns io.ErrUnexpectedEOF if r ends before n bytes.
+type exactReader struct {
+	r io.Reader
+	n int64
+}
+
+func (e *exactReader) Read(p []byte) (int, error) {
+	if e.n <= 0 {
+		return 0, io.EOF
+	}
+	if int64(len(p)) > e.n {
+		p = p[:e.n]
+	}
+	n, err := e.r.Read(p)
+	e.n -= int64(n)
+	if err == io.EOF && e.n > 0 {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
 // --- Delete ---
 
 func TestDelete_Success(t *testing.T) {
@@ -328,6 +965,251 @@ func TestDelete_NotFound(t *testing.T) {
 	}
 }
 
+func TestDelete_NotEmpty(t *testing.T) {
+	store := &mockStorage{
+		deleteFn: func(_ context.Context, _ string) error {
+			return storage.ErrNotEmpty
+		},
+	}
+	h := newTestHandler(store)
+
+	req := httptest.NewRequest(http.MethodDelete, "/api/v1/files?path=docs", nil)
+	rr := httptest.NewRecorder()
+	h.Delete(rr, req)
+
+	if rr.Code != http.StatusConflict {
+		t.Errorf("expected 409, got %d", rr.Code)
+	}
+}
+
+func TestDelete_Recursive(t *testing.T) {
+	h, store := newMemoryHandler(t, map[string]string{"docs/a.txt": "alpha", "docs/sub/b.txt": "beta"})
+
+	req := httptest.NewRequest(http.MethodDelete, "/api/v1/files?path=docs&recursive=true", nil)
+	rr := httptest.NewRecorder()
+	h.Delete(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if _, err := store.Stat(context.Background(), "docs"); err == nil {
+		t.Error("directory still exists after recursive delete")
+	}
+}
+
+func TestDelete_InvalidRecursive(t *testing.T) {
+	h := newTestHandler(&mockStorage{})
+
+	req := httptest.NewRequest(http.MethodDelete, "/api/v1/files?path=docs&recursive=maybe", nil)
+	rr := httptest.NewRecorder()
+	h.Delete(rr, req)
+
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400, got %d", rr.Code)
+	}
+}
+
+func TestDelete_IfMatch(t *testing.T) {
+	h, store := newMemoryHandler(t, map[string]string{"a.txt": "v1", "docs/b.txt": "b"})
+	info, _ := store.Stat(context.Background(), "a.txt")
+
+	tests := []struct {
+		name  string
+		query string
+		etag  string
+		want  int
+	}{
+		{"stale tag", "path=a.txt", `"0123"`, http.StatusPreconditionFailed},
+		{"directory", "path=docs", "*", http.StatusPreconditionFailed},
+		{"with recursive", "path=docs&recursive=true", "*", http.StatusBadRequest},
+		{"current tag", "path=a.txt", info.ETag, http.StatusOK},
+		{"already deleted", "path=a.txt", info.ETag, http.StatusPreconditionFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodDelete, "/api/v1/files?"+tt.query, nil)
+			req.Header.Set("If-Match", tt.etag)
+			rr := httptest.NewRecorder()
+			h.Delete(rr, req)
+			if rr.Code != tt.want {
+				t.Errorf("expected %d, got %d: %s", tt.want, rr.Code, rr.Body.String())
+			}
+		})
+	}
+
+	req := httptest.NewRequest(http.MethodDelete, "/api/v1/files?path=docs/b.txt", nil)
+	req.Header.Set("If-None-Match", "*")
+	rr := httptest.NewRecorder()
+	h.Delete(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("If-None-Match on delete: expected 400, got %d", rr.Code)
+	}
+}
+
+// plainStore hides the optional capabilities of the store it wraps.
+type plainStore struct {
+	storage.Storage
+}
+
+func TestConditional_NotSupported(t *testing.T) {
+	_, store := newMemoryHandler(t, map[string]string{"a.txt": "v1"})
+	h := NewHandler(plainStore{store}, 10<<20)
+	info, _ := store.Stat(context.Background(), "a.txt")
+
+	tests := []struct {
+		name   string
+		method string
+		header string
+		value  string
+	}{
+		{"put If-Match", http.MethodPut, "If-Match", info.ETag},
+		{"put If-None-Match", http.MethodPut, "If-None-Match", "*"},
+		{"delete If-Match", http.MethodDelete, "If-Match", info.ETag},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/api/v1/files?path=a.txt", strings.NewReader("v2"))
+			req.Header.Set(tt.header, tt.value)
+			rr := httptest.NewRecorder()
+			if tt.method == http.MethodPut {
+				h.Put(rr, req)
+			} else {
+				h.Delete(rr, req)
+			}
+			if rr.Code != http.StatusNotImplemented {
+				t.Errorf("expected 501, got %d: %s", rr.Code, rr.Body.String())
+			}
+		})
+	}
+	if got := readFile(t, store, "a.txt"); got != "v1" {
+		t.Errorf("refused requests changed the file to %q", got)
+	}
+}
+
+// --- Mkdir ---
+
+func TestMkdir_Success(t *testing.T) {
+	h, store := newMemoryHandler(t, nil)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/files/mkdir?path=a/b/c", nil)
+	rr := httptest.NewRecorder()
+	h.Mkdir(rr, req)
+
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+	info, err := store.Stat(context.Background(), "a/b/c")
+	if err != nil || !info.IsDir {
+		t.Errorf("expected directory a/b/c, got %+v, %v", info, err)
+	}
+}
+
+func TestMkdir_Errors(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  int
+	}{
+		{"missing path", "", http.StatusBadRequest},
+		{"exists", "path=docs", http.StatusConflict},
+		{"file exists", "path=docs/a.txt", http.StatusConflict},
+		{"root", "path=/", http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, _ := newMemoryHandler(t, map[string]string{"docs/a.txt": "alpha"})
+
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/files/mkdir?"+tt.query, nil)
+			rr := httptest.NewRecorder()
+			h.Mkdir(rr, req)
+
+			if rr.Code != tt.want {
+				t.Errorf("expected %d, got %d: %s", tt.want, rr.Code, rr.Body.String())
+			}
+		})
+	}
+}
+
+// --- Move / Copy ---
+
+// newMemoryHandler returns a handler over an in-memory backend holding the
+// given files, for tests that depend on real storage semantics.
+func newMemoryHandler(t *testing.T, files map[string]string) (*Handler, storage.Storage) {
+	t.Helper()
+	store := memory.New()
+	for p, content := range files {
+		if err := store.Write(context.Background(), p, strings.NewReader(content)); err != nil {
+			t.Fatalf("Write(%q): %v", p, err)
+		}
+	}
+	return NewHandler(store, 10<<20), store
+}
+
+func TestMove_Success(t *testing.T) {
+	h, store := newMemoryHandler(t, map[string]string{"docs/a.txt": "alpha"})
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/files/move?from=docs/a.txt&to=archive/a.txt", nil)
+	rr := httptest.NewRecorder()
+	h.Move(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if _, err := store.Stat(context.Background(), "archive/a.txt"); err != nil {
+		t.Errorf("destination missing after move: %v", err)
+	}
+	if _, err := store.Stat(context.Background(), "docs/a.txt"); err == nil {
+		t.Error("source still exists after move")
+	}
+}
+
+func TestCopy_Success(t *testing.T) {
+	h, store := newMemoryHandler(t, map[string]string{"docs/a.txt": "alpha"})
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/files/copy?from=docs/a.txt&to=docs/b.txt", nil)
+	rr := httptest.NewRecorder()
+	h.Copy(rr, req)
+
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+	for _, p := range []string{"docs/a.txt", "docs/b.txt"} {
+		if _, err := store.Stat(context.Background(), p); err != nil {
+			t.Errorf("Stat(%q) after copy: %v", p, err)
+		}
+	}
+}
+
+func TestMove_Errors(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  int
+	}{
+		{"missing from", "to=b.txt", http.StatusBadRequest},
+		{"missing to", "from=docs/a.txt", http.StatusBadRequest},
+		{"source not found", "from=nope.txt&to=b.txt", http.StatusNotFound},
+		{"into itself", "from=docs&to=docs/inner", http.StatusBadRequest},
+		{"onto directory", "from=docs/a.txt&to=other", http.StatusConflict},
+		{"root", "from=/&to=elsewhere", http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, _ := newMemoryHandler(t, map[string]string{"docs/a.txt": "alpha", "other/b.txt": "beta"})
+
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/files/move?"+tt.query, nil)
+			rr := httptest.NewRecorder()
+			h.Move(rr, req)
+
+			if rr.Code != tt.want {
+				t.Errorf("expected %d, got %d: %s", tt.want, rr.Code, rr.Body.String())
+			}
+		})
+	}
+}
+
 // --- Stat ---
 
 func TestStat_Success(t *testing.T) {
@@ -391,3 +1273,227 @@ func TestStat_PermissionDenied(t *testing.T) {
 		t.Errorf("expected 403, got %d", rr.Code)
 	}
 }
+
+// --- Search ---
+
+// searchLines runs Search and decodes the NDJSON body, failing on any line
+// that is not a FileInfo.
+func searchLines(t *testing.T, h *Handler, req *http.Request) (*httptest.ResponseRecorder, []storage.FileInfo) {
+	t.Helper()
+	rr := httptest.NewRecorder()
+	h.Search(rr, req)
+
+	var files []storage.FileInfo
+	if rr.Code != http.StatusOK {
+		return rr, nil
+	}
+	dec := json.NewDecoder(rr.Body)
+	for dec.More() {
+		var line map[string]any
+		if err := dec.Decode(&line); err != nil {
+			t.Fatalf("decode NDJSON line: %v", err)
+		}
+		if msg, ok := line["error"]; ok {
+			t.Fatalf("unexpected error line: %v", msg)
+		}
+		files = append(files, storage.FileInfo{Path: line["path"].(string), IsDir: line["isDir"].(bool)})
+	}
+	return rr, files
+}
+
+func searchPaths(files []storage.FileInfo) string {
+	var paths []string
+	for _, f := range files {
+		paths = append(paths, f.Path)
+	}
+	return strings.Join(paths, ",")
+}
+
+func TestSearch(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"path=docs&glob=*.txt", "docs/a.txt,docs/c.txt,docs/d.txt,docs/sub/x.txt,docs/zdir/y.txt"},
+		{"path=docs&glob=*.txt&maxDepth=1", "docs/a.txt,docs/c.txt,docs/d.txt"},
+		{"path=docs&maxDepth=1&glob=*dir", "docs/zdir"},
+		{"path=docs&glob=sub/*", "docs/sub/x.txt"},
+		{"glob=ignore.txt", "other/ignore.txt"},
+		{"path=docs/sub", "docs/sub/x.txt"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			h := newListHandler(t)
+			rr, files := searchLines(t, h, httptest.NewRequest(http.MethodGet, "/api/v1/files/search?"+tt.query, nil))
+			if rr.Code != http.StatusOK {
+				t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+			}
+			if ct := rr.Header().Get("Content-Type"); ct != "application/x-ndjson" {
+				t.Errorf("expected Content-Type application/x-ndjson, got %q", ct)
+			}
+			if got := searchPaths(files); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSearch_Errors(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  int
+	}{
+		{"bad glob", "glob=[", http.StatusBadRequest},
+		{"zero depth", "maxDepth=0", http.StatusBadRequest},
+		{"bad depth", "maxDepth=deep", http.StatusBadRequest},
+		{"not found", "path=nope", http.StatusNotFound},
+		{"file", "path=docs/a.txt", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newListHandler(t)
+			rr := httptest.NewRecorder()
+			h.Search(rr, httptest.NewRequest(http.MethodGet, "/api/v1/files/search?"+tt.query, nil))
+			if rr.Code != tt.want {
+				t.Errorf("expected %d, got %d: %s", tt.want, rr.Code, rr.Body.String())
+			}
+		})
+	}
+}
+
+// endlessWalker walks a never-ending directory, checking its context before
+// each entry as the real backends do.
+type endlessWalker struct {
+	mockStorage
+	visits int
+}
+
+func (e *endlessWalker) Walk(ctx context.Context, _ string, fn storage.WalkFunc) error {
+	for i := 0; ; i++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		e.visits++
+		if err := fn(storage.FileInfo{Name: "f", Path: "f" + strconv.Itoa(i)}); err != nil {
+			return err
+		}
+	}
+}
+
+func TestSearch_StopsWhenClientGoesAway(t *testing.T) {
+	store := &endlessWalker{mockStorage: mockStorage{
+		statFn: func(_ context.Context, _ string) (*storage.FileInfo, error) {
+			return &storage.FileInfo{IsDir: true}, nil
+		},
+	}}
+	h := NewHandler(store, 10<<20)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/files/search", nil).WithContext(ctx)
+	rr := &cancellingRecorder{ResponseRecorder: httptest.NewRecorder(), after: 3, cancel: cancel}
+	h.Search(rr, req)
+
+	if store.visits != 3 {
+		t.Errorf("expected the walk to stop after 3 entries, got %d", store.visits)
+	}
+	if lines := strings.Count(rr.Body.String(), "\n"); lines != 3 {
+		t.Errorf("expected 3 lines and no error line, got %d: %s", lines, rr.Body.String())
+	}
+}
+
+// cancellingRecorder cancels the request context after a number of writes,
+// like a client disconnecting mid-stream.
+type cancellingRecorder struct {
+	*httptest.ResponseRecorder
+	after  int
+	cancel context.CancelFunc
+}
+
+func (c *cancellingRecorder) Write(b []byte) (int, error) {
+	n, err := c.ResponseRecorder.Write(b)
+	if c.after--; c.after == 0 {
+		c.cancel()
+	}
+	return n, err
+}
+
+// --- Checksum ---
+
+func TestChecksum(t *testing.T) {
+	tests := []struct {
+		algo string
+		want string
+	}{
+		{"", "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"},
+		{"sha256", "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"},
+		{"md5", "5d41402abc4b2a76b9719d911017c592"},
+		{"crc32c", "9a71bb4c"},
+	}
+
+	for _, tt := range tests {
+		t.Run("algo="+tt.algo, func(t *testing.T) {
+			h, _ := newMemoryHandler(t, map[string]string{"docs/hello.txt": "hello"})
+
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/files/checksum?path=/docs/hello.txt&algo="+tt.algo, nil)
+			rr := httptest.NewRecorder()
+			h.Checksum(rr, req)
+
+			if rr.Code != http.StatusOK {
+				t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+			}
+			var body ChecksumResponse
+			json.NewDecoder(rr.Body).Decode(&body)
+			if body.Checksum != tt.want || body.Path != "docs/hello.txt" {
+				t.Errorf("unexpected response %+v, want checksum %s", body, tt.want)
+			}
+			if tt.algo != "" && body.Algorithm != tt.algo {
+				t.Errorf("expected algorithm %q, got %q", tt.algo, body.Algorithm)
+			}
+		})
+	}
+}
+
+func TestChecksum_Errors(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  int
+	}{
+		{"missing path", "algo=md5", http.StatusBadRequest},
+		{"bad algo", "path=docs/hello.txt&algo=sha1", http.StatusBadRequest},
+		{"directory", "path=docs", http.StatusBadRequest},
+		{"not found", "path=nope.txt", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, _ := newMemoryHandler(t, map[string]string{"docs/hello.txt": "hello"})
+
+			rr := httptest.NewRecorder()
+			h.Checksum(rr, httptest.NewRequest(http.MethodGet, "/api/v1/files/checksum?"+tt.query, nil))
+			if rr.Code != tt.want {
+				t.Errorf("expected %d, got %d: %s", tt.want, rr.Code, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestDownload_BackendETag(t *testing.T) {
+	h, store := newMemoryHandler(t, map[string]string{"hello.txt": "hello"})
+	info, _ := store.Stat(context.Background(), "hello.txt")
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/files/download?path=hello.txt", nil)
+	req.Header.Set("If-None-Match", info.ETag)
+	rr := httptest.NewRecorder()
+	h.Download(rr, req)
+
+	if rr.Code != http.StatusNotModified {
+		t.Errorf("expected 304 for the backend ETag %s, got %d", info.ETag, rr.Code)
+	}
+	if got := rr.Header().Get("ETag"); got != info.ETag {
+		t.Errorf("expected ETag %s, got %s", info.ETag, got)
+	}
+}
@@ -0,0 +1,172 @@
+package api
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"go-storage-api/internal/storage"
+)
+
+// maxListLimit caps the limit query parameter of List.
+const maxListLimit = 1000
+
+// listQuery holds the parsed query parameters of List.
+type listQuery struct {
+	path  string
+	limit int // 0 returns every entry
+	sort  string
+	desc  bool
+	typ   string
+	glob  string
+
+	// Position decoded from the cursor parameter.
+	token  string
+	offset int
+}
+
+// streamed reports whether the listing can be paged by the backend. Only
+// name-ascending order matches the order backends page in; any other order
+// needs the whole directory before the first entry can be returned.
+func (q *listQuery) streamed() bool {
+	return q.sort == "name" && !q.desc
+}
+
+// parseListQuery validates the query parameters of List. The error message
+// is suitable for a 400 response.
+func parseListQuery(v url.Values) (*listQuery, error) {
+	q := &listQuery{
+		path: v.Get("path"),
+		sort: v.Get("sort"),
+		typ:  v.Get("type"),
+		glob: v.Get("glob"),
+	}
+	if q.path == "" {
+		q.path = "/"
+	}
+
+	if s := v.Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > maxListLimit {
+			return nil, errors.New("limit must be between 1 and " + strconv.Itoa(maxListLimit))
+		}
+		q.limit = n
+	}
+
+	switch q.sort {
+	case "":
+		q.sort = "name"
+	case "name", "size", "modTime":
+	default:
+		return nil, errors.New("sort must be name, size or modTime")
+	}
+
+	switch v.Get("order") {
+	case "", "asc":
+	case "desc":
+		q.desc = true
+	default:
+		return nil, errors.New("order must be asc or desc")
+	}
+
+	switch q.typ {
+	case "", "file", "dir":
+	default:
+		return nil, errors.New("type must be file or dir")
+	}
+
+	if _, err := path.Match(q.glob, ""); err != nil {
+		return nil, errors.New("invalid glob pattern")
+	}
+
+	if c := v.Get("cursor"); c != "" {
+		if q.limit == 0 {
+			return nil, errors.New("cursor requires limit")
+		}
+		if err := q.decodeCursor(c); err != nil {
+			return nil, err
+		}
+	}
+	return q, nil
+}
+
+// match applies the type and glob filters to an entry.
+func (q *listQuery) match(f storage.FileInfo) bool {
+	if q.typ == "file" && f.IsDir || q.typ == "dir" && !f.IsDir {
+		return false
+	}
+	if q.glob != "" {
+		if ok, _ := path.Match(q.glob, f.Name); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// sortEntries orders files by the requested key, breaking ties by name.
+func (q *listQuery) sortEntries(files []storage.FileInfo) {
+	less := func(a, b storage.FileInfo) bool {
+		switch q.sort {
+		case "size":
+			if a.Size != b.Size {
+				return a.Size < b.Size
+			}
+		case "modTime":
+			if !a.ModTime.Equal(b.ModTime) {
+				return a.ModTime.Before(b.ModTime)
+			}
+		}
+		return a.Name < b.Name
+	}
+	sort.Slice(files, func(i, j int) bool {
+		if q.desc {
+			return less(files[j], files[i])
+		}
+		return less(files[i], files[j])
+	})
+}
+
+// listCursor is the decoded form of the opaque cursor returned by List. It
+// carries the query it was issued for, so a cursor cannot be replayed
+// against a different directory, order or filter.
+type listCursor struct {
+	Query  string `json:"q"`
+	Token  string `json:"t,omitempty"`
+	Offset int    `json:"o,omitempty"`
+}
+
+func (q *listQuery) fingerprint() string {
+	order := "asc"
+	if q.desc {
+		order = "desc"
+	}
+	return strings.Join([]string{q.path, q.sort, order, q.typ, q.glob}, "\x00")
+}
+
+// cursor encodes the position after the current page: a backend token when
+// streamed, an offset into the sorted listing otherwise.
+func (q *listQuery) cursor(token string, offset int) string {
+	data, _ := json.Marshal(listCursor{Query: q.fingerprint(), Token: token, Offset: offset})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func (q *listQuery) decodeCursor(s string) error {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return errors.New("invalid cursor")
+	}
+	var c listCursor
+	if err := json.Unmarshal(data, &c); err != nil || c.Offset < 0 {
+		return errors.New("invalid cursor")
+	}
+	if c.Query != q.fingerprint() {
+		return errors.New("cursor does not match query")
+	}
+	q.token, q.offset = c.Token, c.Offset
+	return nil
+}
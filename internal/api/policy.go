@@ -0,0 +1,62 @@
+package api
+
+import (
+	"net/http"
+
+	"go-storage-api/internal/auth"
+	"go-storage-api/internal/policy"
+)
+
+// PolicyHandler serves /api/v1/policy/explain, a dry run of the policy for
+// debugging it.
+type PolicyHandler struct {
+	policy *policy.Policy
+}
+
+// NewPolicyHandler creates a PolicyHandler for p.
+func NewPolicyHandler(p *policy.Policy) *PolicyHandler {
+	return &PolicyHandler{policy: p}
+}
+
+// Explain reports whether a principal may perform the operation op on path,
+// and which roles and rules decide it, without touching storage. The
+// principal defaults to the caller; explaining another principal is
+// reserved to the policy's admins. For the caller, the scopes and prefixes
+// of their own credentials are checked too, as they are on every request.
+func (h *PolicyHandler) Explain(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	op, err := auth.ParseOperation(q.Get("op"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "op must be read, write or delete")
+		return
+	}
+	p := q.Get("path")
+
+	caller := auth.FromContext(r.Context())
+	principal := q.Get("principal")
+	self := caller != nil && (principal == "" || principal == caller.ID)
+	switch {
+	case self:
+		principal = caller.ID
+	case principal == "":
+		writeError(w, http.StatusBadRequest, "principal query parameter is required")
+		return
+	case caller != nil && !h.policy.IsAdmin(caller.ID):
+		writeError(w, http.StatusForbidden, "only policy admins may explain decisions for other principals")
+		return
+	}
+
+	resp := ExplainResponse{
+		Principal: principal,
+		Operation: op,
+		Path:      "/" + auth.Clean(p),
+		Decision:  h.policy.Evaluate(principal, op, p),
+	}
+	if self && resp.Allowed {
+		if err := auth.Check(r.Context(), op, p); err != nil {
+			resp.Allowed = false
+			resp.Reason = "not permitted by the caller's credentials: " + err.Error()
+		}
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
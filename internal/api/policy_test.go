@@ -0,0 +1,272 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"testing"
+
+	"go-storage-api/internal/auth"
+	"go-storage-api/internal/policy"
+	"go-storage-api/internal/storage"
+	"go-storage-api/internal/storage/memory"
+)
+
+// newPolicyRouter returns a router whose keys all carry every scope, so
+// only the policy limits them: alice is in team-a, root is a policy admin,
+// and carol may use /shared except for /shared/secret.
+func newPolicyRouter(t *testing.T, files map[string]string) (http.Handler, storage.Storage) {
+	t.Helper()
+	all := []string{"read", "write", "delete"}
+	keys, err := auth.NewKeyStore([]auth.Key{
+		{ID: "alice", Hash: auth.HashKey("alice-key"), Scopes: all},
+		{ID: "root", Hash: auth.HashKey("root-key"), Scopes: all},
+		{ID: "bob", Hash: auth.HashKey("bob-key"), Scopes: []string{"read"}},
+		{ID: "carol", Hash: auth.HashKey("carol-key"), Scopes: all},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pol, err := policy.Read(strings.NewReader(`{
+	  "roles": {
+	    "team-a": {"rules": [
+	      {"paths": ["/team-a/**"], "allow": ["read", "write", "delete"]},
+	      {"paths": ["/shared/**"], "allow": ["read"]},
+	      {"paths": ["/**"], "deny": ["delete"]}
+	    ]},
+	    "everything": {"rules": [{"paths": ["/**"], "allow": ["read", "write", "delete"]}]},
+	    "staff": {"rules": [
+	      {"paths": ["/shared/**"], "allow": ["read", "write", "delete"]},
+	      {"paths": ["/shared/secret/**"], "deny": ["read", "write", "delete"]},
+	      {"paths": ["/shared/*/locked/**"], "deny": ["write"]}
+	    ]}
+	  },
+	  "bindings": [
+	    {"role": "team-a", "principals": ["key:alice"]},
+	    {"role": "staff", "principals": ["key:carol"]},
+	    {"role": "everything", "principals": ["key:root", "key:bob"]}
+	  ],
+	  "admins": ["key:root"]
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store := memory.New()
+	for p, content := range files {
+		if err := store.Write(context.Background(), p, strings.NewReader(content)); err != nil {
+			t.Fatalf("Write(%q): %v", p, err)
+		}
+	}
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	return NewRouter(store, Options{MaxUploadSize: 10 << 20, Logger: logger, Auth: keys, Policy: pol}), store
+}
+
+// --- Enforcement ---
+
+func TestPolicy_Enforced(t *testing.T) {
+	router, store := newPolicyRouter(t, map[string]string{
+		"team-a/report.pdf": "report",
+		"shared/rules.md":   "rules",
+	})
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		want   int
+	}{
+		{"write own", http.MethodPut, "/api/v1/files?path=/team-a/new.txt", http.StatusCreated},
+		{"read shared", http.MethodGet, "/api/v1/files/download?path=/shared/rules.md", http.StatusOK},
+		{"write shared", http.MethodPut, "/api/v1/files?path=/shared/new.txt", http.StatusForbidden},
+		{"never delete", http.MethodDelete, "/api/v1/files?path=/team-a/report.pdf", http.StatusForbidden},
+		{"copy shared in", http.MethodPost, "/api/v1/files/copy?from=/shared/rules.md&to=/team-a/rules.md", http.StatusCreated},
+		{"copy own out", http.MethodPost, "/api/v1/files/copy?from=/team-a/report.pdf&to=/shared/report.pdf", http.StatusForbidden},
+		// Moving out of team-a deletes the source, which team-a never may.
+		{"move own", http.MethodPost, "/api/v1/files/move?from=/team-a/report.pdf&to=/team-a/old.pdf", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := serveAs(router, "alice-key", tt.method, tt.target, strings.NewReader("data"))
+			if rr.Code != tt.want {
+				t.Errorf("expected %d, got %d: %s", tt.want, rr.Code, rr.Body.String())
+			}
+		})
+	}
+
+	if _, err := store.Stat(context.Background(), "shared/report.pdf"); err == nil {
+		t.Error("expected the denied copy to write nothing")
+	}
+}
+
+func TestPolicy_DenialShape(t *testing.T) {
+	router, _ := newPolicyRouter(t, nil)
+
+	rr := serveAs(router, "alice-key", http.MethodPut, "/api/v1/files?path=/shared/x", strings.NewReader("x"))
+	if rr.Code != http.StatusForbidden {
+		t.Fatalf("expected 403, got %d", rr.Code)
+	}
+	if ct := rr.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("expected application/json, got %q", ct)
+	}
+	var body ErrorResponse
+	json.NewDecoder(rr.Body).Decode(&body)
+	if want := "forbidden: no rule allows write on /shared/x"; body.Error != want {
+		t.Errorf("expected error %q, got %q", want, body.Error)
+	}
+}
+
+// --- Subtrees ---
+
+// subtreeFiles has a denied directory below one the staff role may use.
+var subtreeFiles = map[string]string{
+	"shared/docs/a.txt":     "a",
+	"shared/secret/key.txt": "key",
+}
+
+func TestPolicy_SearchSkipsDenied(t *testing.T) {
+	router, _ := newPolicyRouter(t, subtreeFiles)
+
+	rr := serveAs(router, "carol-key", http.MethodGet, "/api/v1/files/search?path=/shared", nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var found []string
+	dec := json.NewDecoder(rr.Body)
+	for dec.More() {
+		var f storage.FileInfo
+		if err := dec.Decode(&f); err != nil {
+			t.Fatal(err)
+		}
+		found = append(found, f.Path)
+	}
+	if got := strings.Join(found, ","); got != "shared/docs,shared/docs/a.txt" {
+		t.Errorf("expected only the allowed entries, got %s", got)
+	}
+}
+
+func TestPolicy_ArchiveSkipsDenied(t *testing.T) {
+	router, _ := newPolicyRouter(t, subtreeFiles)
+
+	rr := serveAs(router, "carol-key", http.MethodGet, "/api/v1/files/archive?path=/shared", nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if got := entryNames(readArchive(t, "zip", rr.Body.Bytes())); got != "shared/,shared/docs/,shared/docs/a.txt" {
+		t.Errorf("expected only the allowed entries, got %s", got)
+	}
+}
+
+func TestPolicy_TreeOperations(t *testing.T) {
+	router, store := newPolicyRouter(t, subtreeFiles)
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		want   int
+	}{
+		{"delete denied below", http.MethodDelete, "/api/v1/files?path=/shared&recursive=true", http.StatusForbidden},
+		{"copy denied below source", http.MethodPost, "/api/v1/files/copy?from=/shared&to=/shared/x/all", http.StatusForbidden},
+		{"move denied below source", http.MethodPost, "/api/v1/files/move?from=/shared&to=/shared/x/all", http.StatusForbidden},
+		{"copy denied below destination", http.MethodPost, "/api/v1/files/copy?from=/shared/docs&to=/shared/copy", http.StatusForbidden},
+		{"copy file", http.MethodPost, "/api/v1/files/copy?from=/shared/docs/a.txt&to=/shared/copy", http.StatusCreated},
+		{"move allowed tree", http.MethodPost, "/api/v1/files/move?from=/shared/docs&to=/shared/old/docs", http.StatusOK},
+		{"delete allowed tree", http.MethodDelete, "/api/v1/files?path=/shared/old&recursive=true", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := serveAs(router, "carol-key", tt.method, tt.target, nil)
+			if rr.Code != tt.want {
+				t.Errorf("expected %d, got %d: %s", tt.want, rr.Code, rr.Body.String())
+			}
+		})
+	}
+
+	if got := readFile(t, store, "shared/secret/key.txt"); got != "key" {
+		t.Errorf("expected the denied file to stay, got %q", got)
+	}
+	if _, err := store.Stat(context.Background(), "shared/x"); err == nil {
+		t.Error("expected the refused copies to write nothing")
+	}
+}
+
+func TestPolicy_ExtractChecksEntries(t *testing.T) {
+	for _, format := range []string{"zip", "tar.gz"} {
+		t.Run(format, func(t *testing.T) {
+			router, store := newPolicyRouter(t, nil)
+
+			body := buildArchive(t, format, testEntry{name: "docs/a.txt", body: "a"}, testEntry{name: "secret/key.txt", body: "key"})
+			rr := serveAs(router, "carol-key", http.MethodPost, "/api/v1/files/extract?format="+format+"&path=/shared", bytes.NewReader(body))
+			if rr.Code != http.StatusForbidden {
+				t.Fatalf("expected 403, got %d: %s", rr.Code, rr.Body.String())
+			}
+			if _, err := store.Stat(context.Background(), "shared/secret/key.txt"); err == nil {
+				t.Error("expected the denied entry not to be written")
+			}
+		})
+	}
+}
+
+// --- Explain ---
+
+func TestPolicy_Explain(t *testing.T) {
+	router, _ := newPolicyRouter(t, nil)
+
+	rr := serveAs(router, "alice-key", http.MethodGet, "/api/v1/policy/explain?op=delete&path=/team-a/x", nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var resp ExplainResponse
+	json.NewDecoder(rr.Body).Decode(&resp)
+	if resp.Principal != "key:alice" || resp.Operation != auth.Delete || resp.Path != "/team-a/x" || resp.Allowed {
+		t.Errorf("unexpected explanation %+v", resp)
+	}
+	if resp.Reason != "delete on /team-a/x denied by role team-a rule 3" || len(resp.Matches) != 2 {
+		t.Errorf("unexpected reasoning %q, %+v", resp.Reason, resp.Matches)
+	}
+}
+
+func TestPolicy_ExplainIncludesCredentials(t *testing.T) {
+	router, _ := newPolicyRouter(t, nil)
+
+	// The policy gives bob everything, but his key only reads.
+	rr := serveAs(router, "bob-key", http.MethodGet, "/api/v1/policy/explain?op=write&path=/x", nil)
+	var resp ExplainResponse
+	json.NewDecoder(rr.Body).Decode(&resp)
+	if resp.Allowed || !strings.HasPrefix(resp.Reason, "not permitted by the caller's credentials") {
+		t.Errorf("expected the key's scopes to be reported, got %+v", resp)
+	}
+}
+
+func TestPolicy_ExplainOtherPrincipals(t *testing.T) {
+	router, _ := newPolicyRouter(t, nil)
+
+	rr := serveAs(router, "alice-key", http.MethodGet, "/api/v1/policy/explain?op=read&path=/x&principal=key:bob", nil)
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("expected 403 for a non-admin, got %d", rr.Code)
+	}
+
+	rr = serveAs(router, "root-key", http.MethodGet, "/api/v1/policy/explain?op=write&path=/team-a/x&principal=key:alice", nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 for an admin, got %d", rr.Code)
+	}
+	var resp ExplainResponse
+	json.NewDecoder(rr.Body).Decode(&resp)
+	if resp.Principal != "key:alice" || !resp.Allowed {
+		t.Errorf("unexpected explanation %+v", resp)
+	}
+}
+
+func TestPolicy_ExplainInvalidOp(t *testing.T) {
+	router, _ := newPolicyRouter(t, nil)
+
+	rr := serveAs(router, "alice-key", http.MethodGet, "/api/v1/policy/explain?op=admin&path=/x", nil)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400, got %d", rr.Code)
+	}
+}
@@ -0,0 +1,38 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"go-storage-api/internal/storage"
+)
+
+// parseCondition reads the If-Match and If-None-Match headers of a write.
+// If-Match takes a single entity tag or "*"; a weak tag never matches, since
+// If-Match compares strongly. If-None-Match only supports "*", for
+// create-only writes. The error message is suitable for a 400 response.
+func parseCondition(h http.Header) (storage.Condition, error) {
+	var cond storage.Condition
+	if v := strings.TrimSpace(strings.Join(h.Values("If-Match"), ",")); v != "" {
+		if v != "*" && !isEntityTag(strings.TrimPrefix(v, "W/")) {
+			return cond, errors.New("If-Match must be a single entity tag or *")
+		}
+		cond.IfMatch = v
+	}
+	if v := strings.TrimSpace(strings.Join(h.Values("If-None-Match"), ",")); v != "" {
+		if v != "*" {
+			return cond, errors.New("If-None-Match only supports *")
+		}
+		if cond.IfMatch != "" {
+			return cond, errors.New("If-Match and If-None-Match cannot be combined")
+		}
+		cond.IfNoneMatch = true
+	}
+	return cond, nil
+}
+
+// isEntityTag reports whether s is one quoted entity tag.
+func isEntityTag(s string) bool {
+	return len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' && !strings.Contains(s[1:len(s)-1], `"`)
+}
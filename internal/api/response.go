@@ -3,6 +3,10 @@ package api
 import (
 	"encoding/json"
 	"net/http"
+	"time"
+
+	"go-storage-api/internal/auth"
+	"go-storage-api/internal/policy"
 )
 
 type ErrorResponse struct {
@@ -13,6 +17,26 @@ type SuccessResponse struct {
 	Message string `json:"message"`
 }
 
+type SessionResponse struct {
+	ID      string    `json:"id"`
+	Path    string    `json:"path"`
+	MaxSize int64     `json:"maxSize"`
+	Expires time.Time `json:"expires"`
+}
+
+type ChecksumResponse struct {
+	Path      string `json:"path"`
+	Algorithm string `json:"algorithm"`
+	Checksum  string `json:"checksum"`
+}
+
+type ExplainResponse struct {
+	Principal string         `json:"principal"`
+	Operation auth.Operation `json:"operation"`
+	Path      string         `json:"path"`
+	policy.Decision
+}
+
 func writeJSON(w http.ResponseWriter, status int, data interface{}) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
@@ -4,28 +4,114 @@ import (
 	"log/slog"
 	"net/http"
 
+	"go-storage-api/internal/auth"
 	"go-storage-api/internal/middleware"
+	"go-storage-api/internal/policy"
 	"go-storage-api/internal/storage"
+	"go-storage-api/internal/upload"
 )
 
+// Options configures NewRouter.
+type Options struct {
+	// MaxUploadSize caps the request body of a single upload.
+	MaxUploadSize int64
+	// Uploads stages resumable uploads and multipart sessions. The
+	// /api/v1/uploads routes are only registered when it is set.
+	Uploads *upload.Store
+	// MaxResumableSize caps the total size of a resumable upload.
+	MaxResumableSize int64
+	// Extract limits what an archive sent to /api/v1/files/extract may
+	// unpack to. Zero fields take their value from DefaultExtractLimits.
+	Extract ExtractLimits
+	// Logger receives one line per request. It defaults to slog.Default.
+	Logger *slog.Logger
+	// Auth authenticates every request except the health check, and each
+	// route checks the caller may perform its operations on the paths it
+	// names. Without it the API is open.
+	Auth auth.Authenticator
+	// Policy, if set, must also allow every operation a route performs,
+	// and /api/v1/policy/explain is registered. It requires Auth.
+	Policy *policy.Policy
+	// Shares, with a Signer, registers /api/v1/shares and lets share links
+	// stand in for credentials on the download and upload routes. It
+	// requires Auth.
+	Shares ShareOptions
+}
+
 // NewRouter creates a fully wired http.Handler with middleware and routes.
-func NewRouter(store storage.Storage, maxUploadSize int64, logger *slog.Logger) http.Handler {
-	h := NewHandler(store, maxUploadSize)
+func NewRouter(store storage.Storage, opts Options) http.Handler {
+	h := NewHandler(store, opts.MaxUploadSize)
+	logger := opts.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	az := authorizer{check: auth.Check, checkTree: auth.Check}
+	if opts.Policy != nil {
+		az.check, az.checkTree = opts.Policy.Check, opts.Policy.CheckTree
+	}
 
 	mux := http.NewServeMux()
 
 	mux.HandleFunc("GET /api/v1/health", h.Health)
-	mux.HandleFunc("GET /api/v1/files", h.List)
-	mux.HandleFunc("GET /api/v1/files/download", h.Download)
-	mux.HandleFunc("POST /api/v1/files/upload", h.Upload)
-	mux.HandleFunc("DELETE /api/v1/files", h.Delete)
-	mux.HandleFunc("GET /api/v1/files/stat", h.Stat)
+	mux.HandleFunc("GET /api/v1/files", az.authorize(h.List, reads("path")))
+	mux.HandleFunc("GET /api/v1/files/download", az.authorize(h.Download, reads("path")))
+	mux.HandleFunc("POST /api/v1/files/upload", az.authorize(h.Upload, writes("path")))
+	mux.HandleFunc("PUT /api/v1/files", az.authorize(h.Put, writes("path")))
+	mux.HandleFunc("DELETE /api/v1/files", az.authorize(h.Delete, deletes("path")))
+	mux.HandleFunc("POST /api/v1/files/mkdir", az.authorize(h.Mkdir, writes("path")))
+	mux.HandleFunc("POST /api/v1/files/move", az.authorize(h.Move, moves("from"), writes("to")))
+	mux.HandleFunc("POST /api/v1/files/copy", az.authorize(h.Copy, reads("from"), writes("to")))
+	mux.HandleFunc("GET /api/v1/files/stat", az.authorize(h.Stat, reads("path")))
+	mux.HandleFunc("GET /api/v1/files/search", az.authorize(h.Search, reads("path")))
+	mux.HandleFunc("GET /api/v1/files/checksum", az.authorize(h.Checksum, reads("path")))
+	mux.HandleFunc("GET /api/v1/files/archive", az.authorize(h.Archive, reads("path")))
+
+	limits := opts.Extract
+	if limits.MaxEntries == 0 {
+		limits.MaxEntries = DefaultExtractLimits.MaxEntries
+	}
+	if limits.MaxSize == 0 {
+		limits.MaxSize = DefaultExtractLimits.MaxSize
+	}
+	x := NewExtractHandler(store, opts.MaxUploadSize, limits)
+	mux.HandleFunc("POST /api/v1/files/extract", az.authorize(x.Extract, writes("path")))
+
+	if opts.Policy != nil {
+		mux.HandleFunc("GET /api/v1/policy/explain", NewPolicyHandler(opts.Policy).Explain)
+	}
+
+	shares := opts.Shares
+	if shares.Creators == nil {
+		shares.Creators, _ = opts.Auth.(auth.Lookup)
+	}
+	if shares.Signer != nil {
+		mux.HandleFunc("POST /api/v1/shares", NewShareHandler(store, shares, az.check).Create)
+	}
+
+	if opts.Uploads != nil {
+		u := NewUploadHandler(store, opts.Uploads, opts.MaxResumableSize, opts.MaxUploadSize)
+		mux.HandleFunc("OPTIONS /api/v1/uploads", tus(u.Options))
+		mux.HandleFunc("POST /api/v1/uploads", az.authorize(withTus(u.Create, u.CreateSession), writes("path")))
+		mux.HandleFunc("HEAD /api/v1/uploads/{id}", tus(az.authorizeUpload(opts.Uploads, u.Head)))
+		mux.HandleFunc("PATCH /api/v1/uploads/{id}", tus(az.authorizeUpload(opts.Uploads, u.Patch)))
+		mux.HandleFunc("DELETE /api/v1/uploads/{id}", az.authorizeUpload(opts.Uploads, withTus(u.Terminate, u.AbortSession)))
+		mux.HandleFunc("PUT /api/v1/uploads/{id}/parts/{n}", az.authorizeUpload(opts.Uploads, u.PutPart))
+		mux.HandleFunc("POST /api/v1/uploads/{id}/complete", az.authorizeUpload(opts.Uploads, u.CompleteSession))
+	}
 
-	stack := middleware.Chain(
+	chain := []middleware.Middleware{
 		middleware.RequestID,
 		middleware.Logging(logger),
 		middleware.PathGuard,
-	)
+	}
+	if opts.Auth != nil {
+		authn := opts.Auth
+		if shares.Signer != nil {
+			authn = auth.Any(shareLinks{shares.Signer, shares.Creators}, authn)
+		}
+		chain = append(chain, auth.Middleware(authn, "/api/v1/health"))
+	}
 
-	return stack(mux)
+	return middleware.Chain(chain...)(mux)
 }
@@ -28,12 +28,15 @@ func newTestRouter() http.Handler {
 			return nil
 		},
 		statFn: func(_ context.Context, _ string) (*storage.FileInfo, error) {
-			return &storage.FileInfo{Name: "test"}, nil
+			return &storage.FileInfo{Name: "test", Size: 4}, nil
+		},
+		mkdirFn: func(_ context.Context, _ string) error {
+			return nil
 		},
 	}
 
 	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
-	return NewRouter(store, 10<<20, logger)
+	return NewRouter(store, Options{MaxUploadSize: 10 << 20, Logger: logger})
 }
 
 func TestRouter_HealthRoute(t *testing.T) {
@@ -90,6 +93,21 @@ func TestRouter_DownloadRoute(t *testing.T) {
 	}
 }
 
+func TestRouter_DownloadHead(t *testing.T) {
+	router := newTestRouter()
+
+	req := httptest.NewRequest(http.MethodHead, "/api/v1/files/download?path=test.txt", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected 200, got %d", rr.Code)
+	}
+	if got := rr.Header().Get("Content-Length"); got != "4" {
+		t.Errorf("expected Content-Length 4, got %q", got)
+	}
+}
+
 func TestRouter_DeleteRoute(t *testing.T) {
 	router := newTestRouter()
 
@@ -102,6 +120,88 @@ func TestRouter_DeleteRoute(t *testing.T) {
 	}
 }
 
+func TestRouter_MkdirRoute(t *testing.T) {
+	router := newTestRouter()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/files/mkdir?path=newdir", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusCreated {
+		t.Errorf("expected 201, got %d", rr.Code)
+	}
+}
+
+func TestRouter_PutRoute(t *testing.T) {
+	router := newTestRouter()
+
+	req := httptest.NewRequest(http.MethodPut, "/api/v1/files?path=test.txt", strings.NewReader("data"))
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusCreated {
+		t.Errorf("expected 201, got %d", rr.Code)
+	}
+}
+
+func TestRouter_SearchRoute(t *testing.T) {
+	router := newTestRouter()
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/files/search?path=/", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for a non-directory, got %d", rr.Code)
+	}
+}
+
+func TestRouter_ChecksumRoute(t *testing.T) {
+	router := newTestRouter()
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/files/checksum?path=test.txt&algo=md5", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected 200, got %d", rr.Code)
+	}
+	var body ChecksumResponse
+	json.NewDecoder(rr.Body).Decode(&body)
+	if body.Checksum != "8d777f385d3dfec8815d20f7496026dc" {
+		t.Errorf("expected md5 of %q, got %q", "data", body.Checksum)
+	}
+}
+
+func TestRouter_ArchiveRoute(t *testing.T) {
+	router := newTestRouter()
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/files/archive?path=test.txt&format=tar.gz", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected 200, got %d", rr.Code)
+	}
+	if ct := rr.Header().Get("Content-Type"); ct != "application/gzip" {
+		t.Errorf("expected Content-Type application/gzip, got %q", ct)
+	}
+}
+
+func TestRouter_ExtractRoute(t *testing.T) {
+	router := newTestRouter()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/files/extract?path=/", strings.NewReader("not a zip"))
+	req.Header.Set("Content-Type", "application/zip")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	// Reaching the handler: the body is read and refused as an archive.
+	if rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), "invalid archive") {
+		t.Errorf("expected 400 invalid archive, got %d: %s", rr.Code, rr.Body.String())
+	}
+}
+
 func TestRouter_WrongMethod(t *testing.T) {
 	router := newTestRouter()
 
@@ -0,0 +1,122 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"go-storage-api/internal/storage"
+	"go-storage-api/internal/upload"
+)
+
+// withTus routes a request to the tus handler when it carries a
+// Tus-Resumable header and to the session handler otherwise, so tus uploads
+// and multipart sessions can share /api/v1/uploads.
+func withTus(tusHandler, session http.HandlerFunc) http.HandlerFunc {
+	tusHandler = tus(tusHandler)
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Tus-Resumable") != "" {
+			tusHandler(w, r)
+			return
+		}
+		session(w, r)
+	}
+}
+
+// CreateSession starts a multipart session to the path query parameter.
+// Parts are then uploaded, in any order and in parallel, with PutPart, and
+// may add up to the same size as a tus upload.
+func (h *UploadHandler) CreateSession(w http.ResponseWriter, r *http.Request) {
+	p := r.URL.Query().Get("path")
+	if p == "" {
+		writeError(w, http.StatusBadRequest, "path query parameter is required")
+		return
+	}
+	if info, err := h.store.Stat(r.Context(), p); err == nil && info.IsDir {
+		writeError(w, http.StatusConflict, "path is a directory")
+		return
+	}
+
+	info, err := h.uploads.CreateSession(r.Context(), h.store, p, h.sizeLimit(r))
+	if err != nil {
+		handleUploadError(w, err)
+		return
+	}
+	w.Header().Set("Location", "/api/v1/uploads/"+info.ID)
+	writeJSON(w, http.StatusCreated, SessionResponse{ID: info.ID, Path: info.Path, MaxSize: info.Size, Expires: info.Expires})
+}
+
+// PutPart stores the request body as part n of a session. Content-Length is
+// required, since backends with native multipart uploads must declare each
+// part's size before sending it. Digest headers are verified as for
+// uploads.
+func (h *UploadHandler) PutPart(w http.ResponseWriter, r *http.Request) {
+	n, err := strconv.Atoi(r.PathValue("n"))
+	if err != nil || n < 1 || n > storage.MaxParts {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("part number must be between 1 and %d", storage.MaxParts))
+		return
+	}
+	if r.ContentLength < 0 {
+		writeError(w, http.StatusLengthRequired, "Content-Length header is required")
+		return
+	}
+	if r.ContentLength > h.maxPartSize {
+		writeError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("part exceeds maximum size of %d bytes", h.maxPartSize))
+		return
+	}
+	want, err := parseDigests(r.Header)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// The server never reads past Content-Length, so the body needs no
+	// further limit.
+	var body io.Reader = r.Body
+	if want != nil {
+		body = newDigestReader(body, want)
+	}
+	if err := h.uploads.PutPart(r.Context(), h.store, r.PathValue("id"), n, body, r.ContentLength); err != nil {
+		if errors.Is(err, errDigestMismatch) {
+			writeError(w, http.StatusUnprocessableEntity, errDigestMismatch.Error())
+			return
+		}
+		if !writeBodyError(w, err) {
+			handleSessionError(w, err)
+		}
+		return
+	}
+	writeJSON(w, http.StatusOK, SuccessResponse{Message: "part uploaded"})
+}
+
+// CompleteSession assembles the uploaded parts, in part number order, into
+// the session's file. If that fails the session is kept and the request
+// can be retried.
+func (h *UploadHandler) CompleteSession(w http.ResponseWriter, r *http.Request) {
+	if err := h.uploads.CompleteSession(r.Context(), h.store, r.PathValue("id")); err != nil {
+		handleSessionError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, SuccessResponse{Message: "file uploaded"})
+}
+
+// AbortSession ends a session and discards its parts.
+func (h *UploadHandler) AbortSession(w http.ResponseWriter, r *http.Request) {
+	if err := h.uploads.AbortSession(r.Context(), h.store, r.PathValue("id")); err != nil {
+		handleUploadError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, SuccessResponse{Message: "upload aborted"})
+}
+
+// handleSessionError is handleUploadError for sessions, whose size limit
+// covers all parts rather than a declared Upload-Length.
+func handleSessionError(w http.ResponseWriter, err error) {
+	if errors.Is(err, upload.ErrTooLarge) {
+		writeError(w, http.StatusRequestEntityTooLarge, "parts exceed the maximum upload size")
+		return
+	}
+	handleUploadError(w, err)
+}
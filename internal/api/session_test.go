@@ -0,0 +1,205 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// createSession starts a multipart session and returns its URL.
+func createSession(t *testing.T, router http.Handler, path string) string {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/uploads?path="+path, nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("create session: expected 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	var resp SessionResponse
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	loc := rr.Header().Get("Location")
+	if loc != "/api/v1/uploads/"+resp.ID || resp.Path != path || resp.Expires.IsZero() {
+		t.Fatalf("create session = %+v, Location %q", resp, loc)
+	}
+	return loc
+}
+
+func sessionRequest(router http.Handler, method, target, body string, header map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestSession_ParallelParts(t *testing.T) {
+	router, store := newTusRouter(t)
+	loc := createSession(t, router, "docs/a.txt")
+
+	var wg sync.WaitGroup
+	for n := 1; n <= 5; n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rr := sessionRequest(router, http.MethodPut, fmt.Sprintf("%s/parts/%d", loc, n), fmt.Sprintf("part%d;", n), nil)
+			if rr.Code != http.StatusOK {
+				t.Errorf("part %d: expected 200, got %d: %s", n, rr.Code, rr.Body.String())
+			}
+		}()
+	}
+	wg.Wait()
+
+	rr := sessionRequest(router, http.MethodPost, loc+"/complete", "", nil)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("complete: expected 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if got, want := readFile(t, store, "docs/a.txt"), "part1;part2;part3;part4;part5;"; got != want {
+		t.Errorf("assembled %q, want %q", got, want)
+	}
+
+	rr = sessionRequest(router, http.MethodPost, loc+"/complete", "", nil)
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("second complete: expected 404, got %d", rr.Code)
+	}
+}
+
+func TestSession_PartErrors(t *testing.T) {
+	router, _ := newTusRouter(t)
+	loc := createSession(t, router, "a.txt")
+
+	tests := []struct {
+		name   string
+		target string
+		body   string
+		length int64
+		header map[string]string
+		want   int
+	}{
+		{"part zero", loc + "/parts/0", "abc", 3, nil, http.StatusBadRequest},
+		{"part past limit", loc + "/parts/10001", "abc", 3, nil, http.StatusBadRequest},
+		{"part not a number", loc + "/parts/x", "abc", 3, nil, http.StatusBadRequest},
+		{"no length", loc + "/parts/1", "abc", -1, nil, http.StatusLengthRequired},
+		{"too large", loc + "/parts/1", "abc", 11 << 20, nil, http.StatusRequestEntityTooLarge},
+		{"bad digest header", loc + "/parts/1", "abc", 3, map[string]string{"Content-MD5": "!"}, http.StatusBadRequest},
+		{"digest mismatch", loc + "/parts/1", "abc", 3, map[string]string{"Content-MD5": base64Of([]byte("0123456789abcdef"))}, http.StatusUnprocessableEntity},
+		{"unknown session", "/api/v1/uploads/" + strings.Repeat("0", 32) + "/parts/1", "abc", 3, nil, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPut, tt.target, strings.NewReader(tt.body))
+			req.ContentLength = tt.length
+			for k, v := range tt.header {
+				req.Header.Set(k, v)
+			}
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+			if rr.Code != tt.want {
+				t.Errorf("expected %d, got %d: %s", tt.want, rr.Code, rr.Body.String())
+			}
+		})
+	}
+
+	// None of the failed parts was kept.
+	rr := sessionRequest(router, http.MethodPost, loc+"/complete", "", nil)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("complete without parts: expected 400, got %d: %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestSession_TotalSize(t *testing.T) {
+	router, store := newTusRouter(t)
+
+	rr := sessionRequest(router, http.MethodPost, "/api/v1/uploads?path=a.bin", "", nil)
+	var resp SessionResponse
+	json.NewDecoder(rr.Body).Decode(&resp)
+	if resp.MaxSize != 1024 {
+		t.Errorf("expected the session limited to MaxResumableSize, got %+v", resp)
+	}
+	loc := rr.Header().Get("Location")
+
+	// Each part fits the part limit, but together they pass the upload limit.
+	part := strings.Repeat("x", 600)
+	if rr := sessionRequest(router, http.MethodPut, loc+"/parts/1", part, nil); rr.Code != http.StatusOK {
+		t.Fatalf("part 1: expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if rr := sessionRequest(router, http.MethodPut, loc+"/parts/2", part, nil); rr.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("part 2: expected 413, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if rr := sessionRequest(router, http.MethodPut, loc+"/parts/2", part[:424], nil); rr.Code != http.StatusOK {
+		t.Fatalf("part 2: expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if rr := sessionRequest(router, http.MethodPost, loc+"/complete", "", nil); rr.Code != http.StatusCreated {
+		t.Fatalf("complete: expected 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if got := readFile(t, store, "a.bin"); len(got) != 1024 {
+		t.Errorf("assembled %d bytes, want 1024", len(got))
+	}
+}
+
+func TestSession_CreateErrors(t *testing.T) {
+	router, store := newTusRouter(t)
+	store.Mkdir(context.Background(), "docs")
+
+	for target, want := range map[string]int{
+		"/api/v1/uploads":           http.StatusBadRequest,
+		"/api/v1/uploads?path=docs": http.StatusConflict,
+	} {
+		if rr := sessionRequest(router, http.MethodPost, target, "", nil); rr.Code != want {
+			t.Errorf("POST %s: expected %d, got %d", target, want, rr.Code)
+		}
+	}
+}
+
+func TestSession_Abort(t *testing.T) {
+	router, store := newTusRouter(t)
+	loc := createSession(t, router, "a.txt")
+	sessionRequest(router, http.MethodPut, loc+"/parts/1", "abc", nil)
+
+	// A tus termination does not end a session.
+	if rr := tusRequest(router, http.MethodDelete, loc, "", nil); rr.Code != http.StatusNotFound {
+		t.Errorf("tus DELETE of a session: expected 404, got %d", rr.Code)
+	}
+
+	rr := sessionRequest(router, http.MethodDelete, loc, "", nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("abort: expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if rr := sessionRequest(router, http.MethodPost, loc+"/complete", "", nil); rr.Code != http.StatusNotFound {
+		t.Errorf("complete after abort: expected 404, got %d", rr.Code)
+	}
+	if _, err := store.Stat(context.Background(), "a.txt"); err == nil {
+		t.Error("aborted session created the file")
+	}
+}
+
+func TestSession_NotATusUpload(t *testing.T) {
+	router, _ := newTusRouter(t)
+	loc := createSession(t, router, "a.txt")
+	sessionRequest(router, http.MethodPut, loc+"/parts/1", "abc", nil)
+
+	if rr := tusRequest(router, http.MethodHead, loc, "", nil); rr.Code != http.StatusNotFound {
+		t.Errorf("tus HEAD of a session: expected 404, got %d", rr.Code)
+	}
+	rr := tusRequest(router, http.MethodPatch, loc, "abc", map[string]string{
+		"Content-Type":  "application/offset+octet-stream",
+		"Upload-Offset": "0",
+	})
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("tus PATCH of a session: expected 404, got %d", rr.Code)
+	}
+
+	tusLoc := createTusUpload(t, router, "b.txt", 3)
+	if rr := sessionRequest(router, http.MethodPut, tusLoc+"/parts/1", "abc", nil); rr.Code != http.StatusNotFound {
+		t.Errorf("part upload to a tus upload: expected 404, got %d", rr.Code)
+	}
+}
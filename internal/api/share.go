@@ -0,0 +1,240 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-storage-api/internal/auth"
+	"go-storage-api/internal/share"
+	"go-storage-api/internal/storage"
+)
+
+// ShareOptions configures share links: URLs that let anyone holding them
+// download or upload one file until they expire.
+type ShareOptions struct {
+	// Signer signs the links. The /api/v1/shares route is only registered
+	// when it is set.
+	Signer *share.Signer
+	// MaxExpiry caps how long a link may stay valid. Zero means
+	// DefaultShareMaxExpiry.
+	MaxExpiry time.Duration
+	// BaseURL is the external URL of the API that links point to, such as
+	// https://files.example.com. Without it, links use the scheme and host
+	// of the request that created them.
+	BaseURL string
+	// Presign hands out the backend's own presigned URLs instead, where it
+	// implements storage.Presigner.
+	Presign bool
+	// Creators looks up the creators of links. Links from creators it
+	// knows are bound to them: they stop working once the creator is gone
+	// or may no longer perform the operation on the path. NewRouter sets it
+	// to Options.Auth if that implements auth.Lookup.
+	Creators auth.Lookup
+}
+
+// DefaultShareMaxExpiry is the longest a link may be valid when
+// ShareOptions leaves it unset. It is also the most S3 accepts for a
+// presigned URL.
+const DefaultShareMaxExpiry = 7 * 24 * time.Hour
+
+// defaultShareExpiry is the validity of a link created without expiresIn,
+// unless MaxExpiry is shorter.
+const defaultShareExpiry = 24 * time.Hour
+
+// shareRoutes are the requests a link may make, by the operation it grants.
+var shareRoutes = map[string]auth.Operation{
+	"GET /api/v1/files/download":  auth.Read,
+	"HEAD /api/v1/files/download": auth.Read,
+	"PUT /api/v1/files":           auth.Write,
+	"POST /api/v1/files/upload":   auth.Write,
+}
+
+// shareLinks authenticates requests that carry a share link in place of
+// credentials. A link is only accepted on the routes of its operation, so
+// a write link cannot be used to create directories or unpack archives. A
+// bound link is only accepted while creators still knows its creator and
+// allows them the link's operation.
+type shareLinks struct {
+	signer   *share.Signer
+	creators auth.Lookup
+}
+
+func (s shareLinks) Authenticate(r *http.Request) (*auth.Principal, error) {
+	q := r.URL.Query()
+	if !share.Signed(q) {
+		return nil, auth.ErrNoCredentials
+	}
+	link, err := s.signer.Verify(q)
+	if err != nil {
+		return nil, err
+	}
+	if op, ok := shareRoutes[r.Method+" "+r.URL.Path]; !ok || op != link.Operation {
+		return nil, fmt.Errorf("%w: %s share link not valid for %s %s", auth.ErrInvalidCredentials, link.Operation, r.Method, r.URL.Path)
+	}
+	p := link.Principal()
+	if link.Bound {
+		var creator *auth.Principal
+		ok := false
+		if s.creators != nil {
+			creator, ok = s.creators.Lookup(link.CreatedBy)
+		}
+		if !ok || !creator.Allows(link.Operation, link.Path) {
+			return nil, fmt.Errorf("%w: share link creator %q may no longer %s /%s", auth.ErrInvalidCredentials, link.CreatedBy, link.Operation, link.Path)
+		}
+		if creator.MaxSize > 0 && (p.MaxSize == 0 || creator.MaxSize < p.MaxSize) {
+			p.MaxSize = creator.MaxSize
+		}
+	}
+	return p, nil
+}
+
+// ShareHandler creates share links.
+type ShareHandler struct {
+	store storage.Storage
+	opts  ShareOptions
+	check func(ctx context.Context, op auth.Operation, path string) error
+	now   func() time.Time
+}
+
+// NewShareHandler creates a ShareHandler. check decides whether the caller
+// may perform the operation they are sharing, as it does for the routes the
+// link will be used on.
+func NewShareHandler(store storage.Storage, opts ShareOptions, check func(ctx context.Context, op auth.Operation, path string) error) *ShareHandler {
+	if opts.MaxExpiry == 0 {
+		opts.MaxExpiry = DefaultShareMaxExpiry
+	}
+	return &ShareHandler{store: store, opts: opts, check: check, now: time.Now}
+}
+
+// ShareResponse describes a created link and how to use it.
+type ShareResponse struct {
+	URL       string         `json:"url"`
+	Method    string         `json:"method"`
+	Path      string         `json:"path"`
+	Operation auth.Operation `json:"operation"`
+	Expires   time.Time      `json:"expires"`
+	MaxSize   int64          `json:"maxSize,omitempty"`
+	// Presigned is set for URLs issued by the backend rather than the API.
+	Presigned bool `json:"presigned,omitempty"`
+}
+
+// Create returns a link through which the file at path can be downloaded
+// (op=read, the default) or uploaded with PUT (op=write) by anyone holding
+// it. expiresIn is a duration such as 1h, at most the configured maximum;
+// maxSize caps the size of an upload. The caller must be allowed op on path
+// themselves, and requests made with the link act as the caller, so a
+// policy keeps applying to them.
+func (h *ShareHandler) Create(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	p := q.Get("path")
+	if auth.Clean(p) == "" {
+		writeError(w, http.StatusBadRequest, "path query parameter must name a file")
+		return
+	}
+	op := auth.Read
+	if v := q.Get("op"); v != "" {
+		op = auth.Operation(v)
+	}
+	if op != auth.Read && op != auth.Write {
+		writeError(w, http.StatusBadRequest, "op must be read or write")
+		return
+	}
+
+	expiresIn := min(defaultShareExpiry, h.opts.MaxExpiry)
+	if v := q.Get("expiresIn"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 || d > h.opts.MaxExpiry {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("expiresIn must be a positive duration of at most %s", h.opts.MaxExpiry))
+			return
+		}
+		expiresIn = d
+	}
+	var maxSize int64
+	if v := q.Get("maxSize"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n <= 0 {
+			writeError(w, http.StatusBadRequest, "maxSize must be a positive number of bytes")
+			return
+		}
+		if op != auth.Write {
+			writeError(w, http.StatusBadRequest, "maxSize only applies to write links")
+			return
+		}
+		maxSize = n
+	}
+
+	if err := h.check(r.Context(), op, p); err != nil {
+		writeError(w, http.StatusForbidden, err.Error())
+		return
+	}
+	info, err := h.store.Stat(r.Context(), p)
+	switch {
+	case err == nil && info.IsDir && op == auth.Read:
+		writeError(w, http.StatusBadRequest, "path is a directory")
+		return
+	case err == nil && info.IsDir:
+		writeError(w, http.StatusConflict, "path is a directory")
+		return
+	case err != nil && op == auth.Read:
+		handleStorageError(w, err)
+		return
+	}
+
+	resp := ShareResponse{
+		Method:    http.MethodGet,
+		Path:      "/" + auth.Clean(p),
+		Operation: op,
+		Expires:   time.Unix(h.now().Add(expiresIn).Unix(), 0).UTC(),
+		MaxSize:   maxSize,
+	}
+	if op == auth.Write {
+		resp.Method = http.MethodPut
+	}
+
+	// A presigned PUT cannot cap the size of the upload, so size-limited
+	// write links always go through the API.
+	if presigner, ok := h.store.(storage.Presigner); ok && h.opts.Presign && maxSize == 0 {
+		u, err := presigner.PresignURL(r.Context(), resp.Method, p, expiresIn)
+		if err != nil {
+			handleStorageError(w, err)
+			return
+		}
+		resp.URL, resp.Presigned = u, true
+		writeJSON(w, http.StatusCreated, resp)
+		return
+	}
+
+	var by string
+	bound := false
+	if caller := auth.FromContext(r.Context()); caller != nil {
+		by = caller.ID
+		if h.opts.Creators != nil {
+			_, bound = h.opts.Creators.Lookup(by)
+		}
+	}
+	route := "/api/v1/files/download"
+	if op == auth.Write {
+		route = "/api/v1/files"
+	}
+	link := h.opts.Signer.Sign(share.Link{Path: p, Operation: op, Expires: resp.Expires, MaxSize: maxSize, CreatedBy: by, Bound: bound})
+	resp.URL = h.baseURL(r) + route + "?" + link.Encode()
+	writeJSON(w, http.StatusCreated, resp)
+}
+
+// baseURL is the configured base URL, or the one the request was sent to.
+// Behind a proxy that rewrites the host or terminates TLS, BaseURL must be
+// set.
+func (h *ShareHandler) baseURL(r *http.Request) string {
+	if h.opts.BaseURL != "" {
+		return strings.TrimSuffix(h.opts.BaseURL, "/")
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
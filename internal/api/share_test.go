@@ -0,0 +1,331 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"go-storage-api/internal/auth"
+	"go-storage-api/internal/share"
+	"go-storage-api/internal/storage"
+	"go-storage-api/internal/storage/memory"
+)
+
+const shareBaseURL = "https://files.example.com"
+
+// newShareRouter returns a router with the keys of newAuthRouter and share
+// links enabled over store.
+func newShareRouter(t *testing.T, store storage.Storage, presign bool) (http.Handler, *share.Signer) {
+	t.Helper()
+	keys, err := auth.NewKeyStore([]auth.Key{
+		{ID: "admin", Hash: auth.HashKey("admin-key"), Scopes: []string{"read", "write", "delete"}},
+		{ID: "reader", Hash: auth.HashKey("reader-key"), Scopes: []string{"read"}},
+		{ID: "ci", Hash: auth.HashKey("ci-key"), Scopes: []string{"read", "write"}, Prefixes: []string{"builds"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := share.New([]byte(strings.Repeat("k", share.MinSecretSize)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	return NewRouter(store, Options{
+		MaxUploadSize: 10 << 20,
+		Logger:        logger,
+		Auth:          keys,
+		Shares:        ShareOptions{Signer: signer, MaxExpiry: 48 * time.Hour, BaseURL: shareBaseURL + "/", Presign: presign},
+	}), signer
+}
+
+func newShareStore(t *testing.T, files map[string]string) storage.Storage {
+	t.Helper()
+	store := memory.New()
+	for p, content := range files {
+		if err := store.Write(context.Background(), p, strings.NewReader(content)); err != nil {
+			t.Fatalf("Write(%q): %v", p, err)
+		}
+	}
+	return store
+}
+
+// createShare creates a link as key and returns it, failing the test
+// unless the API answers 201.
+func createShare(t *testing.T, router http.Handler, key, query string) ShareResponse {
+	t.Helper()
+	rr := serveAs(router, key, http.MethodPost, "/api/v1/shares?"+query, nil)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("create share: expected 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var resp ShareResponse
+	json.NewDecoder(rr.Body).Decode(&resp)
+	return resp
+}
+
+// target strips the base URL from a link so it can be served in-process.
+func target(t *testing.T, link string) string {
+	t.Helper()
+	rest, ok := strings.CutPrefix(link, shareBaseURL)
+	if !ok {
+		t.Fatalf("expected link under %s, got %s", shareBaseURL, link)
+	}
+	return rest
+}
+
+// --- Download ---
+
+func TestShare_Download(t *testing.T) {
+	router, _ := newShareRouter(t, newShareStore(t, map[string]string{"docs/a.txt": "hello"}), false)
+
+	resp := createShare(t, router, "reader-key", "path=/docs/a.txt&expiresIn=1h")
+	if resp.Method != http.MethodGet || resp.Operation != auth.Read || resp.Path != "/docs/a.txt" || resp.Presigned {
+		t.Errorf("unexpected share %+v", resp)
+	}
+	if d := time.Until(resp.Expires); d < 59*time.Minute || d > time.Hour {
+		t.Errorf("expected expiry in an hour, got %s", resp.Expires)
+	}
+
+	link := target(t, resp.URL)
+	rr := serveAs(router, "", http.MethodGet, link, nil)
+	if rr.Code != http.StatusOK || rr.Body.String() != "hello" {
+		t.Errorf("expected 200 hello, got %d %q", rr.Code, rr.Body.String())
+	}
+	rr = serveAs(router, "", http.MethodHead, link, nil)
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected HEAD to be allowed, got %d", rr.Code)
+	}
+}
+
+func TestShare_LinkLimits(t *testing.T) {
+	router, _ := newShareRouter(t, newShareStore(t, map[string]string{"docs/a.txt": "a", "docs/b.txt": "b"}), false)
+
+	link := target(t, createShare(t, router, "admin-key", "path=/docs/a.txt").URL)
+	_, query, _ := strings.Cut(link, "?")
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+	}{
+		{"other route", http.MethodGet, "/api/v1/files/stat?" + query},
+		{"other operation", http.MethodPut, "/api/v1/files?" + query},
+		{"other path", http.MethodGet, "/api/v1/files/download?" + strings.Replace(query, "a.txt", "b.txt", 1)},
+		{"repeated path", http.MethodGet, link + "&path=/docs/b.txt"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := serveAs(router, "", tt.method, tt.target, strings.NewReader("x"))
+			if rr.Code != http.StatusUnauthorized {
+				t.Errorf("expected 401, got %d: %s", rr.Code, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestShare_Expired(t *testing.T) {
+	router, signer := newShareRouter(t, newShareStore(t, map[string]string{"a.txt": "a"}), false)
+
+	q := signer.Sign(share.Link{Path: "/a.txt", Operation: auth.Read, Expires: time.Now().Add(-time.Minute), CreatedBy: "admin"})
+	rr := serveAs(router, "", http.MethodGet, "/api/v1/files/download?"+q.Encode(), nil)
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 for an expired link, got %d", rr.Code)
+	}
+}
+
+// TestShare_CreatorRevoked serves links created with newShareRouter's keys
+// from a router whose key file has since changed.
+func TestShare_CreatorRevoked(t *testing.T) {
+	store := newShareStore(t, map[string]string{"docs/a.txt": "a", "builds/b.txt": "b"})
+	router, signer := newShareRouter(t, store, false)
+	readerLink := target(t, createShare(t, router, "reader-key", "path=/docs/a.txt").URL)
+	ciLink := target(t, createShare(t, router, "ci-key", "path=/builds/b.txt").URL)
+
+	// reader is removed and ci loses its read scope.
+	keys, err := auth.NewKeyStore([]auth.Key{
+		{ID: "ci", Hash: auth.HashKey("ci-key"), Scopes: []string{"write"}, Prefixes: []string{"builds"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	rotated := NewRouter(store, Options{
+		MaxUploadSize: 10 << 20,
+		Logger:        logger,
+		Auth:          keys,
+		Shares:        ShareOptions{Signer: signer, BaseURL: shareBaseURL},
+	})
+
+	for name, link := range map[string]string{"removed key": readerLink, "narrowed key": ciLink} {
+		t.Run(name, func(t *testing.T) {
+			if rr := serveAs(rotated, "", http.MethodGet, link, nil); rr.Code != http.StatusUnauthorized {
+				t.Errorf("expected 401, got %d: %s", rr.Code, rr.Body.String())
+			}
+			if rr := serveAs(router, "", http.MethodGet, link, nil); rr.Code != http.StatusOK {
+				t.Errorf("expected the original router to accept the link, got %d", rr.Code)
+			}
+		})
+	}
+}
+
+// tokenAuth stands in for a JWT authenticator: the token "jwt-ci" has the
+// subject "ci", the ID of one of the keys of newShareRouter.
+type tokenAuth struct{}
+
+func (tokenAuth) Authenticate(r *http.Request) (*auth.Principal, error) {
+	if auth.Credential(r) != "jwt-ci" {
+		return nil, auth.ErrNoCredentials
+	}
+	return &auth.Principal{ID: auth.TokenPrefix + "https://idp.example.com/ci", Operations: []auth.Operation{auth.Read}}, nil
+}
+
+func TestShare_TokenSubjectMatchesKeyID(t *testing.T) {
+	store := newShareStore(t, map[string]string{"docs/a.txt": "a"})
+	keys, err := auth.NewKeyStore([]auth.Key{
+		{ID: "ci", Hash: auth.HashKey("ci-key"), Scopes: []string{"read"}, Prefixes: []string{"builds"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := share.New([]byte(strings.Repeat("k", share.MinSecretSize)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	router := NewRouter(store, Options{
+		MaxUploadSize: 10 << 20,
+		Logger:        slog.New(slog.NewJSONHandler(io.Discard, nil)),
+		Auth:          auth.Any(tokenAuth{}, keys),
+		Shares:        ShareOptions{Signer: signer, BaseURL: shareBaseURL},
+	})
+
+	// The token may read /docs, the key of the same name may not. The
+	// token's link must be neither bound to the key nor judged by it.
+	u, err := url.Parse(createShare(t, router, "jwt-ci", "path=/docs/a.txt").URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	if by := q.Get(share.ParamCreatedBy); by != "jwt:https://idp.example.com/ci" {
+		t.Errorf("expected the link to name the token's principal, got %q", by)
+	}
+	if q.Get(share.ParamBound) != "" {
+		t.Error("expected the token's link not to be bound to the key")
+	}
+	if rr := serveAs(router, "", http.MethodGet, u.RequestURI(), nil); rr.Code != http.StatusOK {
+		t.Errorf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+}
+
+// --- Upload ---
+
+func TestShare_Upload(t *testing.T) {
+	store := newShareStore(t, nil)
+	router, _ := newShareRouter(t, store, false)
+
+	resp := createShare(t, router, "ci-key", "path=/builds/out.bin&op=write&maxSize=5")
+	if resp.Method != http.MethodPut || resp.MaxSize != 5 {
+		t.Errorf("unexpected share %+v", resp)
+	}
+	link := target(t, resp.URL)
+
+	rr := serveAs(router, "", http.MethodPut, link, strings.NewReader("too large"))
+	if rr.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected 413 past maxSize, got %d", rr.Code)
+	}
+	rr = serveAs(router, "", http.MethodPut, link, strings.NewReader("small"))
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if info, err := store.Stat(context.Background(), "builds/out.bin"); err != nil || info.Size != 5 {
+		t.Errorf("expected the upload to be stored, got %+v, %v", info, err)
+	}
+
+	rr = serveAs(router, "", http.MethodGet, strings.Replace(link, "/api/v1/files?", "/api/v1/files/download?", 1), nil)
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("expected a write link not to download, got %d", rr.Code)
+	}
+}
+
+// --- Create ---
+
+func TestShare_CreateRejects(t *testing.T) {
+	router, _ := newShareRouter(t, newShareStore(t, map[string]string{"docs/a.txt": "a", "builds/x": "x"}), false)
+
+	tests := []struct {
+		name  string
+		key   string
+		query string
+		want  int
+	}{
+		{"no path", "admin-key", "", http.StatusBadRequest},
+		{"root", "admin-key", "path=/", http.StatusBadRequest},
+		{"delete", "admin-key", "path=/docs/a.txt&op=delete", http.StatusBadRequest},
+		{"too long", "admin-key", "path=/docs/a.txt&expiresIn=72h", http.StatusBadRequest},
+		{"bad expiry", "admin-key", "path=/docs/a.txt&expiresIn=-1h", http.StatusBadRequest},
+		{"read size", "admin-key", "path=/docs/a.txt&maxSize=10", http.StatusBadRequest},
+		{"directory", "admin-key", "path=/docs", http.StatusBadRequest},
+		{"write directory", "admin-key", "path=/docs&op=write", http.StatusConflict},
+		{"missing", "admin-key", "path=/docs/none.txt", http.StatusNotFound},
+		{"beyond scopes", "reader-key", "path=/docs/new.txt&op=write", http.StatusForbidden},
+		{"beyond prefixes", "ci-key", "path=/docs/a.txt", http.StatusForbidden},
+		{"no credentials", "", "path=/docs/a.txt", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := serveAs(router, tt.key, http.MethodPost, "/api/v1/shares?"+tt.query, nil)
+			if rr.Code != tt.want {
+				t.Errorf("expected %d, got %d: %s", tt.want, rr.Code, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestShare_BaseURLFromRequest(t *testing.T) {
+	store := newShareStore(t, map[string]string{"a.txt": "a"})
+	signer, _ := share.New([]byte(strings.Repeat("k", share.MinSecretSize)))
+	h := NewShareHandler(store, ShareOptions{Signer: signer}, auth.Check)
+
+	rr := httptest.NewRecorder()
+	h.Create(rr, httptest.NewRequest(http.MethodPost, "http://api.internal:8080/api/v1/shares?path=/a.txt", nil))
+	var resp ShareResponse
+	json.NewDecoder(rr.Body).Decode(&resp)
+	if !strings.HasPrefix(resp.URL, "http://api.internal:8080/api/v1/files/download?") {
+		t.Errorf("expected a link to the request's host, got %q", resp.URL)
+	}
+}
+
+// --- Presign ---
+
+// presignStore is a memory store that presigns URLs on a fake host.
+type presignStore struct {
+	storage.Storage
+}
+
+func (presignStore) PresignURL(_ context.Context, method, p string, expires time.Duration) (string, error) {
+	return "https://bucket.example.com/" + auth.Clean(p) + "?" + url.Values{"method": {method}, "expires": {expires.String()}}.Encode(), nil
+}
+
+func TestShare_Presign(t *testing.T) {
+	router, _ := newShareRouter(t, presignStore{newShareStore(t, map[string]string{"a.txt": "a"})}, true)
+
+	resp := createShare(t, router, "admin-key", "path=/a.txt&expiresIn=2h")
+	if !resp.Presigned || resp.URL != "https://bucket.example.com/a.txt?expires=2h0m0s&method=GET" {
+		t.Errorf("expected a presigned GET, got %+v", resp)
+	}
+	resp = createShare(t, router, "admin-key", "path=/b.txt&op=write")
+	if !resp.Presigned || resp.Method != http.MethodPut || !strings.Contains(resp.URL, "method=PUT") {
+		t.Errorf("expected a presigned PUT, got %+v", resp)
+	}
+
+	// A presigned PUT cannot enforce a size limit, so the API signs it.
+	resp = createShare(t, router, "admin-key", "path=/b.txt&op=write&maxSize=10")
+	if resp.Presigned || !strings.HasPrefix(resp.URL, shareBaseURL+"/api/v1/files?") {
+		t.Errorf("expected an API link for a size-limited upload, got %+v", resp)
+	}
+}
@@ -0,0 +1,269 @@
+package api
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"go-storage-api/internal/auth"
+	"go-storage-api/internal/storage"
+	"go-storage-api/internal/upload"
+)
+
+// tusVersion is the tus protocol version served under /api/v1/uploads.
+const tusVersion = "1.0.0"
+
+// tusExtensions lists the tus extensions UploadHandler implements.
+const tusExtensions = "creation,expiration,termination"
+
+// UploadHandler serves resumable uploads and multipart sessions under
+// /api/v1/uploads. Data is staged in an upload.Store, or in the backend for
+// native multipart uploads, and written to storage once complete.
+type UploadHandler struct {
+	store       storage.Storage
+	uploads     *upload.Store
+	maxSize     int64
+	maxPartSize int64
+}
+
+// NewUploadHandler creates an UploadHandler that accepts tus uploads and
+// sessions of up to maxSize bytes in total, and session parts of up to
+// maxPartSize bytes.
+func NewUploadHandler(store storage.Storage, uploads *upload.Store, maxSize, maxPartSize int64) *UploadHandler {
+	return &UploadHandler{store: store, uploads: uploads, maxSize: maxSize, maxPartSize: maxPartSize}
+}
+
+// sizeLimit is the largest total size of an upload: the server's limit, or
+// the caller's own if it is lower.
+func (h *UploadHandler) sizeLimit(r *http.Request) int64 {
+	if p := auth.FromContext(r.Context()); p != nil && p.MaxSize > 0 && p.MaxSize < h.maxSize {
+		return p.MaxSize
+	}
+	return h.maxSize
+}
+
+// tus wraps a tus endpoint: every response carries Tus-Resumable, and
+// requests for any other protocol version are refused with 412.
+func tus(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Tus-Resumable", tusVersion)
+		if r.Method != http.MethodOptions && r.Header.Get("Tus-Resumable") != tusVersion {
+			w.Header().Set("Tus-Version", tusVersion)
+			writeError(w, http.StatusPreconditionFailed, "unsupported Tus-Resumable version, want "+tusVersion)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// Options advertises the supported protocol version, extensions and size
+// limit.
+func (h *UploadHandler) Options(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Tus-Version", tusVersion)
+	w.Header().Set("Tus-Extension", tusExtensions)
+	w.Header().Set("Tus-Max-Size", strconv.FormatInt(h.maxSize, 10))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Create starts an upload of Upload-Length bytes to the path query
+// parameter and returns its URL in Location.
+func (h *UploadHandler) Create(w http.ResponseWriter, r *http.Request) {
+	p := r.URL.Query().Get("path")
+	if p == "" {
+		writeError(w, http.StatusBadRequest, "path query parameter is required")
+		return
+	}
+
+	v := r.Header.Get("Upload-Length")
+	if v == "" {
+		if r.Header.Get("Upload-Defer-Length") != "" {
+			writeError(w, http.StatusBadRequest, "Upload-Defer-Length is not supported")
+			return
+		}
+		writeError(w, http.StatusBadRequest, "Upload-Length header is required")
+		return
+	}
+	size, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || size < 0 {
+		writeError(w, http.StatusBadRequest, "invalid Upload-Length header")
+		return
+	}
+	if limit := h.sizeLimit(r); size > limit {
+		w.Header().Set("Tus-Max-Size", strconv.FormatInt(limit, 10))
+		writeError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("upload exceeds maximum size of %d bytes", limit))
+		return
+	}
+	meta, err := parseTusMetadata(r.Header.Get("Upload-Metadata"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Refuse a target that can never be written before the client sends
+	// any data.
+	if info, err := h.store.Stat(r.Context(), p); err == nil && info.IsDir {
+		writeError(w, http.StatusConflict, "path is a directory")
+		return
+	}
+
+	info, err := h.uploads.Create(p, size, meta)
+	if err != nil {
+		handleUploadError(w, err)
+		return
+	}
+	if size == 0 {
+		if err := h.uploads.Commit(r.Context(), info.ID, h.store); err != nil {
+			handleUploadError(w, err)
+			return
+		}
+	}
+
+	w.Header().Set("Location", "/api/v1/uploads/"+info.ID)
+	w.Header().Set("Upload-Expires", info.Expires.UTC().Format(http.TimeFormat))
+	w.WriteHeader(http.StatusCreated)
+}
+
+// Head reports how much of an upload has been received.
+func (h *UploadHandler) Head(w http.ResponseWriter, r *http.Request) {
+	info, err := h.tusUpload(r.PathValue("id"))
+	if err != nil {
+		handleUploadError(w, err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Upload-Offset", strconv.FormatInt(info.Offset, 10))
+	w.Header().Set("Upload-Length", strconv.FormatInt(info.Size, 10))
+	w.Header().Set("Upload-Expires", info.Expires.UTC().Format(http.TimeFormat))
+	if len(info.Metadata) > 0 {
+		w.Header().Set("Upload-Metadata", formatTusMetadata(info.Metadata))
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// Patch appends the request body at Upload-Offset. When the last byte
+// arrives the file is written to storage. If that fails the upload stays
+// complete, and an empty PATCH at the final offset retries the write.
+func (h *UploadHandler) Patch(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Content-Type") != "application/offset+octet-stream" {
+		writeError(w, http.StatusUnsupportedMediaType, "Content-Type must be application/offset+octet-stream")
+		return
+	}
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		writeError(w, http.StatusBadRequest, "invalid Upload-Offset header")
+		return
+	}
+
+	id := r.PathValue("id")
+	if info, err := h.tusUpload(id); err == nil && r.ContentLength > info.Size-offset {
+		writeError(w, http.StatusRequestEntityTooLarge, "data exceeds Upload-Length")
+		return
+	}
+	info, err := h.uploads.Append(id, offset, r.Body)
+	if info != nil {
+		w.Header().Set("Upload-Offset", strconv.FormatInt(info.Offset, 10))
+		w.Header().Set("Upload-Expires", info.Expires.UTC().Format(http.TimeFormat))
+	}
+	if err != nil {
+		if !writeBodyError(w, err) {
+			handleUploadError(w, err)
+		}
+		return
+	}
+
+	if info.Offset == info.Size {
+		if err := h.uploads.Commit(r.Context(), id, h.store); err != nil {
+			handleUploadError(w, err)
+			return
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Terminate discards an upload and the data received so far.
+func (h *UploadHandler) Terminate(w http.ResponseWriter, r *http.Request) {
+	if err := h.uploads.Remove(r.PathValue("id")); err != nil {
+		handleUploadError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// tusUpload returns the tus upload with the given id. Multipart sessions
+// share the ID space under /api/v1/uploads but are not tus uploads, so they
+// are reported as not found.
+func (h *UploadHandler) tusUpload(id string) (*upload.Info, error) {
+	info, err := h.uploads.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if info.Kind != upload.KindTus {
+		return nil, fmt.Errorf("upload %s: %w", id, storage.ErrNotFound)
+	}
+	return info, nil
+}
+
+// handleUploadError maps upload store errors, and storage errors from
+// committing an upload, to HTTP responses.
+func handleUploadError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, upload.ErrLocked):
+		writeError(w, http.StatusLocked, "upload is locked by another request")
+	case errors.Is(err, upload.ErrOffset):
+		writeError(w, http.StatusConflict, "Upload-Offset does not match the upload")
+	case errors.Is(err, upload.ErrTooLarge):
+		writeError(w, http.StatusRequestEntityTooLarge, "data exceeds Upload-Length")
+	case errors.Is(err, upload.ErrIncomplete):
+		writeError(w, http.StatusConflict, "upload is incomplete")
+	default:
+		handleStorageError(w, err)
+	}
+}
+
+// parseTusMetadata decodes an Upload-Metadata header: comma-separated pairs
+// of a key and an optional base64-encoded value.
+func parseTusMetadata(v string) (map[string]string, error) {
+	if strings.TrimSpace(v) == "" {
+		return nil, nil
+	}
+	meta := map[string]string{}
+	for _, pair := range strings.Split(v, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(pair), " ")
+		if key == "" {
+			return nil, errors.New("invalid Upload-Metadata header")
+		}
+		if _, dup := meta[key]; dup {
+			return nil, fmt.Errorf("duplicate Upload-Metadata key %q", key)
+		}
+		decoded, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Upload-Metadata value for %q", key)
+		}
+		meta[key] = string(decoded)
+	}
+	return meta, nil
+}
+
+// formatTusMetadata encodes metadata for the Upload-Metadata header, with
+// keys in sorted order.
+func formatTusMetadata(meta map[string]string) string {
+	keys := make([]string, 0, len(meta))
+	for k := range meta {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, len(keys))
+	for i, k := range keys {
+		pairs[i] = k
+		if meta[k] != "" {
+			pairs[i] += " " + base64.StdEncoding.EncodeToString([]byte(meta[k]))
+		}
+	}
+	return strings.Join(pairs, ",")
+}
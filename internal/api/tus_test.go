@@ -0,0 +1,292 @@
+package api
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"go-storage-api/internal/storage"
+	"go-storage-api/internal/storage/memory"
+	"go-storage-api/internal/upload"
+)
+
+// newTusRouter returns a router with resumable uploads over an in-memory
+// backend, limited to 1 KiB per upload.
+func newTusRouter(t *testing.T) (http.Handler, storage.Storage) {
+	t.Helper()
+	uploads, err := upload.New(t.TempDir(), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := memory.New()
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	return NewRouter(store, Options{
+		MaxUploadSize:    10 << 20,
+		Uploads:          uploads,
+		MaxResumableSize: 1024,
+		Logger:           logger,
+	}), store
+}
+
+// tusRequest sends a tus request with the protocol header set.
+func tusRequest(router http.Handler, method, target, body string, header map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set("Tus-Resumable", tusVersion)
+	if method == http.MethodPatch {
+		req.Header.Set("Content-Type", "application/offset+octet-stream")
+	}
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	return rr
+}
+
+// createTusUpload starts an upload and returns its URL.
+func createTusUpload(t *testing.T, router http.Handler, path string, size int) string {
+	t.Helper()
+	rr := tusRequest(router, http.MethodPost, "/api/v1/uploads?path="+path, "", map[string]string{
+		"Upload-Length":   strconv.Itoa(size),
+		"Upload-Metadata": "filename cmVwb3J0LnBkZg==,draft",
+	})
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("create: expected 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+	loc := rr.Header().Get("Location")
+	if !strings.HasPrefix(loc, "/api/v1/uploads/") {
+		t.Fatalf("Location = %q", loc)
+	}
+	if rr.Header().Get("Upload-Expires") == "" {
+		t.Error("create response has no Upload-Expires")
+	}
+	return loc
+}
+
+func readFile(t *testing.T, store storage.Storage, path string) string {
+	t.Helper()
+	rc, err := store.Read(context.Background(), path)
+	if err != nil {
+		t.Fatalf("Read(%q): %v", path, err)
+	}
+	defer rc.Close()
+	data, _ := io.ReadAll(rc)
+	return string(data)
+}
+
+func TestTus_Options(t *testing.T) {
+	router, _ := newTusRouter(t)
+
+	req := httptest.NewRequest(http.MethodOptions, "/api/v1/uploads", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d", rr.Code)
+	}
+	want := map[string]string{
+		"Tus-Resumable": "1.0.0",
+		"Tus-Version":   "1.0.0",
+		"Tus-Extension": "creation,expiration,termination",
+		"Tus-Max-Size":  "1024",
+	}
+	for k, v := range want {
+		if got := rr.Header().Get(k); got != v {
+			t.Errorf("%s = %q, want %q", k, got, v)
+		}
+	}
+}
+
+func TestTus_UploadInChunks(t *testing.T) {
+	router, store := newTusRouter(t)
+	loc := createTusUpload(t, router, "/docs/report.pdf", 11)
+
+	rr := tusRequest(router, http.MethodHead, loc, "", nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("head: expected 200, got %d", rr.Code)
+	}
+	if got := rr.Header().Get("Upload-Offset"); got != "0" {
+		t.Errorf("Upload-Offset = %q, want 0", got)
+	}
+	if got := rr.Header().Get("Upload-Length"); got != "11" {
+		t.Errorf("Upload-Length = %q, want 11", got)
+	}
+	if got := rr.Header().Get("Upload-Metadata"); got != "draft,filename cmVwb3J0LnBkZg==" {
+		t.Errorf("Upload-Metadata = %q", got)
+	}
+	if got := rr.Header().Get("Cache-Control"); got != "no-store" {
+		t.Errorf("Cache-Control = %q, want no-store", got)
+	}
+
+	rr = tusRequest(router, http.MethodPatch, loc, "hello ", map[string]string{"Upload-Offset": "0"})
+	if rr.Code != http.StatusNoContent {
+		t.Fatalf("patch: expected 204, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if got := rr.Header().Get("Upload-Offset"); got != "6" {
+		t.Errorf("Upload-Offset after first chunk = %q, want 6", got)
+	}
+	if _, err := store.Stat(context.Background(), "docs/report.pdf"); err == nil {
+		t.Error("file is visible before the upload is complete")
+	}
+
+	rr = tusRequest(router, http.MethodPatch, loc, "world", map[string]string{"Upload-Offset": "6"})
+	if rr.Code != http.StatusNoContent {
+		t.Fatalf("patch: expected 204, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if got := readFile(t, store, "docs/report.pdf"); got != "hello world" {
+		t.Errorf("stored %q, want %q", got, "hello world")
+	}
+
+	// A committed upload is gone.
+	if rr := tusRequest(router, http.MethodHead, loc, "", nil); rr.Code != http.StatusNotFound {
+		t.Errorf("head after completion: expected 404, got %d", rr.Code)
+	}
+}
+
+func TestTus_EmptyUpload(t *testing.T) {
+	router, store := newTusRouter(t)
+	createTusUpload(t, router, "/empty.txt", 0)
+
+	if got := readFile(t, store, "empty.txt"); got != "" {
+		t.Errorf("stored %q, want empty file", got)
+	}
+}
+
+func TestTus_Terminate(t *testing.T) {
+	router, _ := newTusRouter(t)
+	loc := createTusUpload(t, router, "/a.txt", 10)
+
+	if rr := tusRequest(router, http.MethodDelete, loc, "", nil); rr.Code != http.StatusNoContent {
+		t.Fatalf("delete: expected 204, got %d", rr.Code)
+	}
+	if rr := tusRequest(router, http.MethodHead, loc, "", nil); rr.Code != http.StatusNotFound {
+		t.Errorf("head after delete: expected 404, got %d", rr.Code)
+	}
+	if rr := tusRequest(router, http.MethodDelete, loc, "", nil); rr.Code != http.StatusNotFound {
+		t.Errorf("second delete: expected 404, got %d", rr.Code)
+	}
+}
+
+func TestTus_CreateErrors(t *testing.T) {
+	router, store := newTusRouter(t)
+	store.Mkdir(context.Background(), "dir")
+
+	tests := []struct {
+		name   string
+		target string
+		header map[string]string
+		want   int
+	}{
+		{"missing path", "/api/v1/uploads", map[string]string{"Upload-Length": "5"}, http.StatusBadRequest},
+		{"missing length", "/api/v1/uploads?path=a.txt", nil, http.StatusBadRequest},
+		{"deferred length", "/api/v1/uploads?path=a.txt", map[string]string{"Upload-Defer-Length": "1"}, http.StatusBadRequest},
+		{"negative length", "/api/v1/uploads?path=a.txt", map[string]string{"Upload-Length": "-1"}, http.StatusBadRequest},
+		{"too large", "/api/v1/uploads?path=a.txt", map[string]string{"Upload-Length": "1025"}, http.StatusRequestEntityTooLarge},
+		{"bad metadata", "/api/v1/uploads?path=a.txt", map[string]string{"Upload-Length": "5", "Upload-Metadata": "name !!!"}, http.StatusBadRequest},
+		{"directory target", "/api/v1/uploads?path=dir", map[string]string{"Upload-Length": "5"}, http.StatusConflict},
+		{"traversal", "/api/v1/uploads?path=../etc/passwd", map[string]string{"Upload-Length": "5"}, http.StatusBadRequest},
+		{"wrong version", "/api/v1/uploads?path=a.txt", map[string]string{"Upload-Length": "5", "Tus-Resumable": "0.2.2"}, http.StatusPreconditionFailed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := tusRequest(router, http.MethodPost, tt.target, "", tt.header)
+			if rr.Code != tt.want {
+				t.Errorf("expected %d, got %d: %s", tt.want, rr.Code, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestTus_PatchErrors(t *testing.T) {
+	router, _ := newTusRouter(t)
+	loc := createTusUpload(t, router, "/a.txt", 5)
+
+	tests := []struct {
+		name   string
+		target string
+		body   string
+		header map[string]string
+		want   int
+	}{
+		{"wrong offset", loc, "abc", map[string]string{"Upload-Offset": "2"}, http.StatusConflict},
+		{"missing offset", loc, "abc", map[string]string{"Upload-Offset": ""}, http.StatusBadRequest},
+		{"wrong content type", loc, "abc", map[string]string{"Upload-Offset": "0", "Content-Type": "text/plain"}, http.StatusUnsupportedMediaType},
+		{"past the length", loc, "abcdef", map[string]string{"Upload-Offset": "0"}, http.StatusRequestEntityTooLarge},
+		{"unknown upload", "/api/v1/uploads/" + strings.Repeat("0", 32), "abc", map[string]string{"Upload-Offset": "0"}, http.StatusNotFound},
+		{"missing version", loc, "abc", map[string]string{"Upload-Offset": "0", "Tus-Resumable": ""}, http.StatusPreconditionFailed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := tusRequest(router, http.MethodPatch, tt.target, tt.body, tt.header)
+			if rr.Code != tt.want {
+				t.Errorf("expected %d, got %d: %s", tt.want, rr.Code, rr.Body.String())
+			}
+			if rr.Header().Get("Tus-Resumable") != tusVersion {
+				t.Error("response has no Tus-Resumable header")
+			}
+		})
+	}
+
+	// None of the failed requests stored anything.
+	rr := tusRequest(router, http.MethodHead, loc, "", nil)
+	if got := rr.Header().Get("Upload-Offset"); got != "0" {
+		t.Errorf("Upload-Offset after failed patches = %q, want 0", got)
+	}
+}
+
+func TestTus_RetryFailedCommit(t *testing.T) {
+	router, store := newTusRouter(t)
+	loc := createTusUpload(t, router, "/blocked/a.txt", 3)
+
+	// A file where the parent directory should be makes the commit fail.
+	store.Write(context.Background(), "blocked", strings.NewReader("x"))
+	rr := tusRequest(router, http.MethodPatch, loc, "abc", map[string]string{"Upload-Offset": "0"})
+	if rr.Code == http.StatusNoContent {
+		t.Fatal("patch succeeded although the commit cannot")
+	}
+
+	store.Delete(context.Background(), "blocked")
+	rr = tusRequest(router, http.MethodPatch, loc, "", map[string]string{"Upload-Offset": "3"})
+	if rr.Code != http.StatusNoContent {
+		t.Fatalf("retry: expected 204, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if got := readFile(t, store, "blocked/a.txt"); got != "abc" {
+		t.Errorf("stored %q, want %q", got, "abc")
+	}
+}
+
+func TestTus_RoutesNeedUploadStore(t *testing.T) {
+	router := newTestRouter()
+
+	rr := tusRequest(router, http.MethodPost, "/api/v1/uploads?path=a.txt", "", map[string]string{"Upload-Length": "5"})
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected 404 without an upload store, got %d", rr.Code)
+	}
+}
+
+func TestParseTusMetadata(t *testing.T) {
+	meta, err := parseTusMetadata("filename cmVwb3J0LnBkZg==, is_confidential ,type dGV4dC9wbGFpbg==")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta["filename"] != "report.pdf" || meta["type"] != "text/plain" {
+		t.Errorf("metadata = %v", meta)
+	}
+	if v, ok := meta["is_confidential"]; !ok || v != "" {
+		t.Errorf("key without value = %q, %v", v, ok)
+	}
+
+	for _, bad := range []string{"a b c", "a eA==,a eQ==", " , a"} {
+		if _, err := parseTusMetadata(bad); err == nil {
+			t.Errorf("parseTusMetadata(%q) succeeded", bad)
+		}
+	}
+}
@@ -0,0 +1,246 @@
+// Package auth authenticates API callers and checks what they may do.
+//
+// An Authenticator turns the credentials of a request into a Principal.
+// Middleware runs it for every request and stores the Principal in the
+// request context, and Check tests it against the operation and path a
+// handler is about to perform.
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+
+	"go-storage-api/internal/middleware"
+)
+
+var (
+	// ErrNoCredentials is returned by an Authenticator for a request that
+	// carries no credentials it recognizes.
+	ErrNoCredentials = errors.New("no credentials")
+	// ErrInvalidCredentials is returned for credentials that are malformed,
+	// unknown or expired.
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	// ErrForbidden is returned by Check for an operation the principal is
+	// not allowed to perform.
+	ErrForbidden = errors.New("forbidden")
+)
+
+// Operation is a kind of access to storage.
+type Operation string
+
+const (
+	Read   Operation = "read"
+	Write  Operation = "write"
+	Delete Operation = "delete"
+)
+
+// ParseOperation validates an operation name from configuration.
+func ParseOperation(s string) (Operation, error) {
+	switch op := Operation(s); op {
+	case Read, Write, Delete:
+		return op, nil
+	}
+	return "", fmt.Errorf("unknown operation %q (must be read, write or delete)", s)
+}
+
+// Principal IDs start with the kind of credentials the caller presented,
+// so an API key and a token subject of the same name are never taken for
+// the same caller by policy bindings or share links.
+const (
+	// KeyPrefix starts the ID of an API key's principal, as in "key:ci".
+	KeyPrefix = "key:"
+	// TokenPrefix starts the ID of a token's principal, followed by the
+	// issuer, "/" and the subject, as in
+	// "jwt:https://idp.example.com/alice".
+	TokenPrefix = "jwt:"
+)
+
+// Principal is an authenticated caller.
+type Principal struct {
+	// ID names the caller in logs, policy bindings and share links:
+	// KeyPrefix and the API key ID, or TokenPrefix, the token's issuer and
+	// its subject.
+	ID string
+	// Operations lists what the caller may do.
+	Operations []Operation
+	// Prefixes limits the caller to these paths and everything below
+	// them. Empty means the whole storage.
+	Prefixes []string
+	// MaxSize, if positive, caps the size of a single upload below the
+	// server's own limit.
+	MaxSize int64
+}
+
+// Allows reports whether p may perform op on the storage path name; "" is
+// the root.
+func (p *Principal) Allows(op Operation, name string) bool {
+	allowed := false
+	for _, o := range p.Operations {
+		allowed = allowed || o == op
+	}
+	if !allowed {
+		return false
+	}
+	if len(p.Prefixes) == 0 {
+		return true
+	}
+	name = Clean(name)
+	for _, prefix := range p.Prefixes {
+		if underPrefix(name, Clean(prefix)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Clean normalizes a storage path the way backends do: slash-separated,
+// without a leading slash, "" for the root.
+func Clean(name string) string {
+	return strings.TrimPrefix(path.Clean("/"+name), "/")
+}
+
+// underPrefix reports whether the cleaned path name is prefix or lies
+// below it. The root prefix "" covers everything.
+func underPrefix(name, prefix string) bool {
+	return prefix == "" || name == prefix || strings.HasPrefix(name, prefix+"/")
+}
+
+// Authenticator identifies the caller of a request.
+type Authenticator interface {
+	// Authenticate returns the caller's Principal, ErrNoCredentials if the
+	// request carries none this Authenticator understands, or an error
+	// wrapping ErrInvalidCredentials.
+	Authenticate(r *http.Request) (*Principal, error)
+}
+
+// Lookup is implemented by Authenticators that can find a principal by ID
+// without its credentials, as KeyStore can. Share links use it to check
+// that their creator is still allowed what the link grants.
+type Lookup interface {
+	// Lookup returns the principal with id as currently configured, and
+	// false if there is none.
+	Lookup(id string) (*Principal, bool)
+}
+
+// Any returns an Authenticator that tries each of authns in turn and
+// accepts the first Principal. If none recognizes the credentials, the
+// first error other than ErrNoCredentials is returned, so an expired token
+// is reported as such rather than as missing. It implements Lookup with
+// those of authns that do.
+func Any(authns ...Authenticator) Authenticator {
+	return anyAuthenticator(authns)
+}
+
+type anyAuthenticator []Authenticator
+
+func (a anyAuthenticator) Authenticate(r *http.Request) (*Principal, error) {
+	var first error
+	for _, authn := range a {
+		p, err := authn.Authenticate(r)
+		if err == nil {
+			return p, nil
+		}
+		if first == nil && !errors.Is(err, ErrNoCredentials) {
+			first = err
+		}
+	}
+	if first == nil {
+		return nil, ErrNoCredentials
+	}
+	return nil, first
+}
+
+func (a anyAuthenticator) Lookup(id string) (*Principal, bool) {
+	for _, authn := range a {
+		if l, ok := authn.(Lookup); ok {
+			if p, found := l.Lookup(id); found {
+				return p, true
+			}
+		}
+	}
+	return nil, false
+}
+
+type contextKey struct{}
+
+// WithPrincipal returns a copy of ctx carrying p.
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, contextKey{}, p)
+}
+
+// FromContext returns the Principal stored by Middleware, or nil if the
+// request was not authenticated.
+func FromContext(ctx context.Context) *Principal {
+	p, _ := ctx.Value(contextKey{}).(*Principal)
+	return p
+}
+
+// Check returns ErrForbidden unless the request's principal may perform op
+// on name. Requests without a principal pass: authentication is either off
+// or was already enforced by Middleware.
+func Check(ctx context.Context, op Operation, name string) error {
+	p := FromContext(ctx)
+	if p == nil || p.Allows(op, name) {
+		return nil
+	}
+	return fmt.Errorf("%w: %s not permitted on /%s", ErrForbidden, op, Clean(name))
+}
+
+// Credential returns the token of a request from the Authorization header
+// ("Bearer <token>") or the X-API-Key header, or "" if it has neither.
+func Credential(r *http.Request) string {
+	if scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " "); ok && strings.EqualFold(scheme, "Bearer") {
+		return strings.TrimSpace(token)
+	}
+	return strings.TrimSpace(r.Header.Get("X-API-Key"))
+}
+
+// Middleware authenticates every request with authn, except for the exact
+// URL paths listed in public. Requests without valid credentials get 401;
+// otherwise the Principal is stored in the context for Check, and its ID
+// for logging with middleware.WithPrincipal.
+func Middleware(authn Authenticator, public ...string) middleware.Middleware {
+	open := make(map[string]bool, len(public))
+	for _, p := range public {
+		open[p] = true
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if open[r.URL.Path] {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			p, err := authn.Authenticate(r)
+			if err != nil {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="go-storage-api"`)
+				msg := "authentication required"
+				if !errors.Is(err, ErrNoCredentials) {
+					msg = "invalid credentials"
+				}
+				writeError(w, http.StatusUnauthorized, msg)
+				return
+			}
+
+			ctx := middleware.WithPrincipal(r.Context(), p.ID)
+			next.ServeHTTP(w, r.WithContext(WithPrincipal(ctx, p)))
+		})
+	}
+}
+
+// errorResponse mirrors the api.ErrorResponse JSON shape, as in package
+// middleware.
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(errorResponse{Error: msg})
+}
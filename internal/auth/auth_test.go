@@ -0,0 +1,194 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go-storage-api/internal/middleware"
+)
+
+func discardLogger() *slog.Logger {
+	return slog.New(slog.NewJSONHandler(io.Discard, nil))
+}
+
+// --- Principal ---
+
+func TestPrincipal_Allows(t *testing.T) {
+	p := &Principal{
+		ID:         "ci",
+		Operations: []Operation{Read, Write},
+		Prefixes:   []string{"/builds", "shared/"},
+	}
+
+	tests := []struct {
+		op   Operation
+		path string
+		want bool
+	}{
+		{Read, "builds", true},
+		{Read, "/builds/app.tar", true},
+		{Write, "builds/nested/deep/file", true},
+		{Write, "shared/x", true},
+		{Read, "buildsX/file", false},
+		{Read, "other/file", false},
+		{Read, "", false},
+		{Read, "/builds/../other", false},
+		{Delete, "builds/app.tar", false},
+	}
+	for _, tt := range tests {
+		if got := p.Allows(tt.op, tt.path); got != tt.want {
+			t.Errorf("Allows(%s, %q) = %v, want %v", tt.op, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestPrincipal_AllowsEverywhereWithoutPrefixes(t *testing.T) {
+	p := &Principal{ID: "admin", Operations: []Operation{Read}}
+	for _, path := range []string{"", "/", "a/b/c"} {
+		if !p.Allows(Read, path) {
+			t.Errorf("expected read on %q to be allowed", path)
+		}
+	}
+	if p.Allows(Write, "a") {
+		t.Error("expected write to be denied without the write scope")
+	}
+}
+
+func TestCheck(t *testing.T) {
+	if err := Check(context.Background(), Delete, "anything"); err != nil {
+		t.Errorf("expected requests without a principal to pass, got %v", err)
+	}
+
+	ctx := WithPrincipal(context.Background(), &Principal{ID: "r", Operations: []Operation{Read}, Prefixes: []string{"docs"}})
+	if err := Check(ctx, Read, "docs/a.txt"); err != nil {
+		t.Errorf("expected read on docs/a.txt to pass, got %v", err)
+	}
+	err := Check(ctx, Write, "docs/a.txt")
+	if !errors.Is(err, ErrForbidden) {
+		t.Fatalf("expected ErrForbidden, got %v", err)
+	}
+	if want := "forbidden: write not permitted on /docs/a.txt"; err.Error() != want {
+		t.Errorf("expected %q, got %q", want, err.Error())
+	}
+}
+
+// --- Credential ---
+
+func TestCredential(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		value  string
+		want   string
+	}{
+		{"bearer", "Authorization", "Bearer abc123", "abc123"},
+		{"bearer lowercase", "Authorization", "bearer abc123", "abc123"},
+		{"basic ignored", "Authorization", "Basic dXNlcjpwYXNz", ""},
+		{"api key header", "X-API-Key", " abc123 ", "abc123"},
+		{"none", "", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.header != "" {
+				req.Header.Set(tt.header, tt.value)
+			}
+			if got := Credential(req); got != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+// --- Middleware ---
+
+type authenticatorFunc func(r *http.Request) (*Principal, error)
+
+func (f authenticatorFunc) Authenticate(r *http.Request) (*Principal, error) { return f(r) }
+
+func TestMiddleware_StoresPrincipal(t *testing.T) {
+	want := &Principal{ID: "ci", Operations: []Operation{Read}}
+	authn := authenticatorFunc(func(*http.Request) (*Principal, error) { return want, nil })
+
+	var got *Principal
+	var logged string
+	// Logging installs the holder that WithPrincipal fills in.
+	handler := middleware.Chain(middleware.Logging(discardLogger()), Middleware(authn))(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got = FromContext(r.Context())
+			logged = middleware.PrincipalFromContext(r.Context())
+		}),
+	)
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/v1/files", nil))
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rr.Code)
+	}
+	if got != want {
+		t.Errorf("expected principal %+v in context, got %+v", want, got)
+	}
+	if logged != "ci" {
+		t.Errorf("expected principal ID %q for logging, got %q", "ci", logged)
+	}
+}
+
+func TestMiddleware_Rejects(t *testing.T) {
+	tests := []struct {
+		name    string
+		err     error
+		wantMsg string
+	}{
+		{"no credentials", ErrNoCredentials, "authentication required"},
+		{"invalid credentials", ErrInvalidCredentials, "invalid credentials"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			authn := authenticatorFunc(func(*http.Request) (*Principal, error) { return nil, tt.err })
+			called := false
+			handler := Middleware(authn)(http.HandlerFunc(func(http.ResponseWriter, *http.Request) { called = true }))
+
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/v1/files", nil))
+
+			if called {
+				t.Error("expected handler not to be called")
+			}
+			if rr.Code != http.StatusUnauthorized {
+				t.Errorf("expected 401, got %d", rr.Code)
+			}
+			if rr.Header().Get("WWW-Authenticate") == "" {
+				t.Error("expected WWW-Authenticate header")
+			}
+			var body errorResponse
+			json.NewDecoder(rr.Body).Decode(&body)
+			if body.Error != tt.wantMsg {
+				t.Errorf("expected error %q, got %q", tt.wantMsg, body.Error)
+			}
+		})
+	}
+}
+
+func TestMiddleware_PublicPaths(t *testing.T) {
+	authn := authenticatorFunc(func(*http.Request) (*Principal, error) { return nil, ErrNoCredentials })
+	handler := Middleware(authn, "/api/v1/health")(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/v1/health", nil))
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected 200 for public path, got %d", rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/v1/health/x", nil))
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 below public path, got %d", rr.Code)
+	}
+}
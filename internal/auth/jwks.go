@@ -0,0 +1,279 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// jwksMaxSize caps the size of a key set document.
+const jwksMaxSize = 1 << 20
+
+// jwksMinRefresh is the least time between two fetches of a key set, so
+// tokens with unknown key IDs cannot make every request refetch it.
+const jwksMinRefresh = time.Minute
+
+// jwksFetchTimeout bounds a single fetch of a key set.
+const jwksFetchTimeout = 10 * time.Second
+
+// JWKS is a JSON Web Key Set read from a file or fetched from a URL, such as
+// an OIDC provider's jwks_uri. Keys are cached and refetched once the cache
+// is older than the refresh interval, or earlier when a token names a key ID
+// the cache does not hold, so keys rotated by the provider are picked up
+// without a restart. If a refetch fails, the cached keys stay in use.
+//
+// Refetches run in the background, one at a time and without holding the
+// cache, so tokens with known keys are verified while the provider answers.
+type JWKS struct {
+	source  string
+	refresh time.Duration
+	client  *http.Client
+	now     func() time.Time
+
+	mu        sync.Mutex
+	keys      []jwk
+	fetched   time.Time     // last successful fetch
+	attempted time.Time     // last fetch, successful or not
+	fetching  chan struct{} // closed when the running refetch ends; nil if none
+}
+
+// jwk is a verification key from a key set.
+type jwk struct {
+	id  string
+	alg string // "" if the set does not restrict it
+	key crypto.PublicKey
+}
+
+// LoadJWKS reads the key set at source, a file path or an http(s) URL, and
+// refetches it every refresh.
+func LoadJWKS(ctx context.Context, source string, refresh time.Duration) (*JWKS, error) {
+	s := &JWKS{
+		source:  source,
+		refresh: refresh,
+		client:  &http.Client{Timeout: jwksFetchTimeout},
+		now:     time.Now,
+	}
+	s.attempted = s.now()
+	keys, err := s.load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	s.keys, s.fetched = keys, s.attempted
+	return s, nil
+}
+
+// Keys returns the keys that may have signed a token with key ID kid and
+// algorithm alg. A token without a key ID may match any key. If no cached
+// key matches, Keys waits for a refetch, or until ctx is done.
+func (s *JWKS) Keys(ctx context.Context, kid, alg string) ([]crypto.PublicKey, error) {
+	s.mu.Lock()
+	keys := s.match(kid, alg)
+	var done <-chan struct{}
+	if len(keys) == 0 || s.now().Sub(s.fetched) >= s.refresh {
+		done = s.refetch()
+	}
+	s.mu.Unlock()
+
+	if len(keys) == 0 && done != nil {
+		select {
+		case <-done:
+			s.mu.Lock()
+			keys = s.match(kid, alg)
+			s.mu.Unlock()
+		case <-ctx.Done():
+		}
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("%w: no key %q for %s", ErrInvalidCredentials, kid, alg)
+	}
+	return keys, nil
+}
+
+func (s *JWKS) match(kid, alg string) []crypto.PublicKey {
+	var keys []crypto.PublicKey
+	for _, k := range s.keys {
+		if (kid == "" || k.id == kid) && (k.alg == "" || k.alg == alg) {
+			keys = append(keys, k.key)
+		}
+	}
+	return keys
+}
+
+// refetch starts a background fetch of the key set unless one is running
+// or the last one began less than jwksMinRefresh ago. It returns a channel
+// closed when the running fetch ends, or nil if there is none. The caller
+// holds s.mu.
+//
+// The fetch does not use a request's context: a client going away must not
+// fail it and so hold off the next attempt for jwksMinRefresh.
+func (s *JWKS) refetch() <-chan struct{} {
+	if s.fetching != nil {
+		return s.fetching
+	}
+	now := s.now()
+	if now.Sub(s.attempted) < jwksMinRefresh {
+		return nil
+	}
+	s.attempted = now
+	done := make(chan struct{})
+	s.fetching = done
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), jwksFetchTimeout)
+		defer cancel()
+		keys, err := s.load(ctx)
+
+		s.mu.Lock()
+		// On failure the old keys are kept; a provider outage should not
+		// lock out tokens signed with keys already known.
+		if err == nil {
+			s.keys, s.fetched = keys, now
+		}
+		s.fetching = nil
+		s.mu.Unlock()
+		close(done)
+	}()
+	return done
+}
+
+// load reads and parses the current key set.
+func (s *JWKS) load(ctx context.Context) ([]jwk, error) {
+	data, err := s.read(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("read JWKS %s: %w", s.source, err)
+	}
+	keys, err := parseJWKS(data)
+	if err != nil {
+		return nil, fmt.Errorf("parse JWKS %s: %w", s.source, err)
+	}
+	return keys, nil
+}
+
+func (s *JWKS) read(ctx context.Context) ([]byte, error) {
+	if !strings.HasPrefix(s.source, "https://") && !strings.HasPrefix(s.source, "http://") {
+		return os.ReadFile(s.source)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.source, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/jwk-set+json, application/json")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, jwksMaxSize))
+}
+
+// parseJWKS decodes a key set. Keys for encryption and of unsupported types
+// are skipped, as providers publish those alongside signing keys; a set
+// without any usable key is an error.
+func parseJWKS(data []byte) ([]jwk, error) {
+	var set struct {
+		Keys []json.RawMessage `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, err
+	}
+
+	var keys []jwk
+	for i, raw := range set.Keys {
+		var k struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Use string `json:"use"`
+			Alg string `json:"alg"`
+			Crv string `json:"crv"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		}
+		if err := json.Unmarshal(raw, &k); err != nil {
+			return nil, fmt.Errorf("key %d: %w", i, err)
+		}
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+
+		var (
+			key crypto.PublicKey
+			err error
+		)
+		switch {
+		case k.Kty == "RSA":
+			key, err = rsaKey(k.N, k.E)
+		case k.Kty == "EC" && k.Crv == "P-256":
+			key, err = p256Key(k.X, k.Y)
+		case k.Kty == "OKP" && k.Crv == "Ed25519":
+			key, err = ed25519Key(k.X)
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", k.Kid, err)
+		}
+		keys = append(keys, jwk{id: k.Kid, alg: k.Alg, key: key})
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("no RSA, P-256 or Ed25519 signing keys")
+	}
+	return keys, nil
+}
+
+func rsaKey(n, e string) (crypto.PublicKey, error) {
+	nb, err := base64.RawURLEncoding.DecodeString(n)
+	if err != nil {
+		return nil, fmt.Errorf("invalid modulus: %w", err)
+	}
+	eb, err := base64.RawURLEncoding.DecodeString(e)
+	if err != nil || len(eb) == 0 || len(eb) > 4 {
+		return nil, errors.New("invalid exponent")
+	}
+	key := &rsa.PublicKey{N: new(big.Int).SetBytes(nb), E: int(new(big.Int).SetBytes(eb).Int64())}
+	if key.N.BitLen() < 2048 {
+		return nil, errors.New("RSA keys must have at least 2048 bits")
+	}
+	return key, nil
+}
+
+func p256Key(x, y string) (crypto.PublicKey, error) {
+	xb, errX := base64.RawURLEncoding.DecodeString(x)
+	yb, errY := base64.RawURLEncoding.DecodeString(y)
+	if errX != nil || errY != nil || len(xb) != 32 || len(yb) != 32 {
+		return nil, errors.New("invalid P-256 coordinates")
+	}
+	// crypto/ecdh rejects points that are not on the curve.
+	if _, err := ecdh.P256().NewPublicKey(append(append([]byte{4}, xb...), yb...)); err != nil {
+		return nil, err
+	}
+	return &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(xb), Y: new(big.Int).SetBytes(yb)}, nil
+}
+
+func ed25519Key(x string) (crypto.PublicKey, error) {
+	xb, err := base64.RawURLEncoding.DecodeString(x)
+	if err != nil || len(xb) != ed25519.PublicKeySize {
+		return nil, errors.New("invalid Ed25519 key")
+	}
+	return ed25519.PublicKey(xb), nil
+}
@@ -0,0 +1,143 @@
+package auth
+
+import (
+	"crypto"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// jwtLeeway is the clock skew tolerated when checking exp and nbf.
+const jwtLeeway = 30 * time.Second
+
+// jwtMethods are the accepted signature algorithms. HMAC and "none" are
+// left out on purpose: a key set only holds public keys.
+var jwtMethods = []string{"RS256", "ES256", "EdDSA"}
+
+// JWTOptions configures a JWTAuthenticator.
+type JWTOptions struct {
+	// Issuer must equal the token's iss claim.
+	Issuer string
+	// Audience must be one of the token's aud values.
+	Audience string
+	// ScopeClaim names the claim holding the granted operations, either a
+	// space-separated string, as in OAuth's scope, or an array.
+	ScopeClaim string
+	// ScopePrefix is stripped from scope values before they are matched
+	// against read, write and delete, so "storage:read" can grant read.
+	// Values without it are ignored.
+	ScopePrefix string
+	// PrefixesClaim names the claim holding the path prefixes the token is
+	// limited to, as a string or an array. Without the claim the token
+	// covers the whole storage.
+	PrefixesClaim string
+}
+
+// JWTAuthenticator authenticates requests by a signed JWT in the
+// Authorization header, such as an OIDC access token. The Principal's ID
+// is TokenPrefix, the issuer, "/" and the subject.
+type JWTAuthenticator struct {
+	keys   *JWKS
+	opts   JWTOptions
+	parser *jwt.Parser
+}
+
+// NewJWTAuthenticator verifies tokens with keys and checks their claims
+// against opts. Issuer, Audience and ScopeClaim are required.
+func NewJWTAuthenticator(keys *JWKS, opts JWTOptions) (*JWTAuthenticator, error) {
+	if opts.Issuer == "" || opts.Audience == "" || opts.ScopeClaim == "" {
+		return nil, errors.New("issuer, audience and scope claim are required")
+	}
+	a := &JWTAuthenticator{keys: keys, opts: opts}
+	a.parser = jwt.NewParser(
+		jwt.WithValidMethods(jwtMethods),
+		jwt.WithIssuer(opts.Issuer),
+		jwt.WithAudience(opts.Audience),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(jwtLeeway),
+		jwt.WithTimeFunc(func() time.Time { return keys.now() }),
+	)
+	return a, nil
+}
+
+// Authenticate verifies the bearer token. Anything that is not shaped like
+// a JWT is reported as ErrNoCredentials, so an API key in the same header
+// can be tried by another Authenticator.
+func (a *JWTAuthenticator) Authenticate(r *http.Request) (*Principal, error) {
+	token := Credential(r)
+	if strings.Count(token, ".") != 2 {
+		return nil, ErrNoCredentials
+	}
+
+	claims := jwt.MapClaims{}
+	_, err := a.parser.ParseWithClaims(token, claims, func(t *jwt.Token) (any, error) {
+		kid, _ := t.Header["kid"].(string)
+		keys, err := a.keys.Keys(r.Context(), kid, t.Method.Alg())
+		if err != nil {
+			return nil, err
+		}
+		return verificationKeys(keys), nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidCredentials, err)
+	}
+
+	sub, err := claims.GetSubject()
+	if err != nil || sub == "" {
+		return nil, fmt.Errorf("%w: token has no subject", ErrInvalidCredentials)
+	}
+	p := &Principal{ID: TokenPrefix + a.opts.Issuer + "/" + sub}
+	for _, v := range stringsClaim(claims, a.opts.ScopeClaim) {
+		name, ok := strings.CutPrefix(v, a.opts.ScopePrefix)
+		if !ok {
+			continue
+		}
+		// Other scopes, such as openid or profile, are not ours to judge.
+		if op, err := ParseOperation(name); err == nil {
+			p.Operations = append(p.Operations, op)
+		}
+	}
+	if a.opts.PrefixesClaim != "" {
+		if _, ok := claims[a.opts.PrefixesClaim]; ok {
+			p.Prefixes = stringsClaim(claims, a.opts.PrefixesClaim)
+			if len(p.Prefixes) == 0 {
+				// An empty list limits the token to nothing, not to
+				// everything.
+				return nil, fmt.Errorf("%w: %s claim is empty or malformed", ErrInvalidCredentials, a.opts.PrefixesClaim)
+			}
+		}
+	}
+	return p, nil
+}
+
+func verificationKeys(keys []crypto.PublicKey) jwt.VerificationKeySet {
+	set := jwt.VerificationKeySet{Keys: make([]jwt.VerificationKey, len(keys))}
+	for i, k := range keys {
+		set.Keys[i] = k
+	}
+	return set
+}
+
+// stringsClaim reads a claim that is either a space-separated string or an
+// array of strings. Anything else yields nothing.
+func stringsClaim(claims jwt.MapClaims, name string) []string {
+	switch v := claims[name].(type) {
+	case string:
+		return strings.Fields(v)
+	case []any:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			s, ok := item.(string)
+			if !ok {
+				return nil
+			}
+			values = append(values, s)
+		}
+		return values
+	}
+	return nil
+}
@@ -0,0 +1,507 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	testIssuer   = "https://idp.example.com"
+	testAudience = "storage-api"
+)
+
+// signingKey is a private key with the JWK of its public half.
+type signingKey struct {
+	kid    string
+	method jwt.SigningMethod
+	priv   crypto.Signer
+}
+
+func newSigningKeys(t *testing.T) (rs, es, ed signingKey) {
+	t.Helper()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signingKey{"rs", jwt.SigningMethodRS256, rsaKey},
+		signingKey{"es", jwt.SigningMethodES256, ecKey},
+		signingKey{"ed", jwt.SigningMethodEdDSA, edKey}
+}
+
+func (k signingKey) jwk() map[string]string {
+	b64 := base64.RawURLEncoding.EncodeToString
+	switch pub := k.priv.Public().(type) {
+	case *rsa.PublicKey:
+		return map[string]string{"kty": "RSA", "kid": k.kid, "use": "sig", "n": b64(pub.N.Bytes()), "e": b64(big.NewInt(int64(pub.E)).Bytes())}
+	case *ecdsa.PublicKey:
+		return map[string]string{"kty": "EC", "kid": k.kid, "crv": "P-256", "x": b64(pub.X.FillBytes(make([]byte, 32))), "y": b64(pub.Y.FillBytes(make([]byte, 32)))}
+	case ed25519.PublicKey:
+		return map[string]string{"kty": "OKP", "kid": k.kid, "crv": "Ed25519", "alg": "EdDSA", "x": b64(pub)}
+	}
+	panic("unsupported key")
+}
+
+func jwksJSON(t *testing.T, keys ...signingKey) []byte {
+	t.Helper()
+	set := map[string][]map[string]string{"keys": {}}
+	for _, k := range keys {
+		set["keys"] = append(set["keys"], k.jwk())
+	}
+	data, err := json.Marshal(set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func (k signingKey) sign(t *testing.T, claims jwt.MapClaims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(k.method, claims)
+	token.Header["kid"] = k.kid
+	s, err := token.SignedString(k.priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// testClock is a settable time source for JWKS.now.
+type testClock struct {
+	mu sync.Mutex
+	t  time.Time
+}
+
+func (c *testClock) now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.t
+}
+
+func (c *testClock) advance(d time.Duration) {
+	c.mu.Lock()
+	c.t = c.t.Add(d)
+	c.mu.Unlock()
+}
+
+// newTestJWKS loads keys from a file and sets its clock to clock.
+func newTestJWKS(t *testing.T, clock *testClock, keys ...signingKey) *JWKS {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(path, jwksJSON(t, keys...), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	jwks, err := LoadJWKS(context.Background(), path, time.Hour)
+	if err != nil {
+		t.Fatalf("LoadJWKS: %v", err)
+	}
+	jwks.now = clock.now
+	return jwks
+}
+
+func newTestJWTAuthenticator(t *testing.T, jwks *JWKS) *JWTAuthenticator {
+	t.Helper()
+	a, err := NewJWTAuthenticator(jwks, JWTOptions{
+		Issuer:        testIssuer,
+		Audience:      testAudience,
+		ScopeClaim:    "scope",
+		ScopePrefix:   "storage:",
+		PrefixesClaim: "storage_prefixes",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+func validClaims(now time.Time) jwt.MapClaims {
+	return jwt.MapClaims{
+		"iss":   testIssuer,
+		"aud":   testAudience,
+		"sub":   "alice",
+		"exp":   now.Add(5 * time.Minute).Unix(),
+		"scope": "openid storage:read storage:write",
+	}
+}
+
+func bearer(token string) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/files", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	return req
+}
+
+// --- JWTAuthenticator ---
+
+func TestJWT_Algorithms(t *testing.T) {
+	clock := &testClock{t: time.Now()}
+	rs, es, ed := newSigningKeys(t)
+	a := newTestJWTAuthenticator(t, newTestJWKS(t, clock, rs, es, ed))
+
+	for _, k := range []signingKey{rs, es, ed} {
+		t.Run(k.method.Alg(), func(t *testing.T) {
+			p, err := a.Authenticate(bearer(k.sign(t, validClaims(clock.now()))))
+			if err != nil {
+				t.Fatalf("Authenticate: %v", err)
+			}
+			if want := "jwt:https://idp.example.com/alice"; p.ID != want {
+				t.Errorf("expected ID %q, got %q", want, p.ID)
+			}
+			if !p.Allows(Write, "any/path") || p.Allows(Delete, "any/path") {
+				t.Errorf("unexpected operations %v", p.Operations)
+			}
+		})
+	}
+}
+
+func TestJWT_Rejects(t *testing.T) {
+	clock := &testClock{t: time.Now()}
+	rs, es, _ := newSigningKeys(t)
+	a := newTestJWTAuthenticator(t, newTestJWKS(t, clock, rs))
+	now := clock.now()
+
+	with := func(key, value any) jwt.MapClaims {
+		c := validClaims(now)
+		if value == nil {
+			delete(c, key.(string))
+		} else {
+			c[key.(string)] = value
+		}
+		return c
+	}
+	hmac := jwt.NewWithClaims(jwt.SigningMethodHS256, validClaims(now))
+	hmacToken, _ := hmac.SignedString([]byte("shared"))
+	none := jwt.NewWithClaims(jwt.SigningMethodNone, validClaims(now))
+	noneToken, _ := none.SignedString(jwt.UnsafeAllowNoneSignatureType)
+	// Signed by a key that is not in the set, but claiming the known ID.
+	impostor := signingKey{"rs", jwt.SigningMethodES256, es.priv}
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"wrong issuer", rs.sign(t, with("iss", "https://evil.example.com"))},
+		{"wrong audience", rs.sign(t, with("aud", "other-api"))},
+		{"expired", rs.sign(t, with("exp", now.Add(-time.Minute).Unix()))},
+		{"no expiry", rs.sign(t, with("exp", nil))},
+		{"not yet valid", rs.sign(t, with("nbf", now.Add(time.Hour).Unix()))},
+		{"no subject", rs.sign(t, with("sub", nil))},
+		{"empty prefixes", rs.sign(t, with("storage_prefixes", []string{}))},
+		{"unknown key", es.sign(t, validClaims(now))},
+		{"wrong key for kid", impostor.sign(t, validClaims(now))},
+		{"hmac", hmacToken},
+		{"none", noneToken},
+		{"garbage", "a.b.c"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := a.Authenticate(bearer(tt.token))
+			if !errors.Is(err, ErrInvalidCredentials) {
+				t.Errorf("expected ErrInvalidCredentials, got %v", err)
+			}
+		})
+	}
+}
+
+func TestJWT_NotAToken(t *testing.T) {
+	clock := &testClock{t: time.Now()}
+	rs, _, _ := newSigningKeys(t)
+	a := newTestJWTAuthenticator(t, newTestJWKS(t, clock, rs))
+
+	for _, token := range []string{"", "plain-api-key"} {
+		if _, err := a.Authenticate(bearer(token)); !errors.Is(err, ErrNoCredentials) {
+			t.Errorf("Authenticate(%q): expected ErrNoCredentials, got %v", token, err)
+		}
+	}
+}
+
+func TestJWT_Claims(t *testing.T) {
+	clock := &testClock{t: time.Now()}
+	rs, _, _ := newSigningKeys(t)
+	a := newTestJWTAuthenticator(t, newTestJWKS(t, clock, rs))
+
+	claims := validClaims(clock.now())
+	claims["scope"] = []string{"storage:read", "storage:delete", "write", "storage:admin"}
+	claims["storage_prefixes"] = []string{"/teams/a", "shared"}
+	claims["aud"] = []string{"other-api", testAudience}
+
+	p, err := a.Authenticate(bearer(rs.sign(t, claims)))
+	if err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	if len(p.Operations) != 2 || p.Operations[0] != Read || p.Operations[1] != Delete {
+		t.Errorf("expected read and delete, got %v", p.Operations)
+	}
+	if !p.Allows(Delete, "teams/a/x") || !p.Allows(Read, "shared") || p.Allows(Read, "teams/b") {
+		t.Errorf("unexpected prefixes %v", p.Prefixes)
+	}
+
+	claims["storage_prefixes"] = "/teams/a"
+	p, err = a.Authenticate(bearer(rs.sign(t, claims)))
+	if err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	if len(p.Prefixes) != 1 || p.Prefixes[0] != "/teams/a" {
+		t.Errorf("expected a single prefix from a string claim, got %v", p.Prefixes)
+	}
+}
+
+func TestNewJWTAuthenticator_RequiresClaims(t *testing.T) {
+	if _, err := NewJWTAuthenticator(&JWKS{}, JWTOptions{Issuer: testIssuer, ScopeClaim: "scope"}); err == nil {
+		t.Error("expected error without audience")
+	}
+}
+
+// --- JWKS ---
+
+func TestJWKS_Rotation(t *testing.T) {
+	rs, es, _ := newSigningKeys(t)
+
+	var mu sync.Mutex
+	current := jwksJSON(t, rs)
+	fetches := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		fetches++
+		if current == nil {
+			http.Error(w, "down", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write(current)
+	}))
+	defer srv.Close()
+	setKeys := func(data []byte) {
+		mu.Lock()
+		current = data
+		mu.Unlock()
+	}
+	fetched := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return fetches
+	}
+
+	jwks, err := LoadJWKS(context.Background(), srv.URL, time.Hour)
+	if err != nil {
+		t.Fatalf("LoadJWKS: %v", err)
+	}
+	clock := &testClock{t: time.Now()}
+	jwks.now = clock.now
+	a := newTestJWTAuthenticator(t, jwks)
+
+	// The provider rotates to a new key. A token with the new key ID
+	// triggers a refetch, but not more often than jwksMinRefresh.
+	setKeys(jwksJSON(t, es))
+	clock.advance(jwksMinRefresh)
+	if _, err := a.Authenticate(bearer(es.sign(t, validClaims(clock.now())))); err != nil {
+		t.Fatalf("expected the rotated key to be fetched, got %v", err)
+	}
+	if _, err := a.Authenticate(bearer(rs.sign(t, validClaims(clock.now())))); err == nil {
+		t.Error("expected the retired key to be rejected")
+	}
+	if n := fetched(); n != 2 {
+		t.Errorf("expected 2 fetches, got %d", n)
+	}
+
+	// Once the cache is stale it is refetched in the background; if that
+	// fails, the cached keys stay valid.
+	setKeys(nil)
+	clock.advance(time.Hour)
+	if _, err := a.Authenticate(bearer(es.sign(t, validClaims(clock.now())))); err != nil {
+		t.Errorf("expected cached keys during an outage, got %v", err)
+	}
+	waitFetch(jwks)
+	if _, err := a.Authenticate(bearer(es.sign(t, validClaims(clock.now())))); err != nil {
+		t.Errorf("expected cached keys after a failed refetch, got %v", err)
+	}
+	if n := fetched(); n != 3 {
+		t.Errorf("expected 3 fetches, got %d", n)
+	}
+}
+
+func TestJWKS_SlowProvider(t *testing.T) {
+	rs, es, _ := newSigningKeys(t)
+
+	release := make(chan struct{})
+	requested := make(chan struct{}, 1)
+	var mu sync.Mutex
+	current := jwksJSON(t, rs)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		data := current
+		mu.Unlock()
+		if data == nil {
+			requested <- struct{}{}
+			<-release
+			data = jwksJSON(t, rs, es)
+		}
+		w.Write(data)
+	}))
+	defer srv.Close()
+
+	jwks, err := LoadJWKS(context.Background(), srv.URL, time.Hour)
+	if err != nil {
+		t.Fatalf("LoadJWKS: %v", err)
+	}
+	clock := &testClock{t: time.Now().Add(jwksMinRefresh)}
+	jwks.now = clock.now
+	a := newTestJWTAuthenticator(t, jwks)
+
+	mu.Lock()
+	current = nil
+	mu.Unlock()
+
+	// A request with an unknown key ID gives up when its client does,
+	// while the refetch it started goes on.
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() {
+		_, err := jwks.Keys(ctx, es.kid, es.method.Alg())
+		errc <- err
+	}()
+	<-requested
+
+	// Tokens with known keys do not wait for the provider.
+	if _, err := a.Authenticate(bearer(rs.sign(t, validClaims(clock.now())))); err != nil {
+		t.Errorf("expected a known key during a refetch, got %v", err)
+	}
+
+	cancel()
+	if err := <-errc; !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("expected ErrInvalidCredentials after the client left, got %v", err)
+	}
+	close(release)
+	waitFetch(jwks)
+
+	if _, err := a.Authenticate(bearer(es.sign(t, validClaims(clock.now())))); err != nil {
+		t.Errorf("expected the key from the finished refetch, got %v", err)
+	}
+}
+
+// waitFetch waits for the background fetch of jwks, if one is running.
+func waitFetch(jwks *JWKS) {
+	jwks.mu.Lock()
+	done := jwks.fetching
+	jwks.mu.Unlock()
+	if done != nil {
+		<-done
+	}
+}
+
+func TestParseJWKS(t *testing.T) {
+	rs, es, ed := newSigningKeys(t)
+	small, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	encKey := rs.jwk()
+	encKey["use"] = "enc"
+	set, _ := json.Marshal(map[string]any{"keys": []any{
+		encKey,
+		map[string]string{"kty": "EC", "crv": "P-384", "x": "AA", "y": "AA"},
+		map[string]string{"kty": "oct", "k": "c2VjcmV0"},
+		es.jwk(),
+		ed.jwk(),
+	}})
+	keys, err := parseJWKS(set)
+	if err != nil {
+		t.Fatalf("parseJWKS: %v", err)
+	}
+	if len(keys) != 2 || keys[0].id != "es" || keys[1].id != "ed" || keys[1].alg != "EdDSA" {
+		t.Errorf("expected the es and ed keys only, got %+v", keys)
+	}
+
+	invalid := []map[string]string{
+		signingKey{"small", jwt.SigningMethodRS256, small}.jwk(),
+		{"kty": "EC", "crv": "P-256", "x": es.jwk()["x"], "y": es.jwk()["x"]},
+		{"kty": "OKP", "crv": "Ed25519", "x": "AAAA"},
+	}
+	for _, k := range invalid {
+		set, _ := json.Marshal(map[string]any{"keys": []any{k}})
+		if _, err := parseJWKS(set); err == nil {
+			t.Errorf("expected error for %v", k)
+		}
+	}
+
+	if _, err := parseJWKS([]byte(`{"keys": []}`)); err == nil {
+		t.Error("expected error for a set without keys")
+	}
+}
+
+// --- Any ---
+
+func TestAny(t *testing.T) {
+	clock := &testClock{t: time.Now()}
+	rs, _, _ := newSigningKeys(t)
+	tokens := newTestJWTAuthenticator(t, newTestJWKS(t, clock, rs))
+	keys, err := NewKeyStore([]Key{{ID: "ci", Hash: HashKey("ci-secret"), Scopes: []string{"read"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := Any(tokens, keys)
+
+	if p, err := a.Authenticate(bearer("ci-secret")); err != nil || p.ID != "key:ci" {
+		t.Errorf("expected API key to authenticate, got %+v, %v", p, err)
+	}
+	if p, err := a.Authenticate(bearer(rs.sign(t, validClaims(clock.now())))); err != nil || p.ID != "jwt:https://idp.example.com/alice" {
+		t.Errorf("expected token to authenticate, got %+v, %v", p, err)
+	}
+
+	expired := validClaims(clock.now())
+	expired["exp"] = clock.now().Add(-time.Hour).Unix()
+	_, err = a.Authenticate(bearer(rs.sign(t, expired)))
+	if !errors.Is(err, ErrInvalidCredentials) || !errors.Is(err, jwt.ErrTokenExpired) {
+		t.Errorf("expected the token's error rather than the key store's, got %v", err)
+	}
+
+	if _, err := a.Authenticate(httptest.NewRequest(http.MethodGet, "/", nil)); !errors.Is(err, ErrNoCredentials) {
+		t.Errorf("expected ErrNoCredentials, got %v", err)
+	}
+
+	// Only the key store can look principals up.
+	l := a.(Lookup)
+	if p, ok := l.Lookup("key:ci"); !ok || p.ID != "key:ci" {
+		t.Errorf("expected the key store's principal, got %+v, %v", p, ok)
+	}
+	if _, ok := l.Lookup("jwt:https://idp.example.com/alice"); ok {
+		t.Error("expected token subjects not to be found")
+	}
+
+	// A token whose subject is a key ID is a different principal, and
+	// looking it up does not find the key.
+	claims := validClaims(clock.now())
+	claims["sub"] = "ci"
+	p, err := a.Authenticate(bearer(rs.sign(t, claims)))
+	if err != nil || p.ID != "jwt:https://idp.example.com/ci" {
+		t.Fatalf("expected the token's own principal, got %+v, %v", p, err)
+	}
+	if _, ok := l.Lookup(p.ID); ok {
+		t.Error("expected the token's principal not to be found as the key")
+	}
+}
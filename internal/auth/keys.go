@@ -0,0 +1,125 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// hashPrefix marks the hash algorithm of a stored key. Only SHA-256 is
+// supported: API keys are long random strings, not passwords, so a fast
+// hash does not make them guessable.
+const hashPrefix = "sha256:"
+
+// Key is one API key in a key file. The key itself is never stored, only
+// its hash.
+type Key struct {
+	ID string `json:"id"`
+	// Hash is "sha256:" followed by the hex SHA-256 of the key, as
+	// returned by HashKey.
+	Hash     string   `json:"hash"`
+	Scopes   []string `json:"scopes"`
+	Prefixes []string `json:"prefixes,omitempty"`
+}
+
+// HashKey returns the value stored in Key.Hash for key.
+func HashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hashPrefix + hex.EncodeToString(sum[:])
+}
+
+// KeyStore authenticates requests by API key.
+type KeyStore struct {
+	byHash map[string]*Principal
+	byID   map[string]*Principal
+}
+
+// NewKeyStore validates keys and indexes them by hash.
+func NewKeyStore(keys []Key) (*KeyStore, error) {
+	s := &KeyStore{byHash: make(map[string]*Principal, len(keys)), byID: make(map[string]*Principal, len(keys))}
+	for i, k := range keys {
+		if k.ID == "" {
+			return nil, fmt.Errorf("key %d: id is required", i+1)
+		}
+		if _, dup := s.byID[KeyPrefix+k.ID]; dup {
+			return nil, fmt.Errorf("key %q: duplicate id", k.ID)
+		}
+
+		digest, ok := strings.CutPrefix(k.Hash, hashPrefix)
+		if raw, err := hex.DecodeString(digest); !ok || err != nil || len(raw) != sha256.Size {
+			return nil, fmt.Errorf("key %q: hash must be %q followed by 64 hex digits", k.ID, hashPrefix)
+		}
+		hash := hashPrefix + strings.ToLower(digest)
+		if _, dup := s.byHash[hash]; dup {
+			return nil, fmt.Errorf("key %q: same hash as another key", k.ID)
+		}
+
+		if len(k.Scopes) == 0 {
+			return nil, fmt.Errorf("key %q: at least one scope is required", k.ID)
+		}
+		p := &Principal{ID: KeyPrefix + k.ID, Prefixes: k.Prefixes}
+		for _, name := range k.Scopes {
+			op, err := ParseOperation(name)
+			if err != nil {
+				return nil, fmt.Errorf("key %q: %w", k.ID, err)
+			}
+			p.Operations = append(p.Operations, op)
+		}
+		s.byHash[hash] = p
+		s.byID[p.ID] = p
+	}
+	return s, nil
+}
+
+// keyFile is the JSON layout read by LoadKeyStore.
+type keyFile struct {
+	Keys []Key `json:"keys"`
+}
+
+// ReadKeyStore parses a key file:
+//
+//	{"keys": [{"id": "ci", "hash": "sha256:…", "scopes": ["read", "write"], "prefixes": ["/builds"]}]}
+func ReadKeyStore(r io.Reader) (*KeyStore, error) {
+	var f keyFile
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&f); err != nil {
+		return nil, fmt.Errorf("parse key file: %w", err)
+	}
+	return NewKeyStore(f.Keys)
+}
+
+// LoadKeyStore reads the key file at path.
+func LoadKeyStore(path string) (*KeyStore, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadKeyStore(f)
+}
+
+// Authenticate looks up the key from the Authorization or X-API-Key header.
+func (s *KeyStore) Authenticate(r *http.Request) (*Principal, error) {
+	key := Credential(r)
+	if key == "" {
+		return nil, ErrNoCredentials
+	}
+	p, ok := s.byHash[HashKey(key)]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown API key", ErrInvalidCredentials)
+	}
+	return p, nil
+}
+
+// Lookup returns the principal with id, KeyPrefix and a key ID, so a key
+// removed from the key file also stops the share links its holder created.
+func (s *KeyStore) Lookup(id string) (*Principal, bool) {
+	p, ok := s.byID[id]
+	return p, ok
+}
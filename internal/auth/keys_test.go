@@ -0,0 +1,125 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// --- KeyStore ---
+
+func TestKeyStore_Authenticate(t *testing.T) {
+	// Stored hashes are accepted in either case.
+	keys, err := NewKeyStore([]Key{
+		{ID: "reader", Hash: HashKey("read-secret"), Scopes: []string{"read"}},
+		{ID: "ci", Hash: "sha256:" + strings.ToUpper(HashKey("ci-secret")[len(hashPrefix):]), Scopes: []string{"read", "write"}, Prefixes: []string{"/builds"}},
+	})
+	if err != nil {
+		t.Fatalf("NewKeyStore: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer ci-secret")
+	p, err := keys.Authenticate(req)
+	if err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	if p.ID != "key:ci" || !p.Allows(Write, "builds/app") || p.Allows(Write, "other") {
+		t.Errorf("unexpected principal %+v", p)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-API-Key", "read-secret")
+	if p, err := keys.Authenticate(req); err != nil || p.ID != "key:reader" {
+		t.Errorf("expected reader, got %+v, %v", p, err)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-API-Key", "wrong")
+	if _, err := keys.Authenticate(req); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("expected ErrInvalidCredentials, got %v", err)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	if _, err := keys.Authenticate(req); !errors.Is(err, ErrNoCredentials) {
+		t.Errorf("expected ErrNoCredentials, got %v", err)
+	}
+}
+
+func TestKeyStore_Lookup(t *testing.T) {
+	keys, err := NewKeyStore([]Key{{ID: "ci", Hash: HashKey("ci-secret"), Scopes: []string{"write"}, Prefixes: []string{"/builds"}}})
+	if err != nil {
+		t.Fatalf("NewKeyStore: %v", err)
+	}
+	if p, ok := keys.Lookup("key:ci"); !ok || p.ID != "key:ci" || !p.Allows(Write, "builds/x") {
+		t.Errorf("expected ci, got %+v, %v", p, ok)
+	}
+	if _, ok := keys.Lookup("key:gone"); ok {
+		t.Error("expected an unknown ID not to be found")
+	}
+	if _, ok := keys.Lookup("ci"); ok {
+		t.Error("expected a key ID without KeyPrefix not to be found")
+	}
+}
+
+func TestNewKeyStore_Invalid(t *testing.T) {
+	good := HashKey("secret")
+	tests := []struct {
+		name string
+		keys []Key
+	}{
+		{"missing id", []Key{{Hash: good, Scopes: []string{"read"}}}},
+		{"duplicate id", []Key{
+			{ID: "a", Hash: good, Scopes: []string{"read"}},
+			{ID: "a", Hash: HashKey("other"), Scopes: []string{"read"}},
+		}},
+		{"duplicate hash", []Key{
+			{ID: "a", Hash: good, Scopes: []string{"read"}},
+			{ID: "b", Hash: good, Scopes: []string{"write"}},
+		}},
+		{"short hash", []Key{{ID: "a", Hash: "sha256:abcd", Scopes: []string{"read"}}}},
+		{"plaintext key", []Key{{ID: "a", Hash: "secret", Scopes: []string{"read"}}}},
+		{"no scopes", []Key{{ID: "a", Hash: good}}},
+		{"unknown scope", []Key{{ID: "a", Hash: good, Scopes: []string{"admin"}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewKeyStore(tt.keys); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+func TestLoadKeyStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	content := `{"keys": [{"id": "ci", "hash": "` + HashKey("s3cret") + `", "scopes": ["read", "delete"], "prefixes": ["/tmp"]}]}`
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	keys, err := LoadKeyStore(path)
+	if err != nil {
+		t.Fatalf("LoadKeyStore: %v", err)
+	}
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-API-Key", "s3cret")
+	p, err := keys.Authenticate(req)
+	if err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	if !p.Allows(Delete, "tmp/x") || p.Allows(Write, "tmp/x") {
+		t.Errorf("unexpected principal %+v", p)
+	}
+}
+
+func TestReadKeyStore_UnknownField(t *testing.T) {
+	_, err := ReadKeyStore(strings.NewReader(`{"keys": [{"id": "a", "key": "plaintext", "scopes": ["read"]}]}`))
+	if err == nil {
+		t.Error("expected error for unknown field")
+	}
+}
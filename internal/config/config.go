@@ -3,8 +3,12 @@ package config
 import (
 	"fmt"
 	"log"
+	"net/url"
 	"os"
 	"strconv"
+	"time"
+
+	"go-storage-api/internal/share"
 )
 
 type Config struct {
@@ -12,10 +16,63 @@ type Config struct {
 	LogLevel       string
 	StorageBackend string
 	MaxUploadSize  int64
+	Uploads        UploadConfig
+	Extract        ExtractConfig
+	Auth           AuthConfig
+	Shares         ShareConfig
 	Local          LocalConfig
 	SMB            SMBConfig
 	FTP            FTPConfig
 	S3             S3Config
+	SFTP           SFTPConfig
+	WebDAV         WebDAVConfig
+}
+
+// UploadConfig configures resumable uploads.
+type UploadConfig struct {
+	Dir     string
+	Expiry  time.Duration
+	MaxSize int64
+}
+
+// ExtractConfig limits archive extraction.
+type ExtractConfig struct {
+	MaxEntries int
+	MaxSize    int64
+}
+
+// AuthConfig selects how API callers authenticate. Authentication is off
+// when no source of credentials is configured.
+type AuthConfig struct {
+	// APIKeysFile is a JSON file of hashed API keys and their scopes.
+	APIKeysFile string
+	JWT         JWTConfig
+	// PolicyFile is a JSON file of roles and bindings that every request
+	// must also satisfy. It needs one of the above.
+	PolicyFile string
+}
+
+// JWTConfig configures bearer token validation. It is enabled by JWKS.
+type JWTConfig struct {
+	// JWKS is the file path or http(s) URL of the signing key set.
+	JWKS          string
+	JWKSRefresh   time.Duration
+	Issuer        string
+	Audience      string
+	ScopeClaim    string
+	ScopePrefix   string
+	PrefixesClaim string
+}
+
+// ShareConfig configures share links. They are enabled by Secret.
+type ShareConfig struct {
+	// Secret is the HMAC key links are signed with.
+	Secret    string
+	MaxExpiry time.Duration
+	// BaseURL is the external URL of the API that links point to.
+	BaseURL string
+	// S3Presign hands out native S3 presigned URLs on the s3 backend.
+	S3Presign bool
 }
 
 type LocalConfig struct {
@@ -35,25 +92,48 @@ type FTPConfig struct {
 	Port     string
 	User     string
 	Password string
+	PoolSize int
 }
 
 type S3Config struct {
-	Bucket string
-	Region string
-	Prefix string
+	Bucket       string
+	Region       string
+	Prefix       string
+	Endpoint     string
+	UsePathStyle bool
+}
+
+type SFTPConfig struct {
+	Host                 string
+	Port                 string
+	User                 string
+	Password             string
+	PrivateKeyPath       string
+	PrivateKeyPassphrase string
+	KnownHostsPath       string
+	RootPath             string
+}
+
+type WebDAVConfig struct {
+	URL      string
+	User     string
+	Password string
 }
 
 func Load() *Config {
 	backend := envOrDefault("STORAGE_BACKEND", "local")
 
 	validBackends := map[string]bool{
-		"local": true,
-		"smb":   true,
-		"ftp":   true,
-		"s3":    true,
+		"local":  true,
+		"memory": true,
+		"smb":    true,
+		"ftp":    true,
+		"s3":     true,
+		"sftp":   true,
+		"webdav": true,
 	}
 	if !validBackends[backend] {
-		log.Fatalf("invalid STORAGE_BACKEND: %q (must be one of: local, smb, ftp, s3)", backend)
+		log.Fatalf("invalid STORAGE_BACKEND: %q (must be one of: local, memory, smb, ftp, s3, sftp, webdav)", backend)
 	}
 
 	maxUpload, err := strconv.ParseInt(envOrDefault("MAX_UPLOAD_SIZE", "104857600"), 10, 64)
@@ -61,11 +141,84 @@ func Load() *Config {
 		log.Fatalf("invalid MAX_UPLOAD_SIZE: %v", err)
 	}
 
+	uploadExpiry, err := time.ParseDuration(envOrDefault("UPLOAD_EXPIRY", "24h"))
+	if err != nil || uploadExpiry <= 0 {
+		log.Fatalf("invalid UPLOAD_EXPIRY: must be a positive duration such as 24h")
+	}
+
+	uploadMaxSize, err := strconv.ParseInt(envOrDefault("UPLOAD_MAX_SIZE", "10737418240"), 10, 64)
+	if err != nil {
+		log.Fatalf("invalid UPLOAD_MAX_SIZE: %v", err)
+	}
+
+	extractMaxEntries, err := strconv.Atoi(envOrDefault("EXTRACT_MAX_ENTRIES", "10000"))
+	if err != nil || extractMaxEntries <= 0 {
+		log.Fatalf("invalid EXTRACT_MAX_ENTRIES: must be a positive integer")
+	}
+
+	extractMaxSize, err := strconv.ParseInt(envOrDefault("EXTRACT_MAX_SIZE", "1073741824"), 10, 64)
+	if err != nil || extractMaxSize <= 0 {
+		log.Fatalf("invalid EXTRACT_MAX_SIZE: must be a positive number of bytes")
+	}
+
+	jwksRefresh, err := time.ParseDuration(envOrDefault("AUTH_JWT_JWKS_REFRESH", "1h"))
+	if err != nil || jwksRefresh <= 0 {
+		log.Fatalf("invalid AUTH_JWT_JWKS_REFRESH: must be a positive duration such as 1h")
+	}
+
+	shareMaxExpiry, err := time.ParseDuration(envOrDefault("SHARE_MAX_EXPIRY", "168h"))
+	if err != nil || shareMaxExpiry <= 0 {
+		log.Fatalf("invalid SHARE_MAX_EXPIRY: must be a positive duration such as 168h")
+	}
+
+	sharePresign, err := strconv.ParseBool(envOrDefault("SHARE_S3_PRESIGN", "false"))
+	if err != nil {
+		log.Fatalf("invalid SHARE_S3_PRESIGN: %v", err)
+	}
+
+	ftpPoolSize, err := strconv.Atoi(envOrDefault("FTP_POOL_SIZE", "4"))
+	if err != nil {
+		log.Fatalf("invalid FTP_POOL_SIZE: %v", err)
+	}
+
+	s3PathStyle, err := strconv.ParseBool(envOrDefault("S3_USE_PATH_STYLE", "false"))
+	if err != nil {
+		log.Fatalf("invalid S3_USE_PATH_STYLE: %v", err)
+	}
+
 	cfg := &Config{
 		Port:           envOrDefault("PORT", "8080"),
 		LogLevel:       envOrDefault("LOG_LEVEL", "info"),
 		StorageBackend: backend,
 		MaxUploadSize:  maxUpload,
+		Uploads: UploadConfig{
+			Dir:     envOrDefault("UPLOAD_DIR", "./uploads"),
+			Expiry:  uploadExpiry,
+			MaxSize: uploadMaxSize,
+		},
+		Extract: ExtractConfig{
+			MaxEntries: extractMaxEntries,
+			MaxSize:    extractMaxSize,
+		},
+		Auth: AuthConfig{
+			APIKeysFile: os.Getenv("AUTH_API_KEYS_FILE"),
+			PolicyFile:  os.Getenv("AUTH_POLICY_FILE"),
+			JWT: JWTConfig{
+				JWKS:          os.Getenv("AUTH_JWT_JWKS"),
+				JWKSRefresh:   jwksRefresh,
+				Issuer:        os.Getenv("AUTH_JWT_ISSUER"),
+				Audience:      os.Getenv("AUTH_JWT_AUDIENCE"),
+				ScopeClaim:    envOrDefault("AUTH_JWT_SCOPE_CLAIM", "scope"),
+				ScopePrefix:   os.Getenv("AUTH_JWT_SCOPE_PREFIX"),
+				PrefixesClaim: envOrDefault("AUTH_JWT_PREFIXES_CLAIM", "storage_prefixes"),
+			},
+		},
+		Shares: ShareConfig{
+			Secret:    os.Getenv("SHARE_SECRET"),
+			MaxExpiry: shareMaxExpiry,
+			BaseURL:   os.Getenv("SHARE_BASE_URL"),
+			S3Presign: sharePresign,
+		},
 		Local: LocalConfig{
 			RootPath: envOrDefault("LOCAL_ROOT_PATH", "./data"),
 		},
@@ -81,17 +234,41 @@ func Load() *Config {
 			Port:     envOrDefault("FTP_PORT", "21"),
 			User:     os.Getenv("FTP_USER"),
 			Password: os.Getenv("FTP_PASSWORD"),
+			PoolSize: ftpPoolSize,
 		},
 		S3: S3Config{
-			Bucket: os.Getenv("S3_BUCKET"),
-			Region: envOrDefault("S3_REGION", "us-east-1"),
-			Prefix: os.Getenv("S3_PREFIX"),
+			Bucket:       os.Getenv("S3_BUCKET"),
+			Region:       envOrDefault("S3_REGION", "us-east-1"),
+			Prefix:       os.Getenv("S3_PREFIX"),
+			Endpoint:     os.Getenv("S3_ENDPOINT"),
+			UsePathStyle: s3PathStyle,
+		},
+		SFTP: SFTPConfig{
+			Host:                 os.Getenv("SFTP_HOST"),
+			Port:                 envOrDefault("SFTP_PORT", "22"),
+			User:                 os.Getenv("SFTP_USER"),
+			Password:             os.Getenv("SFTP_PASSWORD"),
+			PrivateKeyPath:       os.Getenv("SFTP_PRIVATE_KEY_PATH"),
+			PrivateKeyPassphrase: os.Getenv("SFTP_PRIVATE_KEY_PASSPHRASE"),
+			KnownHostsPath:       os.Getenv("SFTP_KNOWN_HOSTS_PATH"),
+			RootPath:             os.Getenv("SFTP_ROOT_PATH"),
+		},
+		WebDAV: WebDAVConfig{
+			URL:      os.Getenv("WEBDAV_URL"),
+			User:     os.Getenv("WEBDAV_USER"),
+			Password: os.Getenv("WEBDAV_PASSWORD"),
 		},
 	}
 
 	if err := cfg.validateBackend(); err != nil {
 		log.Fatalf("config validation failed: %v", err)
 	}
+	if err := cfg.validateAuth(); err != nil {
+		log.Fatalf("config validation failed: %v", err)
+	}
+	if err := cfg.validateShares(); err != nil {
+		log.Fatalf("config validation failed: %v", err)
+	}
 
 	return cfg
 }
@@ -113,10 +290,67 @@ func (c *Config) validateBackend() error {
 		if c.FTP.Host == "" {
 			return fmt.Errorf("FTP_HOST is required for ftp backend")
 		}
+		if c.FTP.PoolSize < 1 {
+			return fmt.Errorf("FTP_POOL_SIZE must be at least 1")
+		}
 	case "s3":
 		if c.S3.Bucket == "" {
 			return fmt.Errorf("S3_BUCKET is required for s3 backend")
 		}
+	case "sftp":
+		if c.SFTP.Host == "" {
+			return fmt.Errorf("SFTP_HOST is required for sftp backend")
+		}
+		if c.SFTP.User == "" {
+			return fmt.Errorf("SFTP_USER is required for sftp backend")
+		}
+		if c.SFTP.Password == "" && c.SFTP.PrivateKeyPath == "" {
+			return fmt.Errorf("SFTP_PASSWORD or SFTP_PRIVATE_KEY_PATH is required for sftp backend")
+		}
+		if c.SFTP.KnownHostsPath == "" {
+			return fmt.Errorf("SFTP_KNOWN_HOSTS_PATH is required for sftp backend")
+		}
+	case "webdav":
+		if c.WebDAV.URL == "" {
+			return fmt.Errorf("WEBDAV_URL is required for webdav backend")
+		}
+	}
+	return nil
+}
+
+func (c *Config) validateAuth() error {
+	if c.Auth.PolicyFile != "" && c.Auth.APIKeysFile == "" && c.Auth.JWT.JWKS == "" {
+		return fmt.Errorf("AUTH_POLICY_FILE requires AUTH_API_KEYS_FILE or AUTH_JWT_JWKS")
+	}
+	if c.Auth.JWT.JWKS == "" {
+		return nil
+	}
+	if c.Auth.JWT.Issuer == "" {
+		return fmt.Errorf("AUTH_JWT_ISSUER is required with AUTH_JWT_JWKS")
+	}
+	if c.Auth.JWT.Audience == "" {
+		return fmt.Errorf("AUTH_JWT_AUDIENCE is required with AUTH_JWT_JWKS")
+	}
+	return nil
+}
+
+func (c *Config) validateShares() error {
+	if c.Shares.Secret == "" {
+		return nil
+	}
+	if c.Auth.APIKeysFile == "" && c.Auth.JWT.JWKS == "" {
+		return fmt.Errorf("SHARE_SECRET requires AUTH_API_KEYS_FILE or AUTH_JWT_JWKS")
+	}
+	if len(c.Shares.Secret) < share.MinSecretSize {
+		return fmt.Errorf("SHARE_SECRET must be at least %d bytes", share.MinSecretSize)
+	}
+	if c.Shares.S3Presign && c.Shares.MaxExpiry > 7*24*time.Hour {
+		return fmt.Errorf("SHARE_MAX_EXPIRY must be at most 168h with SHARE_S3_PRESIGN, the limit of S3 presigned URLs")
+	}
+	if c.Shares.BaseURL != "" {
+		if u, err := url.Parse(c.Shares.BaseURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("SHARE_BASE_URL must be an absolute http(s) URL")
+		}
 	}
 	return nil
 }
@@ -1,7 +1,9 @@
 package config
 
 import (
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestLoadDefaults(t *testing.T) {
@@ -47,6 +49,182 @@ func TestLoadCustomValues(t *testing.T) {
 	}
 }
 
+func TestLoadUploadDefaults(t *testing.T) {
+	t.Setenv("STORAGE_BACKEND", "memory")
+
+	cfg := Load()
+
+	if cfg.Uploads.Dir != "./uploads" {
+		t.Errorf("expected default Uploads.Dir ./uploads, got %s", cfg.Uploads.Dir)
+	}
+	if cfg.Uploads.Expiry != 24*time.Hour {
+		t.Errorf("expected default Uploads.Expiry 24h, got %s", cfg.Uploads.Expiry)
+	}
+	if cfg.Uploads.MaxSize != 10<<30 {
+		t.Errorf("expected default Uploads.MaxSize 10737418240, got %d", cfg.Uploads.MaxSize)
+	}
+}
+
+func TestLoadUploadConfig(t *testing.T) {
+	t.Setenv("STORAGE_BACKEND", "memory")
+	t.Setenv("UPLOAD_DIR", "/var/lib/uploads")
+	t.Setenv("UPLOAD_EXPIRY", "90m")
+	t.Setenv("UPLOAD_MAX_SIZE", "1048576")
+
+	cfg := Load()
+
+	if cfg.Uploads.Dir != "/var/lib/uploads" {
+		t.Errorf("expected Uploads.Dir /var/lib/uploads, got %s", cfg.Uploads.Dir)
+	}
+	if cfg.Uploads.Expiry != 90*time.Minute {
+		t.Errorf("expected Uploads.Expiry 90m, got %s", cfg.Uploads.Expiry)
+	}
+	if cfg.Uploads.MaxSize != 1048576 {
+		t.Errorf("expected Uploads.MaxSize 1048576, got %d", cfg.Uploads.MaxSize)
+	}
+}
+
+func TestLoadExtractConfig(t *testing.T) {
+	t.Setenv("STORAGE_BACKEND", "memory")
+
+	cfg := Load()
+	if cfg.Extract.MaxEntries != 10000 || cfg.Extract.MaxSize != 1<<30 {
+		t.Errorf("expected default Extract limits 10000 entries and 1073741824 bytes, got %+v", cfg.Extract)
+	}
+
+	t.Setenv("EXTRACT_MAX_ENTRIES", "50")
+	t.Setenv("EXTRACT_MAX_SIZE", "2048")
+	cfg = Load()
+	if cfg.Extract.MaxEntries != 50 || cfg.Extract.MaxSize != 2048 {
+		t.Errorf("expected Extract limits 50 entries and 2048 bytes, got %+v", cfg.Extract)
+	}
+}
+
+func TestLoadAuthConfig(t *testing.T) {
+	t.Setenv("STORAGE_BACKEND", "memory")
+
+	cfg := Load()
+	if cfg.Auth.APIKeysFile != "" {
+		t.Errorf("expected authentication off by default, got %+v", cfg.Auth)
+	}
+
+	if cfg.Auth.JWT.JWKSRefresh != time.Hour || cfg.Auth.JWT.ScopeClaim != "scope" || cfg.Auth.JWT.PrefixesClaim != "storage_prefixes" {
+		t.Errorf("unexpected JWT defaults %+v", cfg.Auth.JWT)
+	}
+
+	t.Setenv("AUTH_API_KEYS_FILE", "/etc/storage-api/keys.json")
+	cfg = Load()
+	if cfg.Auth.APIKeysFile != "/etc/storage-api/keys.json" {
+		t.Errorf("expected Auth.APIKeysFile /etc/storage-api/keys.json, got %s", cfg.Auth.APIKeysFile)
+	}
+}
+
+func TestLoadJWTConfig(t *testing.T) {
+	t.Setenv("STORAGE_BACKEND", "memory")
+	t.Setenv("AUTH_JWT_JWKS", "https://idp.example.com/jwks.json")
+	t.Setenv("AUTH_JWT_JWKS_REFRESH", "15m")
+	t.Setenv("AUTH_JWT_ISSUER", "https://idp.example.com")
+	t.Setenv("AUTH_JWT_AUDIENCE", "storage-api")
+	t.Setenv("AUTH_JWT_SCOPE_CLAIM", "scp")
+	t.Setenv("AUTH_JWT_SCOPE_PREFIX", "storage:")
+	t.Setenv("AUTH_JWT_PREFIXES_CLAIM", "paths")
+
+	cfg := Load()
+
+	want := JWTConfig{
+		JWKS:          "https://idp.example.com/jwks.json",
+		JWKSRefresh:   15 * time.Minute,
+		Issuer:        "https://idp.example.com",
+		Audience:      "storage-api",
+		ScopeClaim:    "scp",
+		ScopePrefix:   "storage:",
+		PrefixesClaim: "paths",
+	}
+	if cfg.Auth.JWT != want {
+		t.Errorf("expected %+v, got %+v", want, cfg.Auth.JWT)
+	}
+}
+
+func TestValidateAuth_PolicyRequiresAuthentication(t *testing.T) {
+	cfg := &Config{Auth: AuthConfig{PolicyFile: "policy.json"}}
+	if err := cfg.validateAuth(); err == nil {
+		t.Error("expected error for a policy without authentication")
+	}
+	cfg.Auth.APIKeysFile = "keys.json"
+	if err := cfg.validateAuth(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestValidateAuth_JWTRequiresIssuerAndAudience(t *testing.T) {
+	cfg := &Config{Auth: AuthConfig{JWT: JWTConfig{JWKS: "jwks.json", Audience: "storage-api"}}}
+	if err := cfg.validateAuth(); err == nil {
+		t.Error("expected error without issuer")
+	}
+	cfg.Auth.JWT = JWTConfig{JWKS: "jwks.json", Issuer: "https://idp.example.com"}
+	if err := cfg.validateAuth(); err == nil {
+		t.Error("expected error without audience")
+	}
+	cfg.Auth.JWT.Audience = "storage-api"
+	if err := cfg.validateAuth(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestLoadShareConfig(t *testing.T) {
+	t.Setenv("STORAGE_BACKEND", "memory")
+
+	cfg := Load()
+	if cfg.Shares.Secret != "" || cfg.Shares.MaxExpiry != 168*time.Hour || cfg.Shares.S3Presign {
+		t.Errorf("unexpected share defaults %+v", cfg.Shares)
+	}
+
+	secret := strings.Repeat("x", 32)
+	t.Setenv("AUTH_API_KEYS_FILE", "keys.json")
+	t.Setenv("SHARE_SECRET", secret)
+	t.Setenv("SHARE_MAX_EXPIRY", "24h")
+	t.Setenv("SHARE_BASE_URL", "https://files.example.com")
+	t.Setenv("SHARE_S3_PRESIGN", "true")
+	cfg = Load()
+	want := ShareConfig{Secret: secret, MaxExpiry: 24 * time.Hour, BaseURL: "https://files.example.com", S3Presign: true}
+	if cfg.Shares != want {
+		t.Errorf("expected %+v, got %+v", want, cfg.Shares)
+	}
+}
+
+func TestValidateShares(t *testing.T) {
+	secret := strings.Repeat("x", 32)
+	tests := []struct {
+		name    string
+		cfg     Config
+		wantErr bool
+	}{
+		{"off", Config{}, false},
+		{"no authentication", Config{Shares: ShareConfig{Secret: secret}}, true},
+		{"short secret", Config{Auth: AuthConfig{APIKeysFile: "keys.json"}, Shares: ShareConfig{Secret: "short"}}, true},
+		{"presign too long", Config{Auth: AuthConfig{APIKeysFile: "keys.json"}, Shares: ShareConfig{Secret: secret, MaxExpiry: 30 * 24 * time.Hour, S3Presign: true}}, true},
+		{"relative base URL", Config{Auth: AuthConfig{APIKeysFile: "keys.json"}, Shares: ShareConfig{Secret: secret, BaseURL: "files.example.com"}}, true},
+		{"valid", Config{Auth: AuthConfig{APIKeysFile: "keys.json"}, Shares: ShareConfig{Secret: secret, BaseURL: "https://files.example.com"}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.cfg.validateShares(); (err != nil) != tt.wantErr {
+				t.Errorf("validateShares() = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadMemoryBackend(t *testing.T) {
+	t.Setenv("STORAGE_BACKEND", "memory")
+
+	cfg := Load()
+
+	if cfg.StorageBackend != "memory" {
+		t.Errorf("expected StorageBackend memory, got %s", cfg.StorageBackend)
+	}
+}
+
 func TestLoadSMBBackendConfig(t *testing.T) {
 	t.Setenv("STORAGE_BACKEND", "smb")
 	t.Setenv("SMB_HOST", "fileserver.local")
@@ -83,6 +261,9 @@ func TestLoadFTPBackendConfig(t *testing.T) {
 	if cfg.FTP.Port != "2121" {
 		t.Errorf("expected FTP.Port 2121, got %s", cfg.FTP.Port)
 	}
+	if cfg.FTP.PoolSize != 4 {
+		t.Errorf("expected default FTP.PoolSize 4, got %d", cfg.FTP.PoolSize)
+	}
 }
 
 func TestLoadS3BackendConfig(t *testing.T) {
@@ -104,6 +285,68 @@ func TestLoadS3BackendConfig(t *testing.T) {
 	}
 }
 
+func TestLoadS3CustomEndpoint(t *testing.T) {
+	t.Setenv("STORAGE_BACKEND", "s3")
+	t.Setenv("S3_BUCKET", "my-bucket")
+	t.Setenv("S3_ENDPOINT", "http://minio.local:9000")
+	t.Setenv("S3_USE_PATH_STYLE", "true")
+
+	cfg := Load()
+
+	if cfg.S3.Endpoint != "http://minio.local:9000" {
+		t.Errorf("expected S3.Endpoint http://minio.local:9000, got %s", cfg.S3.Endpoint)
+	}
+	if !cfg.S3.UsePathStyle {
+		t.Error("expected S3.UsePathStyle true")
+	}
+}
+
+func TestLoadSFTPBackendConfig(t *testing.T) {
+	t.Setenv("STORAGE_BACKEND", "sftp")
+	t.Setenv("SFTP_HOST", "sftp.example.com")
+	t.Setenv("SFTP_USER", "drop")
+	t.Setenv("SFTP_PRIVATE_KEY_PATH", "/keys/id_ed25519")
+	t.Setenv("SFTP_KNOWN_HOSTS_PATH", "/etc/ssh/known_hosts")
+	t.Setenv("SFTP_ROOT_PATH", "/incoming")
+
+	cfg := Load()
+
+	if cfg.SFTP.Host != "sftp.example.com" {
+		t.Errorf("expected SFTP.Host sftp.example.com, got %s", cfg.SFTP.Host)
+	}
+	if cfg.SFTP.Port != "22" {
+		t.Errorf("expected default SFTP.Port 22, got %s", cfg.SFTP.Port)
+	}
+	if cfg.SFTP.PrivateKeyPath != "/keys/id_ed25519" {
+		t.Errorf("expected SFTP.PrivateKeyPath /keys/id_ed25519, got %s", cfg.SFTP.PrivateKeyPath)
+	}
+	if cfg.SFTP.KnownHostsPath != "/etc/ssh/known_hosts" {
+		t.Errorf("expected SFTP.KnownHostsPath /etc/ssh/known_hosts, got %s", cfg.SFTP.KnownHostsPath)
+	}
+	if cfg.SFTP.RootPath != "/incoming" {
+		t.Errorf("expected SFTP.RootPath /incoming, got %s", cfg.SFTP.RootPath)
+	}
+}
+
+func TestLoadWebDAVBackendConfig(t *testing.T) {
+	t.Setenv("STORAGE_BACKEND", "webdav")
+	t.Setenv("WEBDAV_URL", "https://cloud.example.com/remote.php/dav/files/alice/")
+	t.Setenv("WEBDAV_USER", "alice")
+	t.Setenv("WEBDAV_PASSWORD", "secret")
+
+	cfg := Load()
+
+	if cfg.WebDAV.URL != "https://cloud.example.com/remote.php/dav/files/alice/" {
+		t.Errorf("expected WebDAV.URL, got %s", cfg.WebDAV.URL)
+	}
+	if cfg.WebDAV.User != "alice" {
+		t.Errorf("expected WebDAV.User alice, got %s", cfg.WebDAV.User)
+	}
+	if cfg.WebDAV.Password != "secret" {
+		t.Errorf("expected WebDAV.Password secret, got %s", cfg.WebDAV.Password)
+	}
+}
+
 func TestS3DefaultRegion(t *testing.T) {
 	t.Setenv("STORAGE_BACKEND", "s3")
 	t.Setenv("S3_BUCKET", "my-bucket")
@@ -147,6 +390,17 @@ func TestValidateBackendFTPMissingHost(t *testing.T) {
 	}
 }
 
+func TestValidateBackendFTPPoolSize(t *testing.T) {
+	cfg := &Config{
+		StorageBackend: "ftp",
+		FTP:            FTPConfig{Host: "ftp.example.com", PoolSize: 0},
+	}
+	err := cfg.validateBackend()
+	if err == nil {
+		t.Error("expected error for FTP_POOL_SIZE below 1")
+	}
+}
+
 func TestValidateBackendS3MissingBucket(t *testing.T) {
 	cfg := &Config{
 		StorageBackend: "s3",
@@ -157,6 +411,45 @@ func TestValidateBackendS3MissingBucket(t *testing.T) {
 	}
 }
 
+func TestValidateBackendSFTP(t *testing.T) {
+	valid := SFTPConfig{Host: "sftp.example.com", User: "drop", Password: "secret", KnownHostsPath: "/etc/ssh/known_hosts"}
+
+	tests := []struct {
+		name    string
+		mutate  func(c *SFTPConfig)
+		wantErr bool
+	}{
+		{"valid password", func(c *SFTPConfig) {}, false},
+		{"valid key", func(c *SFTPConfig) { c.Password = ""; c.PrivateKeyPath = "/keys/id_ed25519" }, false},
+		{"missing host", func(c *SFTPConfig) { c.Host = "" }, true},
+		{"missing user", func(c *SFTPConfig) { c.User = "" }, true},
+		{"no credentials", func(c *SFTPConfig) { c.Password = "" }, true},
+		{"missing known_hosts", func(c *SFTPConfig) { c.KnownHostsPath = "" }, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sftp := valid
+			tt.mutate(&sftp)
+			cfg := &Config{StorageBackend: "sftp", SFTP: sftp}
+			err := cfg.validateBackend()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateBackend() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateBackendWebDAVMissingURL(t *testing.T) {
+	cfg := &Config{
+		StorageBackend: "webdav",
+	}
+	err := cfg.validateBackend()
+	if err == nil {
+		t.Error("expected error for missing WEBDAV_URL")
+	}
+}
+
 func TestValidateBackendLocalMissingRoot(t *testing.T) {
 	cfg := &Config{
 		StorageBackend: "local",
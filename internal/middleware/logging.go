@@ -1,6 +1,7 @@
 package middleware
 
 import (
+	"context"
 	"log/slog"
 	"net/http"
 	"time"
@@ -29,22 +30,35 @@ func (rw *responseWriter) Write(b []byte) (int, error) {
 	return rw.ResponseWriter.Write(b)
 }
 
+// Unwrap lets http.ResponseController reach the underlying writer, e.g. to
+// flush streamed responses.
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
 // Logging records structured log entries for every HTTP request using slog.
+// Requests authenticated further down the chain are logged with the
+// caller's ID as "principal".
 func Logging(logger *slog.Logger) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			start := time.Now()
 
 			wrapped := &responseWriter{ResponseWriter: w, status: http.StatusOK}
-			next.ServeHTTP(wrapped, r)
+			ctx := context.WithValue(r.Context(), principalKey, &principal{})
+			next.ServeHTTP(wrapped, r.WithContext(ctx))
 
-			logger.Info("request",
+			attrs := []any{
 				slog.String("method", r.Method),
 				slog.String("path", r.URL.Path),
 				slog.Int("status", wrapped.status),
 				slog.String("duration", time.Since(start).String()),
 				slog.String("request_id", RequestIDFromContext(r.Context())),
-			)
+			}
+			if id := PrincipalFromContext(ctx); id != "" {
+				attrs = append(attrs, slog.String("principal", id))
+			}
+			logger.Info("request", attrs...)
 		})
 	}
 }
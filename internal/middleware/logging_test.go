@@ -47,6 +47,26 @@ func TestLogging_ImplicitOK(t *testing.T) {
 	assertLogFieldFloat(t, entry, "status", 200)
 }
 
+func TestLogging_SupportsFlush(t *testing.T) {
+	var buf bytes.Buffer
+	logger := newTestLogger(&buf)
+
+	handler := Logging(logger)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("partial"))
+		if err := http.NewResponseController(w).Flush(); err != nil {
+			t.Errorf("Flush through logging middleware: %v", err)
+		}
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/stream", nil)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if !rr.Flushed {
+		t.Error("expected the underlying writer to be flushed")
+	}
+}
+
 func TestLogging_IncludesRequestID(t *testing.T) {
 	var buf bytes.Buffer
 	logger := newTestLogger(&buf)
@@ -67,6 +87,36 @@ func TestLogging_IncludesRequestID(t *testing.T) {
 	}
 }
 
+func TestLogging_IncludesPrincipal(t *testing.T) {
+	var buf bytes.Buffer
+	logger := newTestLogger(&buf)
+
+	var seen string
+	handler := Logging(logger)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Set by authentication inside Logging, as in the real chain.
+		ctx := WithPrincipal(r.Context(), "ci-key")
+		seen = PrincipalFromContext(ctx)
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if seen != "ci-key" {
+		t.Errorf("PrincipalFromContext = %q, want ci-key", seen)
+	}
+	assertLogField(t, parseLogEntry(t, &buf), "principal", "ci-key")
+}
+
+func TestLogging_OmitsPrincipalWhenUnauthenticated(t *testing.T) {
+	var buf bytes.Buffer
+	handler := Logging(newTestLogger(&buf))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if _, ok := parseLogEntry(t, &buf)["principal"]; ok {
+		t.Error("expected no principal in log entry")
+	}
+}
+
 func TestLogging_IncludesDuration(t *testing.T) {
 	var buf bytes.Buffer
 	logger := newTestLogger(&buf)
@@ -6,6 +6,8 @@ import (
 	"net/url"
 	"path"
 	"strings"
+
+	"go-storage-api/internal/storage"
 )
 
 // errorResponse mirrors the api.ErrorResponse JSON shape but is defined
@@ -14,39 +16,69 @@ type errorResponse struct {
 	Error string `json:"error"`
 }
 
-// PathGuard rejects requests whose "path" query parameter contains directory
-// traversal sequences (..) or null bytes. Valid paths are normalized with
-// path.Clean before the request continues.
+// pathParams lists the query parameters that carry storage paths. Move and
+// copy name two paths, so both ends are guarded the same way as "path".
+var pathParams = []string{"path", "from", "to"}
+
+// PathGuard rejects requests whose path query parameters ("path", "from" and
+// "to") contain directory traversal sequences (..), null bytes or elements
+// reserved for backend temporary files (storage.TempPrefix). Valid paths
+// are normalized with path.Clean before the request continues. Every value
+// of a repeated parameter is checked, since the archive endpoint takes
+// several paths.
 func PathGuard(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		raw := r.URL.Query().Get("path")
-		if raw == "" {
-			next.ServeHTTP(w, r)
-			return
-		}
+		q := r.URL.Query()
+		changed := false
 
-		// Decode to catch double-encoded traversal (%252e%252e).
-		decoded, err := url.QueryUnescape(raw)
-		if err != nil {
-			writeErrorJSON(w, http.StatusBadRequest, "invalid path encoding")
-			return
-		}
+		for _, param := range pathParams {
+			values := q[param]
+			for i, raw := range values {
+				if raw == "" {
+					continue
+				}
 
-		if containsTraversal(decoded) || containsNullByte(decoded) {
-			writeErrorJSON(w, http.StatusBadRequest, "invalid path")
-			return
-		}
+				// Decode to catch double-encoded traversal (%252e%252e).
+				decoded, err := url.QueryUnescape(raw)
+				if err != nil {
+					writeErrorJSON(w, http.StatusBadRequest, "invalid path encoding")
+					return
+				}
 
-		// Normalize and replace the query parameter.
-		cleaned := path.Clean(decoded)
-		q := r.URL.Query()
-		q.Set("path", cleaned)
-		r.URL.RawQuery = q.Encode()
+				cleaned, ok := CheckPath(decoded)
+				if !ok {
+					writeErrorJSON(w, http.StatusBadRequest, "invalid path")
+					return
+				}
+
+				// Normalize the value in place.
+				values[i] = cleaned
+				changed = true
+			}
+		}
 
+		if changed {
+			r.URL.RawQuery = q.Encode()
+		}
 		next.ServeHTTP(w, r)
 	})
 }
 
+// CheckPath applies PathGuard's rules to a path that does not arrive as a
+// query parameter, such as the name of an entry in an uploaded archive. It
+// returns the path cleaned with path.Clean, or false if the path contains a
+// traversal sequence, a null byte or a reserved element.
+func CheckPath(p string) (string, bool) {
+	if containsTraversal(p) || containsNullByte(p) {
+		return "", false
+	}
+	cleaned := path.Clean(p)
+	if storage.HasTemp(cleaned) {
+		return "", false
+	}
+	return cleaned, true
+}
+
 func containsTraversal(s string) bool {
 	return strings.Contains(s, "..")
 }
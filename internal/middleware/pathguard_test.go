@@ -62,6 +62,30 @@ func TestPathGuard_BlocksNullBytes(t *testing.T) {
 	})
 }
 
+func TestPathGuard_BlocksReservedNames(t *testing.T) {
+	handler := PathGuard(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("handler should not have been called")
+	}))
+
+	tests := []string{
+		"path=.~upload-parts",
+		"path=docs/.~upload-abc/file.txt",
+		"path=docs/.~upload-1234",
+		"from=a.txt&to=.~upload-parts/x",
+	}
+	for _, query := range tests {
+		t.Run(query, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/files?"+query, nil)
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusBadRequest {
+				t.Errorf("expected 400, got %d", rr.Code)
+			}
+		})
+	}
+}
+
 func TestPathGuard_AllowsValidPaths(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -73,6 +97,7 @@ func TestPathGuard_AllowsValidPaths(t *testing.T) {
 		{"trailing slash cleaned", "docs/guide/", "docs/guide"},
 		{"double slash cleaned", "docs//guide", "docs/guide"},
 		{"dot current dir", "./readme.txt", "readme.txt"},
+		{"reserved prefix inside a name", "docs/a.~upload-1", "docs/a.~upload-1"},
 	}
 
 	for _, tt := range tests {
@@ -115,3 +140,87 @@ func TestPathGuard_NoPathParam(t *testing.T) {
 		t.Errorf("expected 200, got %d", rr.Code)
 	}
 }
+
+func TestPathGuard_GuardsFromAndTo(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+	}{
+		{"traversal in from", "from=../etc/passwd&to=copy.txt"},
+		{"traversal in to", "from=a.txt&to=../../escape.txt"},
+		{"encoded traversal in to", "from=a.txt&to=%252e%252e%252fescape.txt"},
+		{"null byte in from", "from=a%00.txt&to=b.txt"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := PathGuard(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				t.Error("handler should not be called")
+			}))
+
+			req := httptest.NewRequest(http.MethodPost, "/files/move?"+tt.query, nil)
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusBadRequest {
+				t.Errorf("expected 400, got %d", rr.Code)
+			}
+		})
+	}
+}
+
+func TestPathGuard_CleansFromAndTo(t *testing.T) {
+	var from, to string
+	handler := PathGuard(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		from = r.URL.Query().Get("from")
+		to = r.URL.Query().Get("to")
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "/files/move?from=docs//a.txt&to=./archive/a.txt", nil)
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if from != "docs/a.txt" || to != "archive/a.txt" {
+		t.Errorf("expected cleaned paths, got from=%q to=%q", from, to)
+	}
+}
+
+func TestPathGuard_RepeatedParams(t *testing.T) {
+	var paths []string
+	handler := PathGuard(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = r.URL.Query()["path"]
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/files/archive?path=docs//a&path=./b", nil)
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	if len(paths) != 2 || paths[0] != "docs/a" || paths[1] != "b" {
+		t.Errorf("expected both paths cleaned, got %q", paths)
+	}
+
+	// A traversal in any value is refused, not just in the first.
+	req = httptest.NewRequest(http.MethodGet, "/files/archive?path=docs&path=../etc", nil)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400, got %d", rr.Code)
+	}
+}
+
+func TestCheckPath(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+		ok   bool
+	}{
+		{"docs//a.txt", "docs/a.txt", true},
+		{"./docs/", "docs", true},
+		{"../etc/passwd", "", false},
+		{"docs/../../x", "", false},
+		{"a\x00b", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := CheckPath(tt.in)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("CheckPath(%q) = %q, %v; want %q, %v", tt.in, got, ok, tt.want, tt.ok)
+		}
+	}
+}
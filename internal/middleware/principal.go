@@ -0,0 +1,31 @@
+package middleware
+
+import "context"
+
+const principalKey contextKey = "principal"
+
+// principal holds the ID of the authenticated caller. Logging puts an empty
+// one in the context before the request reaches authentication further in,
+// so the ID set there is still visible when the request is logged.
+type principal struct {
+	id string
+}
+
+// WithPrincipal records the ID of the authenticated caller, such as an API
+// key ID or a token subject, for PrincipalFromContext and the request log.
+func WithPrincipal(ctx context.Context, id string) context.Context {
+	if p, ok := ctx.Value(principalKey).(*principal); ok {
+		p.id = id
+		return ctx
+	}
+	return context.WithValue(ctx, principalKey, &principal{id: id})
+}
+
+// PrincipalFromContext returns the caller ID stored by WithPrincipal, or ""
+// for an unauthenticated request.
+func PrincipalFromContext(ctx context.Context) string {
+	if p, ok := ctx.Value(principalKey).(*principal); ok {
+		return p.id
+	}
+	return ""
+}
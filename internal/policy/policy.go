@@ -0,0 +1,452 @@
+// Package policy decides which principals may perform which operations on
+// which paths, based on a declarative file of roles and bindings.
+//
+// A role is a list of rules, each allowing or denying operations on paths
+// matched by globs. Bindings give roles to principals by ID, such as
+// "key:ci" or "jwt:https://idp.example.com/alice", or to every
+// authenticated principal with "*". A request is allowed if some rule of
+// the principal's roles allows it and none denies it.
+package policy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"go-storage-api/internal/auth"
+)
+
+// Everyone binds a role to every authenticated principal.
+const Everyone = "*"
+
+// Rule allows or denies operations on the paths matched by any of its
+// globs. In a glob, "*" matches within one path segment and "**" matches
+// any number of segments, so "/team-a/**" covers /team-a and everything
+// below it.
+type Rule struct {
+	Paths []string `json:"paths"`
+	Allow []string `json:"allow,omitempty"`
+	Deny  []string `json:"deny,omitempty"`
+}
+
+// Role is a named set of rules.
+type Role struct {
+	Rules []Rule `json:"rules"`
+}
+
+// Binding gives a role to principals.
+type Binding struct {
+	Role       string   `json:"role"`
+	Principals []string `json:"principals"`
+}
+
+// File is the layout of a policy file.
+type File struct {
+	Roles    map[string]Role `json:"roles"`
+	Bindings []Binding       `json:"bindings"`
+	// Admins may explain decisions for other principals.
+	Admins []string `json:"admins,omitempty"`
+}
+
+// Policy is a validated policy file, ready to evaluate.
+type Policy struct {
+	roles    map[string][]rule
+	bindings map[string][]string // principal -> role names
+	admins   map[string]bool
+}
+
+type rule struct {
+	index int // 1-based, for explanations
+	paths [][]string
+	raw   []string
+	allow map[auth.Operation]bool
+	deny  map[auth.Operation]bool
+}
+
+// New validates f: every binding must name a defined role, every rule needs
+// paths and operations, and globs must be well-formed.
+func New(f File) (*Policy, error) {
+	p := &Policy{
+		roles:    make(map[string][]rule, len(f.Roles)),
+		bindings: map[string][]string{},
+		admins:   map[string]bool{},
+	}
+	for name, role := range f.Roles {
+		if len(role.Rules) == 0 {
+			return nil, fmt.Errorf("role %q: no rules", name)
+		}
+		for i, r := range role.Rules {
+			compiled, err := compileRule(r)
+			if err != nil {
+				return nil, fmt.Errorf("role %q rule %d: %w", name, i+1, err)
+			}
+			compiled.index = i + 1
+			p.roles[name] = append(p.roles[name], compiled)
+		}
+	}
+	for i, b := range f.Bindings {
+		if _, ok := p.roles[b.Role]; !ok {
+			return nil, fmt.Errorf("binding %d: unknown role %q", i+1, b.Role)
+		}
+		if len(b.Principals) == 0 {
+			return nil, fmt.Errorf("binding %d: no principals", i+1)
+		}
+		for _, id := range b.Principals {
+			if id != Everyone && !validPrincipal(id) {
+				return nil, fmt.Errorf("binding %d: principal %q must start with %q or %q", i+1, id, auth.KeyPrefix, auth.TokenPrefix)
+			}
+			p.bindings[id] = appendUnique(p.bindings[id], b.Role)
+		}
+	}
+	for _, id := range f.Admins {
+		if !validPrincipal(id) {
+			return nil, fmt.Errorf("admin %q must start with %q or %q", id, auth.KeyPrefix, auth.TokenPrefix)
+		}
+		p.admins[id] = true
+	}
+	return p, nil
+}
+
+// validPrincipal reports whether id names its kind of credentials, as
+// principal IDs do. A bare name would match neither an API key nor a token.
+func validPrincipal(id string) bool {
+	return strings.HasPrefix(id, auth.KeyPrefix) || strings.HasPrefix(id, auth.TokenPrefix)
+}
+
+func compileRule(r Rule) (rule, error) {
+	c := rule{raw: r.Paths, allow: map[auth.Operation]bool{}, deny: map[auth.Operation]bool{}}
+	if len(r.Paths) == 0 {
+		return c, errors.New("no paths")
+	}
+	if len(r.Allow) == 0 && len(r.Deny) == 0 {
+		return c, errors.New("neither allow nor deny")
+	}
+	for _, glob := range r.Paths {
+		segs := segments(glob)
+		for _, seg := range segs {
+			if _, err := path.Match(seg, ""); err != nil {
+				return c, fmt.Errorf("invalid glob %q", glob)
+			}
+		}
+		c.paths = append(c.paths, segs)
+	}
+	for _, ops := range []struct {
+		names []string
+		set   map[auth.Operation]bool
+	}{{r.Allow, c.allow}, {r.Deny, c.deny}} {
+		for _, name := range ops.names {
+			op, err := auth.ParseOperation(name)
+			if err != nil {
+				return c, err
+			}
+			ops.set[op] = true
+		}
+	}
+	return c, nil
+}
+
+// Read parses and validates a policy file.
+func Read(r io.Reader) (*Policy, error) {
+	var f File
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&f); err != nil {
+		return nil, fmt.Errorf("parse policy: %w", err)
+	}
+	return New(f)
+}
+
+// Load reads the policy file at path.
+func Load(path string) (*Policy, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Read(f)
+}
+
+// Match is a rule that applied to a request.
+type Match struct {
+	Role string `json:"role"`
+	// Rule is the 1-based position of the rule in the role.
+	Rule   int      `json:"rule"`
+	Paths  []string `json:"paths"`
+	Effect string   `json:"effect"` // "allow" or "deny"
+}
+
+// Decision is the outcome of evaluating a request, with the reasoning.
+type Decision struct {
+	Allowed bool     `json:"allowed"`
+	Reason  string   `json:"reason"`
+	Roles   []string `json:"roles"`
+	Matches []Match  `json:"matches"`
+}
+
+// Roles returns the names of the roles bound to principal, directly or
+// through Everyone.
+func (p *Policy) Roles(principal string) []string {
+	var roles []string
+	for _, r := range p.bindings[principal] {
+		roles = appendUnique(roles, r)
+	}
+	for _, r := range p.bindings[Everyone] {
+		roles = appendUnique(roles, r)
+	}
+	sort.Strings(roles)
+	return roles
+}
+
+// Evaluate decides whether principal may perform op on the storage path
+// name. Deny rules win over allow rules; without any matching rule the
+// request is denied.
+func (p *Policy) Evaluate(principal string, op auth.Operation, name string) Decision {
+	d := Decision{Roles: p.Roles(principal), Matches: []Match{}}
+	target := segments(name)
+	var denied, allowed *Match
+	for _, role := range d.Roles {
+		for _, r := range p.roles[role] {
+			if !r.matches(target) {
+				continue
+			}
+			m := Match{Role: role, Rule: r.index, Paths: r.raw}
+			switch {
+			case r.deny[op]:
+				m.Effect = "deny"
+				if denied == nil {
+					denied = &m
+				}
+			case r.allow[op]:
+				m.Effect = "allow"
+				if allowed == nil {
+					allowed = &m
+				}
+			default:
+				continue
+			}
+			d.Matches = append(d.Matches, m)
+		}
+	}
+
+	where := "/" + auth.Clean(name)
+	switch {
+	case denied != nil:
+		d.Reason = fmt.Sprintf("%s on %s denied by role %s rule %d", op, where, denied.Role, denied.Rule)
+	case allowed != nil:
+		d.Allowed = true
+		d.Reason = fmt.Sprintf("%s on %s allowed by role %s rule %d", op, where, allowed.Role, allowed.Rule)
+	case len(d.Roles) == 0:
+		d.Reason = fmt.Sprintf("no role is bound to %s", principal)
+	default:
+		d.Reason = fmt.Sprintf("no rule allows %s on %s", op, where)
+	}
+	return d
+}
+
+// Check is auth.Check with the policy applied on top: the caller's own
+// credentials must allow the operation, and so must the policy. Requests
+// without a principal are refused, since a policy is only useful with
+// authentication.
+func (p *Policy) Check(ctx context.Context, op auth.Operation, name string) error {
+	if err := auth.Check(ctx, op, name); err != nil {
+		return err
+	}
+	pr := auth.FromContext(ctx)
+	if pr == nil {
+		return fmt.Errorf("%w: not authenticated", auth.ErrForbidden)
+	}
+	if d := p.Evaluate(pr.ID, op, name); !d.Allowed {
+		return fmt.Errorf("%w: %s", auth.ErrForbidden, d.Reason)
+	}
+	return nil
+}
+
+// EvaluateTree decides whether principal may perform op on name and on
+// every path that could exist below it, as a recursive delete or a move of
+// a directory does. Beyond Evaluate on name, some allow rule must match
+// everything below it, and no deny rule may match anything below it.
+func (p *Policy) EvaluateTree(principal string, op auth.Operation, name string) Decision {
+	d := p.Evaluate(principal, op, name)
+	if !d.Allowed {
+		return d
+	}
+	target := segments(name)
+	where := "/" + auth.Clean(name)
+	covered := false
+	for _, role := range d.Roles {
+		for _, r := range p.roles[role] {
+			switch {
+			case r.deny[op] && r.matchesBelow(target):
+				d.Allowed = false
+				d.Reason = fmt.Sprintf("%s below %s denied by role %s rule %d", op, where, role, r.index)
+				d.Matches = append(d.Matches, Match{Role: role, Rule: r.index, Paths: r.raw, Effect: "deny"})
+				return d
+			case r.allow[op] && !r.deny[op] && r.coversBelow(target):
+				covered = true
+			}
+		}
+	}
+	if !covered {
+		d.Allowed = false
+		d.Reason = fmt.Sprintf("no rule allows %s on everything below %s", op, where)
+	}
+	return d
+}
+
+// CheckTree is Check for op on name and everything below it, decided by
+// EvaluateTree. Credential prefixes need no extra check, as they always
+// cover whole subtrees.
+func (p *Policy) CheckTree(ctx context.Context, op auth.Operation, name string) error {
+	if err := auth.Check(ctx, op, name); err != nil {
+		return err
+	}
+	pr := auth.FromContext(ctx)
+	if pr == nil {
+		return fmt.Errorf("%w: not authenticated", auth.ErrForbidden)
+	}
+	if d := p.EvaluateTree(pr.ID, op, name); !d.Allowed {
+		return fmt.Errorf("%w: %s", auth.ErrForbidden, d.Reason)
+	}
+	return nil
+}
+
+// IsAdmin reports whether principal may explain decisions for others.
+func (p *Policy) IsAdmin(principal string) bool {
+	return p.admins[principal]
+}
+
+func (r rule) matches(target []string) bool {
+	for _, glob := range r.paths {
+		if matchSegments(glob, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesBelow reports whether one of r's globs may match a path below
+// target. It errs towards true, so deny rules are never overlooked.
+func (r rule) matchesBelow(target []string) bool {
+	for _, glob := range r.paths {
+		if overlapsBelow(glob, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// coversBelow reports whether one of r's globs matches every path below
+// target. It errs towards false.
+func (r rule) coversBelow(target []string) bool {
+	for _, glob := range r.paths {
+		if coversBelow(glob, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// segments splits a path or glob into its cleaned segments; the root has
+// none.
+func segments(name string) []string {
+	name = auth.Clean(name)
+	if name == "" {
+		return nil
+	}
+	return strings.Split(name, "/")
+}
+
+// matchSegments matches a path against a glob, segment by segment. "**"
+// matches zero or more segments; any other segment is a path.Match pattern.
+func matchSegments(glob, name []string) bool {
+	for len(glob) > 0 {
+		if glob[0] == "**" {
+			rest := glob[1:]
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(rest, name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(glob[0], name[0]); !ok {
+			return false
+		}
+		glob, name = glob[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// overlapsBelow reports whether glob can match some path below dir. Once
+// dir is used up, any glob segments left are taken to match something.
+func overlapsBelow(glob, dir []string) bool {
+	for ; len(dir) > 0; glob, dir = glob[1:], dir[1:] {
+		if len(glob) == 0 {
+			return false
+		}
+		if glob[0] == "**" {
+			return true
+		}
+		if ok, _ := path.Match(glob[0], dir[0]); !ok {
+			return false
+		}
+	}
+	return len(glob) > 0
+}
+
+// coversBelow reports whether glob matches every path below dir.
+func coversBelow(glob, dir []string) bool {
+	if matchesAny(glob) {
+		return true
+	}
+	if len(glob) == 0 || len(dir) == 0 {
+		return false
+	}
+	if glob[0] == "**" {
+		for i := 0; i <= len(dir); i++ {
+			if coversBelow(glob[1:], dir[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if ok, _ := path.Match(glob[0], dir[0]); !ok {
+		return false
+	}
+	return coversBelow(glob[1:], dir[1:])
+}
+
+// matchesAny reports whether glob matches every path of one or more
+// segments: it is made of "**" and at most one "*", with at least one "**".
+func matchesAny(glob []string) bool {
+	stars, any := 0, false
+	for _, seg := range glob {
+		switch seg {
+		case "**":
+			any = true
+		case "*":
+			stars++
+		default:
+			return false
+		}
+	}
+	return any && stars <= 1
+}
+
+func appendUnique(list []string, s string) []string {
+	for _, v := range list {
+		if v == s {
+			return list
+		}
+	}
+	return append(list, s)
+}
@@ -0,0 +1,289 @@
+package policy
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go-storage-api/internal/auth"
+)
+
+// teamPolicy is the example from the docs: team-a writes under /team-a,
+// reads /shared and never deletes; everyone reads /public.
+const teamPolicy = `{
+  "roles": {
+    "team-a": {"rules": [
+      {"paths": ["/team-a/**"], "allow": ["read", "write", "delete"]},
+      {"paths": ["/shared/**"], "allow": ["read"]},
+      {"paths": ["/**"], "deny": ["delete"]}
+    ]},
+    "reader": {"rules": [
+      {"paths": ["/public/**", "/"], "allow": ["read"]}
+    ]},
+    "ops": {"rules": [
+      {"paths": ["/**"], "allow": ["read", "write", "delete"]}
+    ]}
+  },
+  "bindings": [
+    {"role": "team-a", "principals": ["key:alice", "key:ci-team-a"]},
+    {"role": "reader", "principals": ["*"]},
+    {"role": "ops", "principals": ["key:root"]}
+  ],
+  "admins": ["key:root"]
+}`
+
+func mustRead(t *testing.T, s string) *Policy {
+	t.Helper()
+	p, err := Read(strings.NewReader(s))
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	return p
+}
+
+// --- Evaluate ---
+
+func TestEvaluate(t *testing.T) {
+	p := mustRead(t, teamPolicy)
+
+	tests := []struct {
+		principal string
+		op        auth.Operation
+		path      string
+		want      bool
+	}{
+		{"key:alice", auth.Write, "/team-a/report.pdf", true},
+		{"key:alice", auth.Write, "team-a", true},
+		{"key:alice", auth.Read, "/shared/handbook.md", true},
+		{"key:alice", auth.Write, "/shared/handbook.md", false},
+		{"key:alice", auth.Delete, "/team-a/report.pdf", false},
+		{"key:alice", auth.Write, "/team-ab/x", false},
+		{"key:alice", auth.Read, "/public/logo.png", true},
+		{"key:alice", auth.Read, "/", true},
+		{"key:alice", auth.Read, "/team-b/x", false},
+		{"key:bob", auth.Read, "/public/logo.png", true},
+		{"key:bob", auth.Read, "/team-a/x", false},
+		// A token whose subject is a bound key's ID gets nothing of the key.
+		{"jwt:https://idp.example.com/alice", auth.Write, "/team-a/report.pdf", false},
+		{"jwt:https://idp.example.com/alice", auth.Read, "/public/logo.png", true},
+		{"key:root", auth.Delete, "/team-a/x", true},
+	}
+	for _, tt := range tests {
+		d := p.Evaluate(tt.principal, tt.op, tt.path)
+		if d.Allowed != tt.want {
+			t.Errorf("Evaluate(%s, %s, %s) = %v (%s), want %v", tt.principal, tt.op, tt.path, d.Allowed, d.Reason, tt.want)
+		}
+	}
+}
+
+func TestEvaluate_Explains(t *testing.T) {
+	p := mustRead(t, teamPolicy)
+
+	d := p.Evaluate("key:alice", auth.Delete, "/team-a/report.pdf")
+	if want := "delete on /team-a/report.pdf denied by role team-a rule 3"; d.Reason != want {
+		t.Errorf("expected reason %q, got %q", want, d.Reason)
+	}
+	if len(d.Roles) != 2 || d.Roles[0] != "reader" || d.Roles[1] != "team-a" {
+		t.Errorf("expected roles [reader team-a], got %v", d.Roles)
+	}
+	if len(d.Matches) != 2 || d.Matches[0].Effect != "allow" || d.Matches[1].Effect != "deny" || d.Matches[1].Rule != 3 {
+		t.Errorf("unexpected matches %+v", d.Matches)
+	}
+
+	d = p.Evaluate("key:bob", auth.Write, "/public/x")
+	if want := "no rule allows write on /public/x"; d.Reason != want {
+		t.Errorf("expected reason %q, got %q", want, d.Reason)
+	}
+
+	p = mustRead(t, `{"roles": {"r": {"rules": [{"paths": ["/"], "allow": ["read"]}]}}, "bindings": [{"role": "r", "principals": ["key:a"]}]}`)
+	d = p.Evaluate("key:nobody", auth.Read, "/")
+	if want := "no role is bound to key:nobody"; d.Reason != want {
+		t.Errorf("expected reason %q, got %q", want, d.Reason)
+	}
+}
+
+func TestMatchSegments(t *testing.T) {
+	tests := []struct {
+		glob, path string
+		want       bool
+	}{
+		{"/", "", true},
+		{"/", "a", false},
+		{"/**", "", true},
+		{"/**", "a/b/c", true},
+		{"/a/*", "a/b", true},
+		{"/a/*", "a/b/c", false},
+		{"/a/*", "a", false},
+		{"/a/**/c.txt", "a/c.txt", true},
+		{"/a/**/c.txt", "a/x/y/c.txt", true},
+		{"/a/**/c.txt", "a/x/y/d.txt", false},
+		{"/*/reports/*.pdf", "team/reports/q1.pdf", true},
+		{"/*/reports/*.pdf", "team/reports/q1.txt", false},
+		{"/logs/2026-??", "logs/2026-10", true},
+	}
+	for _, tt := range tests {
+		if got := matchSegments(segments(tt.glob), segments(tt.path)); got != tt.want {
+			t.Errorf("match(%q, %q) = %v, want %v", tt.glob, tt.path, got, tt.want)
+		}
+	}
+}
+
+// sharedPolicy allows reading and deleting /shared except for
+// /shared/secret, and reading single files in /drop.
+const sharedPolicy = `{
+  "roles": {
+    "staff": {"rules": [
+      {"paths": ["/shared/**"], "allow": ["read", "delete"]},
+      {"paths": ["/shared/secret/**"], "deny": ["read", "delete"]},
+      {"paths": ["/drop", "/drop/*"], "allow": ["read"]}
+    ]}
+  },
+  "bindings": [{"role": "staff", "principals": ["key:alice"]}]
+}`
+
+func TestEvaluateTree(t *testing.T) {
+	p := mustRead(t, sharedPolicy)
+
+	tests := []struct {
+		op   auth.Operation
+		path string
+		want bool
+	}{
+		{auth.Delete, "/shared/docs", true},
+		{auth.Delete, "/shared/secret", false},
+		{auth.Delete, "/shared", false},
+		{auth.Read, "/shared", false},
+		{auth.Read, "/", false},
+		{auth.Read, "/drop", false},
+		{auth.Read, "/drop/a", false},
+		{auth.Read, "/shared/docs/sub", true},
+	}
+	for _, tt := range tests {
+		d := p.EvaluateTree("key:alice", tt.op, tt.path)
+		if d.Allowed != tt.want {
+			t.Errorf("EvaluateTree(%s, %s) = %v (%s), want %v", tt.op, tt.path, d.Allowed, d.Reason, tt.want)
+		}
+	}
+
+	d := p.EvaluateTree("key:alice", auth.Delete, "/shared")
+	if want := "delete below /shared denied by role staff rule 2"; d.Reason != want {
+		t.Errorf("expected reason %q, got %q", want, d.Reason)
+	}
+	d = p.EvaluateTree("key:alice", auth.Read, "/drop")
+	if want := "no rule allows read on everything below /drop"; d.Reason != want {
+		t.Errorf("expected reason %q, got %q", want, d.Reason)
+	}
+}
+
+func TestCoversBelow(t *testing.T) {
+	tests := []struct {
+		glob, dir   string
+		covers, may bool
+	}{
+		{"/**", "", true, true},
+		{"/a/**", "a", true, true},
+		{"/a/**", "a/b", true, true},
+		{"/a/**", "b", false, false},
+		{"/a/*", "a", false, true},
+		{"/a/*/**", "a", true, true},
+		{"/a/**/*", "a", true, true},
+		{"/a/b/**", "a", false, true},
+		{"/**/secret", "a", false, true},
+		{"/*/x/**", "a/x", true, true},
+		{"/a", "a", false, false},
+		{"/", "", false, false},
+	}
+	for _, tt := range tests {
+		glob, dir := segments(tt.glob), segments(tt.dir)
+		if got := coversBelow(glob, dir); got != tt.covers {
+			t.Errorf("coversBelow(%q, %q) = %v, want %v", tt.glob, tt.dir, got, tt.covers)
+		}
+		if got := overlapsBelow(glob, dir); got != tt.may {
+			t.Errorf("overlapsBelow(%q, %q) = %v, want %v", tt.glob, tt.dir, got, tt.may)
+		}
+	}
+}
+
+// --- Check ---
+
+func TestCheck(t *testing.T) {
+	p := mustRead(t, teamPolicy)
+
+	if err := p.Check(context.Background(), auth.Read, "/public/x"); !errors.Is(err, auth.ErrForbidden) {
+		t.Errorf("expected requests without a principal to be refused, got %v", err)
+	}
+
+	alice := auth.WithPrincipal(context.Background(), &auth.Principal{ID: "key:alice", Operations: []auth.Operation{auth.Read, auth.Write}})
+	if err := p.Check(alice, auth.Write, "/team-a/x"); err != nil {
+		t.Errorf("expected write to be allowed, got %v", err)
+	}
+	err := p.Check(alice, auth.Write, "/shared/x")
+	if !errors.Is(err, auth.ErrForbidden) || !strings.Contains(err.Error(), "no rule allows write on /shared/x") {
+		t.Errorf("expected policy denial, got %v", err)
+	}
+
+	// The credential's own scopes still apply: root's key only reads.
+	root := auth.WithPrincipal(context.Background(), &auth.Principal{ID: "key:root", Operations: []auth.Operation{auth.Read}})
+	if err := p.Check(root, auth.Delete, "/team-a/x"); !errors.Is(err, auth.ErrForbidden) {
+		t.Errorf("expected the key's scopes to limit the policy, got %v", err)
+	}
+}
+
+func TestCheckTree(t *testing.T) {
+	p := mustRead(t, sharedPolicy)
+	alice := auth.WithPrincipal(context.Background(), &auth.Principal{ID: "key:alice", Operations: []auth.Operation{auth.Read, auth.Delete}})
+
+	if err := p.CheckTree(alice, auth.Delete, "/shared/docs"); err != nil {
+		t.Errorf("expected deleting /shared/docs to be allowed, got %v", err)
+	}
+	if err := p.CheckTree(alice, auth.Delete, "/shared"); !errors.Is(err, auth.ErrForbidden) {
+		t.Errorf("expected a deny rule below /shared to refuse, got %v", err)
+	}
+	if err := p.CheckTree(context.Background(), auth.Read, "/shared/docs"); !errors.Is(err, auth.ErrForbidden) {
+		t.Errorf("expected requests without a principal to be refused, got %v", err)
+	}
+}
+
+// --- Loading ---
+
+func TestNew_Invalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy string
+	}{
+		{"unknown role", `{"roles": {}, "bindings": [{"role": "x", "principals": ["key:a"]}]}`},
+		{"no principals", `{"roles": {"r": {"rules": [{"paths": ["/"], "allow": ["read"]}]}}, "bindings": [{"role": "r"}]}`},
+		{"no rules", `{"roles": {"r": {"rules": []}}}`},
+		{"no paths", `{"roles": {"r": {"rules": [{"allow": ["read"]}]}}}`},
+		{"no operations", `{"roles": {"r": {"rules": [{"paths": ["/"]}]}}}`},
+		{"unknown operation", `{"roles": {"r": {"rules": [{"paths": ["/"], "allow": ["admin"]}]}}}`},
+		{"bad glob", `{"roles": {"r": {"rules": [{"paths": ["/a/[b"], "allow": ["read"]}]}}}`},
+		{"unknown field", `{"roles": {"r": {"rules": [{"path": "/", "allow": ["read"]}]}}}`},
+		{"bare principal", `{"roles": {"r": {"rules": [{"paths": ["/"], "allow": ["read"]}]}}, "bindings": [{"role": "r", "principals": ["alice"]}]}`},
+		{"bare admin", `{"roles": {}, "admins": ["alice"]}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Read(strings.NewReader(tt.policy)); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.json")
+	if err := os.WriteFile(path, []byte(teamPolicy), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	p, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if !p.IsAdmin("key:root") || p.IsAdmin("key:alice") {
+		t.Error("expected only root to be an admin")
+	}
+}
@@ -0,0 +1,178 @@
+// Package share signs and verifies links that grant access to a single
+// storage path without credentials.
+//
+// A link is a set of query parameters: the path, the operation, an expiry,
+// an optional upload size limit and the ID of the principal who created it,
+// all covered by an HMAC-SHA256 signature under a server secret. Anyone
+// holding the link may perform its operation on its path until it expires,
+// or, for a bound link, until its creator loses that permission; changing
+// any parameter invalidates the signature.
+package share
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"go-storage-api/internal/auth"
+)
+
+// MinSecretSize is the shortest accepted signing secret, in bytes.
+const MinSecretSize = 32
+
+// ErrExpired is returned by Verify for a link past its expiry. It wraps
+// into auth.ErrInvalidCredentials like every other verification error.
+var ErrExpired = errors.New("share link expired")
+
+// Query parameters of a link. Path is the one the file routes read.
+const (
+	ParamPath      = "path"
+	ParamOperation = "op"
+	ParamExpires   = "expires"
+	ParamMaxSize   = "maxSize"
+	ParamCreatedBy = "by"
+	ParamBound     = "bound"
+	ParamSignature = "sig"
+)
+
+// Link is what a share link grants.
+type Link struct {
+	// Path is the storage path, cleaned as by auth.Clean.
+	Path string
+	// Operation is auth.Read to download the file or auth.Write to upload
+	// it.
+	Operation auth.Operation
+	Expires   time.Time
+	// MaxSize, if positive, caps the size of an upload.
+	MaxSize int64
+	// CreatedBy is the ID of the principal who created the link. Requests
+	// made with the link act as that principal, so a policy still applies.
+	CreatedBy string
+	// Bound marks a link whose creator the server can look up when the
+	// link is used, such as an API key. A bound link is only honoured while
+	// the creator exists and may still perform the operation on the path.
+	Bound bool
+}
+
+// Principal returns the principal a request made with l acts as: its
+// creator, limited to the link's operation, path and upload size.
+func (l Link) Principal() *auth.Principal {
+	return &auth.Principal{
+		ID:         l.CreatedBy,
+		Operations: []auth.Operation{l.Operation},
+		Prefixes:   []string{l.Path},
+		MaxSize:    l.MaxSize,
+	}
+}
+
+// Signer signs and verifies links with a secret.
+type Signer struct {
+	secret []byte
+	now    func() time.Time
+}
+
+// New returns a Signer for secret, which must be at least MinSecretSize
+// bytes. Replacing the secret revokes every link signed with the old one.
+func New(secret []byte) (*Signer, error) {
+	if len(secret) < MinSecretSize {
+		return nil, fmt.Errorf("share secret must be at least %d bytes", MinSecretSize)
+	}
+	return &Signer{secret: secret, now: time.Now}, nil
+}
+
+// Sign returns the query parameters of l, including its signature.
+func (s *Signer) Sign(l Link) url.Values {
+	l.Path = auth.Clean(l.Path)
+	q := url.Values{}
+	q.Set(ParamPath, "/"+l.Path)
+	q.Set(ParamOperation, string(l.Operation))
+	q.Set(ParamExpires, strconv.FormatInt(l.Expires.Unix(), 10))
+	if l.MaxSize > 0 {
+		q.Set(ParamMaxSize, strconv.FormatInt(l.MaxSize, 10))
+	}
+	if l.CreatedBy != "" {
+		q.Set(ParamCreatedBy, l.CreatedBy)
+	}
+	if l.Bound {
+		q.Set(ParamBound, "1")
+	}
+	q.Set(ParamSignature, base64.RawURLEncoding.EncodeToString(s.mac(l)))
+	return q
+}
+
+// Signed reports whether q carries a link signature at all.
+func Signed(q url.Values) bool {
+	return q.Has(ParamSignature)
+}
+
+// Verify checks the link in q and returns what it grants. Every parameter
+// may appear at most once, so a handler cannot read a different path from
+// the one that was signed. Errors wrap auth.ErrInvalidCredentials.
+func (s *Signer) Verify(q url.Values) (Link, error) {
+	for _, name := range []string{ParamPath, ParamOperation, ParamExpires, ParamMaxSize, ParamCreatedBy, ParamBound, ParamSignature} {
+		if len(q[name]) > 1 {
+			return Link{}, invalid("repeated " + name + " parameter")
+		}
+	}
+
+	if !q.Has(ParamPath) {
+		return Link{}, invalid("missing path")
+	}
+	l := Link{Path: auth.Clean(q.Get(ParamPath))}
+	switch op := auth.Operation(q.Get(ParamOperation)); op {
+	case auth.Read, auth.Write:
+		l.Operation = op
+	default:
+		return Link{}, invalid("op must be read or write")
+	}
+	expires, err := strconv.ParseInt(q.Get(ParamExpires), 10, 64)
+	if err != nil {
+		return Link{}, invalid("malformed expiry")
+	}
+	l.Expires = time.Unix(expires, 0)
+	if v := q.Get(ParamMaxSize); v != "" {
+		if l.MaxSize, err = strconv.ParseInt(v, 10, 64); err != nil || l.MaxSize <= 0 {
+			return Link{}, invalid("malformed maxSize")
+		}
+	}
+	l.CreatedBy = q.Get(ParamCreatedBy)
+	switch q.Get(ParamBound) {
+	case "1":
+		l.Bound = true
+	case "":
+	default:
+		return Link{}, invalid("malformed bound")
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(q.Get(ParamSignature))
+	if err != nil {
+		return Link{}, invalid("malformed signature")
+	}
+	if !hmac.Equal(sig, s.mac(l)) {
+		return Link{}, invalid("bad signature")
+	}
+	// The expiry is only trusted once the signature is.
+	if !s.now().Before(l.Expires) {
+		return Link{}, fmt.Errorf("%w: %w", auth.ErrInvalidCredentials, ErrExpired)
+	}
+	return l, nil
+}
+
+// mac is the HMAC of the fields of l. They are encoded as a JSON array so
+// no field can spill into the next.
+func (s *Signer) mac(l Link) []byte {
+	msg, _ := json.Marshal([]any{"v1", l.Operation, l.Path, l.Expires.Unix(), l.MaxSize, l.CreatedBy, l.Bound})
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write(msg)
+	return mac.Sum(nil)
+}
+
+func invalid(msg string) error {
+	return fmt.Errorf("%w: share link: %s", auth.ErrInvalidCredentials, msg)
+}
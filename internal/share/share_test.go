@@ -0,0 +1,112 @@
+package share
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"go-storage-api/internal/auth"
+)
+
+var testSecret = []byte(strings.Repeat("s", MinSecretSize))
+
+func newTestSigner(t *testing.T, now time.Time) *Signer {
+	t.Helper()
+	s, err := New(testSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.now = func() time.Time { return now }
+	return s
+}
+
+// --- Sign / Verify ---
+
+func TestSignVerify(t *testing.T) {
+	now := time.Unix(1_800_000_000, 0)
+	s := newTestSigner(t, now)
+
+	q := s.Sign(Link{Path: "/reports//q3.pdf", Operation: auth.Write, Expires: now.Add(time.Hour), MaxSize: 1024, CreatedBy: "alice"})
+	if q.Get(ParamPath) != "/reports/q3.pdf" {
+		t.Errorf("expected a cleaned path, got %q", q.Get(ParamPath))
+	}
+	l, err := s.Verify(q)
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if l.Path != "reports/q3.pdf" || l.Operation != auth.Write || !l.Expires.Equal(now.Add(time.Hour)) || l.MaxSize != 1024 || l.CreatedBy != "alice" {
+		t.Errorf("unexpected link %+v", l)
+	}
+
+	p := l.Principal()
+	if p.ID != "alice" || p.MaxSize != 1024 || !p.Allows(auth.Write, "/reports/q3.pdf") {
+		t.Errorf("unexpected principal %+v", p)
+	}
+	if p.Allows(auth.Read, "/reports/q3.pdf") || p.Allows(auth.Write, "/reports/q4.pdf") {
+		t.Error("expected the principal to be limited to the link")
+	}
+
+	q = s.Sign(Link{Path: "/a.txt", Operation: auth.Read, Expires: now.Add(time.Hour), CreatedBy: "alice", Bound: true})
+	if l, err := s.Verify(q); err != nil || !l.Bound {
+		t.Errorf("expected a bound link, got %+v, %v", l, err)
+	}
+}
+
+func TestVerify_Rejects(t *testing.T) {
+	now := time.Unix(1_800_000_000, 0)
+	s := newTestSigner(t, now)
+	link := Link{Path: "/a.txt", Operation: auth.Read, Expires: now.Add(time.Hour), CreatedBy: "alice"}
+
+	other, err := New([]byte(strings.Repeat("o", MinSecretSize)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		modify func(q url.Values)
+	}{
+		{"other path", func(q url.Values) { q[ParamPath] = []string{"/b.txt"} }},
+		{"other op", func(q url.Values) { q[ParamOperation] = []string{"write"} }},
+		{"delete op", func(q url.Values) { q[ParamOperation] = []string{"delete"} }},
+		{"later expiry", func(q url.Values) { q[ParamExpires] = []string{"1900000000"} }},
+		{"added size", func(q url.Values) { q[ParamMaxSize] = []string{"10"} }},
+		{"other creator", func(q url.Values) { q[ParamCreatedBy] = []string{"root"} }},
+		{"added bound", func(q url.Values) { q[ParamBound] = []string{"1"} }},
+		{"malformed bound", func(q url.Values) { q[ParamBound] = []string{"yes"} }},
+		{"repeated path", func(q url.Values) { q[ParamPath] = append(q[ParamPath], "/b.txt") }},
+		{"no path", func(q url.Values) { delete(q, ParamPath) }},
+		{"bad signature", func(q url.Values) { q[ParamSignature] = []string{"!"} }},
+		{"other secret", func(q url.Values) { q[ParamSignature] = other.Sign(link)[ParamSignature] }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := s.Sign(link)
+			tt.modify(q)
+			if _, err := s.Verify(q); !errors.Is(err, auth.ErrInvalidCredentials) {
+				t.Errorf("expected ErrInvalidCredentials, got %v", err)
+			}
+		})
+	}
+}
+
+func TestVerify_Expired(t *testing.T) {
+	now := time.Unix(1_800_000_000, 0)
+	s := newTestSigner(t, now)
+
+	q := s.Sign(Link{Path: "/a.txt", Operation: auth.Read, Expires: now})
+	_, err := s.Verify(q)
+	if !errors.Is(err, ErrExpired) || !errors.Is(err, auth.ErrInvalidCredentials) {
+		t.Errorf("expected an expired link, got %v", err)
+	}
+}
+
+// --- New ---
+
+func TestNew_ShortSecret(t *testing.T) {
+	if _, err := New([]byte("short")); err == nil {
+		t.Error("expected short secrets to be rejected")
+	}
+}
@@ -0,0 +1,78 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// asidePrefix starts the name under which a backend keeps the old file
+// while it replaces it. Unlike the random names of TempName, the name of
+// the target follows, so the file can be put back if the process stops
+// before the new one is in place.
+const asidePrefix = TempPrefix + "aside-"
+
+// AsideName returns the name to move the existing file at the cleaned path
+// name to while a backend that cannot rename over a file replaces it. The
+// backend removes the aside file once the new one is in place and puts it
+// back if that rename fails. Between the two renames nothing exists at
+// name, and a process that stops there leaves the old file for Recover.
+func AsideName(name string) string {
+	return path.Join(path.Dir(name), asidePrefix+path.Base(name))
+}
+
+// Recoverer is implemented by backends that replace files through
+// AsideName and so may leave old files behind under it after a crash.
+type Recoverer interface {
+	// Recover puts back every aside file whose target is missing, removes
+	// those whose replacement is in place, and returns how many files it
+	// put back.
+	Recover(ctx context.Context) (int, error)
+}
+
+// RecoverAside implements Recoverer.Recover for a backend. readDir lists a
+// directory including temporary names, and rename and remove change single
+// files; all three take slash-separated paths relative to the root, "" for
+// the root itself. An aside file may also belong to a replacement still in
+// progress elsewhere, which then fails rather than losing either file.
+func RecoverAside(ctx context.Context, readDir func(dir string) ([]FileInfo, error), rename func(from, to string) error, remove func(name string) error) (int, error) {
+	restored := 0
+	var walk func(dir string) error
+	walk = func(dir string) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		entries, err := readDir(dir)
+		if err != nil {
+			return fmt.Errorf("recover %s: %w", dir, err)
+		}
+		exists := make(map[string]bool, len(entries))
+		for _, e := range entries {
+			exists[e.Name] = true
+		}
+		for _, e := range entries {
+			p := path.Join(dir, e.Name)
+			target, ok := strings.CutPrefix(e.Name, asidePrefix)
+			ok = ok && target != ""
+			switch {
+			case ok && !e.IsDir && exists[target]:
+				if err := remove(p); err != nil {
+					return fmt.Errorf("recover %s: %w", p, err)
+				}
+			case ok && !e.IsDir:
+				if err := rename(p, path.Join(dir, target)); err != nil {
+					return fmt.Errorf("recover %s: %w", p, err)
+				}
+				restored++
+			case e.IsDir && !IsTemp(e.Name):
+				if err := walk(p); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	err := walk("")
+	return restored, err
+}
@@ -0,0 +1,75 @@
+package storage
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+)
+
+// Checksum algorithms supported by FileInfo and NewHash.
+const (
+	SHA256 = "sha256"
+	MD5    = "md5"
+	CRC32C = "crc32c"
+)
+
+// Algorithms lists the supported checksum algorithms, strongest first.
+var Algorithms = []string{SHA256, MD5, CRC32C}
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// NewHash returns a hash for one of the supported algorithms, or ErrInvalid.
+func NewHash(algo string) (hash.Hash, error) {
+	switch algo {
+	case SHA256:
+		return sha256.New(), nil
+	case MD5:
+		return md5.New(), nil
+	case CRC32C:
+		return crc32.New(castagnoli), nil
+	}
+	return nil, fmt.Errorf("%w: unsupported checksum algorithm %q", ErrInvalid, algo)
+}
+
+// Checksum reads r to the end and returns its hex-encoded digest.
+func Checksum(r io.Reader, algo string) (string, error) {
+	h, err := NewHash(algo)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Checksum returns the hex-encoded digest recorded for algo, or "" if the
+// backend did not provide one.
+func (fi *FileInfo) Checksum(algo string) string {
+	switch algo {
+	case SHA256:
+		return fi.SHA256
+	case MD5:
+		return fi.MD5
+	case CRC32C:
+		return fi.CRC32C
+	}
+	return ""
+}
+
+// SetChecksum records a hex-encoded digest for algo. Unknown algorithms are
+// ignored.
+func (fi *FileInfo) SetChecksum(algo, sum string) {
+	switch algo {
+	case SHA256:
+		fi.SHA256 = sum
+	case MD5:
+		fi.MD5 = sum
+	case CRC32C:
+		fi.CRC32C = sum
+	}
+}
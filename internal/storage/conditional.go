@@ -0,0 +1,117 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Condition is a precondition on the current state of a file, checked by
+// WriteIf at the moment the file is replaced. The zero Condition always
+// holds.
+type Condition struct {
+	// IfMatch requires the file to exist with this entity tag, as returned
+	// by ETag. "*" matches any existing file. Directories never match.
+	IfMatch string
+	// IfNoneMatch requires that nothing exists at the path.
+	IfNoneMatch bool
+}
+
+// ConditionalWriter is implemented by backends that can check a Condition
+// and change a file in one step, so no other write can slip in between.
+type ConditionalWriter interface {
+	// WriteIf behaves like Write, but fails with ErrPrecondition and leaves
+	// the path untouched unless cond holds when the file is replaced.
+	// IfMatch is never "*"; the WriteIf helper resolves it first.
+	WriteIf(ctx context.Context, path string, r io.Reader, cond Condition) error
+	// DeleteIf deletes the file at path only if its entity tag is etag, and
+	// fails with ErrPrecondition otherwise, including when path is missing
+	// or a directory.
+	DeleteIf(ctx context.Context, path, etag string) error
+}
+
+// ETag returns the entity tag of a file: the one reported by the backend,
+// or one derived from size and modification time for backends without
+// their own. A rewrite with identical size within the backend's timestamp
+// resolution keeps the same tag.
+func ETag(info *FileInfo) string {
+	if info.ETag != "" {
+		return info.ETag
+	}
+	return fmt.Sprintf(`"%x-%x"`, info.Size, info.ModTime.UnixNano())
+}
+
+// Check reports whether cond holds for a file described by info, which is
+// nil if nothing exists at the path. It fails with ErrPrecondition if not.
+func (c Condition) Check(info *FileInfo) error {
+	if c.IfNoneMatch && info != nil {
+		return fmt.Errorf("%w: %s exists", ErrPrecondition, info.Path)
+	}
+	if c.IfMatch != "" {
+		if info == nil || info.IsDir || (c.IfMatch != "*" && c.IfMatch != ETag(info)) {
+			return fmt.Errorf("%w: entity tag does not match", ErrPrecondition)
+		}
+	}
+	return nil
+}
+
+// stat is Stat with ErrNotFound turned into a nil FileInfo, the form Check
+// takes.
+func stat(ctx context.Context, s Storage, p string) (*FileInfo, error) {
+	info, err := s.Stat(ctx, p)
+	if errors.Is(err, ErrNotFound) {
+		return nil, nil
+	}
+	return info, err
+}
+
+// WriteIf writes a file to s if cond holds. The check and the write are
+// atomic, so only backends implementing ConditionalWriter can do this; all
+// others fail with ErrNotSupported before r is read. A Stat followed by a
+// Write would let another writer, in this process or elsewhere, slip in
+// between.
+func WriteIf(ctx context.Context, s Storage, p string, r io.Reader, cond Condition) error {
+	if cond == (Condition{}) {
+		return s.Write(ctx, p, r)
+	}
+	cw, ok := s.(ConditionalWriter)
+	if !ok {
+		return fmt.Errorf("conditional write: %w", ErrNotSupported)
+	}
+
+	if cond.IfMatch == "*" {
+		info, err := stat(ctx, s, p)
+		if err != nil {
+			return err
+		}
+		if err := cond.Check(info); err != nil {
+			return err
+		}
+		// Pin the tag just seen, so the backend refuses the write if the
+		// file changes before it lands.
+		cond.IfMatch = ETag(info)
+	}
+	return cw.WriteIf(ctx, p, r, cond)
+}
+
+// DeleteIf deletes the file at p from s if its entity tag is etag, with the
+// same guarantees as WriteIf.
+func DeleteIf(ctx context.Context, s Storage, p, etag string) error {
+	cw, ok := s.(ConditionalWriter)
+	if !ok {
+		return fmt.Errorf("conditional delete: %w", ErrNotSupported)
+	}
+
+	if etag == "*" {
+		info, err := stat(ctx, s, p)
+		if err != nil {
+			return err
+		}
+		if err := (Condition{IfMatch: etag}).Check(info); err != nil {
+			return err
+		}
+		etag = ETag(info)
+	}
+	return cw.DeleteIf(ctx, p, etag)
+}
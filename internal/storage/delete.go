@@ -0,0 +1,56 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"path"
+	"strings"
+)
+
+// TreeDeleter is implemented by backends that can remove a directory and
+// everything below it in one operation.
+type TreeDeleter interface {
+	// DeleteAll removes path and, if it is a directory, all of its contents.
+	// It fails with ErrNotFound if path does not exist and with
+	// ErrPermission for the root.
+	DeleteAll(ctx context.Context, path string) error
+}
+
+// DeleteAll removes a file or a directory tree from s. Backends implementing
+// TreeDeleter do this natively; for all others the tree is walked with List
+// and removed bottom-up with Delete.
+func DeleteAll(ctx context.Context, s Storage, p string) error {
+	// Checked up front: the fallback would otherwise empty the root before
+	// its own Delete is refused.
+	if strings.TrimPrefix(path.Clean("/"+p), "/") == "" {
+		return ErrPermission
+	}
+	if d, ok := s.(TreeDeleter); ok {
+		return d.DeleteAll(ctx, p)
+	}
+	return deleteTree(ctx, s, p)
+}
+
+func deleteTree(ctx context.Context, s Storage, p string) error {
+	info, err := s.Stat(ctx, p)
+	if err != nil {
+		return err
+	}
+	if info.IsDir {
+		entries, err := s.List(ctx, p)
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			if err := deleteTree(ctx, s, e.Path); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Backends without real directories drop them with their last entry.
+	if err := s.Delete(ctx, p); err != nil && !(info.IsDir && errors.Is(err, ErrNotFound)) {
+		return err
+	}
+	return nil
+}
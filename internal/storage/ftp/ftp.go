@@ -0,0 +1,655 @@
+package ftp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jlaffaye/ftp"
+
+	"go-storage-api/internal/storage"
+)
+
+const dialTimeout = 10 * time.Second
+
+// Storage implements storage.Storage against an FTP server. ftp.ServerConn is
+// not goroutine-safe, so each operation borrows a control connection from a
+// bounded pool (see ADR-014).
+type Storage struct {
+	addr     string
+	user     string
+	password string
+
+	// slots holds one token per connection that may be open at once.
+	// Acquiring a token is what bounds concurrency; idle holds connections
+	// that are logged in and waiting to be reused.
+	slots chan struct{}
+	idle  chan *ftp.ServerConn
+
+	mu     sync.Mutex
+	closed bool
+}
+
+// New connects to the FTP server and returns a backend that keeps at most
+// poolSize control connections open. One connection is established eagerly
+// so that bad credentials fail at startup.
+func New(host, port, user, password string, poolSize int) (*Storage, error) {
+	if poolSize < 1 {
+		return nil, fmt.Errorf("pool size must be at least 1, got %d", poolSize)
+	}
+
+	s := &Storage{
+		addr:     net.JoinHostPort(host, port),
+		user:     user,
+		password: password,
+		slots:    make(chan struct{}, poolSize),
+		idle:     make(chan *ftp.ServerConn, poolSize),
+	}
+
+	c, err := s.acquire(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	s.release(c, nil)
+	return s, nil
+}
+
+func (s *Storage) List(ctx context.Context, p string) ([]storage.FileInfo, error) {
+	dir, err := serverPath(p)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := s.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// LIST on a missing path is answered with an empty listing by some
+	// servers, so confirm the directory exists first.
+	info, err := stat(c, dir)
+	if err == nil && !info.IsDir {
+		s.release(c, nil)
+		return nil, fmt.Errorf("list %s: not a directory", dir)
+	}
+	var entries []*ftp.Entry
+	if err == nil {
+		entries, err = c.List(dir)
+	}
+	s.release(c, err)
+	if err != nil {
+		return nil, mapError(err)
+	}
+
+	files := make([]storage.FileInfo, 0, len(entries))
+	for _, e := range entries {
+		if e.Name == "." || e.Name == ".." || storage.IsTemp(e.Name) {
+			continue
+		}
+		files = append(files, toFileInfo(path.Join(dir, e.Name), e))
+	}
+	return files, nil
+}
+
+func (s *Storage) Read(ctx context.Context, p string) (io.ReadCloser, error) {
+	name, err := serverPath(p)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := s.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.Retr(name)
+	if err != nil {
+		s.release(c, err)
+		return nil, mapError(err)
+	}
+	return &reader{Response: resp, s: s, c: c}, nil
+}
+
+// ReadRange restarts the transfer at offset with REST. Servers that do not
+// implement REST get the whole file with the leading bytes discarded.
+func (s *Storage) ReadRange(ctx context.Context, p string, offset, length int64) (io.ReadCloser, error) {
+	if offset <= 0 {
+		return s.readDiscarding(ctx, p, 0, length)
+	}
+
+	name, err := serverPath(p)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := s.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.RetrFrom(name, uint64(offset))
+	if err != nil {
+		s.release(c, err)
+		var perr *textproto.Error
+		if errors.As(err, &perr) && perr.Code >= 500 && perr.Code <= 504 {
+			return s.readDiscarding(ctx, p, offset, length)
+		}
+		return nil, mapError(err)
+	}
+	return storage.LimitReadCloser(&reader{Response: resp, s: s, c: c}, length), nil
+}
+
+func (s *Storage) readDiscarding(ctx context.Context, p string, offset, length int64) (io.ReadCloser, error) {
+	rc, err := s.Read(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.CopyN(io.Discard, rc, offset); err != nil && err != io.EOF {
+		rc.Close()
+		return nil, err
+	}
+	return storage.LimitReadCloser(rc, length), nil
+}
+
+// Write uploads a storage.TempName sibling on one pooled connection and
+// moves it into place with replace.
+func (s *Storage) Write(ctx context.Context, p string, r io.Reader) error {
+	name, err := serverPath(p)
+	if err != nil {
+		return err
+	}
+	if name == "/" {
+		return storage.ErrPermission
+	}
+
+	c, err := s.acquire(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err := mkdirAll(c, path.Dir(name)); err != nil {
+		s.release(c, err)
+		return fmt.Errorf("write file: %w", mapError(err))
+	}
+	tmp := storage.TempName(name)
+	err = c.Stor(tmp, r)
+	if err == nil {
+		err = replace(c, tmp, name)
+	}
+	s.release(c, err)
+	if err != nil {
+		s.removeTemp(ctx, tmp)
+		return fmt.Errorf("write file: %w", mapError(err))
+	}
+	return nil
+}
+
+// removeTemp deletes the temporary file of a failed Write on a connection
+// of its own, since the one that carried the upload is usually unusable by
+// then.
+func (s *Storage) removeTemp(ctx context.Context, tmp string) {
+	c, err := s.acquire(context.WithoutCancel(ctx))
+	if err != nil {
+		return
+	}
+	err = c.Delete(tmp)
+	s.release(c, err)
+}
+
+// replace renames from over the file to with RNFR/RNTO, which most Unix
+// servers carry out as one rename(2) that replaces an existing file. Where
+// RNTO refuses an existing file, that file goes through its
+// storage.AsideName.
+func replace(c *ftp.ServerConn, from, to string) error {
+	err := c.Rename(from, to)
+	if err == nil {
+		return nil
+	}
+	info, statErr := stat(c, to)
+	switch {
+	case statErr != nil:
+		return err
+	case info.IsDir:
+		return fmt.Errorf("replace %s: %w", to, storage.ErrExist)
+	}
+
+	old := storage.AsideName(to)
+	if err := c.Rename(to, old); err != nil {
+		return err
+	}
+	if err := c.Rename(from, to); err != nil {
+		c.Rename(old, to)
+		return err
+	}
+	c.Delete(old)
+	return nil
+}
+
+// Recover puts back the files replace left aside.
+func (s *Storage) Recover(ctx context.Context) (int, error) {
+	c, err := s.acquire(ctx)
+	if err != nil {
+		return 0, err
+	}
+	readDir := func(dir string) ([]storage.FileInfo, error) {
+		entries, err := c.List("/" + dir)
+		if err != nil {
+			return nil, err
+		}
+		files := make([]storage.FileInfo, 0, len(entries))
+		for _, e := range entries {
+			if e.Name != "." && e.Name != ".." {
+				files = append(files, toFileInfo(path.Join("/", dir, e.Name), e))
+			}
+		}
+		return files, nil
+	}
+	rename := func(from, to string) error {
+		return c.Rename("/"+from, "/"+to)
+	}
+	remove := func(name string) error {
+		return c.Delete("/" + name)
+	}
+	n, err := storage.RecoverAside(ctx, readDir, rename, remove)
+	s.release(c, err)
+	return n, mapError(err)
+}
+
+func (s *Storage) Delete(ctx context.Context, p string) error {
+	name, err := serverPath(p)
+	if err != nil {
+		return err
+	}
+	if name == "/" {
+		return storage.ErrPermission
+	}
+
+	c, err := s.acquire(ctx)
+	if err != nil {
+		return err
+	}
+
+	// FTP has separate commands for files and directories. Try DELE first and
+	// fall back to RMD so that empty directories behave as on local storage.
+	err = c.Delete(name)
+	if isStatus(err, ftp.StatusFileUnavailable) {
+		if rmErr := c.RemoveDir(name); rmErr == nil {
+			err = nil
+		} else if info, statErr := stat(c, name); statErr == nil && info.IsDir {
+			// RMD failed on an existing directory, which servers answer
+			// with a generic 550 when it still has entries.
+			err = rmErr
+			if entries, listErr := c.List(name); listErr == nil && hasEntries(entries) {
+				err = fmt.Errorf("delete %s: %w", name, storage.ErrNotEmpty)
+			}
+		}
+	}
+	s.release(c, err)
+	if err != nil {
+		return mapError(err)
+	}
+	return nil
+}
+
+func (s *Storage) Mkdir(ctx context.Context, p string) error {
+	name, err := serverPath(p)
+	if err != nil {
+		return err
+	}
+	if name == "/" {
+		return storage.ErrPermission
+	}
+
+	c, err := s.acquire(ctx)
+	if err != nil {
+		return err
+	}
+
+	_, err = stat(c, name)
+	switch {
+	case err == nil:
+		err = fmt.Errorf("mkdir %s: %w", name, storage.ErrExist)
+	case errors.Is(mapError(err), storage.ErrNotFound):
+		// Unlike the parents, the directory itself must be created here.
+		err = mkdirAll(c, path.Dir(name))
+		if err == nil {
+			err = c.MakeDir(name)
+		}
+	}
+	s.release(c, err)
+	if err != nil {
+		return mapError(err)
+	}
+	return nil
+}
+
+// Move renames with RNFR/RNTO, replacing an existing file at to the way
+// Write does.
+func (s *Storage) Move(ctx context.Context, from, to string) error {
+	src, err := serverPath(from)
+	if err != nil {
+		return err
+	}
+	dst, err := serverPath(to)
+	if err != nil {
+		return err
+	}
+	if src == "/" || dst == "/" {
+		return storage.ErrPermission
+	}
+
+	c, err := s.acquire(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = mkdirAll(c, path.Dir(dst))
+	if err == nil {
+		err = replace(c, src, dst)
+	}
+	s.release(c, err)
+	if err != nil {
+		return mapError(err)
+	}
+	return nil
+}
+
+// Copy duplicates files through a local temporary file. FTP has no
+// server-side copy, and streaming from Read into Write would hold one pooled
+// connection while waiting for a second, which deadlocks a pool of one.
+func (s *Storage) Copy(ctx context.Context, from, to string) error {
+	info, err := s.Stat(ctx, from)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir {
+		return s.copyFile(ctx, from, to)
+	}
+
+	if err := s.Mkdir(ctx, to); err != nil && !errors.Is(err, storage.ErrExist) {
+		return err
+	}
+	entries, err := s.List(ctx, from)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if err := s.Copy(ctx, e.Path, path.Join(to, e.Name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copyFile downloads from completely, releasing its connection, before
+// uploading to.
+func (s *Storage) copyFile(ctx context.Context, from, to string) error {
+	spool, err := os.CreateTemp("", "ftp-copy-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(spool.Name())
+	defer spool.Close()
+
+	rc, err := s.Read(ctx, from)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(spool, rc)
+	if cerr := rc.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("copy %s: %w", from, mapError(err))
+	}
+	if _, err := spool.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	return s.Write(ctx, to, spool)
+}
+
+func (s *Storage) Stat(ctx context.Context, p string) (*storage.FileInfo, error) {
+	name, err := serverPath(p)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := s.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := stat(c, name)
+	s.release(c, err)
+	if err != nil {
+		return nil, mapError(err)
+	}
+	return info, nil
+}
+
+// Close quits every idle connection. Connections still borrowed by in-flight
+// requests are closed when they are released.
+func (s *Storage) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	s.mu.Unlock()
+
+	for {
+		select {
+		case c := <-s.idle:
+			c.Quit()
+		default:
+			return nil
+		}
+	}
+}
+
+// acquire takes a pool slot, blocking until one is free or ctx is done, and
+// returns a healthy connection for it. Idle connections are checked with NOOP
+// before reuse and replaced if the server has dropped them.
+func (s *Storage) acquire(ctx context.Context) (*ftp.ServerConn, error) {
+	select {
+	case s.slots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	s.mu.Lock()
+	closed := s.closed
+	s.mu.Unlock()
+	if closed {
+		<-s.slots
+		return nil, errors.New("ftp storage is closed")
+	}
+
+	for {
+		select {
+		case c := <-s.idle:
+			if err := c.NoOp(); err != nil {
+				c.Quit()
+				continue
+			}
+			return c, nil
+		default:
+		}
+
+		c, err := s.dial(ctx)
+		if err != nil {
+			<-s.slots
+			return nil, err
+		}
+		return c, nil
+	}
+}
+
+// release returns c to the idle pool and frees its slot. If opErr indicates
+// the control connection is no longer usable, c is closed instead.
+func (s *Storage) release(c *ftp.ServerConn, opErr error) {
+	defer func() { <-s.slots }()
+
+	s.mu.Lock()
+	closed := s.closed
+	s.mu.Unlock()
+
+	if closed || (opErr != nil && !isProtocolError(opErr)) {
+		c.Quit()
+		return
+	}
+
+	select {
+	case s.idle <- c:
+	default:
+		c.Quit()
+	}
+}
+
+func (s *Storage) dial(ctx context.Context) (*ftp.ServerConn, error) {
+	c, err := ftp.Dial(s.addr,
+		ftp.DialWithContext(ctx),
+		ftp.DialWithTimeout(dialTimeout),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("ftp connect: %w", err)
+	}
+	if err := c.Login(s.user, s.password); err != nil {
+		c.Quit()
+		return nil, fmt.Errorf("ftp login: %w", mapError(err))
+	}
+	return c, nil
+}
+
+// reader returns its control connection to the pool once the data transfer
+// has been closed.
+type reader struct {
+	*ftp.Response
+	s    *Storage
+	c    *ftp.ServerConn
+	once sync.Once
+}
+
+func (r *reader) Close() error {
+	err := r.Response.Close()
+	r.once.Do(func() { r.s.release(r.c, err) })
+	return err
+}
+
+// stat emulates a stat call. MLST is used when the server supports it;
+// otherwise the parent directory is listed and searched for the entry.
+func stat(c *ftp.ServerConn, name string) (*storage.FileInfo, error) {
+	if name == "/" {
+		return &storage.FileInfo{Name: "/", Path: "", IsDir: true}, nil
+	}
+
+	entry, err := c.GetEntry(name)
+	if err == nil {
+		entry.Name = path.Base(name)
+		info := toFileInfo(name, entry)
+		return &info, nil
+	}
+	if !isStatus(err, ftp.StatusNotImplemented) && !isStatus(err, ftp.StatusBadCommand) {
+		return nil, err
+	}
+
+	entries, err := c.List(path.Dir(name))
+	if err != nil {
+		return nil, err
+	}
+	base := path.Base(name)
+	for _, e := range entries {
+		if e.Name == base {
+			info := toFileInfo(name, e)
+			return &info, nil
+		}
+	}
+	return nil, storage.ErrNotFound
+}
+
+// mkdirAll creates dir and any missing parents. MKD errors are ignored
+// because most servers report an existing directory as 550; a genuine
+// failure surfaces when the file itself is stored.
+func mkdirAll(c *ftp.ServerConn, dir string) error {
+	if dir == "/" {
+		return nil
+	}
+	current := ""
+	for _, part := range strings.Split(strings.TrimPrefix(dir, "/"), "/") {
+		current += "/" + part
+		if err := c.MakeDir(current); err != nil && !isProtocolError(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// serverPath converts an API path into an absolute server path.
+func serverPath(requested string) (string, error) {
+	if strings.Contains(requested, "..") {
+		return "", storage.ErrPermission
+	}
+	return path.Clean("/" + requested), nil
+}
+
+func toFileInfo(name string, e *ftp.Entry) storage.FileInfo {
+	return storage.FileInfo{
+		Name:    e.Name,
+		Path:    strings.TrimPrefix(name, "/"),
+		Size:    int64(e.Size),
+		IsDir:   e.Type == ftp.EntryTypeFolder,
+		ModTime: e.Time,
+	}
+}
+
+// hasEntries reports whether a LIST result contains anything besides the
+// "." and ".." entries some servers include.
+func hasEntries(entries []*ftp.Entry) bool {
+	for _, e := range entries {
+		if e.Name != "." && e.Name != ".." {
+			return true
+		}
+	}
+	return false
+}
+
+func isStatus(err error, code int) bool {
+	var perr *textproto.Error
+	return errors.As(err, &perr) && perr.Code == code
+}
+
+// isProtocolError reports whether err is a regular FTP reply, meaning the
+// control connection is still in a known state and can be reused.
+func isProtocolError(err error) bool {
+	var perr *textproto.Error
+	return errors.As(err, &perr) || errors.Is(err, storage.ErrNotFound)
+}
+
+// mapError converts FTP reply codes to storage sentinel errors. 550 is used
+// by servers for both missing files and denied access, so the reply text
+// decides between the two.
+func mapError(err error) error {
+	if errors.Is(err, storage.ErrNotFound) || errors.Is(err, storage.ErrPermission) {
+		return err
+	}
+	var perr *textproto.Error
+	if !errors.As(err, &perr) {
+		return err
+	}
+	switch perr.Code {
+	case ftp.StatusFileUnavailable, ftp.StatusFileActionIgnored:
+		msg := strings.ToLower(perr.Msg)
+		if strings.Contains(msg, "denied") || strings.Contains(msg, "permission") {
+			return storage.ErrPermission
+		}
+		return storage.ErrNotFound
+	case ftp.StatusNotLoggedIn, ftp.StatusInvalidCredentials, ftp.StatusBadFileName:
+		return storage.ErrPermission
+	}
+	return err
+}
@@ -0,0 +1,378 @@
+package ftp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go-storage-api/internal/storage"
+	"go-storage-api/internal/storage/storagetest"
+)
+
+func newTestStorage(t *testing.T, mlst bool, poolSize int) (*Storage, *testServer) {
+	t.Helper()
+	srv := newTestServer(t, mlst)
+	host, port := srv.hostPort()
+	s, err := New(host, port, "user", srv.password, poolSize)
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s, srv
+}
+
+// forEachServer runs fn against servers with and without MLST support so
+// both Stat strategies are exercised.
+func forEachServer(t *testing.T, fn func(t *testing.T, s *Storage, srv *testServer)) {
+	for _, mlst := range []bool{true, false} {
+		t.Run(fmt.Sprintf("mlst=%v", mlst), func(t *testing.T) {
+			s, srv := newTestStorage(t, mlst, 2)
+			fn(t, s, srv)
+		})
+	}
+}
+
+func TestNew_BadPassword(t *testing.T) {
+	srv := newTestServer(t, true)
+	host, port := srv.hostPort()
+
+	_, err := New(host, port, "user", "wrong", 1)
+	if !errors.Is(err, storage.ErrPermission) {
+		t.Errorf("expected ErrPermission, got %v", err)
+	}
+}
+
+// --- List ---
+
+func TestList(t *testing.T) {
+	forEachServer(t, func(t *testing.T, s *Storage, srv *testServer) {
+		os.MkdirAll(filepath.Join(srv.root, "docs", "sub"), 0o755)
+		os.WriteFile(filepath.Join(srv.root, "docs", "readme.md"), []byte("hi"), 0o644)
+
+		files, err := s.List(context.Background(), "/docs")
+		if err != nil {
+			t.Fatalf("List: %v", err)
+		}
+		if len(files) != 2 {
+			t.Fatalf("expected 2 entries, got %d: %+v", len(files), files)
+		}
+
+		byName := map[string]storage.FileInfo{}
+		for _, f := range files {
+			byName[f.Name] = f
+		}
+		if f := byName["readme.md"]; f.Path != "docs/readme.md" || f.Size != 2 || f.IsDir {
+			t.Errorf("unexpected readme.md entry: %+v", f)
+		}
+		if !byName["sub"].IsDir {
+			t.Error("expected sub to be a directory")
+		}
+	})
+}
+
+func TestList_NotFound(t *testing.T) {
+	forEachServer(t, func(t *testing.T, s *Storage, _ *testServer) {
+		_, err := s.List(context.Background(), "nonexistent")
+		if !errors.Is(err, storage.ErrNotFound) {
+			t.Errorf("expected ErrNotFound, got %v", err)
+		}
+	})
+}
+
+// --- Read / Write ---
+
+func TestWriteThenRead(t *testing.T) {
+	forEachServer(t, func(t *testing.T, s *Storage, srv *testServer) {
+		ctx := context.Background()
+
+		if err := s.Write(ctx, "deep/nested/file.txt", strings.NewReader("content")); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+		if _, err := os.Stat(filepath.Join(srv.root, "deep", "nested", "file.txt")); err != nil {
+			t.Fatalf("file not on server: %v", err)
+		}
+
+		rc, err := s.Read(ctx, "deep/nested/file.txt")
+		if err != nil {
+			t.Fatalf("Read: %v", err)
+		}
+		data, _ := io.ReadAll(rc)
+		if err := rc.Close(); err != nil {
+			t.Errorf("Close: %v", err)
+		}
+		if string(data) != "content" {
+			t.Errorf("expected %q, got %q", "content", string(data))
+		}
+	})
+}
+
+// TestWrite_Overwrite replaces a file on both servers: the one with MLST
+// lets RNTO replace it, the other refuses and makes replace go through the
+// aside name, which must not be left behind.
+func TestWrite_Overwrite(t *testing.T) {
+	forEachServer(t, func(t *testing.T, s *Storage, srv *testServer) {
+		ctx := context.Background()
+		for _, content := range []string{"old", "new"} {
+			if err := s.Write(ctx, "dir/file.txt", strings.NewReader(content)); err != nil {
+				t.Fatalf("Write(%q): %v", content, err)
+			}
+		}
+		data, err := os.ReadFile(filepath.Join(srv.root, "dir", "file.txt"))
+		if err != nil || string(data) != "new" {
+			t.Errorf("expected %q on the server, got %q, %v", "new", data, err)
+		}
+		entries, _ := os.ReadDir(filepath.Join(srv.root, "dir"))
+		if len(entries) != 1 {
+			t.Errorf("expected only file.txt on the server, got %d entries", len(entries))
+		}
+	})
+}
+
+func TestRead_NotFound(t *testing.T) {
+	forEachServer(t, func(t *testing.T, s *Storage, _ *testServer) {
+		_, err := s.Read(context.Background(), "missing.txt")
+		if !errors.Is(err, storage.ErrNotFound) {
+			t.Errorf("expected ErrNotFound, got %v", err)
+		}
+	})
+}
+
+// Servers without MLST in forEachServer also lack REST, so this covers both
+// the restarted transfer and the discard fallback.
+func TestReadRange(t *testing.T) {
+	forEachServer(t, func(t *testing.T, s *Storage, srv *testServer) {
+		ctx := context.Background()
+		os.WriteFile(filepath.Join(srv.root, "digits.txt"), []byte("0123456789"), 0o644)
+
+		// Enough ranged reads to exhaust the pool if a connection leaked.
+		for i := 0; i < 5; i++ {
+			rc, err := s.ReadRange(ctx, "digits.txt", 4, 3)
+			if err != nil {
+				t.Fatalf("ReadRange: %v", err)
+			}
+			data, _ := io.ReadAll(rc)
+			rc.Close()
+			if string(data) != "456" {
+				t.Errorf("expected %q, got %q", "456", string(data))
+			}
+		}
+
+		if _, err := s.ReadRange(ctx, "missing.txt", 4, 3); !errors.Is(err, storage.ErrNotFound) {
+			t.Errorf("expected ErrNotFound, got %v", err)
+		}
+	})
+}
+
+// --- Delete ---
+
+func TestDelete_FileAndEmptyDir(t *testing.T) {
+	forEachServer(t, func(t *testing.T, s *Storage, srv *testServer) {
+		ctx := context.Background()
+		os.WriteFile(filepath.Join(srv.root, "doomed.txt"), []byte("bye"), 0o644)
+		os.Mkdir(filepath.Join(srv.root, "empty"), 0o755)
+
+		if err := s.Delete(ctx, "doomed.txt"); err != nil {
+			t.Fatalf("Delete file: %v", err)
+		}
+		if err := s.Delete(ctx, "empty"); err != nil {
+			t.Fatalf("Delete dir: %v", err)
+		}
+		if err := s.Delete(ctx, "doomed.txt"); !errors.Is(err, storage.ErrNotFound) {
+			t.Errorf("expected ErrNotFound, got %v", err)
+		}
+	})
+}
+
+// --- Stat ---
+
+func TestStat(t *testing.T) {
+	forEachServer(t, func(t *testing.T, s *Storage, srv *testServer) {
+		ctx := context.Background()
+		os.Mkdir(filepath.Join(srv.root, "mydir"), 0o755)
+		os.WriteFile(filepath.Join(srv.root, "mydir", "info.txt"), []byte("12345"), 0o644)
+
+		fi, err := s.Stat(ctx, "mydir/info.txt")
+		if err != nil {
+			t.Fatalf("Stat: %v", err)
+		}
+		if fi.Name != "info.txt" || fi.Path != "mydir/info.txt" || fi.Size != 5 || fi.IsDir {
+			t.Errorf("unexpected FileInfo: %+v", fi)
+		}
+
+		fi, err = s.Stat(ctx, "mydir")
+		if err != nil {
+			t.Fatalf("Stat dir: %v", err)
+		}
+		if !fi.IsDir {
+			t.Error("expected IsDir=true")
+		}
+
+		if _, err := s.Stat(ctx, "nope.txt"); !errors.Is(err, storage.ErrNotFound) {
+			t.Errorf("expected ErrNotFound, got %v", err)
+		}
+	})
+}
+
+// --- Pool ---
+
+func TestPool_ReusesConnections(t *testing.T) {
+	s, srv := newTestStorage(t, true, 2)
+	ctx := context.Background()
+
+	for i := 0; i < 5; i++ {
+		if _, err := s.List(ctx, "/"); err != nil {
+			t.Fatalf("List: %v", err)
+		}
+	}
+	if got := srv.logins.Load(); got != 1 {
+		t.Errorf("expected 1 login, got %d", got)
+	}
+}
+
+func TestPool_ReplacesDeadIdleConnections(t *testing.T) {
+	s, srv := newTestStorage(t, true, 2)
+
+	srv.dropAll()
+
+	if _, err := s.List(context.Background(), "/"); err != nil {
+		t.Fatalf("List after server dropped connections: %v", err)
+	}
+	if got := srv.logins.Load(); got != 2 {
+		t.Errorf("expected 2 logins, got %d", got)
+	}
+}
+
+func TestPool_BlocksWhenExhausted(t *testing.T) {
+	s, _ := newTestStorage(t, true, 1)
+
+	c, err := s.acquire(context.Background())
+	if err != nil {
+		t.Fatalf("acquire: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := s.Stat(ctx, "/"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected DeadlineExceeded while pool is exhausted, got %v", err)
+	}
+
+	s.release(c, nil)
+	if _, err := s.Stat(context.Background(), "/"); err != nil {
+		t.Errorf("Stat after release: %v", err)
+	}
+}
+
+func TestPool_Concurrent(t *testing.T) {
+	s, srv := newTestStorage(t, true, 3)
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			name := fmt.Sprintf("file-%d.txt", i)
+			if err := s.Write(ctx, name, strings.NewReader(name)); err != nil {
+				errs <- err
+				return
+			}
+			rc, err := s.Read(ctx, name)
+			if err != nil {
+				errs <- err
+				return
+			}
+			data, _ := io.ReadAll(rc)
+			rc.Close()
+			if string(data) != name {
+				errs <- fmt.Errorf("%s: got %q", name, data)
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+	}
+	if got := srv.logins.Load(); got > 3 {
+		t.Errorf("expected at most 3 logins, got %d", got)
+	}
+}
+
+func TestPool_CopyWithOneConnection(t *testing.T) {
+	s, srv := newTestStorage(t, true, 1)
+	os.MkdirAll(filepath.Join(srv.root, "src", "sub"), 0o755)
+	os.WriteFile(filepath.Join(srv.root, "src", "a.txt"), []byte("alpha"), 0o644)
+	os.WriteFile(filepath.Join(srv.root, "src", "sub", "b.txt"), []byte("beta"), 0o644)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := storage.Copy(ctx, s, "src", "dst"); err != nil {
+		t.Fatalf("Copy: %v", err)
+	}
+	for name, want := range map[string]string{"dst/a.txt": "alpha", "dst/sub/b.txt": "beta"} {
+		if got, err := os.ReadFile(filepath.Join(srv.root, filepath.FromSlash(name))); err != nil || string(got) != want {
+			t.Errorf("%s: got %q, %v", name, got, err)
+		}
+	}
+}
+
+// --- Error mapping ---
+
+func TestMapError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{"550 missing", &textproto.Error{Code: 550, Msg: "No such file or directory"}, storage.ErrNotFound},
+		{"550 denied", &textproto.Error{Code: 550, Msg: "Permission denied"}, storage.ErrPermission},
+		{"530 not logged in", &textproto.Error{Code: 530, Msg: "Login incorrect"}, storage.ErrPermission},
+		{"553 bad name", &textproto.Error{Code: 553, Msg: "File name not allowed"}, storage.ErrPermission},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := mapError(tt.err); !errors.Is(got, tt.want) {
+				t.Errorf("mapError(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestServerPath_BlocksTraversal(t *testing.T) {
+	for _, p := range []string{"../etc/passwd", "/../../etc/passwd", "subdir/../../etc"} {
+		if _, err := serverPath(p); !errors.Is(err, storage.ErrPermission) {
+			t.Errorf("serverPath(%q): expected ErrPermission, got %v", p, err)
+		}
+	}
+}
+
+// --- Conformance ---
+
+func TestConformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Storage {
+		s, _ := newTestStorage(t, true, 4)
+		return s
+	})
+}
+
+// --- Interface compliance ---
+
+var (
+	_ storage.Storage     = (*Storage)(nil)
+	_ storage.RangeReader = (*Storage)(nil)
+	_ storage.Mover       = (*Storage)(nil)
+	_ storage.Copier      = (*Storage)(nil)
+	_ storage.Recoverer   = (*Storage)(nil)
+	_ io.Closer           = (*Storage)(nil)
+)
@@ -0,0 +1,336 @@
+package ftp
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testServer is a minimal in-process FTP server backed by a temp directory.
+// It implements just enough of RFC 959 / RFC 3659 for jlaffaye/ftp: login,
+// EPSV data connections, LIST/MLSD/MLST, REST, RETR/STOR, RNFR/RNTO,
+// DELE/RMD/MKD and NOOP. The RFC 3659 extensions (MLST and REST) are only
+// offered when mlst is set; without them the server also refuses RNTO onto
+// an existing file, as some servers do.
+type testServer struct {
+	root     string
+	password string
+	mlst     bool
+
+	ln     net.Listener
+	logins atomic.Int32
+
+	mu    sync.Mutex
+	conns map[net.Conn]struct{}
+}
+
+func newTestServer(t *testing.T, mlst bool) *testServer {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	srv := &testServer{
+		root:     t.TempDir(),
+		password: "secret",
+		mlst:     mlst,
+		ln:       ln,
+		conns:    map[net.Conn]struct{}{},
+	}
+	go srv.serve()
+	t.Cleanup(func() {
+		ln.Close()
+		srv.dropAll()
+	})
+	return srv
+}
+
+func (srv *testServer) hostPort() (string, string) {
+	host, port, _ := net.SplitHostPort(srv.ln.Addr().String())
+	return host, port
+}
+
+// dropAll closes every control connection, simulating a server restart or
+// an idle timeout.
+func (srv *testServer) dropAll() {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	for c := range srv.conns {
+		c.Close()
+	}
+}
+
+func (srv *testServer) serve() {
+	for {
+		conn, err := srv.ln.Accept()
+		if err != nil {
+			return
+		}
+		srv.mu.Lock()
+		srv.conns[conn] = struct{}{}
+		srv.mu.Unlock()
+		go srv.handle(conn)
+	}
+}
+
+type session struct {
+	srv  *testServer
+	ctrl net.Conn
+	r    *bufio.Reader
+	data net.Listener
+	rest int64
+	rnfr string
+}
+
+func (srv *testServer) handle(conn net.Conn) {
+	defer func() {
+		srv.mu.Lock()
+		delete(srv.conns, conn)
+		srv.mu.Unlock()
+		conn.Close()
+	}()
+
+	s := &session{srv: srv, ctrl: conn, r: bufio.NewReader(conn)}
+	defer s.closeData()
+
+	s.reply("220 test server ready")
+	for {
+		line, err := s.r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		cmd, arg, _ := strings.Cut(line, " ")
+		if !s.dispatch(strings.ToUpper(cmd), arg) {
+			return
+		}
+	}
+}
+
+func (s *session) reply(format string, args ...interface{}) {
+	fmt.Fprintf(s.ctrl, format+"\r\n", args...)
+}
+
+func (s *session) full(p string) string {
+	return filepath.Join(s.srv.root, filepath.FromSlash(path.Clean("/"+p)))
+}
+
+func (s *session) dispatch(cmd, arg string) bool {
+	switch cmd {
+	case "USER":
+		s.reply("331 password required")
+	case "PASS":
+		if arg != s.srv.password {
+			s.reply("530 login incorrect")
+			return true
+		}
+		s.srv.logins.Add(1)
+		s.reply("230 logged in")
+	case "FEAT":
+		if s.srv.mlst {
+			s.reply("211-Features:\r\n MLST type*;size*;modify*;\r\n211 End")
+		} else {
+			s.reply("211-Features:\r\n211 End")
+		}
+	case "TYPE", "OPTS":
+		s.reply("200 ok")
+	case "NOOP":
+		s.reply("200 ok")
+	case "QUIT":
+		s.reply("221 bye")
+		return false
+	case "EPSV":
+		s.closeData()
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			s.reply("425 cannot open data connection")
+			return true
+		}
+		s.data = ln
+		s.reply("229 Entering Extended Passive Mode (|||%d|)", ln.Addr().(*net.TCPAddr).Port)
+	case "LIST", "MLSD":
+		s.list(cmd, arg)
+	case "MLST":
+		if !s.srv.mlst {
+			s.reply("502 not implemented")
+			return true
+		}
+		info, err := os.Stat(s.full(arg))
+		if err != nil {
+			s.reply("550 no such file")
+			return true
+		}
+		s.reply("250-File details\r\n %s\r\n250 End", mlsxLine(info, path.Base(arg)))
+	case "REST":
+		n, err := strconv.ParseInt(arg, 10, 64)
+		if !s.srv.mlst || err != nil || n < 0 {
+			s.reply("502 not implemented")
+			return true
+		}
+		s.rest = n
+		s.reply("350 restarting at %d", n)
+	case "RETR":
+		offset := s.rest
+		s.rest = 0
+		f, err := os.Open(s.full(arg))
+		if err != nil {
+			s.closeData()
+			s.reply("550 no such file")
+			return true
+		}
+		defer f.Close()
+		if _, err := f.Seek(offset, io.SeekStart); err != nil {
+			s.closeData()
+			s.reply("551 cannot restart")
+			return true
+		}
+		s.transfer(func(c net.Conn) error {
+			_, err := io.Copy(c, f)
+			return err
+		})
+	case "STOR":
+		f, err := os.Create(s.full(arg))
+		if err != nil {
+			s.closeData()
+			s.reply("550 cannot create file")
+			return true
+		}
+		defer f.Close()
+		s.transfer(func(c net.Conn) error {
+			_, err := io.Copy(f, c)
+			return err
+		})
+	case "RNFR":
+		if _, err := os.Stat(s.full(arg)); err != nil {
+			s.reply("550 no such file")
+			return true
+		}
+		s.rnfr = arg
+		s.reply("350 ready for RNTO")
+	case "RNTO":
+		from := s.rnfr
+		s.rnfr = ""
+		if from == "" {
+			s.reply("503 RNFR required first")
+			return true
+		}
+		if _, err := os.Stat(s.full(arg)); err == nil && !s.srv.mlst {
+			s.reply("550 file exists")
+			return true
+		}
+		if err := os.Rename(s.full(from), s.full(arg)); err != nil {
+			s.reply("550 rename failed")
+			return true
+		}
+		s.reply("250 renamed")
+	case "MKD":
+		if err := os.Mkdir(s.full(arg), 0o755); err != nil {
+			s.reply("550 cannot create directory")
+			return true
+		}
+		s.reply("257 \"%s\" created", arg)
+	case "DELE":
+		info, err := os.Stat(s.full(arg))
+		if err != nil || info.IsDir() {
+			s.reply("550 no such file")
+			return true
+		}
+		os.Remove(s.full(arg))
+		s.reply("250 deleted")
+	case "RMD":
+		info, err := os.Stat(s.full(arg))
+		if err != nil || !info.IsDir() {
+			s.reply("550 no such directory")
+			return true
+		}
+		if err := os.Remove(s.full(arg)); err != nil {
+			s.reply("550 directory not empty")
+			return true
+		}
+		s.reply("250 removed")
+	default:
+		s.reply("502 not implemented")
+	}
+	return true
+}
+
+func (s *session) list(cmd, arg string) {
+	entries, err := os.ReadDir(s.full(arg))
+	if err != nil {
+		// Mimic servers that answer LIST on a missing path with an empty
+		// listing rather than an error.
+		entries = nil
+	}
+	s.transfer(func(c net.Conn) error {
+		for _, e := range entries {
+			info, err := e.Info()
+			if err != nil {
+				return err
+			}
+			if cmd == "MLSD" {
+				fmt.Fprintf(c, "%s\r\n", mlsxLine(info, e.Name()))
+			} else {
+				fmt.Fprintf(c, "%s\r\n", lsLine(info))
+			}
+		}
+		return nil
+	})
+}
+
+// transfer accepts the pending passive data connection and runs fn on it.
+func (s *session) transfer(fn func(net.Conn) error) {
+	if s.data == nil {
+		s.reply("425 use EPSV first")
+		return
+	}
+	s.reply("150 opening data connection")
+	conn, err := s.data.Accept()
+	s.closeData()
+	if err != nil {
+		s.reply("425 cannot open data connection")
+		return
+	}
+	err = fn(conn)
+	conn.Close()
+	if err != nil {
+		s.reply("426 transfer aborted")
+		return
+	}
+	s.reply("226 transfer complete")
+}
+
+func (s *session) closeData() {
+	if s.data != nil {
+		s.data.Close()
+		s.data = nil
+	}
+}
+
+func mlsxLine(info os.FileInfo, name string) string {
+	typ := "file"
+	if info.IsDir() {
+		typ = "dir"
+	}
+	return fmt.Sprintf("type=%s;size=%d;modify=%s; %s",
+		typ, info.Size(), info.ModTime().UTC().Format("20060102150405"), name)
+}
+
+func lsLine(info os.FileInfo) string {
+	mode := "-rw-r--r--"
+	if info.IsDir() {
+		mode = "drwxr-xr-x"
+	}
+	return fmt.Sprintf("%s 1 owner group %d %s %s",
+		mode, info.Size(), info.ModTime().UTC().Format(time.Stamp[:12]), info.Name())
+}
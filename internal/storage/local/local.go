@@ -2,10 +2,13 @@ package local
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	"go-storage-api/internal/storage"
@@ -16,6 +19,14 @@ type Storage struct {
 	root string
 }
 
+// lockName is the file in root that every rename and delete below root
+// locks, so that WriteIf and DeleteIf can check a file and change it
+// without another change in between, from this process or any other
+// serving the same root. One lock for the whole tree keeps a directory
+// move from slipping past a check on a file inside it. Streaming into
+// temporary files happens outside of it.
+const lockName = storage.TempPrefix + "lock"
+
 // New creates a local storage backend rooted at the given directory.
 func New(root string) (*Storage, error) {
 	abs, err := filepath.Abs(root)
@@ -41,6 +52,9 @@ func (s *Storage) List(_ context.Context, path string) ([]storage.FileInfo, erro
 
 	files := make([]storage.FileInfo, 0, len(entries))
 	for _, e := range entries {
+		if storage.IsTemp(e.Name()) {
+			continue
+		}
 		info, err := e.Info()
 		if err != nil {
 			return nil, mapError(err)
@@ -57,6 +71,114 @@ func (s *Storage) List(_ context.Context, path string) ([]storage.FileInfo, erro
 	return files, nil
 }
 
+// listBatch is how many names ListPage reads from the directory at a time.
+const listBatch = 1024
+
+// ListPage reads the directory in batches and keeps only the limit smallest
+// names after the cursor, so memory stays proportional to the page size no
+// matter how large the directory is. The cursor is the last name returned.
+func (s *Storage) ListPage(_ context.Context, path, cursor string, limit int) (*storage.Page, error) {
+	full, err := s.safePath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	dir, err := os.Open(full)
+	if err != nil {
+		return nil, mapError(err)
+	}
+	defer dir.Close()
+
+	// One extra name tells whether another page follows.
+	var names []string
+	for {
+		batch, err := dir.Readdirnames(listBatch)
+		for _, name := range batch {
+			if name > cursor && !storage.IsTemp(name) {
+				names = append(names, name)
+			}
+		}
+		if len(names) > limit+1 {
+			sort.Strings(names)
+			names = names[:limit+1]
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, mapError(err)
+		}
+	}
+	sort.Strings(names)
+
+	files := make([]storage.FileInfo, 0, len(names))
+	for _, name := range names {
+		info, err := os.Lstat(filepath.Join(full, name))
+		if os.IsNotExist(err) {
+			continue // removed since it was listed
+		}
+		if err != nil {
+			return nil, mapError(err)
+		}
+		rel, _ := filepath.Rel(s.root, filepath.Join(full, name))
+		files = append(files, storage.FileInfo{
+			Name:    name,
+			Path:    filepath.ToSlash(rel),
+			Size:    info.Size(),
+			IsDir:   info.IsDir(),
+			ModTime: info.ModTime(),
+		})
+	}
+	return storage.PageAfter(files, limit), nil
+}
+
+// Walk uses filepath.WalkDir, which reads each directory once and does not
+// follow symbolic links.
+func (s *Storage) Walk(ctx context.Context, root string, fn storage.WalkFunc) error {
+	full, err := s.safePath(root)
+	if err != nil {
+		return err
+	}
+
+	err = filepath.WalkDir(full, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if p == full {
+			if !d.IsDir() {
+				return fmt.Errorf("walk %s: %w", root, storage.ErrInvalid)
+			}
+			return nil
+		}
+
+		if storage.IsTemp(d.Name()) {
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		info, err := d.Info()
+		if os.IsNotExist(err) {
+			return nil // removed since its directory was read
+		}
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(s.root, p)
+		return fn(storage.FileInfo{
+			Name:    d.Name(),
+			Path:    filepath.ToSlash(rel),
+			Size:    info.Size(),
+			IsDir:   d.IsDir(),
+			ModTime: info.ModTime(),
+		})
+	})
+	return mapError(err)
+}
+
 func (s *Storage) Read(_ context.Context, path string) (io.ReadCloser, error) {
 	full, err := s.safePath(path)
 	if err != nil {
@@ -70,35 +192,224 @@ func (s *Storage) Read(_ context.Context, path string) (io.ReadCloser, error) {
 	return f, nil
 }
 
-func (s *Storage) Write(_ context.Context, path string, r io.Reader) error {
+// ReadRange seeks to offset before reading, so ranges near the end of a
+// large file are served without reading the bytes before them.
+func (s *Storage) ReadRange(_ context.Context, path string, offset, length int64) (io.ReadCloser, error) {
+	full, err := s.safePath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(full)
+	if err != nil {
+		return nil, mapError(err)
+	}
+	if offset > 0 {
+		if _, err := f.Seek(offset, io.SeekStart); err != nil {
+			f.Close()
+			return nil, fmt.Errorf("seek file: %w", err)
+		}
+	}
+	return storage.LimitReadCloser(f, length), nil
+}
+
+// Write streams into a temporary file in the target's directory, syncs it
+// and renames it over the target, so readers see the old content or the new
+// content but never a partial file. The temporary file is removed if
+// anything fails, including cancellation of ctx.
+func (s *Storage) Write(ctx context.Context, path string, r io.Reader) error {
+	return s.WriteIf(ctx, path, r, storage.Condition{})
+}
+
+// WriteIf streams into a temporary file like Write and checks cond just
+// before the rename, under the lock every rename and delete takes.
+// Platforms without flock refuse conditions with storage.ErrNotSupported.
+func (s *Storage) WriteIf(ctx context.Context, path string, r io.Reader, cond storage.Condition) error {
 	full, err := s.safePath(path)
 	if err != nil {
 		return err
 	}
+	if full == s.root {
+		return storage.ErrPermission
+	}
 
-	if err := os.MkdirAll(filepath.Dir(full), 0o755); err != nil {
+	dir := filepath.Dir(full)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
 		return mapError(err)
 	}
 
-	f, err := os.Create(full)
+	f, err := os.CreateTemp(dir, storage.TempPrefix+"*")
 	if err != nil {
 		return mapError(err)
 	}
-	defer f.Close()
+	tmp := f.Name()
+	committed := false
+	defer func() {
+		if !committed {
+			os.Remove(tmp)
+		}
+	}()
 
-	if _, err := io.Copy(f, r); err != nil {
+	_, err = io.Copy(f, &contextReader{ctx: ctx, r: r})
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
 		return fmt.Errorf("write file: %w", err)
 	}
+
+	// CreateTemp creates the file private to the owner.
+	if err := os.Chmod(tmp, 0o644); err != nil {
+		return mapError(err)
+	}
+	unlock, err := s.lock()
+	if err != nil {
+		return err
+	}
+	err = s.check(path, cond)
+	if err == nil {
+		err = mapError(os.Rename(tmp, full))
+	}
+	unlock()
+	if err != nil {
+		return err
+	}
+	committed = true
+
+	// Make the rename itself durable. Not every platform can sync a
+	// directory, and the file is already in place, so errors are ignored.
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
 	return nil
 }
 
+// contextReader fails once ctx is done, so a cancelled Write stops even
+// while r keeps delivering data.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c *contextReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
+}
+
 func (s *Storage) Delete(_ context.Context, path string) error {
+	return s.delete(path, storage.Condition{})
+}
+
+// DeleteIf checks the entity tag under the lock every rename and delete
+// takes.
+func (s *Storage) DeleteIf(_ context.Context, path, etag string) error {
+	return s.delete(path, storage.Condition{IfMatch: etag})
+}
+
+func (s *Storage) delete(path string, cond storage.Condition) error {
 	full, err := s.safePath(path)
 	if err != nil {
 		return err
 	}
+	if full == s.root {
+		return storage.ErrPermission
+	}
 
+	unlock, err := s.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if err := s.check(path, cond); err != nil {
+		return err
+	}
 	if err := os.Remove(full); err != nil {
+		// The errno for a non-empty directory differs between platforms,
+		// so look at the directory instead.
+		if empty, dirErr := isEmptyDir(full); dirErr == nil && !empty {
+			return fmt.Errorf("delete %s: %w", path, storage.ErrNotEmpty)
+		}
+		return mapError(err)
+	}
+	return nil
+}
+
+// DeleteAll renames the file or directory tree to a temporary sibling under
+// the lock and removes it with os.RemoveAll after releasing the lock, so a
+// large tree disappears at once without holding up other changes.
+func (s *Storage) DeleteAll(_ context.Context, path string) error {
+	full, err := s.safePath(path)
+	if err != nil {
+		return err
+	}
+	if full == s.root {
+		return storage.ErrPermission
+	}
+
+	tmp := filepath.FromSlash(storage.TempName(filepath.ToSlash(full)))
+	unlock, err := s.lock()
+	if err != nil {
+		return err
+	}
+	err = os.Rename(full, tmp)
+	unlock()
+	if err != nil {
+		return mapError(err)
+	}
+	if err := os.RemoveAll(tmp); err != nil {
+		return mapError(err)
+	}
+	return nil
+}
+
+func (s *Storage) Mkdir(_ context.Context, path string) error {
+	full, err := s.safePath(path)
+	if err != nil {
+		return err
+	}
+	if full == s.root {
+		return storage.ErrPermission
+	}
+
+	if _, err := os.Lstat(full); err == nil {
+		return fmt.Errorf("mkdir %s: %w", path, storage.ErrExist)
+	}
+	if err := os.MkdirAll(full, 0o755); err != nil {
+		return mapError(err)
+	}
+	return nil
+}
+
+// Move renames with os.Rename, which is atomic and does not copy data as
+// long as both paths are on the same filesystem, as they are below one root.
+func (s *Storage) Move(_ context.Context, from, to string) error {
+	src, err := s.safePath(from)
+	if err != nil {
+		return err
+	}
+	dst, err := s.safePath(to)
+	if err != nil {
+		return err
+	}
+	if src == s.root || dst == s.root {
+		return storage.ErrPermission
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return mapError(err)
+	}
+	unlock, err := s.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if err := os.Rename(src, dst); err != nil {
 		return mapError(err)
 	}
 	return nil
@@ -116,6 +427,9 @@ func (s *Storage) Stat(_ context.Context, path string) (*storage.FileInfo, error
 	}
 
 	rel, _ := filepath.Rel(s.root, full)
+	if rel == "." {
+		rel = ""
+	}
 	return &storage.FileInfo{
 		Name:    info.Name(),
 		Path:    filepath.ToSlash(rel),
@@ -125,6 +439,39 @@ func (s *Storage) Stat(_ context.Context, path string) (*storage.FileInfo, error
 	}, nil
 }
 
+// lock waits for the lock on lockName and returns the function releasing
+// it. Each call opens the file anew: flock excludes other open files, so
+// goroutines of this process wait for each other like other processes do.
+func (s *Storage) lock() (func(), error) {
+	f, err := os.OpenFile(filepath.Join(s.root, lockName), os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, mapError(err)
+	}
+	if err := lockFile(f); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("lock %s: %w", s.root, err)
+	}
+	return func() { f.Close() }, nil
+}
+
+// check evaluates cond against the file at path. The lock must be held.
+func (s *Storage) check(path string, cond storage.Condition) error {
+	if cond == (storage.Condition{}) {
+		return nil
+	}
+	if !canLock {
+		return fmt.Errorf("conditional write %s: %w", path, storage.ErrNotSupported)
+	}
+	info, err := s.Stat(context.Background(), path)
+	if errors.Is(err, storage.ErrNotFound) {
+		return cond.Check(nil)
+	}
+	if err != nil {
+		return err
+	}
+	return cond.Check(info)
+}
+
 // safePath resolves the requested path against the root directory and ensures
 // the result stays within root to prevent directory traversal.
 func (s *Storage) safePath(requested string) (string, error) {
@@ -136,12 +483,29 @@ func (s *Storage) safePath(requested string) (string, error) {
 	joined := filepath.Join(s.root, filepath.FromSlash(requested))
 	cleaned := filepath.Clean(joined)
 
-	if !strings.HasPrefix(cleaned, s.root) {
+	// Compare against root plus a separator so that a sibling such as
+	// "/data-other" does not pass as being inside "/data".
+	if cleaned != s.root && !strings.HasPrefix(cleaned, s.root+string(filepath.Separator)) {
 		return "", storage.ErrPermission
 	}
 	return cleaned, nil
 }
 
+// isEmptyDir reports whether dir is a directory with no entries.
+func isEmptyDir(dir string) (bool, error) {
+	f, err := os.Open(dir)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	_, err = f.Readdirnames(1)
+	if err == io.EOF {
+		return true, nil
+	}
+	return false, err
+}
+
 // mapError converts os-level errors to storage sentinel errors.
 func mapError(err error) error {
 	if os.IsNotExist(err) {
@@ -8,8 +8,11 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+	"testing/iotest"
+	"time"
 
 	"go-storage-api/internal/storage"
+	"go-storage-api/internal/storage/storagetest"
 )
 
 func newTestStorage(t *testing.T) *Storage {
@@ -182,6 +185,108 @@ func TestWrite_Overwrite(t *testing.T) {
 	}
 }
 
+// rawNames returns the names actually present in dir, temporary files
+// included. The lock file, which stays in the root, is left out.
+func rawNames(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		if e.Name() != lockName {
+			names = append(names, e.Name())
+		}
+	}
+	return names
+}
+
+func TestWrite_FailedReaderKeepsOriginal(t *testing.T) {
+	s := newTestStorage(t)
+	ctx := context.Background()
+	s.Write(ctx, "file.txt", strings.NewReader("original"))
+
+	errBroken := errors.New("broken pipe")
+	r := io.MultiReader(strings.NewReader("partial"), iotest.ErrReader(errBroken))
+	if err := s.Write(ctx, "file.txt", r); !errors.Is(err, errBroken) {
+		t.Fatalf("Write error = %v, want %v", err, errBroken)
+	}
+
+	data, _ := os.ReadFile(filepath.Join(s.root, "file.txt"))
+	if string(data) != "original" {
+		t.Errorf("content = %q, want %q", data, "original")
+	}
+	if names := rawNames(t, s.root); len(names) != 1 {
+		t.Errorf("directory holds %v, want only file.txt", names)
+	}
+}
+
+func TestWrite_CancelledContext(t *testing.T) {
+	s := newTestStorage(t)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	// The reader never fails on its own; only the cancellation stops it.
+	r := io.MultiReader(strings.NewReader("first chunk"), readerFunc(func(p []byte) (int, error) {
+		cancel()
+		return copy(p, "more"), nil
+	}), strings.NewReader(strings.Repeat("x", 1<<20)))
+
+	if err := s.Write(ctx, "dir/file.txt", r); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Write error = %v, want context.Canceled", err)
+	}
+	if names := rawNames(t, filepath.Join(s.root, "dir")); len(names) != 0 {
+		t.Errorf("directory holds %v after cancelled Write, want nothing", names)
+	}
+}
+
+type readerFunc func(p []byte) (int, error)
+
+func (f readerFunc) Read(p []byte) (int, error) { return f(p) }
+
+func TestWrite_InvisibleUntilComplete(t *testing.T) {
+	s := newTestStorage(t)
+	ctx := context.Background()
+
+	pr, pw := io.Pipe()
+	done := make(chan error, 1)
+	go func() { done <- s.Write(ctx, "file.txt", pr) }()
+	pw.Write([]byte("half of the content"))
+
+	// The pipe write returned, so the temporary file exists by now.
+	if names := rawNames(t, s.root); len(names) != 1 || !storage.IsTemp(names[0]) {
+		t.Fatalf("directory holds %v during Write, want one temporary file", names)
+	}
+	if _, err := s.Stat(ctx, "file.txt"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("Stat during Write error = %v, want ErrNotFound", err)
+	}
+	if files, _ := s.List(ctx, "/"); len(files) != 0 {
+		t.Errorf("List during Write = %+v, want no entries", files)
+	}
+	if page, _ := s.ListPage(ctx, "/", "", 10); len(page.Entries) != 0 {
+		t.Errorf("ListPage during Write = %+v, want no entries", page.Entries)
+	}
+	s.Walk(ctx, "/", func(info storage.FileInfo) error {
+		t.Errorf("Walk during Write visited %s", info.Path)
+		return nil
+	})
+
+	pw.Close()
+	if err := <-done; err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	info, err := os.Stat(filepath.Join(s.root, "file.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0o644 {
+		t.Errorf("mode = %v, want 0644", info.Mode().Perm())
+	}
+	if names := rawNames(t, s.root); len(names) != 1 {
+		t.Errorf("directory holds %v after Write, want only file.txt", names)
+	}
+}
+
 // --- Delete ---
 
 func TestDelete_Success(t *testing.T) {
@@ -260,6 +365,136 @@ func TestStat_NotFound(t *testing.T) {
 	}
 }
 
+// --- Locking ---
+
+// TestWriteIf_WaitsForLock holds the lock through a file of its own, as
+// another process serving the same root would, and changes the target
+// meanwhile. The conditional write must wait and then see that change.
+func TestWriteIf_WaitsForLock(t *testing.T) {
+	if !canLock {
+		t.Skip("no flock on this platform")
+	}
+	s := newTestStorage(t)
+	ctx := context.Background()
+
+	other, err := os.OpenFile(filepath.Join(s.root, lockName), os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := lockFile(other); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- s.WriteIf(ctx, "a.txt", strings.NewReader("mine"), storage.Condition{IfNoneMatch: true})
+	}()
+	select {
+	case err := <-done:
+		t.Fatalf("WriteIf returned %v while the lock was held", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	if err := os.WriteFile(filepath.Join(s.root, "a.txt"), []byte("theirs"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	other.Close()
+
+	if err := <-done; !errors.Is(err, storage.ErrPrecondition) {
+		t.Fatalf("WriteIf: expected ErrPrecondition, got %v", err)
+	}
+	data, _ := os.ReadFile(filepath.Join(s.root, "a.txt"))
+	if string(data) != "theirs" {
+		t.Errorf("content = %q, want %q", data, "theirs")
+	}
+}
+
+// --- Multipart ---
+
+func TestMultipart_AssemblesPartsInOrder(t *testing.T) {
+	s := newTestStorage(t)
+	ctx := context.Background()
+
+	id, err := s.CreateMultipart(ctx, "docs/a.txt")
+	if err != nil {
+		t.Fatalf("CreateMultipart: %v", err)
+	}
+	for n, data := range map[int]string{3: "world", 1: "hello", 5: "!", 4: "stale"} {
+		if err := s.UploadPart(ctx, "docs/a.txt", id, n, strings.NewReader(data), int64(len(data))); err != nil {
+			t.Fatalf("UploadPart %d: %v", n, err)
+		}
+	}
+	// Uploading a part again replaces it.
+	if err := s.UploadPart(ctx, "docs/a.txt", id, 1, strings.NewReader("hello "), 6); err != nil {
+		t.Fatalf("UploadPart: %v", err)
+	}
+	if err := s.UploadPart(ctx, "docs/a.txt", id, 4, strings.NewReader(""), 0); err != nil {
+		t.Fatalf("UploadPart: %v", err)
+	}
+
+	// Parts are invisible until the upload completes.
+	var seen []string
+	s.Walk(ctx, "", func(info storage.FileInfo) error {
+		seen = append(seen, info.Path)
+		return nil
+	})
+	if len(seen) != 0 {
+		t.Errorf("Walk during upload saw %v", seen)
+	}
+
+	if err := s.CompleteMultipart(ctx, "docs/a.txt", id); err != nil {
+		t.Fatalf("CompleteMultipart: %v", err)
+	}
+	data, _ := os.ReadFile(filepath.Join(s.root, "docs", "a.txt"))
+	if string(data) != "hello world!" {
+		t.Errorf("assembled %q, want %q", data, "hello world!")
+	}
+	if names := rawNames(t, filepath.Join(s.root, partsDir)); len(names) != 0 {
+		t.Errorf("parts left behind: %v", names)
+	}
+}
+
+func TestMultipart_Errors(t *testing.T) {
+	s := newTestStorage(t)
+	ctx := context.Background()
+
+	if _, err := s.CreateMultipart(ctx, "/"); !errors.Is(err, storage.ErrPermission) {
+		t.Errorf("CreateMultipart at root error = %v, want ErrPermission", err)
+	}
+	for _, id := range []string{"missing", "../../etc", strings.Repeat("0", 32)} {
+		if err := s.UploadPart(ctx, "a.txt", id, 1, strings.NewReader("x"), 1); !errors.Is(err, storage.ErrNotFound) {
+			t.Errorf("UploadPart(%q) error = %v, want ErrNotFound", id, err)
+		}
+	}
+
+	id, _ := s.CreateMultipart(ctx, "a.txt")
+	for _, n := range []int{0, storage.MaxParts + 1} {
+		if err := s.UploadPart(ctx, "a.txt", id, n, strings.NewReader("x"), 1); !errors.Is(err, storage.ErrInvalid) {
+			t.Errorf("UploadPart part %d error = %v, want ErrInvalid", n, err)
+		}
+	}
+	if err := s.CompleteMultipart(ctx, "a.txt", id); !errors.Is(err, storage.ErrInvalid) {
+		t.Errorf("CompleteMultipart without parts error = %v, want ErrInvalid", err)
+	}
+
+	if err := s.UploadPart(ctx, "a.txt", id, 1, iotest.ErrReader(errors.New("dropped")), 1); err == nil {
+		t.Error("UploadPart with a failing reader succeeded")
+	}
+	if names := rawNames(t, filepath.Join(s.root, partsDir, id)); len(names) != 0 {
+		t.Errorf("failed part left %v", names)
+	}
+
+	if err := s.AbortMultipart(ctx, "a.txt", id); err != nil {
+		t.Fatalf("AbortMultipart: %v", err)
+	}
+	if err := s.AbortMultipart(ctx, "a.txt", id); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("second AbortMultipart error = %v, want ErrNotFound", err)
+	}
+	if _, err := s.Stat(ctx, "a.txt"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("Stat after abort error = %v, want ErrNotFound", err)
+	}
+}
+
 // --- Path traversal ---
 
 func TestSafePath_BlocksTraversal(t *testing.T) {
@@ -282,6 +517,18 @@ func TestSafePath_BlocksTraversal(t *testing.T) {
 	}
 }
 
+func TestSafePath_BlocksSiblingWithSharedPrefix(t *testing.T) {
+	parent := t.TempDir()
+	s, err := New(filepath.Join(parent, "data"))
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+
+	if _, err := s.safePath("../data-other/secret.txt"); !errors.Is(err, storage.ErrPermission) {
+		t.Errorf("expected ErrPermission for sibling directory, got %v", err)
+	}
+}
+
 func TestSafePath_AllowsValid(t *testing.T) {
 	s := newTestStorage(t)
 
@@ -306,6 +553,24 @@ func TestSafePath_AllowsValid(t *testing.T) {
 	}
 }
 
+// --- Conformance ---
+
+func TestConformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Storage {
+		return newTestStorage(t)
+	})
+}
+
 // --- Interface compliance ---
 
-var _ storage.Storage = (*Storage)(nil)
+var (
+	_ storage.Storage     = (*Storage)(nil)
+	_ storage.RangeReader = (*Storage)(nil)
+	_ storage.Mover       = (*Storage)(nil)
+	_ storage.TreeDeleter = (*Storage)(nil)
+	_ storage.PageLister  = (*Storage)(nil)
+	_ storage.Walker      = (*Storage)(nil)
+
+	_ storage.MultipartUploader = (*Storage)(nil)
+	_ storage.ConditionalWriter = (*Storage)(nil)
+)
@@ -0,0 +1,11 @@
+//go:build !unix
+
+package local
+
+import "os"
+
+// canLock reports whether lockFile excludes other processes. Without flock
+// it does not, and conditional writes are refused.
+const canLock = false
+
+func lockFile(*os.File) error { return nil }
@@ -0,0 +1,177 @@
+package local
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+
+	"go-storage-api/internal/storage"
+)
+
+// partsDir holds one directory of parts per multipart upload. It lives
+// below the root, so assembling a file never crosses filesystems, and its
+// name starts with storage.TempPrefix, so listings never show it.
+const partsDir = storage.TempPrefix + "parts"
+
+// CreateMultipart creates a directory for the upload's parts.
+func (s *Storage) CreateMultipart(_ context.Context, path string) (string, error) {
+	full, err := s.safePath(path)
+	if err != nil {
+		return "", err
+	}
+	if full == s.root {
+		return "", storage.ErrPermission
+	}
+
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", fmt.Errorf("generate upload id: %w", err)
+	}
+	id := hex.EncodeToString(b[:])
+	if err := os.MkdirAll(filepath.Join(s.root, partsDir, id), 0o755); err != nil {
+		return "", mapError(err)
+	}
+	return id, nil
+}
+
+// UploadPart streams the part into a temporary file and renames it into
+// place, so a failed or repeated upload of a part never leaves a partial
+// one behind.
+func (s *Storage) UploadPart(ctx context.Context, _, id string, n int, r io.Reader, _ int64) error {
+	dir, err := s.uploadDir(id)
+	if err != nil {
+		return err
+	}
+	if n < 1 || n > storage.MaxParts {
+		return fmt.Errorf("part %d: %w", n, storage.ErrInvalid)
+	}
+
+	f, err := os.CreateTemp(dir, storage.TempPrefix+"*")
+	if err != nil {
+		return mapError(err)
+	}
+	tmp := f.Name()
+	_, err = io.Copy(f, &contextReader{ctx: ctx, r: r})
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp, filepath.Join(dir, strconv.Itoa(n)))
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("upload part %d: %w", n, mapError(err))
+	}
+	return nil
+}
+
+// CompleteMultipart concatenates the parts through Write, which makes the
+// result appear atomically, and then removes them.
+func (s *Storage) CompleteMultipart(ctx context.Context, path, id string) error {
+	dir, err := s.uploadDir(id)
+	if err != nil {
+		return err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return mapError(err)
+	}
+
+	var parts []int
+	for _, e := range entries {
+		if n, err := strconv.Atoi(e.Name()); err == nil {
+			parts = append(parts, n)
+		}
+	}
+	if len(parts) == 0 {
+		return fmt.Errorf("complete upload %s: no parts uploaded: %w", id, storage.ErrInvalid)
+	}
+	sort.Ints(parts)
+
+	files := make([]string, len(parts))
+	for i, n := range parts {
+		files[i] = filepath.Join(dir, strconv.Itoa(n))
+	}
+	r := &filesReader{files: files}
+	defer r.Close()
+	if err := s.Write(ctx, path, r); err != nil {
+		return err
+	}
+	os.RemoveAll(dir)
+	return nil
+}
+
+// AbortMultipart removes the upload's parts.
+func (s *Storage) AbortMultipart(_ context.Context, _, id string) error {
+	dir, err := s.uploadDir(id)
+	if err != nil {
+		return err
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		return mapError(err)
+	}
+	return nil
+}
+
+// uploadDir returns the parts directory of an existing upload. IDs arrive
+// from clients, so anything CreateMultipart could not have returned is
+// rejected before it is used in a path.
+func (s *Storage) uploadDir(id string) (string, error) {
+	if _, err := hex.DecodeString(id); err != nil || len(id) != 32 {
+		return "", fmt.Errorf("upload %q: %w", id, storage.ErrNotFound)
+	}
+	dir := filepath.Join(s.root, partsDir, id)
+	if _, err := os.Stat(dir); err != nil {
+		return "", fmt.Errorf("upload %s: %w", id, mapError(err))
+	}
+	return dir, nil
+}
+
+// filesReader reads a list of files one after the other, opening each only
+// when the previous one is exhausted, so an upload with thousands of parts
+// holds a single file open.
+type filesReader struct {
+	files []string
+	cur   *os.File
+}
+
+func (r *filesReader) Read(p []byte) (int, error) {
+	for {
+		if r.cur == nil {
+			if len(r.files) == 0 {
+				return 0, io.EOF
+			}
+			f, err := os.Open(r.files[0])
+			if err != nil {
+				return 0, err
+			}
+			r.cur, r.files = f, r.files[1:]
+		}
+		n, err := r.cur.Read(p)
+		if err == io.EOF {
+			r.cur.Close()
+			r.cur = nil
+			if n == 0 {
+				continue
+			}
+			err = nil
+		}
+		return n, err
+	}
+}
+
+func (r *filesReader) Close() error {
+	if r.cur != nil {
+		return r.cur.Close()
+	}
+	return nil
+}
@@ -0,0 +1,409 @@
+package memory
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go-storage-api/internal/storage"
+)
+
+// node is a file or directory. File contents are never modified in place;
+// Write swaps in a new slice, so readers holding the old one are unaffected.
+type node struct {
+	isDir   bool
+	data    []byte
+	modTime time.Time
+	sums    map[string]string // checksums by algorithm, computed on Write
+}
+
+// Storage implements storage.Storage entirely in memory. It follows the
+// same directory semantics as the local backend: Write creates missing
+// parents, Delete only removes files and empty directories, and directory
+// ModTimes change when entries are added or removed. Contents are lost when
+// the process exits. Write records SHA-256, MD5 and CRC32C checksums, and
+// the MD5 doubles as the ETag.
+type Storage struct {
+	mu    sync.RWMutex
+	nodes map[string]*node
+	now   func() time.Time
+}
+
+// New creates an empty in-memory backend.
+func New() *Storage {
+	return &Storage{
+		nodes: map[string]*node{"": {isDir: true, modTime: time.Now()}},
+		now:   time.Now,
+	}
+}
+
+func (s *Storage) List(ctx context.Context, p string) ([]storage.FileInfo, error) {
+	dir, err := cleanPath(p)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	n, ok := s.nodes[dir]
+	if !ok {
+		return nil, storage.ErrNotFound
+	}
+	if !n.isDir {
+		return nil, fmt.Errorf("list %s: not a directory", dir)
+	}
+
+	files := []storage.FileInfo{}
+	for name, child := range s.nodes {
+		if name != "" && parent(name) == dir {
+			files = append(files, toFileInfo(name, child))
+		}
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Name < files[j].Name })
+	return files, nil
+}
+
+func (s *Storage) Read(ctx context.Context, p string) (io.ReadCloser, error) {
+	name, err := cleanPath(p)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	n, ok := s.nodes[name]
+	if !ok {
+		return nil, storage.ErrNotFound
+	}
+	if n.isDir {
+		return nil, fmt.Errorf("read %s: is a directory", name)
+	}
+	return io.NopCloser(bytes.NewReader(n.data)), nil
+}
+
+// ReadRange serves a slice of the stored bytes. File contents are replaced
+// rather than modified in place, so the slice stays valid after the lock is
+// released.
+func (s *Storage) ReadRange(ctx context.Context, p string, offset, length int64) (io.ReadCloser, error) {
+	name, err := cleanPath(p)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	n, ok := s.nodes[name]
+	if !ok {
+		return nil, storage.ErrNotFound
+	}
+	if n.isDir {
+		return nil, fmt.Errorf("read %s: is a directory", name)
+	}
+
+	size := int64(len(n.data))
+	start := min(max(offset, 0), size)
+	end := size
+	if length >= 0 && start+length < size {
+		end = start + length
+	}
+	return io.NopCloser(bytes.NewReader(n.data[start:end])), nil
+}
+
+// Write buffers r completely before taking the lock, so a failed or
+// cancelled upload never leaves a partial file behind.
+func (s *Storage) Write(ctx context.Context, p string, r io.Reader) error {
+	return s.WriteIf(ctx, p, r, storage.Condition{})
+}
+
+// WriteIf checks cond under the same lock that swaps in the new contents.
+func (s *Storage) WriteIf(ctx context.Context, p string, r io.Reader, cond storage.Condition) error {
+	name, err := cleanPath(p)
+	if err != nil {
+		return err
+	}
+	if name == "" {
+		return storage.ErrPermission
+	}
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("write file: %w", err)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.check(name, cond); err != nil {
+		return err
+	}
+	if n, ok := s.nodes[name]; ok && n.isDir {
+		return fmt.Errorf("write %s: is a directory", name)
+	}
+	if err := s.mkdirAll(parent(name)); err != nil {
+		return err
+	}
+
+	now := s.now()
+	if _, ok := s.nodes[name]; !ok {
+		s.nodes[parent(name)].modTime = now
+	}
+	s.nodes[name] = &node{data: data, modTime: now, sums: checksums(data)}
+	return nil
+}
+
+func (s *Storage) Delete(ctx context.Context, p string) error {
+	return s.delete(p, storage.Condition{})
+}
+
+// DeleteIf checks the entity tag under the same lock that removes the file.
+func (s *Storage) DeleteIf(ctx context.Context, p, etag string) error {
+	return s.delete(p, storage.Condition{IfMatch: etag})
+}
+
+func (s *Storage) delete(p string, cond storage.Condition) error {
+	name, err := cleanPath(p)
+	if err != nil {
+		return err
+	}
+	if name == "" {
+		return storage.ErrPermission
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.check(name, cond); err != nil {
+		return err
+	}
+	n, ok := s.nodes[name]
+	if !ok {
+		return storage.ErrNotFound
+	}
+	if n.isDir {
+		for other := range s.nodes {
+			if parent(other) == name {
+				return fmt.Errorf("delete %s: %w", name, storage.ErrNotEmpty)
+			}
+		}
+	}
+
+	delete(s.nodes, name)
+	s.nodes[parent(name)].modTime = s.now()
+	return nil
+}
+
+// check evaluates cond against the node at name. s.mu must be held.
+func (s *Storage) check(name string, cond storage.Condition) error {
+	n, ok := s.nodes[name]
+	if !ok {
+		return cond.Check(nil)
+	}
+	fi := toFileInfo(name, n)
+	return cond.Check(&fi)
+}
+
+// DeleteAll removes name and every node below it under a single lock.
+func (s *Storage) DeleteAll(ctx context.Context, p string) error {
+	name, err := cleanPath(p)
+	if err != nil {
+		return err
+	}
+	if name == "" {
+		return storage.ErrPermission
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.nodes[name]; !ok {
+		return storage.ErrNotFound
+	}
+	for other := range s.nodes {
+		if other == name || strings.HasPrefix(other, name+"/") {
+			delete(s.nodes, other)
+		}
+	}
+	s.nodes[parent(name)].modTime = s.now()
+	return nil
+}
+
+func (s *Storage) Mkdir(ctx context.Context, p string) error {
+	name, err := cleanPath(p)
+	if err != nil {
+		return err
+	}
+	if name == "" {
+		return storage.ErrPermission
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.nodes[name]; ok {
+		return fmt.Errorf("mkdir %s: %w", name, storage.ErrExist)
+	}
+	return s.mkdirAll(name)
+}
+
+// Move re-keys from and everything below it under a single lock, so
+// readers never observe a half-moved tree.
+func (s *Storage) Move(ctx context.Context, from, to string) error {
+	return s.transfer(from, to, true)
+}
+
+// Copy duplicates from and everything below it. File contents are never
+// modified in place, so the copies share their data with the originals.
+func (s *Storage) Copy(ctx context.Context, from, to string) error {
+	return s.transfer(from, to, false)
+}
+
+func (s *Storage) transfer(from, to string, move bool) error {
+	src, err := cleanPath(from)
+	if err != nil {
+		return err
+	}
+	dst, err := cleanPath(to)
+	if err != nil {
+		return err
+	}
+	if src == "" || dst == "" {
+		return storage.ErrPermission
+	}
+	if src == dst || strings.HasPrefix(dst, src+"/") {
+		return fmt.Errorf("%w: cannot move or copy %s into itself", storage.ErrInvalid, src)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n, ok := s.nodes[src]
+	if !ok {
+		return storage.ErrNotFound
+	}
+	if existing, ok := s.nodes[dst]; ok && (existing.isDir || n.isDir) {
+		return fmt.Errorf("%w: %s", storage.ErrExist, dst)
+	}
+	if err := s.mkdirAll(parent(dst)); err != nil {
+		return err
+	}
+
+	var names []string
+	for name := range s.nodes {
+		if name == src || strings.HasPrefix(name, src+"/") {
+			names = append(names, name)
+		}
+	}
+
+	now := s.now()
+	for _, name := range names {
+		n := *s.nodes[name]
+		if !move {
+			n.modTime = now
+		}
+		if move {
+			delete(s.nodes, name)
+		}
+		s.nodes[dst+strings.TrimPrefix(name, src)] = &n
+	}
+	s.nodes[parent(dst)].modTime = now
+	if move {
+		s.nodes[parent(src)].modTime = now
+	}
+	return nil
+}
+
+func (s *Storage) Stat(ctx context.Context, p string) (*storage.FileInfo, error) {
+	name, err := cleanPath(p)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	n, ok := s.nodes[name]
+	if !ok {
+		return nil, storage.ErrNotFound
+	}
+	fi := toFileInfo(name, n)
+	return &fi, nil
+}
+
+// mkdirAll creates dir and any missing ancestors. The caller holds s.mu.
+func (s *Storage) mkdirAll(dir string) error {
+	n, ok := s.nodes[dir]
+	if ok {
+		if !n.isDir {
+			return fmt.Errorf("mkdir %s: not a directory", dir)
+		}
+		return nil
+	}
+	if err := s.mkdirAll(parent(dir)); err != nil {
+		return err
+	}
+
+	now := s.now()
+	s.nodes[dir] = &node{isDir: true, modTime: now}
+	s.nodes[parent(dir)].modTime = now
+	return nil
+}
+
+// cleanPath normalizes an API path to a slash-separated relative path with
+// no leading "/". The root is "".
+func cleanPath(p string) (string, error) {
+	if strings.Contains(p, "..") {
+		return "", storage.ErrPermission
+	}
+	return strings.TrimPrefix(path.Clean("/"+p), "/"), nil
+}
+
+// parent returns the cleaned path of name's directory. The root's parent is
+// the root.
+func parent(name string) string {
+	dir := path.Dir(name)
+	if dir == "." {
+		return ""
+	}
+	return dir
+}
+
+func toFileInfo(name string, n *node) storage.FileInfo {
+	fi := storage.FileInfo{
+		Name:    path.Base(name),
+		Path:    name,
+		Size:    int64(len(n.data)),
+		IsDir:   n.isDir,
+		ModTime: n.modTime,
+	}
+	if name == "" {
+		fi.Name = "/"
+	}
+	for algo, sum := range n.sums {
+		fi.SetChecksum(algo, sum)
+	}
+	if fi.MD5 != "" {
+		fi.ETag = `"` + fi.MD5 + `"`
+	}
+	return fi
+}
+
+// checksums computes every supported checksum of data.
+func checksums(data []byte) map[string]string {
+	sums := make(map[string]string, len(storage.Algorithms))
+	for _, algo := range storage.Algorithms {
+		sums[algo], _ = storage.Checksum(bytes.NewReader(data), algo)
+	}
+	return sums
+}
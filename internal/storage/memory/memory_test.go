@@ -0,0 +1,353 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go-storage-api/internal/storage"
+	"go-storage-api/internal/storage/storagetest"
+)
+
+// fakeClock returns a strictly increasing time on every call.
+func fakeClock() func() time.Time {
+	t := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	return func() time.Time {
+		t = t.Add(time.Second)
+		return t
+	}
+}
+
+func newTestStorage(t *testing.T) *Storage {
+	t.Helper()
+	s := New()
+	s.now = fakeClock()
+	return s
+}
+
+func write(t *testing.T, s *Storage, p, content string) {
+	t.Helper()
+	if err := s.Write(context.Background(), p, strings.NewReader(content)); err != nil {
+		t.Fatalf("Write(%q): %v", p, err)
+	}
+}
+
+// --- List ---
+
+func TestList(t *testing.T) {
+	s := newTestStorage(t)
+	write(t, s, "docs/readme.md", "hi")
+	write(t, s, "docs/sub/deep.txt", "x")
+	write(t, s, "other.txt", "y")
+
+	files, err := s.List(context.Background(), "/docs")
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("expected 2 entries, got %d: %+v", len(files), files)
+	}
+	if f := files[0]; f.Name != "readme.md" || f.Path != "docs/readme.md" || f.Size != 2 || f.IsDir {
+		t.Errorf("unexpected first entry: %+v", f)
+	}
+	if f := files[1]; f.Name != "sub" || f.Path != "docs/sub" || !f.IsDir {
+		t.Errorf("unexpected second entry: %+v", f)
+	}
+}
+
+func TestList_EmptyRoot(t *testing.T) {
+	s := newTestStorage(t)
+
+	files, err := s.List(context.Background(), "/")
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if files == nil || len(files) != 0 {
+		t.Errorf("expected empty non-nil slice, got %#v", files)
+	}
+}
+
+func TestList_NotFound(t *testing.T) {
+	s := newTestStorage(t)
+
+	_, err := s.List(context.Background(), "nonexistent")
+	if !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestList_File(t *testing.T) {
+	s := newTestStorage(t)
+	write(t, s, "file.txt", "x")
+
+	if _, err := s.List(context.Background(), "file.txt"); err == nil {
+		t.Error("expected error listing a file")
+	}
+}
+
+// --- Read / Write ---
+
+func TestWriteThenRead(t *testing.T) {
+	s := newTestStorage(t)
+	ctx := context.Background()
+	write(t, s, "/a/b/c.txt", "first")
+	write(t, s, "a/b/c.txt", "second")
+
+	rc, err := s.Read(ctx, "a//b/./c.txt")
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	defer rc.Close()
+	data, _ := io.ReadAll(rc)
+	if string(data) != "second" {
+		t.Errorf("expected %q, got %q", "second", string(data))
+	}
+}
+
+func TestWrite_CreatesParents(t *testing.T) {
+	s := newTestStorage(t)
+	write(t, s, "a/b/c.txt", "x")
+
+	for _, dir := range []string{"a", "a/b"} {
+		fi, err := s.Stat(context.Background(), dir)
+		if err != nil {
+			t.Fatalf("Stat(%q): %v", dir, err)
+		}
+		if !fi.IsDir {
+			t.Errorf("expected %q to be a directory", dir)
+		}
+	}
+}
+
+func TestWrite_ParentIsFile(t *testing.T) {
+	s := newTestStorage(t)
+	write(t, s, "file.txt", "x")
+
+	err := s.Write(context.Background(), "file.txt/child.txt", strings.NewReader("y"))
+	if err == nil {
+		t.Error("expected error writing below a file")
+	}
+}
+
+func TestWrite_OverDirectory(t *testing.T) {
+	s := newTestStorage(t)
+	write(t, s, "dir/file.txt", "x")
+
+	if err := s.Write(context.Background(), "dir", strings.NewReader("y")); err == nil {
+		t.Error("expected error overwriting a directory")
+	}
+	if err := s.Write(context.Background(), "/", strings.NewReader("y")); !errors.Is(err, storage.ErrPermission) {
+		t.Errorf("expected ErrPermission writing root, got %v", err)
+	}
+}
+
+func TestWrite_FailedReaderLeavesNothing(t *testing.T) {
+	s := newTestStorage(t)
+	ctx := context.Background()
+
+	r := io.MultiReader(strings.NewReader("partial"), errReader{})
+	if err := s.Write(ctx, "broken.txt", r); err == nil {
+		t.Fatal("expected write error")
+	}
+	if _, err := s.Stat(ctx, "broken.txt"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("expected no file after failed write, got %v", err)
+	}
+}
+
+func TestRead_NotFound(t *testing.T) {
+	s := newTestStorage(t)
+
+	_, err := s.Read(context.Background(), "missing.txt")
+	if !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestRead_Directory(t *testing.T) {
+	s := newTestStorage(t)
+	write(t, s, "dir/file.txt", "x")
+
+	if _, err := s.Read(context.Background(), "dir"); err == nil {
+		t.Error("expected error reading a directory")
+	}
+}
+
+// --- Delete ---
+
+func TestDelete(t *testing.T) {
+	s := newTestStorage(t)
+	ctx := context.Background()
+	write(t, s, "dir/file.txt", "x")
+
+	if err := s.Delete(ctx, "dir"); err == nil {
+		t.Fatal("expected error deleting non-empty directory")
+	}
+	if err := s.Delete(ctx, "dir/file.txt"); err != nil {
+		t.Fatalf("Delete file: %v", err)
+	}
+	if err := s.Delete(ctx, "dir"); err != nil {
+		t.Fatalf("Delete empty dir: %v", err)
+	}
+	if err := s.Delete(ctx, "dir"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+	if err := s.Delete(ctx, "/"); !errors.Is(err, storage.ErrPermission) {
+		t.Errorf("expected ErrPermission deleting root, got %v", err)
+	}
+}
+
+// --- Stat ---
+
+func TestStat(t *testing.T) {
+	s := newTestStorage(t)
+	write(t, s, "mydir/info.txt", "12345")
+
+	fi, err := s.Stat(context.Background(), "mydir/info.txt")
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+	if fi.Name != "info.txt" || fi.Path != "mydir/info.txt" || fi.Size != 5 || fi.IsDir {
+		t.Errorf("unexpected FileInfo: %+v", fi)
+	}
+
+	root, err := s.Stat(context.Background(), "/")
+	if err != nil {
+		t.Fatalf("Stat root: %v", err)
+	}
+	if !root.IsDir || root.Path != "" {
+		t.Errorf("unexpected root FileInfo: %+v", root)
+	}
+
+	if _, err := s.Stat(context.Background(), "nope.txt"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestModTime(t *testing.T) {
+	s := newTestStorage(t)
+	ctx := context.Background()
+
+	write(t, s, "dir/a.txt", "1")
+	first, _ := s.Stat(ctx, "dir/a.txt")
+	dirBefore, _ := s.Stat(ctx, "dir")
+
+	write(t, s, "dir/a.txt", "2")
+	second, _ := s.Stat(ctx, "dir/a.txt")
+	if !second.ModTime.After(first.ModTime) {
+		t.Errorf("overwrite did not advance ModTime: %v -> %v", first.ModTime, second.ModTime)
+	}
+	if dirAfter, _ := s.Stat(ctx, "dir"); !dirAfter.ModTime.Equal(dirBefore.ModTime) {
+		t.Error("overwriting a file should not change its directory's ModTime")
+	}
+
+	write(t, s, "dir/b.txt", "3")
+	if dirAfter, _ := s.Stat(ctx, "dir"); !dirAfter.ModTime.After(dirBefore.ModTime) {
+		t.Error("adding a file should advance its directory's ModTime")
+	}
+}
+
+func TestChecksums(t *testing.T) {
+	s := newTestStorage(t)
+	write(t, s, "a.txt", "hello")
+
+	fi, err := s.Stat(context.Background(), "a.txt")
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+	if fi.SHA256 != "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824" {
+		t.Errorf("unexpected SHA256 %q", fi.SHA256)
+	}
+	if fi.MD5 != "5d41402abc4b2a76b9719d911017c592" || fi.ETag != `"5d41402abc4b2a76b9719d911017c592"` {
+		t.Errorf("unexpected MD5 %q / ETag %q", fi.MD5, fi.ETag)
+	}
+	if fi.CRC32C != "9a71bb4c" {
+		t.Errorf("unexpected CRC32C %q", fi.CRC32C)
+	}
+}
+
+// --- Path handling ---
+
+func TestCleanPath_BlocksTraversal(t *testing.T) {
+	for _, p := range []string{"../etc/passwd", "/../../etc/passwd", "subdir/../../etc"} {
+		if _, err := cleanPath(p); !errors.Is(err, storage.ErrPermission) {
+			t.Errorf("cleanPath(%q): expected ErrPermission, got %v", p, err)
+		}
+	}
+}
+
+// --- Concurrency ---
+
+func TestConcurrentAccess(t *testing.T) {
+	s := New()
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 50)
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			name := fmt.Sprintf("dir%d/file-%d.txt", i%5, i)
+			if err := s.Write(ctx, name, strings.NewReader(name)); err != nil {
+				errs <- err
+				return
+			}
+			rc, err := s.Read(ctx, name)
+			if err != nil {
+				errs <- err
+				return
+			}
+			data, _ := io.ReadAll(rc)
+			rc.Close()
+			if string(data) != name {
+				errs <- fmt.Errorf("%s: got %q", name, data)
+			}
+			if _, err := s.List(ctx, fmt.Sprintf("dir%d", i%5)); err != nil {
+				errs <- err
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+type errReader struct{}
+
+func (errReader) Read([]byte) (int, error) { return 0, errors.New("connection reset") }
+
+// --- Conformance ---
+
+func TestConformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Storage {
+		return New()
+	})
+}
+
+// TestConformance_Fallbacks hides the optional interfaces so that the
+// generic implementations in package storage are held to the same contract.
+func TestConformance_Fallbacks(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Storage {
+		return struct{ storage.Storage }{New()}
+	})
+}
+
+// --- Interface compliance ---
+
+var (
+	_ storage.Storage     = (*Storage)(nil)
+	_ storage.RangeReader = (*Storage)(nil)
+	_ storage.Mover       = (*Storage)(nil)
+	_ storage.Copier      = (*Storage)(nil)
+	_ storage.TreeDeleter = (*Storage)(nil)
+
+	_ storage.ConditionalWriter = (*Storage)(nil)
+)
@@ -0,0 +1,120 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// Mover is implemented by backends that can rename a file or directory
+// without copying its contents.
+type Mover interface {
+	// Move renames from to to, creating missing parents of to. An existing
+	// file at to is replaced.
+	Move(ctx context.Context, from, to string) error
+}
+
+// Copier is implemented by backends that can duplicate a file or directory
+// without streaming it through the API server.
+type Copier interface {
+	// Copy duplicates from at to, creating missing parents of to. An existing
+	// file at to is replaced. Directories are copied recursively.
+	Copy(ctx context.Context, from, to string) error
+}
+
+// Move renames a file or directory in s. Backends implementing Mover do this
+// natively; for all others the tree is copied and the source deleted
+// afterwards, so a failure part-way leaves the source intact.
+//
+// Both Move and Copy fail with ErrInvalid when to is from or lies inside it,
+// with ErrPermission when either is the root, and with ErrExist when to is an
+// existing directory or from is a directory and to an existing file.
+func Move(ctx context.Context, s Storage, from, to string) error {
+	if err := checkTransfer(ctx, s, from, to); err != nil {
+		return err
+	}
+	if m, ok := s.(Mover); ok {
+		return m.Move(ctx, from, to)
+	}
+
+	if err := copyTree(ctx, s, from, to); err != nil {
+		return err
+	}
+	return deleteTree(ctx, s, from)
+}
+
+// Copy duplicates a file or directory in s. Backends implementing Copier do
+// this natively; for all others each file is streamed from Read to Write.
+func Copy(ctx context.Context, s Storage, from, to string) error {
+	if err := checkTransfer(ctx, s, from, to); err != nil {
+		return err
+	}
+	if c, ok := s.(Copier); ok {
+		return c.Copy(ctx, from, to)
+	}
+	return copyTree(ctx, s, from, to)
+}
+
+// checkTransfer applies the rules shared by Move and Copy before any backend
+// is involved, so native and fallback implementations behave alike.
+func checkTransfer(ctx context.Context, s Storage, from, to string) error {
+	src := strings.TrimPrefix(path.Clean("/"+from), "/")
+	dst := strings.TrimPrefix(path.Clean("/"+to), "/")
+	if src == "" || dst == "" {
+		return ErrPermission
+	}
+	if src == dst || strings.HasPrefix(dst, src+"/") {
+		return fmt.Errorf("%w: cannot move or copy %s into itself", ErrInvalid, src)
+	}
+
+	srcInfo, err := s.Stat(ctx, from)
+	if err != nil {
+		return err
+	}
+	dstInfo, err := s.Stat(ctx, to)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if dstInfo.IsDir || srcInfo.IsDir {
+		return fmt.Errorf("%w: %s", ErrExist, dst)
+	}
+	return nil
+}
+
+func copyTree(ctx context.Context, s Storage, from, to string) error {
+	info, err := s.Stat(ctx, from)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir {
+		return copyFile(ctx, s, from, to)
+	}
+
+	if err := s.Mkdir(ctx, to); err != nil && !errors.Is(err, ErrExist) {
+		return err
+	}
+	entries, err := s.List(ctx, from)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if err := copyTree(ctx, s, e.Path, path.Join(to, e.Name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func copyFile(ctx context.Context, s Storage, from, to string) error {
+	rc, err := s.Read(ctx, from)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	return s.Write(ctx, to, rc)
+}
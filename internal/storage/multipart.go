@@ -0,0 +1,30 @@
+package storage
+
+import (
+	"context"
+	"io"
+)
+
+// MaxParts is the highest part number of a multipart upload.
+const MaxParts = 10000
+
+// MultipartUploader is implemented by backends that can assemble a file from
+// parts uploaded independently and in any order. There is no fallback
+// helper: uploads to other backends are staged by the upload package and
+// written with a single Write once complete.
+type MultipartUploader interface {
+	// CreateMultipart starts an upload to path and returns its ID. Nothing
+	// is visible at path until the upload is completed.
+	CreateMultipart(ctx context.Context, path string) (string, error)
+	// UploadPart stores part n, between 1 and MaxParts, of an upload. size
+	// is the exact length of r; backends that must declare it up front rely
+	// on it. Uploading a part number again replaces the earlier part.
+	// Unknown uploads fail with ErrNotFound.
+	UploadPart(ctx context.Context, path, id string, n int, r io.Reader, size int64) error
+	// CompleteMultipart writes the uploaded parts to path in ascending part
+	// order, replacing any existing file, and ends the upload. Gaps in the
+	// numbering are skipped. An upload without parts fails with ErrInvalid.
+	CompleteMultipart(ctx context.Context, path, id string) error
+	// AbortMultipart ends an upload and discards its parts.
+	AbortMultipart(ctx context.Context, path, id string) error
+}
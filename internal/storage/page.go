@@ -0,0 +1,60 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"sort"
+)
+
+// Page is one slice of a directory listing returned by ListPage.
+type Page struct {
+	// Entries are direct children of the directory, ordered by name.
+	Entries []FileInfo
+	// Next resumes the listing after the last entry. It is empty once the
+	// directory has been listed completely.
+	Next string
+}
+
+// PageLister is implemented by backends that can list a large directory a
+// page at a time without holding all of its entries in memory.
+type PageLister interface {
+	// ListPage returns at most limit children of path, ordered by name and
+	// starting after the position encoded in cursor. An empty cursor starts
+	// at the beginning. Cursors are opaque and only valid for the backend
+	// and directory that returned them. Errors are as for List.
+	ListPage(ctx context.Context, path, cursor string, limit int) (*Page, error)
+}
+
+// ListPage lists part of a directory in s. Backends implementing PageLister
+// page natively; for all others the directory is listed in full, sorted by
+// name, and the cursor is the name of the last entry returned.
+func ListPage(ctx context.Context, s Storage, path, cursor string, limit int) (*Page, error) {
+	if limit <= 0 {
+		return nil, fmt.Errorf("%w: limit must be positive", ErrInvalid)
+	}
+	if pl, ok := s.(PageLister); ok {
+		return pl.ListPage(ctx, path, cursor, limit)
+	}
+
+	files, err := s.List(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Name < files[j].Name })
+	start := 0
+	if cursor != "" {
+		start = sort.Search(len(files), func(i int) bool { return files[i].Name > cursor })
+	}
+	return PageAfter(files[start:], limit), nil
+}
+
+// PageAfter returns the first limit entries of sorted as a Page whose cursor
+// is the name of its last entry, the form used by backends that page by
+// name.
+func PageAfter(sorted []FileInfo, limit int) *Page {
+	if len(sorted) <= limit {
+		return &Page{Entries: sorted}
+	}
+	entries := sorted[:limit]
+	return &Page{Entries: entries, Next: entries[limit-1].Name}
+}
@@ -0,0 +1,18 @@
+package storage
+
+import (
+	"context"
+	"time"
+)
+
+// Presigner is implemented by backends that can issue URLs of their own
+// through which a client reads or writes one file directly, bypassing the
+// API. There is no fallback helper: for other backends the API signs links
+// to its own routes.
+type Presigner interface {
+	// PresignURL returns a URL valid for expires through which path can be
+	// downloaded with method GET or replaced with method PUT. Other methods
+	// fail with ErrInvalid. Nothing is checked about path: a GET URL for a
+	// missing file fails only once it is used.
+	PresignURL(ctx context.Context, method, path string, expires time.Duration) (string, error)
+}
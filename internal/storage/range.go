@@ -0,0 +1,49 @@
+package storage
+
+import (
+	"context"
+	"io"
+)
+
+// RangeReader is implemented by backends that can start reading a file at an
+// arbitrary offset without streaming the bytes before it.
+type RangeReader interface {
+	// ReadRange opens path for reading length bytes starting at offset. A
+	// negative length reads to the end of the file. Ranges that extend past
+	// the end are truncated; an offset at or beyond the end yields an empty
+	// reader rather than an error.
+	ReadRange(ctx context.Context, path string, offset, length int64) (io.ReadCloser, error)
+}
+
+// ReadRange reads part of a file from s. Backends implementing RangeReader
+// serve the range natively; for all others the file is read from the start
+// and the bytes before offset are discarded.
+func ReadRange(ctx context.Context, s Storage, path string, offset, length int64) (io.ReadCloser, error) {
+	if rr, ok := s.(RangeReader); ok {
+		return rr.ReadRange(ctx, path, offset, length)
+	}
+
+	rc, err := s.Read(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	if offset > 0 {
+		if _, err := io.CopyN(io.Discard, rc, offset); err != nil && err != io.EOF {
+			rc.Close()
+			return nil, err
+		}
+	}
+	return LimitReadCloser(rc, length), nil
+}
+
+// LimitReadCloser returns a ReadCloser that reads at most n bytes from rc and
+// closes rc when closed. A negative n returns rc unchanged.
+func LimitReadCloser(rc io.ReadCloser, n int64) io.ReadCloser {
+	if n < 0 {
+		return rc
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.LimitReader(rc, n), rc}
+}
@@ -0,0 +1,54 @@
+package s3
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awss3 "github.com/aws/aws-sdk-go-v2/service/s3"
+
+	"go-storage-api/internal/storage"
+)
+
+// PresignURL returns a SigV4 presigned GetObject or PutObject URL. It is
+// signed locally with the backend's credentials, so it expires early if
+// they are temporary, and S3 refuses expiries past seven days.
+func (s *Storage) PresignURL(ctx context.Context, method, p string, expires time.Duration) (string, error) {
+	key, err := s.toKey(p)
+	if err != nil {
+		return "", err
+	}
+	if key == s.prefix {
+		return "", storage.ErrPermission
+	}
+
+	presigner := awss3.NewPresignClient(s.client, awss3.WithPresignExpires(expires))
+	var url string
+	switch method {
+	case http.MethodGet:
+		req, err := presigner.PresignGetObject(ctx, &awss3.GetObjectInput{
+			Bucket: aws.String(s.bucket),
+			Key:    aws.String(key),
+		})
+		if err != nil {
+			return "", fmt.Errorf("presign: %w", err)
+		}
+		url = req.URL
+	case http.MethodPut:
+		// No content type is set: it would be signed, and every client
+		// would have to send exactly the same one.
+		req, err := presigner.PresignPutObject(ctx, &awss3.PutObjectInput{
+			Bucket: aws.String(s.bucket),
+			Key:    aws.String(key),
+		})
+		if err != nil {
+			return "", fmt.Errorf("presign: %w", err)
+		}
+		url = req.URL
+	default:
+		return "", fmt.Errorf("%w: cannot presign %s", storage.ErrInvalid, method)
+	}
+	return url, nil
+}
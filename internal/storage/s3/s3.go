@@ -0,0 +1,779 @@
+package s3
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	awss3 "github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+
+	"go-storage-api/internal/storage"
+)
+
+// Options configures the S3 backend.
+type Options struct {
+	Bucket string
+	Region string
+	Prefix string
+	// Endpoint overrides the AWS endpoint, e.g. for MinIO or a local fake.
+	Endpoint string
+	// UsePathStyle addresses objects as endpoint/bucket/key instead of
+	// bucket.endpoint/key. Most S3-compatible servers require it.
+	UsePathStyle bool
+}
+
+// Storage implements storage.Storage against an S3 bucket. Paths are mapped
+// to object keys under an optional prefix (ADR-009); directories are implied
+// by keys that share a "/"-delimited prefix.
+type Storage struct {
+	client   *awss3.Client
+	uploader *manager.Uploader
+	bucket   string
+	prefix   string
+}
+
+// New creates an S3 backend using the default AWS credential chain and
+// verifies that the bucket is reachable.
+func New(ctx context.Context, opts Options) (*Storage, error) {
+	cfg, err := awsconfig.LoadDefaultConfig(ctx, awsconfig.WithRegion(opts.Region))
+	if err != nil {
+		return nil, fmt.Errorf("load aws config: %w", err)
+	}
+
+	client := awss3.NewFromConfig(cfg, func(o *awss3.Options) {
+		if opts.Endpoint != "" {
+			o.BaseEndpoint = aws.String(opts.Endpoint)
+		}
+		o.UsePathStyle = opts.UsePathStyle
+	})
+
+	if _, err := client.HeadBucket(ctx, &awss3.HeadBucketInput{Bucket: aws.String(opts.Bucket)}); err != nil {
+		return nil, fmt.Errorf("head bucket %q: %w", opts.Bucket, mapError(err))
+	}
+
+	prefix := strings.TrimPrefix(opts.Prefix, "/")
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+
+	return &Storage{
+		client:   client,
+		uploader: manager.NewUploader(client),
+		bucket:   opts.Bucket,
+		prefix:   prefix,
+	}, nil
+}
+
+func (s *Storage) List(ctx context.Context, p string) ([]storage.FileInfo, error) {
+	dir, err := cleanPath(p)
+	if err != nil {
+		return nil, err
+	}
+	prefix := s.dirPrefix(dir)
+
+	files := []storage.FileInfo{}
+	paginator := awss3.NewListObjectsV2Paginator(s.client, &awss3.ListObjectsV2Input{
+		Bucket:    aws.String(s.bucket),
+		Prefix:    aws.String(prefix),
+		Delimiter: aws.String("/"),
+	})
+	found := false
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, mapError(err)
+		}
+		for _, cp := range page.CommonPrefixes {
+			found = true
+			name := path.Base(strings.TrimSuffix(aws.ToString(cp.Prefix), "/"))
+			files = append(files, storage.FileInfo{
+				Name:  name,
+				Path:  path.Join(dir, name),
+				IsDir: true,
+			})
+		}
+		for _, obj := range page.Contents {
+			found = true
+			key := aws.ToString(obj.Key)
+			if key == prefix {
+				// Zero-byte directory marker created by Mkdir or other tools.
+				continue
+			}
+			name := strings.TrimPrefix(key, prefix)
+			files = append(files, storage.FileInfo{
+				Name:    name,
+				Path:    path.Join(dir, name),
+				Size:    aws.ToInt64(obj.Size),
+				ModTime: aws.ToTime(obj.LastModified),
+				ETag:    aws.ToString(obj.ETag),
+			})
+		}
+	}
+
+	// S3 has no real directories, so a prefix with nothing under it does
+	// not exist. The root always exists.
+	if !found && dir != "" {
+		return nil, storage.ErrNotFound
+	}
+	return files, nil
+}
+
+// ListPage maps one ListObjectsV2 call to one page, using the continuation
+// token as the cursor. S3 returns keys in byte order and orders a directory
+// by its "name/" prefix, so across pages "dir" can follow "dir.txt"; entries
+// within a page are sorted by name.
+func (s *Storage) ListPage(ctx context.Context, p, cursor string, limit int) (*storage.Page, error) {
+	dir, err := cleanPath(p)
+	if err != nil {
+		return nil, err
+	}
+	prefix := s.dirPrefix(dir)
+
+	in := &awss3.ListObjectsV2Input{
+		Bucket:    aws.String(s.bucket),
+		Prefix:    aws.String(prefix),
+		Delimiter: aws.String("/"),
+		MaxKeys:   aws.Int32(int32(min(limit, 1000))),
+	}
+	if cursor != "" {
+		in.ContinuationToken = aws.String(cursor)
+	}
+	out, err := s.client.ListObjectsV2(ctx, in)
+	if err != nil {
+		return nil, mapError(err)
+	}
+
+	files := []storage.FileInfo{}
+	for _, cp := range out.CommonPrefixes {
+		name := path.Base(strings.TrimSuffix(aws.ToString(cp.Prefix), "/"))
+		files = append(files, storage.FileInfo{
+			Name:  name,
+			Path:  path.Join(dir, name),
+			IsDir: true,
+		})
+	}
+	for _, obj := range out.Contents {
+		key := aws.ToString(obj.Key)
+		if key == prefix {
+			continue
+		}
+		name := strings.TrimPrefix(key, prefix)
+		files = append(files, storage.FileInfo{
+			Name:    name,
+			Path:    path.Join(dir, name),
+			Size:    aws.ToInt64(obj.Size),
+			ModTime: aws.ToTime(obj.LastModified),
+			ETag:    aws.ToString(obj.ETag),
+		})
+	}
+	if cursor == "" && dir != "" && len(out.CommonPrefixes) == 0 && len(out.Contents) == 0 {
+		return nil, storage.ErrNotFound
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Name < files[j].Name })
+
+	page := &storage.Page{Entries: files}
+	if aws.ToBool(out.IsTruncated) {
+		page.Next = aws.ToString(out.NextContinuationToken)
+	}
+	return page, nil
+}
+
+// Walk lists every key under the directory's prefix without a delimiter,
+// so a whole tree costs one request per 1000 keys instead of one per
+// directory. Directories are derived from the keys: keys below a directory
+// are contiguous in S3's byte order, so a stack of the directories on the
+// current key's path is enough to visit each one once, before its contents.
+func (s *Storage) Walk(ctx context.Context, root string, fn storage.WalkFunc) error {
+	dir, err := cleanPath(root)
+	if err != nil {
+		return err
+	}
+	prefix := s.dirPrefix(dir)
+
+	var stack []string // directories (relative to the storage root) being walked
+	skip := ""         // key prefix of a directory whose contents are skipped
+	found := false
+	visit := func(info storage.FileInfo) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		return fn(info)
+	}
+
+	paginator := awss3.NewListObjectsV2Paginator(s.client, &awss3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucket),
+		Prefix: aws.String(prefix),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return mapError(err)
+		}
+		for _, obj := range page.Contents {
+			found = true
+			key := aws.ToString(obj.Key)
+			if key == prefix || skip != "" && strings.HasPrefix(key, skip) {
+				continue
+			}
+			skip = ""
+
+			rel := strings.TrimPrefix(key, s.prefix)
+			parent := path.Dir(strings.TrimSuffix(rel, "/"))
+			if strings.HasSuffix(rel, "/") {
+				// Directory marker: visit it as a directory, no file entry.
+				parent = strings.TrimSuffix(rel, "/")
+			}
+
+			// Pop directories this key is not under, then push and visit the
+			// ones it is.
+			for len(stack) > 0 && !strings.HasPrefix(parent+"/", stack[len(stack)-1]+"/") {
+				stack = stack[:len(stack)-1]
+			}
+			skipped := false
+			for _, d := range missingDirs(dir, stack, parent) {
+				stack = append(stack, d)
+				err := visit(storage.FileInfo{Name: path.Base(d), Path: d, IsDir: true})
+				if errors.Is(err, storage.SkipDir) {
+					skip = s.prefix + d + "/"
+					skipped = true
+					break
+				}
+				if err != nil {
+					return err
+				}
+			}
+			if skipped || strings.HasSuffix(rel, "/") {
+				continue
+			}
+
+			err := visit(storage.FileInfo{
+				Name:    path.Base(rel),
+				Path:    rel,
+				Size:    aws.ToInt64(obj.Size),
+				ModTime: aws.ToTime(obj.LastModified),
+				ETag:    aws.ToString(obj.ETag),
+			})
+			if err != nil && !errors.Is(err, storage.SkipDir) {
+				return err
+			}
+		}
+	}
+
+	if !found && dir != "" {
+		return storage.ErrNotFound
+	}
+	return nil
+}
+
+// missingDirs returns the directories between the deepest entry of stack
+// (or root, if stack is empty) and dir, outermost first. dir must be root or
+// lie below it.
+func missingDirs(root string, stack []string, dir string) []string {
+	base := root
+	if len(stack) > 0 {
+		base = stack[len(stack)-1]
+	}
+	var dirs []string
+	for d := dir; d != base && d != "." && d != ""; d = path.Dir(d) {
+		dirs = append(dirs, d)
+	}
+	for i, j := 0, len(dirs)-1; i < j; i, j = i+1, j-1 {
+		dirs[i], dirs[j] = dirs[j], dirs[i]
+	}
+	return dirs
+}
+
+func (s *Storage) Read(ctx context.Context, p string) (io.ReadCloser, error) {
+	key, err := s.toKey(p)
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := s.client.GetObject(ctx, &awss3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, mapError(err)
+	}
+	return out.Body, nil
+}
+
+// ReadRange issues a ranged GetObject. S3 rejects a range that starts past
+// the end of the object with InvalidRange, which is reported as an empty read.
+func (s *Storage) ReadRange(ctx context.Context, p string, offset, length int64) (io.ReadCloser, error) {
+	key, err := s.toKey(p)
+	if err != nil {
+		return nil, err
+	}
+
+	// An HTTP range cannot express zero bytes; only check the object exists.
+	if length == 0 {
+		if _, err := s.client.HeadObject(ctx, &awss3.HeadObjectInput{
+			Bucket: aws.String(s.bucket),
+			Key:    aws.String(key),
+		}); err != nil {
+			return nil, mapError(err)
+		}
+		return io.NopCloser(strings.NewReader("")), nil
+	}
+
+	rng := fmt.Sprintf("bytes=%d-", max(offset, 0))
+	if length > 0 {
+		rng += strconv.FormatInt(max(offset, 0)+length-1, 10)
+	}
+	out, err := s.client.GetObject(ctx, &awss3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+		Range:  aws.String(rng),
+	})
+	if err != nil {
+		var apiErr smithy.APIError
+		if errors.As(err, &apiErr) && apiErr.ErrorCode() == "InvalidRange" {
+			return io.NopCloser(strings.NewReader("")), nil
+		}
+		return nil, mapError(err)
+	}
+	return out.Body, nil
+}
+
+// Write streams r to S3. Small bodies are sent with a single PutObject;
+// larger ones are split into a multipart upload so that memory use stays
+// bounded by the uploader's part size and concurrency.
+func (s *Storage) Write(ctx context.Context, p string, r io.Reader) error {
+	return s.WriteIf(ctx, p, r, storage.Condition{})
+}
+
+// WriteIf sends cond as the If-Match or If-None-Match header of the upload,
+// so S3 itself refuses the write if the object changed. For uploads large
+// enough to go multipart, S3 checks the header when the upload completes.
+func (s *Storage) WriteIf(ctx context.Context, p string, r io.Reader, cond storage.Condition) error {
+	key, err := s.toKey(p)
+	if err != nil {
+		return err
+	}
+	if key == s.prefix {
+		return storage.ErrPermission
+	}
+
+	input := &awss3.PutObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+		Body:   r,
+	}
+	if ct := mime.TypeByExtension(path.Ext(key)); ct != "" {
+		input.ContentType = aws.String(ct)
+	}
+	if cond.IfMatch != "" {
+		input.IfMatch = aws.String(cond.IfMatch)
+	}
+	if cond.IfNoneMatch {
+		input.IfNoneMatch = aws.String("*")
+	}
+
+	if _, err := s.uploader.Upload(ctx, input); err != nil {
+		return fmt.Errorf("write file: %w", conditionError(mapError(err), cond.IfMatch))
+	}
+	return nil
+}
+
+func (s *Storage) Delete(ctx context.Context, p string) error {
+	name, err := cleanPath(p)
+	if err != nil {
+		return err
+	}
+	if name == "" {
+		return storage.ErrPermission
+	}
+
+	// DeleteObject succeeds for missing keys; check first so callers get
+	// the same ErrNotFound as on other backends.
+	_, err = s.client.HeadObject(ctx, &awss3.HeadObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(s.prefix + name),
+	})
+	if err == nil {
+		return s.deleteKey(ctx, s.prefix+name)
+	}
+	if err := mapError(err); !errors.Is(err, storage.ErrNotFound) {
+		return err
+	}
+
+	// A directory can only be deleted if nothing but its marker is left.
+	prefix := s.dirPrefix(name)
+	list, err := s.client.ListObjectsV2(ctx, &awss3.ListObjectsV2Input{
+		Bucket:  aws.String(s.bucket),
+		Prefix:  aws.String(prefix),
+		MaxKeys: aws.Int32(2),
+	})
+	if err != nil {
+		return mapError(err)
+	}
+	switch {
+	case len(list.Contents) == 0:
+		return storage.ErrNotFound
+	case len(list.Contents) == 1 && aws.ToString(list.Contents[0].Key) == prefix:
+		return s.deleteKey(ctx, prefix)
+	}
+	return fmt.Errorf("delete %s: %w", name, storage.ErrNotEmpty)
+}
+
+// DeleteAll removes an object, or every object below a directory prefix,
+// with one DeleteObjects request per listing page.
+func (s *Storage) DeleteAll(ctx context.Context, p string) error {
+	name, err := cleanPath(p)
+	if err != nil {
+		return err
+	}
+	if name == "" {
+		return storage.ErrPermission
+	}
+
+	found := false
+	_, err = s.client.HeadObject(ctx, &awss3.HeadObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(s.prefix + name),
+	})
+	if err == nil {
+		found = true
+		if err := s.deleteKey(ctx, s.prefix+name); err != nil {
+			return err
+		}
+	} else if err := mapError(err); !errors.Is(err, storage.ErrNotFound) {
+		return err
+	}
+
+	paginator := awss3.NewListObjectsV2Paginator(s.client, &awss3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucket),
+		Prefix: aws.String(s.dirPrefix(name)),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return mapError(err)
+		}
+		if len(page.Contents) == 0 {
+			continue
+		}
+		found = true
+
+		objects := make([]types.ObjectIdentifier, len(page.Contents))
+		for i, obj := range page.Contents {
+			objects[i] = types.ObjectIdentifier{Key: obj.Key}
+		}
+		out, err := s.client.DeleteObjects(ctx, &awss3.DeleteObjectsInput{
+			Bucket: aws.String(s.bucket),
+			Delete: &types.Delete{Objects: objects, Quiet: aws.Bool(true)},
+		})
+		if err != nil {
+			return mapError(err)
+		}
+		if len(out.Errors) > 0 {
+			e := out.Errors[0]
+			return fmt.Errorf("delete %s: %s: %s", aws.ToString(e.Key), aws.ToString(e.Code), aws.ToString(e.Message))
+		}
+	}
+
+	if !found {
+		return storage.ErrNotFound
+	}
+	return nil
+}
+
+// Mkdir stores a zero-byte marker object whose key ends in "/", the
+// convention the S3 console and most tools use for empty folders.
+func (s *Storage) Mkdir(ctx context.Context, p string) error {
+	name, err := cleanPath(p)
+	if err != nil {
+		return err
+	}
+	if name == "" {
+		return storage.ErrPermission
+	}
+
+	if _, err := s.Stat(ctx, name); err == nil {
+		return fmt.Errorf("mkdir %s: %w", name, storage.ErrExist)
+	} else if !errors.Is(err, storage.ErrNotFound) {
+		return err
+	}
+
+	if _, err := s.client.PutObject(ctx, &awss3.PutObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(s.dirPrefix(name)),
+		Body:   strings.NewReader(""),
+	}); err != nil {
+		return mapError(err)
+	}
+	return nil
+}
+
+// DeleteIf deletes the object only if its ETag is etag, using S3's
+// conditional DeleteObject. Directories have no object of their own and
+// never match.
+func (s *Storage) DeleteIf(ctx context.Context, p, etag string) error {
+	name, err := cleanPath(p)
+	if err != nil {
+		return err
+	}
+	if name == "" {
+		return storage.ErrPermission
+	}
+
+	if _, err := s.client.DeleteObject(ctx, &awss3.DeleteObjectInput{
+		Bucket:  aws.String(s.bucket),
+		Key:     aws.String(s.prefix + name),
+		IfMatch: aws.String(etag),
+	}); err != nil {
+		return conditionError(mapError(err), etag)
+	}
+	return nil
+}
+
+// conditionError reports a missing object as ErrPrecondition when the
+// request required it to exist, as HTTP does.
+func conditionError(err error, ifMatch string) error {
+	if ifMatch != "" && errors.Is(err, storage.ErrNotFound) {
+		return fmt.Errorf("%w: entity tag does not match", storage.ErrPrecondition)
+	}
+	return err
+}
+
+func (s *Storage) deleteKey(ctx context.Context, key string) error {
+	if _, err := s.client.DeleteObject(ctx, &awss3.DeleteObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	}); err != nil {
+		return mapError(err)
+	}
+	return nil
+}
+
+// Copy duplicates a file, or every object below a directory prefix, with
+// server-side CopyObject so no data passes through the API server.
+// CopyObject is limited to objects of 5 GiB.
+func (s *Storage) Copy(ctx context.Context, from, to string) error {
+	return s.transfer(ctx, from, to, false)
+}
+
+// Move copies like Copy and deletes each source object once its copy
+// exists. S3 has no rename, so a failure part-way through a directory
+// leaves the remaining objects at the source.
+func (s *Storage) Move(ctx context.Context, from, to string) error {
+	return s.transfer(ctx, from, to, true)
+}
+
+func (s *Storage) transfer(ctx context.Context, from, to string, move bool) error {
+	src, err := cleanPath(from)
+	if err != nil {
+		return err
+	}
+	dst, err := cleanPath(to)
+	if err != nil {
+		return err
+	}
+	if src == "" || dst == "" {
+		return storage.ErrPermission
+	}
+
+	_, err = s.client.HeadObject(ctx, &awss3.HeadObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(s.prefix + src),
+	})
+	if err == nil {
+		return s.copyObject(ctx, s.prefix+src, s.prefix+dst, move)
+	}
+	if err = mapError(err); !errors.Is(err, storage.ErrNotFound) {
+		return err
+	}
+
+	srcPrefix, dstPrefix := s.dirPrefix(src), s.dirPrefix(dst)
+	paginator := awss3.NewListObjectsV2Paginator(s.client, &awss3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucket),
+		Prefix: aws.String(srcPrefix),
+	})
+	found := false
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return mapError(err)
+		}
+		for _, obj := range page.Contents {
+			found = true
+			key := aws.ToString(obj.Key)
+			if err := s.copyObject(ctx, key, dstPrefix+strings.TrimPrefix(key, srcPrefix), move); err != nil {
+				return err
+			}
+		}
+	}
+	if !found {
+		return storage.ErrNotFound
+	}
+	return nil
+}
+
+func (s *Storage) copyObject(ctx context.Context, srcKey, dstKey string, deleteSource bool) error {
+	if _, err := s.client.CopyObject(ctx, &awss3.CopyObjectInput{
+		Bucket:     aws.String(s.bucket),
+		Key:        aws.String(dstKey),
+		CopySource: aws.String(url.PathEscape(s.bucket) + "/" + escapeKey(srcKey)),
+	}); err != nil {
+		return mapError(err)
+	}
+	if !deleteSource {
+		return nil
+	}
+	return s.deleteKey(ctx, srcKey)
+}
+
+func (s *Storage) Stat(ctx context.Context, p string) (*storage.FileInfo, error) {
+	name, err := cleanPath(p)
+	if err != nil {
+		return nil, err
+	}
+	if name == "" {
+		return &storage.FileInfo{Name: "/", IsDir: true}, nil
+	}
+
+	out, err := s.client.HeadObject(ctx, &awss3.HeadObjectInput{
+		Bucket:       aws.String(s.bucket),
+		Key:          aws.String(s.prefix + name),
+		ChecksumMode: types.ChecksumModeEnabled,
+	})
+	if err == nil {
+		info := &storage.FileInfo{
+			Name:        path.Base(name),
+			Path:        name,
+			Size:        aws.ToInt64(out.ContentLength),
+			ModTime:     aws.ToTime(out.LastModified),
+			ETag:        aws.ToString(out.ETag),
+			ContentType: aws.ToString(out.ContentType),
+		}
+		info.SHA256 = hexChecksum(out.ChecksumSHA256)
+		info.CRC32C = hexChecksum(out.ChecksumCRC32C)
+		info.MD5 = etagMD5(out)
+		return info, nil
+	}
+	if err := mapError(err); !errors.Is(err, storage.ErrNotFound) {
+		return nil, err
+	}
+
+	// No object with that key; it is a directory if anything lives below it.
+	list, err := s.client.ListObjectsV2(ctx, &awss3.ListObjectsV2Input{
+		Bucket:  aws.String(s.bucket),
+		Prefix:  aws.String(s.dirPrefix(name)),
+		MaxKeys: aws.Int32(1),
+	})
+	if err != nil {
+		return nil, mapError(err)
+	}
+	if len(list.Contents) == 0 {
+		return nil, storage.ErrNotFound
+	}
+	return &storage.FileInfo{Name: path.Base(name), Path: name, IsDir: true}, nil
+}
+
+// toKey maps an API path to an object key: the leading "/" is stripped and
+// the configured prefix is prepended (ADR-009).
+func (s *Storage) toKey(p string) (string, error) {
+	name, err := cleanPath(p)
+	if err != nil {
+		return "", err
+	}
+	return s.prefix + name, nil
+}
+
+// dirPrefix returns the key prefix under which the contents of dir live.
+func (s *Storage) dirPrefix(dir string) string {
+	if dir == "" {
+		return s.prefix
+	}
+	return s.prefix + dir + "/"
+}
+
+// cleanPath normalizes an API path to a slash-separated relative path with
+// no leading "/". The root is "".
+func cleanPath(p string) (string, error) {
+	if strings.Contains(p, "..") {
+		return "", storage.ErrPermission
+	}
+	return strings.TrimPrefix(path.Clean("/"+p), "/"), nil
+}
+
+// hexChecksum converts a base64 checksum from S3 to hex. Checksums of
+// multipart uploads are checksums of the part checksums, suffixed with
+// "-<parts>", and do not describe the content; they are dropped.
+func hexChecksum(b64 *string) string {
+	if b64 == nil || strings.Contains(*b64, "-") {
+		return ""
+	}
+	sum, err := base64.StdEncoding.DecodeString(*b64)
+	if err != nil {
+		return ""
+	}
+	return hex.EncodeToString(sum)
+}
+
+// etagMD5 returns the MD5 of an object from its ETag. S3's ETag is the hex
+// MD5 of the content for objects uploaded in one part, unencrypted or with
+// SSE-S3. Multipart ETags end in "-<parts>", and with SSE-KMS or SSE-C the
+// ETag is not a digest at all; for those "" is returned.
+func etagMD5(out *awss3.HeadObjectOutput) string {
+	if out.ServerSideEncryption == types.ServerSideEncryptionAwsKms ||
+		out.ServerSideEncryption == types.ServerSideEncryptionAwsKmsDsse ||
+		out.SSECustomerAlgorithm != nil {
+		return ""
+	}
+	tag := strings.Trim(aws.ToString(out.ETag), `"`)
+	if len(tag) != 32 {
+		return ""
+	}
+	if _, err := hex.DecodeString(tag); err != nil {
+		return ""
+	}
+	return strings.ToLower(tag)
+}
+
+// escapeKey URL-encodes each segment of an object key for use in
+// CopySource, keeping the slashes between them.
+func escapeKey(key string) string {
+	segments := strings.Split(key, "/")
+	for i, seg := range segments {
+		segments[i] = url.PathEscape(seg)
+	}
+	return strings.Join(segments, "/")
+}
+
+// mapError converts S3 API error codes to storage sentinel errors.
+func mapError(err error) error {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.ErrorCode() {
+		case "NoSuchKey", "NotFound", "NoSuchBucket", "NoSuchUpload":
+			return storage.ErrNotFound
+		case "AccessDenied", "Forbidden", "AllAccessDisabled":
+			return storage.ErrPermission
+		case "PreconditionFailed", "ConditionalRequestConflict":
+			// A conditional write or delete lost against the current
+			// object or a concurrent request.
+			return storage.ErrPrecondition
+		case "EntityTooSmall", "InvalidPart", "InvalidPartOrder":
+			// Multipart uploads whose parts S3 refuses to assemble.
+			return fmt.Errorf("%w: %s", storage.ErrInvalid, apiErr.ErrorMessage())
+		}
+	}
+	return err
+}
@@ -0,0 +1,577 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awss3 "github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/johannesboyne/gofakes3"
+	"github.com/johannesboyne/gofakes3/backend/s3mem"
+
+	"go-storage-api/internal/storage"
+	"go-storage-api/internal/storage/storagetest"
+)
+
+const testBucket = "test-bucket"
+
+// fakeS3 runs an in-process S3 server and counts multipart initiations.
+type fakeS3 struct {
+	*httptest.Server
+	backend   *s3mem.Backend
+	multipart atomic.Int32
+
+	// conditional serializes requests with If-Match or If-None-Match,
+	// which gofakes3 ignores, so checkConditions can evaluate them the way
+	// S3 does.
+	conditional sync.Mutex
+}
+
+func newFakeS3(t *testing.T) *fakeS3 {
+	t.Helper()
+
+	backend := s3mem.New()
+	if err := backend.CreateBucket(testBucket); err != nil {
+		t.Fatalf("create bucket: %v", err)
+	}
+
+	f := &fakeS3{backend: backend}
+	handler := gofakes3.New(backend).Server()
+	f.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := r.URL.Query()["uploads"]; ok && r.Method == http.MethodPost {
+			f.multipart.Add(1)
+		}
+		bucket, key, ok := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+		if ok && strings.HasSuffix(key, "/") {
+			f.serveMarker(t, w, r, bucket, key)
+			return
+		}
+		if r.Method != http.MethodGet && r.Method != http.MethodHead &&
+			(r.Header.Get("If-Match") != "" || r.Header.Get("If-None-Match") != "") {
+			f.conditional.Lock()
+			defer f.conditional.Unlock()
+			if !f.checkConditions(w, r, bucket, key) {
+				return
+			}
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(f.Close)
+	return f
+}
+
+// checkConditions answers a conditional write or delete that must fail, as
+// S3 would, and reports whether the request may proceed.
+func (f *fakeS3) checkConditions(w http.ResponseWriter, r *http.Request, bucket, key string) bool {
+	etag := ""
+	if obj, err := f.backend.HeadObject(bucket, key); err == nil {
+		etag = `"` + hex.EncodeToString(obj.Hash) + `"`
+	}
+	ifMatch, ifNoneMatch := r.Header.Get("If-Match"), r.Header.Get("If-None-Match")
+	switch {
+	case ifMatch != "" && etag == "":
+		w.WriteHeader(http.StatusNotFound)
+		io.WriteString(w, `<Error><Code>NoSuchKey</Code><Message>The specified key does not exist.</Message></Error>`)
+		return false
+	case ifMatch != "" && ifMatch != etag, ifNoneMatch == "*" && etag != "":
+		w.WriteHeader(http.StatusPreconditionFailed)
+		io.WriteString(w, `<Error><Code>PreconditionFailed</Code><Message>At least one of the pre-conditions you specified did not hold</Message></Error>`)
+		return false
+	}
+	return true
+}
+
+// serveMarker handles writes to directory marker keys ("dir/") directly on
+// the backend. gofakes3 strips trailing slashes from object keys in the URL,
+// which real S3 does not.
+func (f *fakeS3) serveMarker(t *testing.T, w http.ResponseWriter, r *http.Request, bucket, key string) {
+	switch {
+	case r.Method == http.MethodPut && r.Header.Get("X-Amz-Copy-Source") != "":
+		src, _ := url.PathUnescape(r.Header.Get("X-Amz-Copy-Source"))
+		srcBucket, srcKey, _ := strings.Cut(strings.TrimPrefix(src, "/"), "/")
+		obj, err := f.backend.GetObject(srcBucket, srcKey, nil)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		defer obj.Contents.Close()
+		if _, err := f.backend.PutObject(bucket, key, map[string]string{}, obj.Contents, obj.Size); err != nil {
+			t.Errorf("copy marker %s: %v", key, err)
+		}
+		io.WriteString(w, `<CopyObjectResult><ETag>"d41d8cd98f00b204e9800998ecf8427e"</ETag></CopyObjectResult>`)
+	case r.Method == http.MethodPut:
+		if _, err := f.backend.PutObject(bucket, key, map[string]string{}, r.Body, r.ContentLength); err != nil {
+			t.Errorf("put marker %s: %v", key, err)
+		}
+	case r.Method == http.MethodDelete:
+		if _, err := f.backend.DeleteObject(bucket, key); err != nil {
+			t.Errorf("delete marker %s: %v", key, err)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "unsupported marker request", http.StatusNotImplemented)
+	}
+}
+
+func newTestStorage(t *testing.T, prefix string) (*Storage, *fakeS3) {
+	t.Helper()
+
+	t.Setenv("AWS_ACCESS_KEY_ID", "test")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "test")
+	t.Setenv("AWS_EC2_METADATA_DISABLED", "true")
+
+	f := newFakeS3(t)
+	s, err := New(context.Background(), Options{
+		Bucket:       testBucket,
+		Region:       "us-east-1",
+		Prefix:       prefix,
+		Endpoint:     f.URL,
+		UsePathStyle: true,
+	})
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+	return s, f
+}
+
+func putObject(t *testing.T, f *fakeS3, key, content string) {
+	t.Helper()
+	_, err := f.backend.PutObject(testBucket, key, map[string]string{}, strings.NewReader(content), int64(len(content)))
+	if err != nil {
+		t.Fatalf("put %s: %v", key, err)
+	}
+}
+
+func TestNew_MissingBucket(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "test")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "test")
+	f := newFakeS3(t)
+
+	_, err := New(context.Background(), Options{
+		Bucket:       "nope",
+		Region:       "us-east-1",
+		Endpoint:     f.URL,
+		UsePathStyle: true,
+	})
+	if err == nil {
+		t.Fatal("expected error for missing bucket")
+	}
+}
+
+// --- List ---
+
+func TestList_ObjectsAndCommonPrefixes(t *testing.T) {
+	s, f := newTestStorage(t, "data/")
+	putObject(t, f, "data/docs/readme.md", "hi")
+	putObject(t, f, "data/docs/guide/intro.md", "intro")
+	putObject(t, f, "other/ignored.txt", "x")
+
+	files, err := s.List(context.Background(), "/docs")
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("expected 2 entries, got %d: %+v", len(files), files)
+	}
+
+	byName := map[string]storage.FileInfo{}
+	for _, fi := range files {
+		byName[fi.Name] = fi
+	}
+	if fi := byName["readme.md"]; fi.Path != "docs/readme.md" || fi.Size != 2 || fi.IsDir {
+		t.Errorf("unexpected readme.md entry: %+v", fi)
+	}
+	if fi := byName["guide"]; fi.Path != "docs/guide" || !fi.IsDir {
+		t.Errorf("unexpected guide entry: %+v", fi)
+	}
+}
+
+func TestList_EmptyRoot(t *testing.T) {
+	s, _ := newTestStorage(t, "")
+
+	files, err := s.List(context.Background(), "/")
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(files) != 0 {
+		t.Errorf("expected 0 entries, got %d", len(files))
+	}
+}
+
+func TestList_NotFound(t *testing.T) {
+	s, _ := newTestStorage(t, "")
+
+	_, err := s.List(context.Background(), "nonexistent")
+	if !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+// --- Read / Write ---
+
+func TestWriteThenRead(t *testing.T) {
+	s, f := newTestStorage(t, "data")
+	ctx := context.Background()
+
+	if err := s.Write(ctx, "/docs/file.txt", strings.NewReader("content")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if _, err := f.backend.HeadObject(testBucket, "data/docs/file.txt"); err != nil {
+		t.Fatalf("object not stored under prefix: %v", err)
+	}
+
+	rc, err := s.Read(ctx, "docs/file.txt")
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	defer rc.Close()
+	data, _ := io.ReadAll(rc)
+	if string(data) != "content" {
+		t.Errorf("expected %q, got %q", "content", string(data))
+	}
+}
+
+func TestWrite_LargeFileUsesMultipart(t *testing.T) {
+	s, f := newTestStorage(t, "")
+	ctx := context.Background()
+
+	// Larger than the uploader's default 5 MiB part size. Wrapped so the
+	// uploader cannot see the length up front.
+	payload := bytes.Repeat([]byte("0123456789abcdef"), (12<<20)/16)
+	if err := s.Write(ctx, "big.bin", io.MultiReader(bytes.NewReader(payload))); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if f.multipart.Load() == 0 {
+		t.Error("expected a multipart upload to be initiated")
+	}
+
+	rc, err := s.Read(ctx, "big.bin")
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	defer rc.Close()
+	got, _ := io.ReadAll(rc)
+	if !bytes.Equal(got, payload) {
+		t.Errorf("round-trip mismatch: got %d bytes, want %d", len(got), len(payload))
+	}
+}
+
+func TestWriteIf_MultipartChecksOnComplete(t *testing.T) {
+	s, f := newTestStorage(t, "")
+	ctx := context.Background()
+	putObject(t, f, "big.bin", "old")
+
+	payload := bytes.Repeat([]byte("x"), 12<<20)
+	err := s.WriteIf(ctx, "big.bin", io.MultiReader(bytes.NewReader(payload)), storage.Condition{IfNoneMatch: true})
+	if !errors.Is(err, storage.ErrPrecondition) {
+		t.Fatalf("WriteIf: got %v, want ErrPrecondition", err)
+	}
+	if f.multipart.Load() == 0 {
+		t.Error("expected a multipart upload to be initiated")
+	}
+	info, err := s.Stat(ctx, "big.bin")
+	if err != nil || info.Size != 3 {
+		t.Errorf("Stat after refused write = %+v, %v; want the old object", info, err)
+	}
+}
+
+func TestRead_NotFound(t *testing.T) {
+	s, _ := newTestStorage(t, "")
+
+	_, err := s.Read(context.Background(), "missing.txt")
+	if !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+// --- Multipart ---
+
+func TestMultipart(t *testing.T) {
+	s, f := newTestStorage(t, "data")
+	ctx := context.Background()
+
+	id, err := s.CreateMultipart(ctx, "docs/a.txt")
+	if err != nil {
+		t.Fatalf("CreateMultipart: %v", err)
+	}
+	// Parts arrive out of order and as plain readers that cannot be
+	// rewound, as they do from an HTTP request.
+	for _, part := range []struct {
+		n    int
+		data string
+	}{{3, "!"}, {1, "hello "}, {2, "world"}} {
+		r := io.MultiReader(strings.NewReader(part.data))
+		if err := s.UploadPart(ctx, "docs/a.txt", id, part.n, r, int64(len(part.data))); err != nil {
+			t.Fatalf("UploadPart %d: %v", part.n, err)
+		}
+	}
+	if _, err := f.backend.HeadObject(testBucket, "data/docs/a.txt"); err == nil {
+		t.Error("object visible before the upload completed")
+	}
+
+	if err := s.CompleteMultipart(ctx, "docs/a.txt", id); err != nil {
+		t.Fatalf("CompleteMultipart: %v", err)
+	}
+	rc, err := s.Read(ctx, "docs/a.txt")
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	defer rc.Close()
+	if data, _ := io.ReadAll(rc); string(data) != "hello world!" {
+		t.Errorf("assembled %q, want %q", data, "hello world!")
+	}
+}
+
+func TestMultipart_Errors(t *testing.T) {
+	s, _ := newTestStorage(t, "")
+	ctx := context.Background()
+
+	if _, err := s.CreateMultipart(ctx, "/"); !errors.Is(err, storage.ErrPermission) {
+		t.Errorf("CreateMultipart at root error = %v, want ErrPermission", err)
+	}
+	if err := s.UploadPart(ctx, "a.txt", "missing", 1, strings.NewReader("x"), 1); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("UploadPart to unknown upload error = %v, want ErrNotFound", err)
+	}
+
+	id, _ := s.CreateMultipart(ctx, "a.txt")
+	if err := s.CompleteMultipart(ctx, "a.txt", id); !errors.Is(err, storage.ErrInvalid) {
+		t.Errorf("CompleteMultipart without parts error = %v, want ErrInvalid", err)
+	}
+	if err := s.AbortMultipart(ctx, "a.txt", id); err != nil {
+		t.Fatalf("AbortMultipart: %v", err)
+	}
+	if err := s.UploadPart(ctx, "a.txt", id, 1, strings.NewReader("x"), 1); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("UploadPart after abort error = %v, want ErrNotFound", err)
+	}
+}
+
+// --- Presign ---
+
+func TestPresignURL(t *testing.T) {
+	s, f := newTestStorage(t, "data")
+	ctx := context.Background()
+	putObject(t, f, "data/docs/a.txt", "hello")
+
+	get, err := s.PresignURL(ctx, http.MethodGet, "/docs/a.txt", time.Hour)
+	if err != nil {
+		t.Fatalf("PresignURL(GET): %v", err)
+	}
+	u, _ := url.Parse(get)
+	if u.Path != "/"+testBucket+"/data/docs/a.txt" || u.Query().Get("X-Amz-Expires") != "3600" {
+		t.Errorf("unexpected URL %s", get)
+	}
+	resp, err := http.Get(get)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || string(body) != "hello" {
+		t.Errorf("GET: expected 200 hello, got %d %q", resp.StatusCode, body)
+	}
+
+	put, err := s.PresignURL(ctx, http.MethodPut, "/docs/b.txt", time.Hour)
+	if err != nil {
+		t.Fatalf("PresignURL(PUT): %v", err)
+	}
+	req, _ := http.NewRequest(http.MethodPut, put, strings.NewReader("uploaded"))
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("PUT: expected 200, got %d", resp.StatusCode)
+	}
+	rc, err := s.Read(ctx, "/docs/b.txt")
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	got, _ := io.ReadAll(rc)
+	rc.Close()
+	if string(got) != "uploaded" {
+		t.Errorf("expected uploaded content, got %q", got)
+	}
+}
+
+func TestPresignURL_Errors(t *testing.T) {
+	s, _ := newTestStorage(t, "")
+	ctx := context.Background()
+
+	if _, err := s.PresignURL(ctx, http.MethodDelete, "/a.txt", time.Hour); !errors.Is(err, storage.ErrInvalid) {
+		t.Errorf("expected ErrInvalid for DELETE, got %v", err)
+	}
+	if _, err := s.PresignURL(ctx, http.MethodGet, "/", time.Hour); !errors.Is(err, storage.ErrPermission) {
+		t.Errorf("expected ErrPermission for the root, got %v", err)
+	}
+}
+
+// --- Delete ---
+
+func TestDelete(t *testing.T) {
+	s, f := newTestStorage(t, "")
+	ctx := context.Background()
+	putObject(t, f, "doomed.txt", "bye")
+
+	if err := s.Delete(ctx, "doomed.txt"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if err := s.Delete(ctx, "doomed.txt"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("expected ErrNotFound on second delete, got %v", err)
+	}
+}
+
+// --- Stat ---
+
+func TestStat_Metadata(t *testing.T) {
+	s, _ := newTestStorage(t, "")
+	ctx := context.Background()
+	if err := s.Write(ctx, "page.html", strings.NewReader("<p>hi</p>")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	fi, err := s.Stat(ctx, "page.html")
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+	if fi.ETag == "" || !strings.HasPrefix(fi.ContentType, "text/html") {
+		t.Errorf("expected ETag and ContentType from HeadObject, got %+v", fi)
+	}
+	if want := "343fc7b27c1b966b623aa483c880210c"; fi.MD5 != want {
+		t.Errorf("expected MD5 %s from the single-part ETag, got %q", want, fi.MD5)
+	}
+}
+
+func TestEtagMD5(t *testing.T) {
+	md5 := `"5d41402abc4b2a76b9719d911017c592"`
+	tests := []struct {
+		name string
+		out  awss3.HeadObjectOutput
+		want string
+	}{
+		{"single part", awss3.HeadObjectOutput{ETag: &md5}, "5d41402abc4b2a76b9719d911017c592"},
+		{"sse-s3", awss3.HeadObjectOutput{ETag: &md5, ServerSideEncryption: types.ServerSideEncryptionAes256}, "5d41402abc4b2a76b9719d911017c592"},
+		{"sse-kms", awss3.HeadObjectOutput{ETag: &md5, ServerSideEncryption: types.ServerSideEncryptionAwsKms}, ""},
+		{"sse-c", awss3.HeadObjectOutput{ETag: &md5, SSECustomerAlgorithm: aws.String("AES256")}, ""},
+		{"multipart", awss3.HeadObjectOutput{ETag: aws.String(`"5d41402abc4b2a76b9719d911017c592-3"`)}, ""},
+		{"none", awss3.HeadObjectOutput{}, ""},
+	}
+	for _, tt := range tests {
+		if got := etagMD5(&tt.out); got != tt.want {
+			t.Errorf("%s: etagMD5 = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestHexChecksum(t *testing.T) {
+	b64 := "LPJNul+wow4m6DsqxbninhsWHlwfp0JecwQzYpOLmCQ="
+	if got := hexChecksum(&b64); got != "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824" {
+		t.Errorf("hexChecksum(%q) = %q", b64, got)
+	}
+	composite := "LPJNul+wow4m6DsqxbninhsWHlwfp0JecwQzYpOLmCQ=-3"
+	if got := hexChecksum(&composite); got != "" {
+		t.Errorf("expected multipart checksum to be dropped, got %q", got)
+	}
+	if got := hexChecksum(nil); got != "" {
+		t.Errorf("hexChecksum(nil) = %q", got)
+	}
+}
+
+func TestStat(t *testing.T) {
+	s, f := newTestStorage(t, "")
+	ctx := context.Background()
+	putObject(t, f, "mydir/info.txt", "12345")
+
+	fi, err := s.Stat(ctx, "mydir/info.txt")
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+	if fi.Name != "info.txt" || fi.Path != "mydir/info.txt" || fi.Size != 5 || fi.IsDir {
+		t.Errorf("unexpected FileInfo: %+v", fi)
+	}
+
+	fi, err = s.Stat(ctx, "mydir")
+	if err != nil {
+		t.Fatalf("Stat dir: %v", err)
+	}
+	if !fi.IsDir {
+		t.Error("expected IsDir=true for common prefix")
+	}
+
+	if _, err := s.Stat(ctx, "nope.txt"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+// --- Key mapping ---
+
+func TestToKey(t *testing.T) {
+	tests := []struct {
+		prefix string
+		path   string
+		want   string
+	}{
+		{"", "/docs/report.pdf", "docs/report.pdf"},
+		{"", "docs/report.pdf", "docs/report.pdf"},
+		{"data/", "/docs/report.pdf", "data/docs/report.pdf"},
+		{"data/", "/", "data/"},
+		{"data/", "docs//guide/", "data/docs/guide"},
+	}
+
+	for _, tt := range tests {
+		s := &Storage{prefix: tt.prefix}
+		got, err := s.toKey(tt.path)
+		if err != nil {
+			t.Errorf("toKey(%q): unexpected error: %v", tt.path, err)
+		}
+		if got != tt.want {
+			t.Errorf("toKey(%q) with prefix %q = %q, want %q", tt.path, tt.prefix, got, tt.want)
+		}
+	}
+}
+
+func TestToKey_BlocksTraversal(t *testing.T) {
+	s := &Storage{prefix: "tenant-a/"}
+	for _, p := range []string{"../tenant-b/secret", "/../../etc/passwd"} {
+		if _, err := s.toKey(p); !errors.Is(err, storage.ErrPermission) {
+			t.Errorf("toKey(%q): expected ErrPermission, got %v", p, err)
+		}
+	}
+}
+
+// --- Conformance ---
+
+func TestConformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Storage {
+		s, _ := newTestStorage(t, "conformance/")
+		return s
+	})
+}
+
+// --- Interface compliance ---
+
+var (
+	_ storage.Storage     = (*Storage)(nil)
+	_ storage.RangeReader = (*Storage)(nil)
+	_ storage.Mover       = (*Storage)(nil)
+	_ storage.Copier      = (*Storage)(nil)
+	_ storage.TreeDeleter = (*Storage)(nil)
+	_ storage.PageLister  = (*Storage)(nil)
+	_ storage.Walker      = (*Storage)(nil)
+
+	_ storage.MultipartUploader = (*Storage)(nil)
+	_ storage.ConditionalWriter = (*Storage)(nil)
+	_ storage.Presigner         = (*Storage)(nil)
+)
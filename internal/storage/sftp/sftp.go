@@ -0,0 +1,572 @@
+package sftp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	gosftp "github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+
+	"go-storage-api/internal/storage"
+)
+
+// handshakeTimeout bounds the TCP dial plus SSH handshake and authentication.
+const handshakeTimeout = 30 * time.Second
+
+// Options configures the SFTP backend. At least one of Password or
+// PrivateKeyPath must be set; when both are, the key is offered first.
+type Options struct {
+	Host                 string
+	Port                 string
+	User                 string
+	Password             string
+	PrivateKeyPath       string
+	PrivateKeyPassphrase string
+	// KnownHostsPath is an OpenSSH known_hosts file. The server's host key
+	// must be listed in it; unknown or changed keys abort the connection.
+	KnownHostsPath string
+	// RootPath is the remote directory that API paths are resolved against.
+	// Empty means the login directory.
+	RootPath string
+}
+
+// session is one SSH connection with an SFTP subsystem running on it.
+type session struct {
+	ssh  *ssh.Client
+	sftp *gosftp.Client
+}
+
+func (s *session) Close() error {
+	s.sftp.Close()
+	return s.ssh.Close()
+}
+
+// Storage implements storage.Storage over SFTP. A single SSH session is
+// shared across requests (pkg/sftp multiplexes concurrent requests over one
+// channel) and is re-established transparently when the server drops it.
+type Storage struct {
+	addr   string
+	config *ssh.ClientConfig
+	root   string
+
+	mu      sync.Mutex
+	session *session
+}
+
+// New connects to the SFTP server, verifying its host key against the
+// known_hosts file and authenticating with the configured credentials.
+func New(ctx context.Context, opts Options) (*Storage, error) {
+	hostKeyCallback, err := knownhosts.New(opts.KnownHostsPath)
+	if err != nil {
+		return nil, fmt.Errorf("load known_hosts: %w", err)
+	}
+
+	var auth []ssh.AuthMethod
+	if opts.PrivateKeyPath != "" {
+		signer, err := loadPrivateKey(opts.PrivateKeyPath, opts.PrivateKeyPassphrase)
+		if err != nil {
+			return nil, err
+		}
+		auth = append(auth, ssh.PublicKeys(signer))
+	}
+	if opts.Password != "" {
+		auth = append(auth, ssh.Password(opts.Password))
+	}
+	if len(auth) == 0 {
+		return nil, errors.New("sftp: no password or private key configured")
+	}
+
+	s := &Storage{
+		addr: net.JoinHostPort(opts.Host, opts.Port),
+		config: &ssh.ClientConfig{
+			User:            opts.User,
+			Auth:            auth,
+			HostKeyCallback: hostKeyCallback,
+			Timeout:         handshakeTimeout,
+		},
+		root: opts.RootPath,
+	}
+	if _, err := s.connect(ctx); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func loadPrivateKey(keyPath, passphrase string) (ssh.Signer, error) {
+	pemBytes, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("read private key: %w", err)
+	}
+	var signer ssh.Signer
+	if passphrase != "" {
+		signer, err = ssh.ParsePrivateKeyWithPassphrase(pemBytes, []byte(passphrase))
+	} else {
+		signer, err = ssh.ParsePrivateKey(pemBytes)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parse private key: %w", err)
+	}
+	return signer, nil
+}
+
+func (s *Storage) List(ctx context.Context, p string) ([]storage.FileInfo, error) {
+	name, err := cleanPath(p)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []fs.FileInfo
+	err = s.do(ctx, func(c *gosftp.Client) error {
+		var err error
+		entries, err = c.ReadDirContext(ctx, s.remotePath(name))
+		return err
+	})
+	if err != nil {
+		return nil, mapError(err)
+	}
+
+	files := make([]storage.FileInfo, 0, len(entries))
+	for _, e := range entries {
+		if storage.IsTemp(e.Name()) {
+			continue
+		}
+		files = append(files, toFileInfo(path.Join(name, e.Name()), e))
+	}
+	return files, nil
+}
+
+func (s *Storage) Read(ctx context.Context, p string) (io.ReadCloser, error) {
+	name, err := cleanPath(p)
+	if err != nil {
+		return nil, err
+	}
+
+	var f *gosftp.File
+	err = s.do(ctx, func(c *gosftp.Client) error {
+		var err error
+		f, err = c.Open(s.remotePath(name))
+		return err
+	})
+	if err != nil {
+		return nil, mapError(err)
+	}
+	return f, nil
+}
+
+// ReadRange seeks the remote file handle so that only the requested range is
+// transferred.
+func (s *Storage) ReadRange(ctx context.Context, p string, offset, length int64) (io.ReadCloser, error) {
+	rc, err := s.Read(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	if offset > 0 {
+		if _, err := rc.(*gosftp.File).Seek(offset, io.SeekStart); err != nil {
+			rc.Close()
+			return nil, mapError(err)
+		}
+	}
+	return storage.LimitReadCloser(rc, length), nil
+}
+
+// Write streams into a storage.TempName sibling and moves it into place
+// with replace.
+func (s *Storage) Write(ctx context.Context, p string, r io.Reader) error {
+	name, err := cleanPath(p)
+	if err != nil {
+		return err
+	}
+	if name == "" {
+		return storage.ErrPermission
+	}
+	tmp := storage.TempName(name)
+
+	// Only the setup is retried on a dropped session; once bytes have been
+	// consumed from r the upload cannot be replayed.
+	var f *gosftp.File
+	err = s.do(ctx, func(c *gosftp.Client) error {
+		if dir := path.Dir(name); dir != "." {
+			if err := c.MkdirAll(s.remotePath(dir)); err != nil {
+				return err
+			}
+		}
+		var err error
+		f, err = c.OpenFile(s.remotePath(tmp), os.O_WRONLY|os.O_CREATE|os.O_EXCL)
+		return err
+	})
+	if err != nil {
+		return mapError(err)
+	}
+
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		s.removeTemp(ctx, tmp)
+		return fmt.Errorf("write file: %w", mapError(err))
+	}
+	if err := f.Close(); err != nil {
+		s.removeTemp(ctx, tmp)
+		return fmt.Errorf("close file: %w", mapError(err))
+	}
+
+	err = s.do(ctx, func(c *gosftp.Client) error {
+		return s.replace(c, tmp, name)
+	})
+	if err != nil {
+		s.removeTemp(ctx, tmp)
+		return mapError(err)
+	}
+	return nil
+}
+
+// removeTemp deletes the temporary file of a failed Write.
+func (s *Storage) removeTemp(ctx context.Context, tmp string) {
+	s.do(context.WithoutCancel(ctx), func(c *gosftp.Client) error {
+		return c.Remove(s.remotePath(tmp))
+	})
+}
+
+// replace renames from over the file to. Plain SFTP rename refuses to
+// replace an existing file, so the OpenSSH posix-rename extension, which
+// replaces it in one step, is used when the server offers it; otherwise an
+// existing file goes through its storage.AsideName.
+func (s *Storage) replace(c *gosftp.Client, from, to string) error {
+	src, dst := s.remotePath(from), s.remotePath(to)
+	if _, ok := c.HasExtension("posix-rename@openssh.com"); ok {
+		return c.PosixRename(src, dst)
+	}
+
+	err := c.Rename(src, dst)
+	if err == nil {
+		return nil
+	}
+	info, statErr := c.Lstat(dst)
+	if statErr != nil {
+		return err
+	}
+	if info.IsDir() {
+		return fmt.Errorf("replace %s: %w", to, storage.ErrExist)
+	}
+
+	old := s.remotePath(storage.AsideName(to))
+	if err := c.Rename(dst, old); err != nil {
+		return err
+	}
+	if err := c.Rename(src, dst); err != nil {
+		c.Rename(old, dst)
+		return err
+	}
+	c.Remove(old)
+	return nil
+}
+
+// Recover puts back the files replace left aside.
+func (s *Storage) Recover(ctx context.Context) (int, error) {
+	var n int
+	err := s.do(ctx, func(c *gosftp.Client) error {
+		readDir := func(dir string) ([]storage.FileInfo, error) {
+			entries, err := c.ReadDir(s.remotePath(dir))
+			if err != nil {
+				return nil, err
+			}
+			files := make([]storage.FileInfo, len(entries))
+			for i, e := range entries {
+				files[i] = toFileInfo(path.Join(dir, e.Name()), e)
+			}
+			return files, nil
+		}
+		rename := func(from, to string) error {
+			return c.Rename(s.remotePath(from), s.remotePath(to))
+		}
+		remove := func(name string) error {
+			return c.Remove(s.remotePath(name))
+		}
+		var err error
+		n, err = storage.RecoverAside(ctx, readDir, rename, remove)
+		return err
+	})
+	return n, mapError(err)
+}
+
+func (s *Storage) Delete(ctx context.Context, p string) error {
+	name, err := cleanPath(p)
+	if err != nil {
+		return err
+	}
+	if name == "" {
+		return storage.ErrPermission
+	}
+
+	err = s.do(ctx, func(c *gosftp.Client) error {
+		err := c.Remove(s.remotePath(name))
+		if err == nil || errors.Is(mapError(err), storage.ErrNotFound) {
+			return err
+		}
+		// Servers report a non-empty directory as a generic failure.
+		if entries, dirErr := c.ReadDir(s.remotePath(name)); dirErr == nil && len(entries) > 0 {
+			return fmt.Errorf("delete %s: %w", name, storage.ErrNotEmpty)
+		}
+		return err
+	})
+	if err != nil {
+		return mapError(err)
+	}
+	return nil
+}
+
+// DeleteAll removes a file or directory tree on the server.
+func (s *Storage) DeleteAll(ctx context.Context, p string) error {
+	name, err := cleanPath(p)
+	if err != nil {
+		return err
+	}
+	if name == "" {
+		return storage.ErrPermission
+	}
+
+	err = s.do(ctx, func(c *gosftp.Client) error {
+		if _, err := c.Lstat(s.remotePath(name)); err != nil {
+			return err
+		}
+		return c.RemoveAll(s.remotePath(name))
+	})
+	if err != nil {
+		return mapError(err)
+	}
+	return nil
+}
+
+func (s *Storage) Mkdir(ctx context.Context, p string) error {
+	name, err := cleanPath(p)
+	if err != nil {
+		return err
+	}
+	if name == "" {
+		return storage.ErrPermission
+	}
+
+	err = s.do(ctx, func(c *gosftp.Client) error {
+		if _, err := c.Lstat(s.remotePath(name)); err == nil {
+			return fmt.Errorf("mkdir %s: %w", name, storage.ErrExist)
+		}
+		return c.MkdirAll(s.remotePath(name))
+	})
+	if err != nil {
+		return mapError(err)
+	}
+	return nil
+}
+
+// Move renames on the server, replacing an existing file at to the way
+// Write does.
+func (s *Storage) Move(ctx context.Context, from, to string) error {
+	src, err := cleanPath(from)
+	if err != nil {
+		return err
+	}
+	dst, err := cleanPath(to)
+	if err != nil {
+		return err
+	}
+	if src == "" || dst == "" {
+		return storage.ErrPermission
+	}
+
+	err = s.do(ctx, func(c *gosftp.Client) error {
+		if err := c.MkdirAll(path.Dir(s.remotePath(dst))); err != nil {
+			return err
+		}
+		return s.replace(c, src, dst)
+	})
+	if err != nil {
+		return mapError(err)
+	}
+	return nil
+}
+
+func (s *Storage) Stat(ctx context.Context, p string) (*storage.FileInfo, error) {
+	name, err := cleanPath(p)
+	if err != nil {
+		return nil, err
+	}
+
+	var info fs.FileInfo
+	err = s.do(ctx, func(c *gosftp.Client) error {
+		var err error
+		info, err = c.Stat(s.remotePath(name))
+		return err
+	})
+	if err != nil {
+		return nil, mapError(err)
+	}
+
+	fi := toFileInfo(name, info)
+	return &fi, nil
+}
+
+// Close ends the SFTP subsystem and the SSH connection.
+func (s *Storage) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.session == nil {
+		return nil
+	}
+	err := s.session.Close()
+	s.session = nil
+	return err
+}
+
+// do runs fn against the current session. If fn fails because the SSH
+// connection is gone, a new session is established and fn is retried once.
+func (s *Storage) do(ctx context.Context, fn func(*gosftp.Client) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	sess, err := s.connect(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = fn(sess.sftp)
+	if !isConnError(err) {
+		return err
+	}
+
+	s.invalidate(sess)
+	sess, err = s.connect(ctx)
+	if err != nil {
+		return err
+	}
+	return fn(sess.sftp)
+}
+
+// connect returns the live session, dialing a new one if necessary.
+func (s *Storage) connect(ctx context.Context) (*session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.session != nil {
+		return s.session, nil
+	}
+	sess, err := s.dial(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("sftp connect: %w", err)
+	}
+	s.session = sess
+	return sess, nil
+}
+
+func (s *Storage) dial(ctx context.Context) (*session, error) {
+	d := net.Dialer{Timeout: handshakeTimeout}
+	conn, err := d.DialContext(ctx, "tcp", s.addr)
+	if err != nil {
+		return nil, err
+	}
+
+	// ssh.NewClientConn has no context support; bound the handshake with a
+	// deadline on the raw connection instead and clear it afterwards.
+	deadline := time.Now().Add(handshakeTimeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	conn.SetDeadline(deadline)
+
+	sshConn, chans, reqs, err := ssh.NewClientConn(conn, s.addr, s.config)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+
+	client := ssh.NewClient(sshConn, chans, reqs)
+	sftpClient, err := gosftp.NewClient(client)
+	if err != nil {
+		client.Close()
+		return nil, fmt.Errorf("start sftp subsystem: %w", err)
+	}
+	return &session{ssh: client, sftp: sftpClient}, nil
+}
+
+// invalidate discards sess if it is still the current session. Another
+// request may already have replaced it, in which case nothing happens.
+func (s *Storage) invalidate(sess *session) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.session == sess {
+		s.session.Close()
+		s.session = nil
+	}
+}
+
+// remotePath resolves a cleaned API path against the configured root.
+func (s *Storage) remotePath(name string) string {
+	if p := path.Join(s.root, name); p != "" {
+		return p
+	}
+	return "."
+}
+
+// cleanPath converts an API path into a path relative to the configured
+// root, which remotePath then joins on.
+func cleanPath(requested string) (string, error) {
+	if strings.Contains(requested, "..") {
+		return "", storage.ErrPermission
+	}
+	cleaned := path.Clean("/" + requested)
+	return strings.TrimPrefix(cleaned, "/"), nil
+}
+
+func toFileInfo(name string, info fs.FileInfo) storage.FileInfo {
+	return storage.FileInfo{
+		Name:    info.Name(),
+		Path:    name,
+		Size:    info.Size(),
+		IsDir:   info.IsDir(),
+		ModTime: info.ModTime(),
+	}
+}
+
+// isConnError reports whether err means the session must be re-established.
+func isConnError(err error) bool {
+	if err == nil {
+		return false
+	}
+	return errors.Is(err, gosftp.ErrSSHFxConnectionLost) ||
+		errors.Is(err, gosftp.ErrSSHFxNoConnection) ||
+		errors.Is(err, net.ErrClosed) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// mapError converts SFTP status codes to storage sentinel errors. pkg/sftp
+// already turns most of them into fs errors, but not every call path does.
+func mapError(err error) error {
+	if errors.Is(err, fs.ErrNotExist) {
+		return storage.ErrNotFound
+	}
+	if errors.Is(err, fs.ErrPermission) {
+		return storage.ErrPermission
+	}
+	var serr *gosftp.StatusError
+	if errors.As(err, &serr) {
+		switch serr.FxCode() {
+		case gosftp.ErrSSHFxNoSuchFile:
+			return storage.ErrNotFound
+		case gosftp.ErrSSHFxPermissionDenied:
+			return storage.ErrPermission
+		}
+	}
+	return err
+}
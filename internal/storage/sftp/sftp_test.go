@@ -0,0 +1,374 @@
+package sftp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	gosftp "github.com/pkg/sftp"
+
+	"go-storage-api/internal/storage"
+	"go-storage-api/internal/storage/storagetest"
+)
+
+func newTestStorage(t *testing.T) (*Storage, *testServer) {
+	t.Helper()
+	srv := newTestServer(t, nil)
+	host, port := srv.hostPort()
+	s, err := New(context.Background(), Options{
+		Host:           host,
+		Port:           port,
+		User:           "user",
+		Password:       srv.password,
+		KnownHostsPath: srv.knownHosts(t, srv.hostKey.PublicKey()),
+		RootPath:       srv.root,
+	})
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s, srv
+}
+
+// --- Connect ---
+
+func TestNew_BadPassword(t *testing.T) {
+	srv := newTestServer(t, nil)
+	host, port := srv.hostPort()
+
+	_, err := New(context.Background(), Options{
+		Host:           host,
+		Port:           port,
+		User:           "user",
+		Password:       "wrong",
+		KnownHostsPath: srv.knownHosts(t, srv.hostKey.PublicKey()),
+	})
+	if err == nil {
+		t.Fatal("expected authentication error")
+	}
+}
+
+func TestNew_PrivateKey(t *testing.T) {
+	for _, passphrase := range []string{"", "hunter2"} {
+		t.Run(fmt.Sprintf("passphrase=%v", passphrase != ""), func(t *testing.T) {
+			keyPath, pub := writeClientKey(t, passphrase)
+			srv := newTestServer(t, pub)
+			host, port := srv.hostPort()
+
+			s, err := New(context.Background(), Options{
+				Host:                 host,
+				Port:                 port,
+				User:                 "user",
+				PrivateKeyPath:       keyPath,
+				PrivateKeyPassphrase: passphrase,
+				KnownHostsPath:       srv.knownHosts(t, srv.hostKey.PublicKey()),
+				RootPath:             srv.root,
+			})
+			if err != nil {
+				t.Fatalf("New() failed: %v", err)
+			}
+			defer s.Close()
+
+			if _, err := s.List(context.Background(), "/"); err != nil {
+				t.Errorf("List: %v", err)
+			}
+		})
+	}
+}
+
+func TestNew_UnknownHostKey(t *testing.T) {
+	srv := newTestServer(t, nil)
+	host, port := srv.hostPort()
+
+	// known_hosts lists a different key for this address.
+	_, err := New(context.Background(), Options{
+		Host:           host,
+		Port:           port,
+		User:           "user",
+		Password:       srv.password,
+		KnownHostsPath: srv.knownHosts(t, newSigner(t).PublicKey()),
+	})
+	if err == nil || !strings.Contains(err.Error(), "key mismatch") {
+		t.Errorf("expected host key mismatch, got %v", err)
+	}
+}
+
+func TestNew_MissingKnownHosts(t *testing.T) {
+	_, err := New(context.Background(), Options{
+		Host:           "127.0.0.1",
+		Port:           "22",
+		User:           "user",
+		Password:       "secret",
+		KnownHostsPath: filepath.Join(t.TempDir(), "missing"),
+	})
+	if err == nil {
+		t.Fatal("expected error for missing known_hosts file")
+	}
+}
+
+// --- List ---
+
+func TestList(t *testing.T) {
+	s, srv := newTestStorage(t)
+	os.MkdirAll(filepath.Join(srv.root, "docs", "sub"), 0o755)
+	os.WriteFile(filepath.Join(srv.root, "docs", "readme.md"), []byte("hi"), 0o644)
+
+	files, err := s.List(context.Background(), "/docs")
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("expected 2 entries, got %d: %+v", len(files), files)
+	}
+
+	byName := map[string]storage.FileInfo{}
+	for _, f := range files {
+		byName[f.Name] = f
+	}
+	if f := byName["readme.md"]; f.Path != "docs/readme.md" || f.Size != 2 || f.IsDir {
+		t.Errorf("unexpected readme.md entry: %+v", f)
+	}
+	if !byName["sub"].IsDir {
+		t.Error("expected sub to be a directory")
+	}
+}
+
+func TestList_NotFound(t *testing.T) {
+	s, _ := newTestStorage(t)
+
+	_, err := s.List(context.Background(), "nonexistent")
+	if !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+// --- Read / Write ---
+
+func TestWriteThenRead(t *testing.T) {
+	s, srv := newTestStorage(t)
+	ctx := context.Background()
+
+	if err := s.Write(ctx, "deep/nested/file.txt", strings.NewReader("content")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(srv.root, "deep", "nested", "file.txt")); err != nil {
+		t.Fatalf("file not on server: %v", err)
+	}
+
+	// Overwrite with shorter content to check truncation.
+	if err := s.Write(ctx, "deep/nested/file.txt", strings.NewReader("new")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	rc, err := s.Read(ctx, "deep/nested/file.txt")
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	data, _ := io.ReadAll(rc)
+	if err := rc.Close(); err != nil {
+		t.Errorf("Close: %v", err)
+	}
+	if string(data) != "new" {
+		t.Errorf("expected %q, got %q", "new", string(data))
+	}
+}
+
+func TestRead_NotFound(t *testing.T) {
+	s, _ := newTestStorage(t)
+
+	_, err := s.Read(context.Background(), "missing.txt")
+	if !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+// --- Delete ---
+
+func TestDelete_FileAndEmptyDir(t *testing.T) {
+	s, srv := newTestStorage(t)
+	ctx := context.Background()
+	os.WriteFile(filepath.Join(srv.root, "doomed.txt"), []byte("bye"), 0o644)
+	os.Mkdir(filepath.Join(srv.root, "empty"), 0o755)
+
+	if err := s.Delete(ctx, "doomed.txt"); err != nil {
+		t.Fatalf("Delete file: %v", err)
+	}
+	if err := s.Delete(ctx, "empty"); err != nil {
+		t.Fatalf("Delete dir: %v", err)
+	}
+	if err := s.Delete(ctx, "doomed.txt"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+// --- Stat ---
+
+func TestStat(t *testing.T) {
+	s, srv := newTestStorage(t)
+	ctx := context.Background()
+	os.Mkdir(filepath.Join(srv.root, "mydir"), 0o755)
+	os.WriteFile(filepath.Join(srv.root, "mydir", "info.txt"), []byte("12345"), 0o644)
+
+	fi, err := s.Stat(ctx, "mydir/info.txt")
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+	if fi.Name != "info.txt" || fi.Path != "mydir/info.txt" || fi.Size != 5 || fi.IsDir {
+		t.Errorf("unexpected FileInfo: %+v", fi)
+	}
+
+	fi, err = s.Stat(ctx, "mydir")
+	if err != nil {
+		t.Fatalf("Stat dir: %v", err)
+	}
+	if !fi.IsDir {
+		t.Error("expected IsDir=true")
+	}
+
+	if _, err := s.Stat(ctx, "nope.txt"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+// --- Session reuse ---
+
+func TestSession_Reused(t *testing.T) {
+	s, srv := newTestStorage(t)
+	ctx := context.Background()
+
+	for i := 0; i < 5; i++ {
+		if _, err := s.List(ctx, "/"); err != nil {
+			t.Fatalf("List: %v", err)
+		}
+	}
+	if got := srv.logins.Load(); got != 1 {
+		t.Errorf("expected 1 login, got %d", got)
+	}
+}
+
+func TestSession_ReconnectsAfterDrop(t *testing.T) {
+	s, srv := newTestStorage(t)
+
+	srv.dropAll()
+
+	if _, err := s.List(context.Background(), "/"); err != nil {
+		t.Fatalf("List after server dropped connection: %v", err)
+	}
+	if got := srv.logins.Load(); got != 2 {
+		t.Errorf("expected 2 logins, got %d", got)
+	}
+}
+
+func TestSession_Concurrent(t *testing.T) {
+	s, srv := newTestStorage(t)
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			name := fmt.Sprintf("file-%d.txt", i)
+			if err := s.Write(ctx, name, strings.NewReader(name)); err != nil {
+				errs <- err
+				return
+			}
+			rc, err := s.Read(ctx, name)
+			if err != nil {
+				errs <- err
+				return
+			}
+			data, _ := io.ReadAll(rc)
+			rc.Close()
+			if string(data) != name {
+				errs <- fmt.Errorf("%s: got %q", name, data)
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+	}
+	if got := srv.logins.Load(); got != 1 {
+		t.Errorf("expected 1 login, got %d", got)
+	}
+}
+
+// --- Paths and errors ---
+
+func TestCleanPath_BlocksTraversal(t *testing.T) {
+	for _, p := range []string{"../etc/passwd", "/../../etc/passwd", "subdir/../../etc"} {
+		if _, err := cleanPath(p); !errors.Is(err, storage.ErrPermission) {
+			t.Errorf("cleanPath(%q): expected ErrPermission, got %v", p, err)
+		}
+	}
+}
+
+func TestRemotePath(t *testing.T) {
+	tests := []struct {
+		root string
+		name string
+		want string
+	}{
+		{"", "", "."},
+		{"", "docs/a.txt", "docs/a.txt"},
+		{"/incoming", "", "/incoming"},
+		{"/incoming", "docs/a.txt", "/incoming/docs/a.txt"},
+	}
+	for _, tt := range tests {
+		s := &Storage{root: tt.root}
+		if got := s.remotePath(tt.name); got != tt.want {
+			t.Errorf("remotePath(%q) with root %q = %q, want %q", tt.name, tt.root, got, tt.want)
+		}
+	}
+}
+
+func TestMapError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{"not exist", &os.PathError{Op: "open", Path: "x", Err: os.ErrNotExist}, storage.ErrNotFound},
+		{"permission", &os.PathError{Op: "open", Path: "x", Err: os.ErrPermission}, storage.ErrPermission},
+		{"status no such file", &gosftp.StatusError{Code: uint32(gosftp.ErrSSHFxNoSuchFile)}, storage.ErrNotFound},
+		{"status denied", &gosftp.StatusError{Code: uint32(gosftp.ErrSSHFxPermissionDenied)}, storage.ErrPermission},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := mapError(tt.err); !errors.Is(got, tt.want) {
+				t.Errorf("mapError(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+// --- Conformance ---
+
+func TestConformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Storage {
+		s, _ := newTestStorage(t)
+		return s
+	})
+}
+
+// --- Interface compliance ---
+
+var (
+	_ storage.Storage     = (*Storage)(nil)
+	_ storage.RangeReader = (*Storage)(nil)
+	_ storage.Mover       = (*Storage)(nil)
+	_ storage.TreeDeleter = (*Storage)(nil)
+	_ storage.Recoverer   = (*Storage)(nil)
+	_ io.Closer           = (*Storage)(nil)
+)
@@ -0,0 +1,203 @@
+package sftp
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	gosftp "github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// testServer is an in-process SSH server that only offers the sftp
+// subsystem, serving the local filesystem via pkg/sftp. Clients are pointed
+// at root through Options.RootPath.
+type testServer struct {
+	root     string
+	password string
+	hostKey  ssh.Signer
+	// clientKey is the only public key accepted for key authentication.
+	clientKey ssh.PublicKey
+
+	ln     net.Listener
+	logins atomic.Int32
+
+	mu    sync.Mutex
+	conns map[net.Conn]struct{}
+}
+
+func newTestServer(t *testing.T, clientKey ssh.PublicKey) *testServer {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	srv := &testServer{
+		root:      t.TempDir(),
+		password:  "secret",
+		hostKey:   newSigner(t),
+		clientKey: clientKey,
+		ln:        ln,
+		conns:     map[net.Conn]struct{}{},
+	}
+	go srv.serve()
+	t.Cleanup(func() {
+		ln.Close()
+		srv.dropAll()
+	})
+	return srv
+}
+
+func (srv *testServer) hostPort() (string, string) {
+	host, port, _ := net.SplitHostPort(srv.ln.Addr().String())
+	return host, port
+}
+
+// knownHosts writes a known_hosts file listing key for this server.
+func (srv *testServer) knownHosts(t *testing.T, key ssh.PublicKey) string {
+	t.Helper()
+	line := knownhosts.Line([]string{srv.ln.Addr().String()}, key)
+	p := filepath.Join(t.TempDir(), "known_hosts")
+	if err := os.WriteFile(p, []byte(line+"\n"), 0o600); err != nil {
+		t.Fatalf("write known_hosts: %v", err)
+	}
+	return p
+}
+
+// dropAll closes every SSH connection, simulating a server restart or an
+// idle timeout.
+func (srv *testServer) dropAll() {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	for c := range srv.conns {
+		c.Close()
+	}
+}
+
+func (srv *testServer) serve() {
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(_ ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			if string(password) != srv.password {
+				return nil, errAuth
+			}
+			return nil, nil
+		},
+		PublicKeyCallback: func(_ ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if srv.clientKey == nil || !bytes.Equal(key.Marshal(), srv.clientKey.Marshal()) {
+				return nil, errAuth
+			}
+			return nil, nil
+		},
+	}
+	config.AddHostKey(srv.hostKey)
+
+	for {
+		conn, err := srv.ln.Accept()
+		if err != nil {
+			return
+		}
+		srv.mu.Lock()
+		srv.conns[conn] = struct{}{}
+		srv.mu.Unlock()
+		go srv.handle(conn, config)
+	}
+}
+
+func (srv *testServer) handle(conn net.Conn, config *ssh.ServerConfig) {
+	defer func() {
+		srv.mu.Lock()
+		delete(srv.conns, conn)
+		srv.mu.Unlock()
+		conn.Close()
+	}()
+
+	_, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		return
+	}
+	srv.logins.Add(1)
+	go ssh.DiscardRequests(reqs)
+
+	for newCh := range chans {
+		if newCh.ChannelType() != "session" {
+			newCh.Reject(ssh.UnknownChannelType, "only session channels are supported")
+			continue
+		}
+		ch, requests, err := newCh.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			for req := range requests {
+				ok := req.Type == "subsystem" && string(req.Payload[4:]) == "sftp"
+				req.Reply(ok, nil)
+				if !ok {
+					continue
+				}
+				server, err := gosftp.NewServer(ch)
+				if err != nil {
+					ch.Close()
+					return
+				}
+				server.Serve()
+				server.Close()
+				return
+			}
+		}()
+	}
+}
+
+var errAuth = errors.New("authentication failed")
+
+func newSigner(t *testing.T) ssh.Signer {
+	t.Helper()
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	signer, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		t.Fatalf("signer: %v", err)
+	}
+	return signer
+}
+
+// writeClientKey generates an OpenSSH private key file, optionally
+// encrypted with passphrase, and returns its path and public key.
+func writeClientKey(t *testing.T, passphrase string) (string, ssh.PublicKey) {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+
+	var block *pem.Block
+	if passphrase != "" {
+		block, err = ssh.MarshalPrivateKeyWithPassphrase(priv, "", []byte(passphrase))
+	} else {
+		block, err = ssh.MarshalPrivateKey(priv, "")
+	}
+	if err != nil {
+		t.Fatalf("marshal key: %v", err)
+	}
+
+	p := filepath.Join(t.TempDir(), "id_ed25519")
+	if err := os.WriteFile(p, pem.EncodeToMemory(block), 0o600); err != nil {
+		t.Fatalf("write key: %v", err)
+	}
+	sshPub, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatalf("public key: %v", err)
+	}
+	return p, sshPub
+}
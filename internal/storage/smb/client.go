@@ -0,0 +1,83 @@
+package smb
+
+import (
+	"context"
+	"io"
+	"io/fs"
+	"net"
+
+	"github.com/hirochachacha/go-smb2"
+)
+
+// shareClient adapts a go-smb2 session and mounted share to the client
+// interface, binding each call to the caller's context.
+type shareClient struct {
+	conn    net.Conn
+	session *smb2.Session
+	share   *smb2.Share
+}
+
+func dialShare(ctx context.Context, addr, shareName, user, password string) (*shareClient, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	dialer := &smb2.Dialer{
+		Initiator: &smb2.NTLMInitiator{
+			User:     user,
+			Password: password,
+		},
+	}
+	session, err := dialer.DialContext(ctx, conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	share, err := session.WithContext(ctx).Mount(shareName)
+	if err != nil {
+		session.Logoff()
+		conn.Close()
+		return nil, err
+	}
+
+	return &shareClient{conn: conn, session: session, share: share}, nil
+}
+
+func (c *shareClient) ReadDir(ctx context.Context, name string) ([]fs.FileInfo, error) {
+	return c.share.WithContext(ctx).ReadDir(name)
+}
+
+func (c *shareClient) Stat(ctx context.Context, name string) (fs.FileInfo, error) {
+	return c.share.WithContext(ctx).Stat(name)
+}
+
+func (c *shareClient) Open(ctx context.Context, name string) (io.ReadCloser, error) {
+	return c.share.WithContext(ctx).Open(name)
+}
+
+func (c *shareClient) Create(ctx context.Context, name string) (io.WriteCloser, error) {
+	return c.share.WithContext(ctx).Create(name)
+}
+
+func (c *shareClient) MkdirAll(ctx context.Context, name string) error {
+	return c.share.WithContext(ctx).MkdirAll(name, 0o755)
+}
+
+func (c *shareClient) Remove(ctx context.Context, name string) error {
+	return c.share.WithContext(ctx).Remove(name)
+}
+
+func (c *shareClient) Rename(ctx context.Context, oldname, newname string) error {
+	return c.share.WithContext(ctx).Rename(oldname, newname)
+}
+
+// Close unmounts the share, logs off and closes the TCP connection. Errors
+// from the first two steps are expected when the server already dropped us.
+func (c *shareClient) Close() error {
+	c.share.Umount()
+	c.session.Logoff()
+	return c.conn.Close()
+}
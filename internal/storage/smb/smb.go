@@ -0,0 +1,475 @@
+package smb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/hirochachacha/go-smb2"
+
+	"go-storage-api/internal/storage"
+)
+
+// NTSTATUS codes the backend cares about. go-smb2 keeps its table in an
+// internal package, so the relevant values are mirrored here.
+const (
+	statusNoSuchFile            uint32 = 0xC000000F
+	statusAccessDenied          uint32 = 0xC0000022
+	statusObjectNameNotFound    uint32 = 0xC0000034
+	statusObjectNameCollision   uint32 = 0xC0000035
+	statusObjectPathNotFound    uint32 = 0xC000003A
+	statusNetworkNameDeleted    uint32 = 0xC00000C9
+	statusDirectoryNotEmpty     uint32 = 0xC0000101
+	statusCannotDelete          uint32 = 0xC0000121
+	statusUserSessionDeleted    uint32 = 0xC0000203
+	statusNetworkSessionExpired uint32 = 0xC000035C
+)
+
+// client is the subset of a mounted SMB share used by the backend. It lets
+// tests substitute an in-process stand-in for a real server.
+type client interface {
+	ReadDir(ctx context.Context, name string) ([]fs.FileInfo, error)
+	Stat(ctx context.Context, name string) (fs.FileInfo, error)
+	Open(ctx context.Context, name string) (io.ReadCloser, error)
+	Create(ctx context.Context, name string) (io.WriteCloser, error)
+	MkdirAll(ctx context.Context, name string) error
+	Remove(ctx context.Context, name string) error
+	Rename(ctx context.Context, oldname, newname string) error
+	Close() error
+}
+
+// dialFunc establishes a new authenticated session with the share mounted.
+type dialFunc func(ctx context.Context) (client, error)
+
+// Storage implements storage.Storage against an SMB2/3 share. The session is
+// shared across requests (go-smb2's Share is goroutine-safe) and is
+// re-established transparently when the server drops it.
+type Storage struct {
+	dial dialFunc
+
+	mu     sync.Mutex
+	client client
+}
+
+// New dials the SMB server, authenticates and mounts the given share.
+func New(host, port, share, user, password string) (*Storage, error) {
+	addr := net.JoinHostPort(host, port)
+	dial := func(ctx context.Context) (client, error) {
+		c, err := dialShare(ctx, addr, share, user, password)
+		if err != nil {
+			return nil, err
+		}
+		return c, nil
+	}
+	return newWithDialer(context.Background(), dial)
+}
+
+func newWithDialer(ctx context.Context, dial dialFunc) (*Storage, error) {
+	s := &Storage{dial: dial}
+	if _, err := s.session(ctx); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *Storage) List(ctx context.Context, p string) ([]storage.FileInfo, error) {
+	name, err := sharePath(p)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []fs.FileInfo
+	err = s.do(ctx, func(c client) error {
+		var err error
+		entries, err = c.ReadDir(ctx, name)
+		return err
+	})
+	if err != nil {
+		return nil, mapError(err)
+	}
+
+	files := make([]storage.FileInfo, 0, len(entries))
+	for _, e := range entries {
+		if storage.IsTemp(e.Name()) {
+			continue
+		}
+		files = append(files, toFileInfo(path.Join(name, e.Name()), e))
+	}
+	return files, nil
+}
+
+func (s *Storage) Read(ctx context.Context, p string) (io.ReadCloser, error) {
+	name, err := sharePath(p)
+	if err != nil {
+		return nil, err
+	}
+
+	var rc io.ReadCloser
+	err = s.do(ctx, func(c client) error {
+		var err error
+		rc, err = c.Open(ctx, name)
+		return err
+	})
+	if err != nil {
+		return nil, mapError(err)
+	}
+	return rc, nil
+}
+
+// ReadRange seeks the open file handle to offset. SMB reads are positional,
+// so this avoids transferring the bytes before the range.
+func (s *Storage) ReadRange(ctx context.Context, p string, offset, length int64) (io.ReadCloser, error) {
+	rc, err := s.Read(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	if offset > 0 {
+		if seeker, ok := rc.(io.Seeker); ok {
+			_, err = seeker.Seek(offset, io.SeekStart)
+		} else {
+			_, err = io.CopyN(io.Discard, rc, offset)
+			if err == io.EOF {
+				err = nil
+			}
+		}
+		if err != nil {
+			rc.Close()
+			return nil, mapError(err)
+		}
+	}
+	return storage.LimitReadCloser(rc, length), nil
+}
+
+// Write streams into a storage.TempName sibling and moves it into place
+// with replace.
+func (s *Storage) Write(ctx context.Context, p string, r io.Reader) error {
+	name, err := sharePath(p)
+	if err != nil {
+		return err
+	}
+	if name == "" {
+		return storage.ErrPermission
+	}
+	tmp := storage.TempName(name)
+
+	// Opening the file may be retried on a dropped session, but the copy
+	// below may not, since r cannot be read twice.
+	var wc io.WriteCloser
+	err = s.do(ctx, func(c client) error {
+		if dir := path.Dir(name); dir != "." {
+			if err := c.MkdirAll(ctx, dir); err != nil {
+				return err
+			}
+		}
+		var err error
+		wc, err = c.Create(ctx, tmp)
+		return err
+	})
+	if err != nil {
+		return mapError(err)
+	}
+
+	if _, err := io.Copy(wc, r); err != nil {
+		wc.Close()
+		s.removeTemp(ctx, tmp)
+		return fmt.Errorf("write file: %w", err)
+	}
+	if err := wc.Close(); err != nil {
+		s.removeTemp(ctx, tmp)
+		return fmt.Errorf("close file: %w", mapError(err))
+	}
+
+	err = s.do(ctx, func(c client) error {
+		return replace(ctx, c, tmp, name)
+	})
+	if err != nil {
+		s.removeTemp(ctx, tmp)
+		return mapError(err)
+	}
+	return nil
+}
+
+// removeTemp deletes the temporary file of a failed Write.
+func (s *Storage) removeTemp(ctx context.Context, tmp string) {
+	ctx = context.WithoutCancel(ctx)
+	s.do(ctx, func(c client) error {
+		return c.Remove(ctx, tmp)
+	})
+}
+
+// replace renames from over the file to. SMB2 can replace the target of a
+// rename, but go-smb2 never asks it to, so an existing file always goes
+// through its storage.AsideName.
+func replace(ctx context.Context, c client, from, to string) error {
+	err := c.Rename(ctx, from, to)
+	if err == nil || !errors.Is(mapError(err), storage.ErrExist) {
+		return err
+	}
+	if info, err := c.Stat(ctx, to); err != nil {
+		return err
+	} else if info.IsDir() {
+		return fmt.Errorf("replace %s: %w", to, storage.ErrExist)
+	}
+
+	old := storage.AsideName(to)
+	if err := c.Rename(ctx, to, old); err != nil {
+		return err
+	}
+	if err := c.Rename(ctx, from, to); err != nil {
+		c.Rename(ctx, old, to)
+		return err
+	}
+	c.Remove(ctx, old)
+	return nil
+}
+
+// Recover puts back the files replace left aside.
+func (s *Storage) Recover(ctx context.Context) (int, error) {
+	var n int
+	err := s.do(ctx, func(c client) error {
+		readDir := func(dir string) ([]storage.FileInfo, error) {
+			entries, err := c.ReadDir(ctx, dir)
+			if err != nil {
+				return nil, err
+			}
+			files := make([]storage.FileInfo, len(entries))
+			for i, e := range entries {
+				files[i] = toFileInfo(path.Join(dir, e.Name()), e)
+			}
+			return files, nil
+		}
+		rename := func(from, to string) error {
+			return c.Rename(ctx, from, to)
+		}
+		remove := func(name string) error {
+			return c.Remove(ctx, name)
+		}
+		var err error
+		n, err = storage.RecoverAside(ctx, readDir, rename, remove)
+		return err
+	})
+	return n, mapError(err)
+}
+
+func (s *Storage) Delete(ctx context.Context, p string) error {
+	name, err := sharePath(p)
+	if err != nil {
+		return err
+	}
+	if name == "" {
+		return storage.ErrPermission
+	}
+
+	err = s.do(ctx, func(c client) error {
+		return c.Remove(ctx, name)
+	})
+	if err != nil {
+		return mapError(err)
+	}
+	return nil
+}
+
+func (s *Storage) Mkdir(ctx context.Context, p string) error {
+	name, err := sharePath(p)
+	if err != nil {
+		return err
+	}
+	if name == "" {
+		return storage.ErrPermission
+	}
+
+	err = s.do(ctx, func(c client) error {
+		if _, err := c.Stat(ctx, name); err == nil {
+			return fmt.Errorf("mkdir %s: %w", name, storage.ErrExist)
+		}
+		return c.MkdirAll(ctx, name)
+	})
+	if err != nil {
+		return mapError(err)
+	}
+	return nil
+}
+
+// Move renames on the server, replacing an existing file at to the way
+// Write does.
+func (s *Storage) Move(ctx context.Context, from, to string) error {
+	src, err := sharePath(from)
+	if err != nil {
+		return err
+	}
+	dst, err := sharePath(to)
+	if err != nil {
+		return err
+	}
+	if src == "" || dst == "" {
+		return storage.ErrPermission
+	}
+
+	err = s.do(ctx, func(c client) error {
+		if dir := path.Dir(dst); dir != "." {
+			if err := c.MkdirAll(ctx, dir); err != nil {
+				return err
+			}
+		}
+		return replace(ctx, c, src, dst)
+	})
+	if err != nil {
+		return mapError(err)
+	}
+	return nil
+}
+
+func (s *Storage) Stat(ctx context.Context, p string) (*storage.FileInfo, error) {
+	name, err := sharePath(p)
+	if err != nil {
+		return nil, err
+	}
+
+	var info fs.FileInfo
+	err = s.do(ctx, func(c client) error {
+		var err error
+		info, err = c.Stat(ctx, name)
+		return err
+	})
+	if err != nil {
+		return nil, mapError(err)
+	}
+
+	fi := toFileInfo(name, info)
+	return &fi, nil
+}
+
+// Close unmounts the share and logs off the session.
+func (s *Storage) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.client == nil {
+		return nil
+	}
+	err := s.client.Close()
+	s.client = nil
+	return err
+}
+
+// do runs fn against the current session. If fn fails because the session or
+// its TCP connection is gone, the session is re-established and fn is
+// retried once.
+func (s *Storage) do(ctx context.Context, fn func(client) error) error {
+	c, err := s.session(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = fn(c)
+	if !isConnError(err) {
+		return err
+	}
+
+	s.invalidate(c)
+	c, err = s.session(ctx)
+	if err != nil {
+		return err
+	}
+	return fn(c)
+}
+
+// session returns the live session, dialing a new one if necessary.
+func (s *Storage) session(ctx context.Context) (client, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.client != nil {
+		return s.client, nil
+	}
+	c, err := s.dial(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("smb connect: %w", err)
+	}
+	s.client = c
+	return c, nil
+}
+
+// invalidate discards c if it is still the current session. Another request
+// may already have replaced it, in which case nothing happens.
+func (s *Storage) invalidate(c client) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.client == c {
+		s.client.Close()
+		s.client = nil
+	}
+}
+
+// sharePath converts an API path into a path below the share, keeping
+// forward slashes, which go-smb2 turns into backslashes.
+func sharePath(requested string) (string, error) {
+	if strings.Contains(requested, "..") {
+		return "", storage.ErrPermission
+	}
+	cleaned := path.Clean("/" + requested)
+	return strings.TrimPrefix(cleaned, "/"), nil
+}
+
+func toFileInfo(name string, info fs.FileInfo) storage.FileInfo {
+	return storage.FileInfo{
+		Name:    info.Name(),
+		Path:    name,
+		Size:    info.Size(),
+		IsDir:   info.IsDir(),
+		ModTime: info.ModTime(),
+	}
+}
+
+// isConnError reports whether err means the session must be re-established.
+func isConnError(err error) bool {
+	if err == nil {
+		return false
+	}
+	var terr *smb2.TransportError
+	if errors.As(err, &terr) {
+		return true
+	}
+	var rerr *smb2.ResponseError
+	if errors.As(err, &rerr) {
+		switch rerr.Code {
+		case statusNetworkNameDeleted, statusUserSessionDeleted, statusNetworkSessionExpired:
+			return true
+		}
+	}
+	return errors.Is(err, net.ErrClosed) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// mapError converts go-smb2 errors and NTSTATUS codes to storage sentinel errors.
+func mapError(err error) error {
+	if errors.Is(err, fs.ErrNotExist) {
+		return storage.ErrNotFound
+	}
+	if errors.Is(err, fs.ErrExist) {
+		return storage.ErrExist
+	}
+	if errors.Is(err, fs.ErrPermission) {
+		return storage.ErrPermission
+	}
+	var rerr *smb2.ResponseError
+	if errors.As(err, &rerr) {
+		switch rerr.Code {
+		case statusNoSuchFile, statusObjectNameNotFound, statusObjectPathNotFound:
+			return storage.ErrNotFound
+		case statusAccessDenied, statusCannotDelete:
+			return storage.ErrPermission
+		case statusDirectoryNotEmpty:
+			return storage.ErrNotEmpty
+		case statusObjectNameCollision:
+			return storage.ErrExist
+		}
+	}
+	return err
+}
@@ -0,0 +1,377 @@
+package smb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/hirochachacha/go-smb2"
+
+	"go-storage-api/internal/storage"
+	"go-storage-api/internal/storage/storagetest"
+)
+
+// fakeClient stands in for a mounted SMB share by operating on a local
+// directory. Setting broken makes every call fail the way go-smb2 does when
+// the TCP connection has been lost.
+type fakeClient struct {
+	root   string
+	broken atomic.Bool
+	closed atomic.Bool
+}
+
+func (c *fakeClient) full(name string) string {
+	return filepath.Join(c.root, filepath.FromSlash(name))
+}
+
+func (c *fakeClient) check() error {
+	if c.broken.Load() || c.closed.Load() {
+		return &smb2.TransportError{Err: io.EOF}
+	}
+	return nil
+}
+
+func (c *fakeClient) ReadDir(_ context.Context, name string) ([]fs.FileInfo, error) {
+	if err := c.check(); err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(c.full(name))
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]fs.FileInfo, 0, len(entries))
+	for _, e := range entries {
+		info, err := e.Info()
+		if err != nil {
+			return nil, err
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+func (c *fakeClient) Stat(_ context.Context, name string) (fs.FileInfo, error) {
+	if err := c.check(); err != nil {
+		return nil, err
+	}
+	return os.Stat(c.full(name))
+}
+
+func (c *fakeClient) Open(_ context.Context, name string) (io.ReadCloser, error) {
+	if err := c.check(); err != nil {
+		return nil, err
+	}
+	return os.Open(c.full(name))
+}
+
+func (c *fakeClient) Create(_ context.Context, name string) (io.WriteCloser, error) {
+	if err := c.check(); err != nil {
+		return nil, err
+	}
+	return os.Create(c.full(name))
+}
+
+func (c *fakeClient) MkdirAll(_ context.Context, name string) error {
+	if err := c.check(); err != nil {
+		return err
+	}
+	return os.MkdirAll(c.full(name), 0o755)
+}
+
+// Remove reports a non-empty directory with the NTSTATUS a real server
+// sends rather than the local errno.
+func (c *fakeClient) Remove(_ context.Context, name string) error {
+	if err := c.check(); err != nil {
+		return err
+	}
+	if entries, err := os.ReadDir(c.full(name)); err == nil && len(entries) > 0 {
+		return &os.PathError{Op: "remove", Path: name, Err: &smb2.ResponseError{Code: statusDirectoryNotEmpty}}
+	}
+	return os.Remove(c.full(name))
+}
+
+// Rename refuses to replace an existing target, as go-smb2 does.
+func (c *fakeClient) Rename(_ context.Context, oldname, newname string) error {
+	if err := c.check(); err != nil {
+		return err
+	}
+	if _, err := os.Lstat(c.full(newname)); err == nil {
+		return &os.PathError{Op: "rename", Path: newname, Err: os.ErrExist}
+	}
+	return os.Rename(c.full(oldname), c.full(newname))
+}
+
+func (c *fakeClient) Close() error {
+	c.closed.Store(true)
+	return nil
+}
+
+// fakeServer hands out fakeClients sharing one root and counts dials.
+type fakeServer struct {
+	root  string
+	dials atomic.Int32
+	last  atomic.Pointer[fakeClient]
+	down  atomic.Bool
+}
+
+func (f *fakeServer) dial(_ context.Context) (client, error) {
+	if f.down.Load() {
+		return nil, fmt.Errorf("dial tcp: connection refused")
+	}
+	f.dials.Add(1)
+	c := &fakeClient{root: f.root}
+	f.last.Store(c)
+	return c, nil
+}
+
+func newTestStorage(t *testing.T) (*Storage, *fakeServer) {
+	t.Helper()
+	srv := &fakeServer{root: t.TempDir()}
+	s, err := newWithDialer(context.Background(), srv.dial)
+	if err != nil {
+		t.Fatalf("newWithDialer: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s, srv
+}
+
+// --- List ---
+
+func TestList_WithFiles(t *testing.T) {
+	s, srv := newTestStorage(t)
+	ctx := context.Background()
+
+	os.MkdirAll(filepath.Join(srv.root, "docs", "sub"), 0o755)
+	os.WriteFile(filepath.Join(srv.root, "docs", "readme.md"), []byte("hi"), 0o644)
+
+	files, err := s.List(ctx, "/docs")
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(files))
+	}
+
+	byName := map[string]storage.FileInfo{}
+	for _, f := range files {
+		byName[f.Name] = f
+	}
+	if byName["readme.md"].Path != "docs/readme.md" {
+		t.Errorf("expected path docs/readme.md, got %s", byName["readme.md"].Path)
+	}
+	if !byName["sub"].IsDir {
+		t.Error("expected sub to be a directory")
+	}
+}
+
+func TestList_Root(t *testing.T) {
+	s, srv := newTestStorage(t)
+
+	os.WriteFile(filepath.Join(srv.root, "a.txt"), []byte("a"), 0o644)
+
+	files, err := s.List(context.Background(), "/")
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(files) != 1 || files[0].Path != "a.txt" {
+		t.Errorf("unexpected listing: %+v", files)
+	}
+}
+
+func TestList_NotFound(t *testing.T) {
+	s, _ := newTestStorage(t)
+
+	_, err := s.List(context.Background(), "nonexistent")
+	if !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+// --- Read / Write ---
+
+func TestWriteThenRead(t *testing.T) {
+	s, _ := newTestStorage(t)
+	ctx := context.Background()
+
+	if err := s.Write(ctx, "deep/nested/file.txt", strings.NewReader("content")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	rc, err := s.Read(ctx, "deep/nested/file.txt")
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	defer rc.Close()
+
+	data, _ := io.ReadAll(rc)
+	if string(data) != "content" {
+		t.Errorf("expected %q, got %q", "content", string(data))
+	}
+}
+
+func TestRead_NotFound(t *testing.T) {
+	s, _ := newTestStorage(t)
+
+	_, err := s.Read(context.Background(), "missing.txt")
+	if !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestWrite_Root(t *testing.T) {
+	s, _ := newTestStorage(t)
+
+	err := s.Write(context.Background(), "/", strings.NewReader("x"))
+	if !errors.Is(err, storage.ErrPermission) {
+		t.Errorf("expected ErrPermission, got %v", err)
+	}
+}
+
+// --- Delete / Stat ---
+
+func TestDelete(t *testing.T) {
+	s, srv := newTestStorage(t)
+	ctx := context.Background()
+
+	os.WriteFile(filepath.Join(srv.root, "doomed.txt"), []byte("bye"), 0o644)
+
+	if err := s.Delete(ctx, "doomed.txt"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if err := s.Delete(ctx, "doomed.txt"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("expected ErrNotFound on second delete, got %v", err)
+	}
+}
+
+func TestStat_File(t *testing.T) {
+	s, srv := newTestStorage(t)
+
+	os.WriteFile(filepath.Join(srv.root, "info.txt"), []byte("12345"), 0o644)
+
+	fi, err := s.Stat(context.Background(), "/info.txt")
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+	if fi.Name != "info.txt" || fi.Path != "info.txt" || fi.Size != 5 || fi.IsDir {
+		t.Errorf("unexpected FileInfo: %+v", fi)
+	}
+}
+
+// --- Reconnect ---
+
+func TestReconnectsAfterTransportError(t *testing.T) {
+	s, srv := newTestStorage(t)
+	ctx := context.Background()
+
+	os.WriteFile(filepath.Join(srv.root, "a.txt"), []byte("a"), 0o644)
+
+	srv.last.Load().broken.Store(true)
+
+	if _, err := s.Stat(ctx, "a.txt"); err != nil {
+		t.Fatalf("Stat after dropped session: %v", err)
+	}
+	if got := srv.dials.Load(); got != 2 {
+		t.Errorf("expected 2 dials, got %d", got)
+	}
+}
+
+func TestReconnectFailureIsReturned(t *testing.T) {
+	s, srv := newTestStorage(t)
+
+	srv.last.Load().broken.Store(true)
+	srv.down.Store(true)
+
+	_, err := s.Stat(context.Background(), "a.txt")
+	if err == nil {
+		t.Fatal("expected error while server is down")
+	}
+
+	// The next request after the server comes back gets a fresh session.
+	srv.down.Store(false)
+	if _, err := s.List(context.Background(), "/"); err != nil {
+		t.Fatalf("List after recovery: %v", err)
+	}
+}
+
+// --- Error mapping ---
+
+func TestMapError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{"os not exist", &os.PathError{Op: "open", Path: "x", Err: os.ErrNotExist}, storage.ErrNotFound},
+		{"os permission", &os.PathError{Op: "open", Path: "x", Err: os.ErrPermission}, storage.ErrPermission},
+		{"no such file", &smb2.ResponseError{Code: statusNoSuchFile}, storage.ErrNotFound},
+		{"path not found", &os.PathError{Op: "open", Path: "x", Err: &smb2.ResponseError{Code: statusObjectPathNotFound}}, storage.ErrNotFound},
+		{"access denied", &smb2.ResponseError{Code: statusAccessDenied}, storage.ErrPermission},
+		{"cannot delete", &smb2.ResponseError{Code: statusCannotDelete}, storage.ErrPermission},
+		{"directory not empty", &os.PathError{Op: "remove", Path: "x", Err: &smb2.ResponseError{Code: statusDirectoryNotEmpty}}, storage.ErrNotEmpty},
+		{"name collision", &smb2.ResponseError{Code: statusObjectNameCollision}, storage.ErrExist},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := mapError(tt.err); !errors.Is(got, tt.want) {
+				t.Errorf("mapError(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+// --- Path mapping ---
+
+func TestSharePath(t *testing.T) {
+	tests := map[string]string{
+		"":                "",
+		"/":               "",
+		"file.txt":        "file.txt",
+		"/docs/readme.md": "docs/readme.md",
+		"docs//guide/":    "docs/guide",
+	}
+	for in, want := range tests {
+		got, err := sharePath(in)
+		if err != nil {
+			t.Errorf("sharePath(%q): unexpected error: %v", in, err)
+		}
+		if got != want {
+			t.Errorf("sharePath(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestSharePath_BlocksTraversal(t *testing.T) {
+	for _, p := range []string{"../etc/passwd", "/../../etc/passwd", "subdir/../../etc"} {
+		if _, err := sharePath(p); !errors.Is(err, storage.ErrPermission) {
+			t.Errorf("sharePath(%q): expected ErrPermission, got %v", p, err)
+		}
+	}
+}
+
+// --- Conformance ---
+
+func TestConformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Storage {
+		s, _ := newTestStorage(t)
+		return s
+	})
+}
+
+// --- Interface compliance ---
+
+var (
+	_ storage.Storage     = (*Storage)(nil)
+	_ storage.RangeReader = (*Storage)(nil)
+	_ storage.Mover       = (*Storage)(nil)
+	_ storage.Recoverer   = (*Storage)(nil)
+	_ io.Closer           = (*Storage)(nil)
+	_ client              = (*shareClient)(nil)
+)
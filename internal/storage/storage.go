@@ -10,6 +10,16 @@ import (
 var (
 	ErrNotFound   = errors.New("file not found")
 	ErrPermission = errors.New("permission denied")
+	ErrExist      = errors.New("file already exists")
+	ErrInvalid    = errors.New("invalid argument")
+	ErrNotEmpty   = errors.New("directory not empty")
+	// ErrPrecondition is returned by conditional writes and deletes whose
+	// Condition does not hold.
+	ErrPrecondition = errors.New("precondition failed")
+	// ErrNotSupported is returned for optional operations a backend cannot
+	// perform safely, such as conditional writes on a backend that cannot
+	// check the condition and change the file in one step.
+	ErrNotSupported = errors.New("not supported by this backend")
 )
 
 type FileInfo struct {
@@ -18,12 +28,53 @@ type FileInfo struct {
 	Size    int64     `json:"size"`
 	IsDir   bool      `json:"isDir"`
 	ModTime time.Time `json:"modTime"`
+
+	// The fields below are optional and only set when the backend records
+	// them; none of them are computed by reading the file. ETag is an HTTP
+	// entity tag including its quotes. Checksums are lowercase hex.
+	ETag        string `json:"etag,omitempty"`
+	ContentType string `json:"contentType,omitempty"`
+	SHA256      string `json:"sha256,omitempty"`
+	MD5         string `json:"md5,omitempty"`
+	CRC32C      string `json:"crc32c,omitempty"`
 }
 
+// Storage is implemented by every backend. The contract below is enforced
+// for all backends by the storagetest conformance suite.
+//
+// Paths are slash-separated and relative to the backend root. A leading "/",
+// repeated slashes and "." elements are ignored, and "", "/" and "." all name
+// the root. Paths that would escape the root fail with ErrPermission.
+// FileInfo.Path is always the cleaned form without a leading "/"; the root's
+// Path is "".
+//
+// Missing paths fail with ErrNotFound, wrapped or not, so callers should test
+// with errors.Is.
 type Storage interface {
+	// List returns the direct children of a directory, in no particular
+	// order. An empty directory yields an empty, non-nil slice.
 	List(ctx context.Context, path string) ([]FileInfo, error)
+	// Read opens a file for streaming. The caller must close it. Reading a
+	// directory fails, either here or on the first Read.
 	Read(ctx context.Context, path string) (io.ReadCloser, error)
+	// Write creates or replaces a file with the contents of r, creating any
+	// missing parent directories. Writing to the root fails. The new
+	// content replaces the old only once r is fully read: if reading r
+	// fails, Write returns that error (wrapped), leaves no partial file at
+	// path and keeps any previous file intact. Backends that cannot rename
+	// over a file leave nothing at path for a moment while replacing it
+	// (see AsideName). Names starting with TempPrefix are reserved for the
+	// backend's temporary files.
 	Write(ctx context.Context, path string, r io.Reader) error
+	// Delete removes a file or an empty directory. Non-empty directories are
+	// left untouched and ErrNotEmpty is returned. Deleting the root fails
+	// with ErrPermission.
 	Delete(ctx context.Context, path string) error
+	// Mkdir creates a directory and any missing parents. It fails with
+	// ErrExist if the path already exists and with ErrPermission for the
+	// root. Object stores record the directory with a marker so that it
+	// survives while empty.
+	Mkdir(ctx context.Context, path string) error
+	// Stat describes a file or directory.
 	Stat(ctx context.Context, path string) (*FileInfo, error)
 }
@@ -0,0 +1,1272 @@
+// Package storagetest provides a conformance suite for storage.Storage
+// implementations. Backend packages call Run from their own tests so that
+// every backend is held to the same contract:
+//
+//	func TestConformance(t *testing.T) {
+//		storagetest.Run(t, func(t *testing.T) storage.Storage {
+//			return newTestStorage(t)
+//		})
+//	}
+package storagetest
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"testing/iotest"
+
+	"go-storage-api/internal/storage"
+)
+
+// Factory returns a new, empty backend for a single subtest. It should
+// register any cleanup (temp dirs, servers, Close) with t.
+type Factory func(t *testing.T) storage.Storage
+
+// largeSize is big enough to cross the multipart threshold of the S3
+// uploader and the internal buffers of the network backends.
+const largeSize = 6<<20 + 123
+
+// Run exercises the storage.Storage contract against backends built by
+// newStore. Each subtest gets a fresh backend.
+func Run(t *testing.T, newStore Factory) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, s storage.Storage)
+	}{
+		{"ListEmptyRoot", testListEmptyRoot},
+		{"RootAliases", testRootAliases},
+		{"ListChildren", testListChildren},
+		{"ListNotFound", testListNotFound},
+		{"ListPage", testListPage},
+		{"ListPageErrors", testListPageErrors},
+		{"Walk", testWalk},
+		{"WalkSkipDir", testWalkSkipDir},
+		{"WalkErrors", testWalkErrors},
+		{"ReadNotFound", testReadNotFound},
+		{"StatNotFound", testStatNotFound},
+		{"DeleteNotFound", testDeleteNotFound},
+		{"WriteRead", testWriteRead},
+		{"WriteEmpty", testWriteEmpty},
+		{"Overwrite", testOverwrite},
+		{"WriteFailedReader", testWriteFailedReader},
+		{"MissingParents", testMissingParents},
+		{"PathNormalization", testPathNormalization},
+		{"Traversal", testTraversal},
+		{"StatFile", testStatFile},
+		{"StatDir", testStatDir},
+		{"Metadata", testMetadata},
+		{"ReadDir", testReadDir},
+		{"WriteRoot", testWriteRoot},
+		{"DeleteRoot", testDeleteRoot},
+		{"DeleteFile", testDeleteFile},
+		{"DeleteNonEmptyDir", testDeleteNonEmptyDir},
+		{"DeleteEmptiedDir", testDeleteEmptiedDir},
+		{"DeleteAll", testDeleteAll},
+		{"DeleteAllErrors", testDeleteAllErrors},
+		{"Mkdir", testMkdir},
+		{"MkdirErrors", testMkdirErrors},
+		{"Concurrent", testConcurrent},
+		{"LargeFile", testLargeFile},
+		{"ReadRange", testReadRange},
+		{"MoveFile", testMoveFile},
+		{"MoveDir", testMoveDir},
+		{"CopyFile", testCopyFile},
+		{"CopyDir", testCopyDir},
+		{"CopyEmptyDir", testCopyEmptyDir},
+		{"TransferErrors", testTransferErrors},
+		{"WriteIf", testWriteIf},
+		{"DeleteIf", testDeleteIf},
+		{"WriteIfConcurrent", testWriteIfConcurrent},
+		{"ConditionalNotSupported", testConditionalNotSupported},
+		{"Recover", testRecover},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.fn(t, newStore(t))
+		})
+	}
+}
+
+func testListEmptyRoot(t *testing.T, s storage.Storage) {
+	files, err := s.List(context.Background(), "/")
+	if err != nil {
+		t.Fatalf("List(/): %v", err)
+	}
+	if files == nil {
+		t.Error("List(/) returned nil; want an empty slice so it encodes as []")
+	}
+	if len(files) != 0 {
+		t.Errorf("List(/) on empty store = %+v, want no entries", files)
+	}
+}
+
+func testRootAliases(t *testing.T, s storage.Storage) {
+	mustWrite(t, s, "top.txt", "x")
+
+	for _, root := range []string{"", "/", ".", "//"} {
+		files, err := s.List(context.Background(), root)
+		if err != nil {
+			t.Errorf("List(%q): %v", root, err)
+			continue
+		}
+		if len(files) != 1 || files[0].Path != "top.txt" {
+			t.Errorf("List(%q) = %+v, want [top.txt]", root, files)
+		}
+
+		fi, err := s.Stat(context.Background(), root)
+		if err != nil {
+			t.Errorf("Stat(%q): %v", root, err)
+			continue
+		}
+		if !fi.IsDir || fi.Path != "" {
+			t.Errorf("Stat(%q) = %+v, want IsDir with empty Path", root, fi)
+		}
+	}
+}
+
+func testListChildren(t *testing.T, s storage.Storage) {
+	mustWrite(t, s, "docs/readme.md", "hi")
+	mustWrite(t, s, "docs/guide/intro.md", "intro")
+	mustWrite(t, s, "other.txt", "x")
+
+	files, err := s.List(context.Background(), "docs")
+	if err != nil {
+		t.Fatalf("List(docs): %v", err)
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Name < files[j].Name })
+
+	if len(files) != 2 {
+		t.Fatalf("List(docs) returned %d entries, want 2 direct children: %+v", len(files), files)
+	}
+	if f := files[0]; f.Name != "guide" || f.Path != "docs/guide" || !f.IsDir {
+		t.Errorf("unexpected directory entry: %+v", f)
+	}
+	if f := files[1]; f.Name != "readme.md" || f.Path != "docs/readme.md" || f.IsDir || f.Size != 2 {
+		t.Errorf("unexpected file entry: %+v", f)
+	}
+}
+
+func testListNotFound(t *testing.T, s storage.Storage) {
+	_, err := s.List(context.Background(), "missing")
+	if !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("List(missing) error = %v, want ErrNotFound", err)
+	}
+}
+
+func testListPage(t *testing.T, s storage.Storage) {
+	want := []string{"a.txt", "b.txt", "c.txt", "d.txt", "e.txt", "sub"}
+	for _, name := range want[:5] {
+		mustWrite(t, s, "dir/"+name, name)
+	}
+	mustWrite(t, s, "dir/sub/inner.txt", "x")
+
+	var got []string
+	cursor := ""
+	for pages := 0; ; pages++ {
+		if pages > len(want) {
+			t.Fatalf("ListPage did not finish after %d pages; got %v", pages, got)
+		}
+		page, err := storage.ListPage(context.Background(), s, "dir", cursor, 2)
+		if err != nil {
+			t.Fatalf("ListPage(dir, %q): %v", cursor, err)
+		}
+		if len(page.Entries) > 2 {
+			t.Fatalf("ListPage returned %d entries, want at most 2", len(page.Entries))
+		}
+		for _, f := range page.Entries {
+			if f.Path != "dir/"+f.Name {
+				t.Errorf("entry %q has Path %q", f.Name, f.Path)
+			}
+			if f.IsDir != (f.Name == "sub") {
+				t.Errorf("entry %q has IsDir=%v", f.Name, f.IsDir)
+			}
+			got = append(got, f.Name)
+		}
+		if page.Next == "" {
+			break
+		}
+		cursor = page.Next
+	}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("paged listing = %v, want %v", got, want)
+	}
+
+	page, err := storage.ListPage(context.Background(), s, "/", "", 10)
+	if err != nil {
+		t.Fatalf("ListPage(/): %v", err)
+	}
+	if len(page.Entries) != 1 || page.Entries[0].Name != "dir" || page.Next != "" {
+		t.Errorf("ListPage(/) = %+v, want only dir", page)
+	}
+}
+
+func testListPageErrors(t *testing.T, s storage.Storage) {
+	if _, err := storage.ListPage(context.Background(), s, "missing", "", 10); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("ListPage(missing) error = %v, want ErrNotFound", err)
+	}
+	if _, err := storage.ListPage(context.Background(), s, "/", "", 0); !errors.Is(err, storage.ErrInvalid) {
+		t.Errorf("ListPage(limit 0) error = %v, want ErrInvalid", err)
+	}
+}
+
+// walkTree is the tree used by the Walk tests; "-" and "." sort before "/"
+// so backends that walk in key order are covered too.
+var walkTree = []string{"top.txt", "a/one.txt", "a/b/two.txt", "a/b-c/three.txt", "a/b.txt", "z/deep/er/four.txt"}
+
+func testWalk(t *testing.T, s storage.Storage) {
+	for _, p := range walkTree {
+		mustWrite(t, s, p, p)
+	}
+
+	tests := []struct {
+		root string
+		want []string
+	}{
+		{"/", []string{"a", "a/b", "a/b-c", "a/b-c/three.txt", "a/b.txt", "a/b/two.txt", "a/one.txt", "top.txt", "z", "z/deep", "z/deep/er", "z/deep/er/four.txt"}},
+		{"a", []string{"a/b", "a/b-c", "a/b-c/three.txt", "a/b.txt", "a/b/two.txt", "a/one.txt"}},
+		{"z/deep", []string{"z/deep/er", "z/deep/er/four.txt"}},
+	}
+	for _, tt := range tests {
+		seen := map[string]bool{}
+		var got []string
+		err := storage.Walk(context.Background(), s, tt.root, func(f storage.FileInfo) error {
+			if seen[f.Path] {
+				t.Errorf("Walk(%q) visited %q twice", tt.root, f.Path)
+			}
+			if parent := path.Dir(f.Path); strings.HasPrefix(parent, strings.Trim(tt.root, "/")+"/") && !seen[parent] {
+				t.Errorf("Walk(%q) visited %q before its directory", tt.root, f.Path)
+			}
+			if f.Name != path.Base(f.Path) {
+				t.Errorf("Walk(%q): entry %q has Name %q", tt.root, f.Path, f.Name)
+			}
+			if f.IsDir == strings.HasSuffix(f.Path, ".txt") {
+				t.Errorf("Walk(%q): entry %q has IsDir=%v", tt.root, f.Path, f.IsDir)
+			}
+			if !f.IsDir && f.Size != int64(len(f.Path)) {
+				t.Errorf("Walk(%q): entry %q has Size %d", tt.root, f.Path, f.Size)
+			}
+			seen[f.Path] = true
+			got = append(got, f.Path)
+			return nil
+		})
+		if err != nil {
+			t.Errorf("Walk(%q): %v", tt.root, err)
+			continue
+		}
+		sort.Strings(got)
+		if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("Walk(%q) visited %v, want %v", tt.root, got, tt.want)
+		}
+	}
+}
+
+func testWalkSkipDir(t *testing.T, s storage.Storage) {
+	for _, p := range walkTree {
+		mustWrite(t, s, p, p)
+	}
+
+	var got []string
+	err := storage.Walk(context.Background(), s, "/", func(f storage.FileInfo) error {
+		got = append(got, f.Path)
+		if f.IsDir && (f.Path == "a/b" || f.Path == "z") {
+			return storage.SkipDir
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Walk: %v", err)
+	}
+	sort.Strings(got)
+	want := []string{"a", "a/b", "a/b-c", "a/b-c/three.txt", "a/b.txt", "a/one.txt", "top.txt", "z"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("Walk with SkipDir visited %v, want %v", got, want)
+	}
+}
+
+func testWalkErrors(t *testing.T, s storage.Storage) {
+	for _, p := range walkTree {
+		mustWrite(t, s, p, p)
+	}
+	ctx := context.Background()
+	noop := func(storage.FileInfo) error { return nil }
+
+	if err := storage.Walk(ctx, s, "missing", noop); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("Walk(missing) error = %v, want ErrNotFound", err)
+	}
+
+	stop := errors.New("stop")
+	visits := 0
+	err := storage.Walk(ctx, s, "/", func(storage.FileInfo) error {
+		visits++
+		return stop
+	})
+	if !errors.Is(err, stop) || visits != 1 {
+		t.Errorf("Walk returned %v after %d visits, want the callback's error after 1", err, visits)
+	}
+
+	cctx, cancel := context.WithCancel(ctx)
+	visits = 0
+	err = storage.Walk(cctx, s, "/", func(storage.FileInfo) error {
+		visits++
+		cancel()
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Walk after cancel returned %v, want context.Canceled", err)
+	}
+	if visits > 2 {
+		t.Errorf("Walk made %d visits after the context was cancelled", visits-1)
+	}
+}
+
+func testReadNotFound(t *testing.T, s storage.Storage) {
+	_, err := s.Read(context.Background(), "missing.txt")
+	if !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("Read(missing.txt) error = %v, want ErrNotFound", err)
+	}
+}
+
+func testStatNotFound(t *testing.T, s storage.Storage) {
+	for _, p := range []string{"missing.txt", "missing/dir/file.txt"} {
+		_, err := s.Stat(context.Background(), p)
+		if !errors.Is(err, storage.ErrNotFound) {
+			t.Errorf("Stat(%q) error = %v, want ErrNotFound", p, err)
+		}
+	}
+}
+
+func testDeleteNotFound(t *testing.T, s storage.Storage) {
+	err := s.Delete(context.Background(), "missing.txt")
+	if !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("Delete(missing.txt) error = %v, want ErrNotFound", err)
+	}
+}
+
+func testWriteRead(t *testing.T, s storage.Storage) {
+	mustWrite(t, s, "hello.txt", "hello, world")
+	if got := mustRead(t, s, "hello.txt"); got != "hello, world" {
+		t.Errorf("Read = %q, want %q", got, "hello, world")
+	}
+}
+
+func testWriteEmpty(t *testing.T, s storage.Storage) {
+	mustWrite(t, s, "empty.txt", "")
+
+	fi, err := s.Stat(context.Background(), "empty.txt")
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+	if fi.Size != 0 || fi.IsDir {
+		t.Errorf("Stat(empty.txt) = %+v, want a zero-size file", fi)
+	}
+	if got := mustRead(t, s, "empty.txt"); got != "" {
+		t.Errorf("Read = %q, want empty", got)
+	}
+}
+
+// errAborted is returned by the reader in testWriteFailedReader, standing in
+// for a dropped connection or a failed checksum.
+var errAborted = errors.New("upload aborted")
+
+// failingReader yields some bytes and then errAborted.
+func failingReader() io.Reader {
+	return io.MultiReader(io.LimitReader(&pattern{}, 64<<10), iotest.ErrReader(errAborted))
+}
+
+func testWriteFailedReader(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+
+	err := s.Write(ctx, "dir/new.bin", failingReader())
+	if !errors.Is(err, errAborted) {
+		t.Errorf("Write with failing reader error = %v, want the reader's error", err)
+	}
+	if _, err := s.Stat(ctx, "dir/new.bin"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("Stat after failed Write error = %v, want ErrNotFound (no partial file)", err)
+	}
+
+	// A failed replacement must keep the old file untouched, and must not
+	// leave its temporary file in listings.
+	mustWrite(t, s, "dir/old.txt", "original")
+	if err := s.Write(ctx, "dir/old.txt", failingReader()); !errors.Is(err, errAborted) {
+		t.Errorf("overwrite with failing reader error = %v, want the reader's error", err)
+	}
+	if got := mustRead(t, s, "dir/old.txt"); got != "original" {
+		t.Errorf("Read after failed overwrite = %q, want the original content", got)
+	}
+	entries, err := s.List(ctx, "dir")
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Name != "old.txt" {
+		var got []string
+		for _, e := range entries {
+			got = append(got, e.Name)
+		}
+		t.Errorf("List after failed writes = %q, want only old.txt", got)
+	}
+}
+
+func testOverwrite(t *testing.T, s storage.Storage) {
+	mustWrite(t, s, "file.txt", "a much longer original body")
+	mustWrite(t, s, "file.txt", "short")
+
+	if got := mustRead(t, s, "file.txt"); got != "short" {
+		t.Errorf("Read after overwrite = %q, want %q", got, "short")
+	}
+	fi, err := s.Stat(context.Background(), "file.txt")
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+	if fi.Size != int64(len("short")) {
+		t.Errorf("Size after overwrite = %d, want %d", fi.Size, len("short"))
+	}
+}
+
+func testMissingParents(t *testing.T, s storage.Storage) {
+	mustWrite(t, s, "a/b/c/d.txt", "deep")
+
+	for _, dir := range []string{"a", "a/b", "a/b/c"} {
+		fi, err := s.Stat(context.Background(), dir)
+		if err != nil {
+			t.Errorf("Stat(%q): %v", dir, err)
+			continue
+		}
+		if !fi.IsDir {
+			t.Errorf("Stat(%q).IsDir = false, want true", dir)
+		}
+	}
+
+	files, err := s.List(context.Background(), "a/b")
+	if err != nil {
+		t.Fatalf("List(a/b): %v", err)
+	}
+	if len(files) != 1 || files[0].Path != "a/b/c" || !files[0].IsDir {
+		t.Errorf("List(a/b) = %+v, want [a/b/c/]", files)
+	}
+}
+
+func testPathNormalization(t *testing.T, s storage.Storage) {
+	mustWrite(t, s, "/norm//dir/./file.txt", "x")
+
+	for _, p := range []string{"norm/dir/file.txt", "/norm/dir/file.txt", "norm//dir/file.txt", "norm/./dir/file.txt"} {
+		fi, err := s.Stat(context.Background(), p)
+		if err != nil {
+			t.Errorf("Stat(%q): %v", p, err)
+			continue
+		}
+		if fi.Path != "norm/dir/file.txt" || fi.Name != "file.txt" {
+			t.Errorf("Stat(%q) = %+v, want Path norm/dir/file.txt", p, fi)
+		}
+	}
+
+	for _, p := range []string{"norm/dir", "/norm/dir/", "norm//dir"} {
+		files, err := s.List(context.Background(), p)
+		if err != nil {
+			t.Errorf("List(%q): %v", p, err)
+			continue
+		}
+		if len(files) != 1 || files[0].Path != "norm/dir/file.txt" {
+			t.Errorf("List(%q) = %+v, want [norm/dir/file.txt]", p, files)
+		}
+	}
+}
+
+func testTraversal(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	for _, p := range []string{"../escape.txt", "/../../etc/passwd", "a/../../escape.txt"} {
+		if _, err := s.List(ctx, p); !errors.Is(err, storage.ErrPermission) {
+			t.Errorf("List(%q) error = %v, want ErrPermission", p, err)
+		}
+		if _, err := s.Read(ctx, p); !errors.Is(err, storage.ErrPermission) {
+			t.Errorf("Read(%q) error = %v, want ErrPermission", p, err)
+		}
+		if err := s.Write(ctx, p, strings.NewReader("x")); !errors.Is(err, storage.ErrPermission) {
+			t.Errorf("Write(%q) error = %v, want ErrPermission", p, err)
+		}
+		if err := s.Delete(ctx, p); !errors.Is(err, storage.ErrPermission) {
+			t.Errorf("Delete(%q) error = %v, want ErrPermission", p, err)
+		}
+		if _, err := s.Stat(ctx, p); !errors.Is(err, storage.ErrPermission) {
+			t.Errorf("Stat(%q) error = %v, want ErrPermission", p, err)
+		}
+	}
+}
+
+func testStatFile(t *testing.T, s storage.Storage) {
+	mustWrite(t, s, "dir/info.txt", "12345")
+
+	fi, err := s.Stat(context.Background(), "dir/info.txt")
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+	if fi.Name != "info.txt" || fi.Path != "dir/info.txt" || fi.Size != 5 || fi.IsDir {
+		t.Errorf("Stat(dir/info.txt) = %+v", fi)
+	}
+	if fi.ModTime.IsZero() {
+		t.Error("Stat(dir/info.txt).ModTime is zero")
+	}
+}
+
+// testMetadata checks the optional FileInfo fields: each one a backend sets
+// must describe the current content, from both Stat and List.
+func testMetadata(t *testing.T, s storage.Storage) {
+	check := func(content string) *storage.FileInfo {
+		t.Helper()
+		mustWrite(t, s, "meta/file.txt", content)
+
+		fi, err := s.Stat(context.Background(), "meta/file.txt")
+		if err != nil {
+			t.Fatalf("Stat: %v", err)
+		}
+		for _, algo := range storage.Algorithms {
+			got := fi.Checksum(algo)
+			if got == "" {
+				continue
+			}
+			want, _ := storage.Checksum(strings.NewReader(content), algo)
+			if got != want {
+				t.Errorf("Stat %s = %s, want %s", algo, got, want)
+			}
+		}
+		if fi.ETag != "" && !strings.HasSuffix(fi.ETag, `"`) {
+			t.Errorf("Stat ETag %q is not a quoted entity tag", fi.ETag)
+		}
+
+		files, err := s.List(context.Background(), "meta")
+		if err != nil {
+			t.Fatalf("List: %v", err)
+		}
+		if len(files) == 1 && files[0].ETag != "" && files[0].ETag != fi.ETag {
+			t.Errorf("List ETag %q differs from Stat ETag %q", files[0].ETag, fi.ETag)
+		}
+		return fi
+	}
+
+	first := check("first version")
+	second := check("second version, longer")
+	if first.ETag != "" && first.ETag == second.ETag {
+		t.Errorf("ETag %q did not change when the content did", first.ETag)
+	}
+
+	dir, err := s.Stat(context.Background(), "meta")
+	if err != nil {
+		t.Fatalf("Stat(meta): %v", err)
+	}
+	if dir.SHA256 != "" || dir.MD5 != "" || dir.CRC32C != "" {
+		t.Errorf("Stat(meta) has checksums for a directory: %+v", dir)
+	}
+}
+
+func testStatDir(t *testing.T, s storage.Storage) {
+	mustWrite(t, s, "mydir/file.txt", "x")
+
+	fi, err := s.Stat(context.Background(), "mydir")
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+	if fi.Name != "mydir" || fi.Path != "mydir" || !fi.IsDir {
+		t.Errorf("Stat(mydir) = %+v, want directory", fi)
+	}
+}
+
+func testReadDir(t *testing.T, s storage.Storage) {
+	mustWrite(t, s, "dir/file.txt", "x")
+
+	rc, err := s.Read(context.Background(), "dir")
+	if err == nil {
+		_, err = io.ReadAll(rc)
+		if cerr := rc.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if err == nil {
+		t.Error("reading a directory succeeded, want an error")
+	}
+}
+
+func testWriteRoot(t *testing.T, s storage.Storage) {
+	if err := s.Write(context.Background(), "/", strings.NewReader("x")); err == nil {
+		t.Error("Write(/) succeeded, want an error")
+	}
+}
+
+func testDeleteRoot(t *testing.T, s storage.Storage) {
+	for _, root := range []string{"", "/"} {
+		if err := s.Delete(context.Background(), root); !errors.Is(err, storage.ErrPermission) {
+			t.Errorf("Delete(%q) error = %v, want ErrPermission", root, err)
+		}
+	}
+	if _, err := s.List(context.Background(), "/"); err != nil {
+		t.Errorf("List(/) after Delete(/): %v", err)
+	}
+}
+
+func testDeleteFile(t *testing.T, s storage.Storage) {
+	mustWrite(t, s, "dir/keep.txt", "keep")
+	mustWrite(t, s, "dir/doomed.txt", "bye")
+
+	if err := s.Delete(context.Background(), "dir/doomed.txt"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := s.Stat(context.Background(), "dir/doomed.txt"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("Stat after Delete error = %v, want ErrNotFound", err)
+	}
+	if got := mustRead(t, s, "dir/keep.txt"); got != "keep" {
+		t.Errorf("sibling changed after Delete: %q", got)
+	}
+}
+
+func testDeleteNonEmptyDir(t *testing.T, s storage.Storage) {
+	mustWrite(t, s, "full/keep.txt", "keep")
+
+	if err := s.Delete(context.Background(), "full"); !errors.Is(err, storage.ErrNotEmpty) {
+		t.Fatalf("Delete of a non-empty directory error = %v, want ErrNotEmpty", err)
+	}
+	if got := mustRead(t, s, "full/keep.txt"); got != "keep" {
+		t.Errorf("directory contents changed after refused Delete: %q", got)
+	}
+}
+
+// testDeleteEmptiedDir removes the last file in a directory and then the
+// directory. Backends without real directories (S3) drop the directory with
+// its last entry, so ErrNotFound is accepted for the second Delete.
+func testDeleteEmptiedDir(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	mustWrite(t, s, "tmp/only.txt", "x")
+
+	if err := s.Delete(ctx, "tmp/only.txt"); err != nil {
+		t.Fatalf("Delete(tmp/only.txt): %v", err)
+	}
+	if err := s.Delete(ctx, "tmp"); err != nil && !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("Delete(tmp) error = %v, want nil or ErrNotFound", err)
+	}
+	if _, err := s.Stat(ctx, "tmp"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("Stat(tmp) after Delete error = %v, want ErrNotFound", err)
+	}
+}
+
+// testDeleteAll goes through storage.DeleteAll, covering both native
+// TreeDeleter implementations and the fallback.
+func testDeleteAll(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	mustWrite(t, s, "tree/a.txt", "a")
+	mustWrite(t, s, "tree/sub/b.txt", "b")
+	mustWrite(t, s, "tree/sub/deeper/c.txt", "c")
+	mustWrite(t, s, "treehouse.txt", "sibling")
+	if err := s.Mkdir(ctx, "tree/empty"); err != nil {
+		t.Fatalf("Mkdir: %v", err)
+	}
+
+	if err := storage.DeleteAll(ctx, s, "tree"); err != nil {
+		t.Fatalf("DeleteAll(tree): %v", err)
+	}
+	if _, err := s.Stat(ctx, "tree"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("Stat(tree) after DeleteAll error = %v, want ErrNotFound", err)
+	}
+	if got := mustRead(t, s, "treehouse.txt"); got != "sibling" {
+		t.Errorf("sibling sharing the name prefix changed: %q", got)
+	}
+
+	if err := storage.DeleteAll(ctx, s, "treehouse.txt"); err != nil {
+		t.Fatalf("DeleteAll(file): %v", err)
+	}
+	if _, err := s.Stat(ctx, "treehouse.txt"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("Stat(file) after DeleteAll error = %v, want ErrNotFound", err)
+	}
+}
+
+func testDeleteAllErrors(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	mustWrite(t, s, "keep.txt", "x")
+
+	if err := storage.DeleteAll(ctx, s, "missing"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("DeleteAll(missing) error = %v, want ErrNotFound", err)
+	}
+	for _, p := range []string{"", "/"} {
+		if err := storage.DeleteAll(ctx, s, p); !errors.Is(err, storage.ErrPermission) {
+			t.Errorf("DeleteAll(%q) error = %v, want ErrPermission", p, err)
+		}
+	}
+	if err := storage.DeleteAll(ctx, s, "../outside"); !errors.Is(err, storage.ErrPermission) {
+		t.Errorf("DeleteAll(../outside) error = %v, want ErrPermission", err)
+	}
+	if got := mustRead(t, s, "keep.txt"); got != "x" {
+		t.Errorf("keep.txt changed: %q", got)
+	}
+}
+
+func testMkdir(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+
+	if err := s.Mkdir(ctx, "/made/nested/deep"); err != nil {
+		t.Fatalf("Mkdir: %v", err)
+	}
+	for _, p := range []string{"made", "made/nested", "made/nested/deep"} {
+		fi, err := s.Stat(ctx, p)
+		if err != nil {
+			t.Fatalf("Stat(%q): %v", p, err)
+		}
+		if !fi.IsDir {
+			t.Errorf("Stat(%q).IsDir = false, want true", p)
+		}
+	}
+
+	files, err := s.List(ctx, "made/nested/deep")
+	if err != nil {
+		t.Fatalf("List(empty dir): %v", err)
+	}
+	if files == nil || len(files) != 0 {
+		t.Errorf("List(empty dir) = %#v, want empty non-nil slice", files)
+	}
+	files, err = s.List(ctx, "made")
+	if err != nil {
+		t.Fatalf("List(made): %v", err)
+	}
+	if len(files) != 1 || files[0].Name != "nested" || !files[0].IsDir {
+		t.Errorf("List(made) = %+v, want only the nested directory", files)
+	}
+
+	mustWrite(t, s, "made/nested/deep/file.txt", "x")
+	if err := s.Delete(ctx, "made/nested/deep/file.txt"); err != nil {
+		t.Fatalf("Delete(file): %v", err)
+	}
+	if err := s.Delete(ctx, "made/nested/deep"); err != nil {
+		t.Fatalf("Delete(empty dir): %v", err)
+	}
+	if _, err := s.Stat(ctx, "made/nested/deep"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("Stat after Delete error = %v, want ErrNotFound", err)
+	}
+}
+
+func testMkdirErrors(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	mustWrite(t, s, "dir/file.txt", "x")
+
+	tests := []struct {
+		path string
+		want error
+	}{
+		{"dir", storage.ErrExist},
+		{"dir/file.txt", storage.ErrExist},
+		{"/", storage.ErrPermission},
+		{"../outside", storage.ErrPermission},
+	}
+	for _, tt := range tests {
+		if err := s.Mkdir(ctx, tt.path); !errors.Is(err, tt.want) {
+			t.Errorf("Mkdir(%q) error = %v, want %v", tt.path, err, tt.want)
+		}
+	}
+	if got := mustRead(t, s, "dir/file.txt"); got != "x" {
+		t.Errorf("file changed by Mkdir over it: %q", got)
+	}
+}
+
+func testConcurrent(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	const n = 16
+
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			// All writers share a parent that does not exist yet, so
+			// parent creation races too.
+			name := fmt.Sprintf("shared/sub/file-%02d.txt", i)
+			if err := s.Write(ctx, name, strings.NewReader(name)); err != nil {
+				errs <- fmt.Errorf("Write(%s): %w", name, err)
+				return
+			}
+			rc, err := s.Read(ctx, name)
+			if err != nil {
+				errs <- fmt.Errorf("Read(%s): %w", name, err)
+				return
+			}
+			data, err := io.ReadAll(rc)
+			rc.Close()
+			if err != nil || string(data) != name {
+				errs <- fmt.Errorf("Read(%s) = %q, %v", name, data, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	files, err := s.List(ctx, "shared/sub")
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(files) != n {
+		t.Errorf("List returned %d entries, want %d", len(files), n)
+	}
+}
+
+func testLargeFile(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+
+	want := sha256.New()
+	src := io.TeeReader(io.LimitReader(&pattern{}, largeSize), want)
+	// Hide the concrete type so backends cannot size or seek the body.
+	if err := s.Write(ctx, "large.bin", struct{ io.Reader }{src}); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	rc, err := s.Read(ctx, "large.bin")
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	defer rc.Close()
+
+	got := sha256.New()
+	n, err := io.Copy(got, rc)
+	if err != nil {
+		t.Fatalf("reading back: %v", err)
+	}
+	if n != largeSize {
+		t.Fatalf("read %d bytes, want %d", n, largeSize)
+	}
+	if !bytes.Equal(got.Sum(nil), want.Sum(nil)) {
+		t.Error("content read back differs from content written")
+	}
+
+	fi, err := s.Stat(ctx, "large.bin")
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+	if fi.Size != largeSize {
+		t.Errorf("Stat.Size = %d, want %d", fi.Size, largeSize)
+	}
+}
+
+// testReadRange goes through storage.ReadRange, so it covers the backend's
+// native RangeReader when there is one and the generic fallback otherwise.
+func testReadRange(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	mustWrite(t, s, "digits.txt", "0123456789")
+
+	tests := []struct {
+		offset, length int64
+		want           string
+	}{
+		{0, -1, "0123456789"},
+		{3, 4, "3456"},
+		{8, -1, "89"},
+		{8, 10, "89"},
+		{0, 0, ""},
+		{10, -1, ""},
+		{15, 5, ""},
+	}
+	for _, tt := range tests {
+		rc, err := storage.ReadRange(ctx, s, "digits.txt", tt.offset, tt.length)
+		if err != nil {
+			t.Errorf("ReadRange(%d, %d): %v", tt.offset, tt.length, err)
+			continue
+		}
+		data, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Errorf("ReadRange(%d, %d): reading: %v", tt.offset, tt.length, err)
+		}
+		if string(data) != tt.want {
+			t.Errorf("ReadRange(%d, %d) = %q, want %q", tt.offset, tt.length, data, tt.want)
+		}
+	}
+
+	if _, err := storage.ReadRange(ctx, s, "missing.txt", 2, 3); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("ReadRange(missing): expected ErrNotFound, got %v", err)
+	}
+}
+
+// The Move and Copy tests go through storage.Move and storage.Copy, so they
+// cover native Mover and Copier implementations as well as the fallbacks.
+
+func testMoveFile(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	mustWrite(t, s, "a.txt", "alpha")
+	mustWrite(t, s, "old.txt", "stale")
+
+	if err := storage.Move(ctx, s, "a.txt", "sub/dir/b.txt"); err != nil {
+		t.Fatalf("Move to new parent: %v", err)
+	}
+	if got := mustRead(t, s, "sub/dir/b.txt"); got != "alpha" {
+		t.Errorf("moved file = %q, want %q", got, "alpha")
+	}
+	if _, err := s.Stat(ctx, "a.txt"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("Stat(source) after Move: expected ErrNotFound, got %v", err)
+	}
+
+	if err := storage.Move(ctx, s, "sub/dir/b.txt", "old.txt"); err != nil {
+		t.Fatalf("Move over existing file: %v", err)
+	}
+	if got := mustRead(t, s, "old.txt"); got != "alpha" {
+		t.Errorf("replaced file = %q, want %q", got, "alpha")
+	}
+}
+
+func testMoveDir(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	mustWrite(t, s, "src/one.txt", "1")
+	mustWrite(t, s, "src/nested/two.txt", "2")
+
+	if err := storage.Move(ctx, s, "src", "dst"); err != nil {
+		t.Fatalf("Move: %v", err)
+	}
+	if got := mustRead(t, s, "dst/one.txt"); got != "1" {
+		t.Errorf("dst/one.txt = %q, want %q", got, "1")
+	}
+	if got := mustRead(t, s, "dst/nested/two.txt"); got != "2" {
+		t.Errorf("dst/nested/two.txt = %q, want %q", got, "2")
+	}
+	if _, err := s.Stat(ctx, "src"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("Stat(source) after Move: expected ErrNotFound, got %v", err)
+	}
+}
+
+func testCopyFile(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	mustWrite(t, s, "a.txt", "alpha")
+
+	if err := storage.Copy(ctx, s, "a.txt", "copies/a.txt"); err != nil {
+		t.Fatalf("Copy: %v", err)
+	}
+	mustWrite(t, s, "copies/a.txt", "changed")
+	if got := mustRead(t, s, "a.txt"); got != "alpha" {
+		t.Errorf("source after writing the copy = %q, want %q", got, "alpha")
+	}
+
+	if err := storage.Copy(ctx, s, "a.txt", "copies/a.txt"); err != nil {
+		t.Fatalf("Copy over existing file: %v", err)
+	}
+	if got := mustRead(t, s, "copies/a.txt"); got != "alpha" {
+		t.Errorf("replaced copy = %q, want %q", got, "alpha")
+	}
+}
+
+func testCopyDir(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	mustWrite(t, s, "src/one.txt", "1")
+	mustWrite(t, s, "src/nested/two.txt", "2")
+
+	if err := storage.Copy(ctx, s, "src", "backup/src"); err != nil {
+		t.Fatalf("Copy: %v", err)
+	}
+	for p, want := range map[string]string{
+		"src/one.txt":               "1",
+		"src/nested/two.txt":        "2",
+		"backup/src/one.txt":        "1",
+		"backup/src/nested/two.txt": "2",
+	} {
+		if got := mustRead(t, s, p); got != want {
+			t.Errorf("%s = %q, want %q", p, got, want)
+		}
+	}
+}
+
+func testTransferErrors(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	mustWrite(t, s, "dir/file.txt", "x")
+	mustWrite(t, s, "other/file.txt", "y")
+
+	tests := []struct {
+		name     string
+		from, to string
+		want     error
+	}{
+		{"missing source", "missing.txt", "b.txt", storage.ErrNotFound},
+		{"root source", "/", "b", storage.ErrPermission},
+		{"root target", "dir/file.txt", "/", storage.ErrPermission},
+		{"traversal", "dir/file.txt", "../escape.txt", storage.ErrPermission},
+		{"onto itself", "dir", "dir", storage.ErrInvalid},
+		{"into itself", "dir", "dir/inner", storage.ErrInvalid},
+		{"file onto directory", "dir/file.txt", "other", storage.ErrExist},
+		{"directory onto file", "dir", "other/file.txt", storage.ErrExist},
+	}
+	for _, tt := range tests {
+		if err := storage.Move(ctx, s, tt.from, tt.to); !errors.Is(err, tt.want) {
+			t.Errorf("Move %s: expected %v, got %v", tt.name, tt.want, err)
+		}
+		if err := storage.Copy(ctx, s, tt.from, tt.to); !errors.Is(err, tt.want) {
+			t.Errorf("Copy %s: expected %v, got %v", tt.name, tt.want, err)
+		}
+	}
+
+	if got := mustRead(t, s, "dir/file.txt"); got != "x" {
+		t.Errorf("source changed by failed transfers: %q", got)
+	}
+}
+
+func testCopyEmptyDir(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	if err := s.Mkdir(ctx, "src/empty"); err != nil {
+		t.Fatalf("Mkdir: %v", err)
+	}
+	mustWrite(t, s, "src/file.txt", "x")
+
+	if err := storage.Copy(ctx, s, "src", "dst"); err != nil {
+		t.Fatalf("Copy: %v", err)
+	}
+	fi, err := s.Stat(ctx, "dst/empty")
+	if err != nil {
+		t.Fatalf("Stat(dst/empty): %v", err)
+	}
+	if !fi.IsDir {
+		t.Error("dst/empty is not a directory")
+	}
+}
+
+// pattern is an endless reader of non-repeating-looking bytes, cheap enough
+// to generate megabytes without holding them in memory.
+type pattern struct{ n uint32 }
+
+func (p *pattern) Read(b []byte) (int, error) {
+	for i := range b {
+		p.n = p.n*1664525 + 1013904223
+		b[i] = byte(p.n >> 24)
+	}
+	return len(b), nil
+}
+
+// mustETag returns the entity tag of the file at p.
+func mustETag(t *testing.T, s storage.Storage, p string) string {
+	t.Helper()
+	info, err := s.Stat(context.Background(), p)
+	if err != nil {
+		t.Fatalf("Stat(%q): %v", p, err)
+	}
+	return storage.ETag(info)
+}
+
+// Conditional writes below change the size with every write, so that tags
+// derived from size and modification time differ even on backends with
+// one-second timestamps.
+
+func testWriteIf(t *testing.T, s storage.Storage) {
+	requireConditional(t, s)
+	ctx := context.Background()
+	write := func(p, content string, cond storage.Condition) error {
+		return storage.WriteIf(ctx, s, p, strings.NewReader(content), cond)
+	}
+	create := storage.Condition{IfNoneMatch: true}
+
+	if err := write("a.txt", "v1", create); err != nil {
+		t.Fatalf("create-only write of a new file: %v", err)
+	}
+	if err := write("a.txt", "v2-", create); !errors.Is(err, storage.ErrPrecondition) {
+		t.Errorf("create-only write of an existing file: got %v, want ErrPrecondition", err)
+	}
+	if got := mustRead(t, s, "a.txt"); got != "v1" {
+		t.Errorf("refused write changed the file to %q", got)
+	}
+
+	old := mustETag(t, s, "a.txt")
+	if err := write("a.txt", "v2--", storage.Condition{IfMatch: old}); err != nil {
+		t.Fatalf("write with the current tag: %v", err)
+	}
+	if err := write("a.txt", "v3---", storage.Condition{IfMatch: old}); !errors.Is(err, storage.ErrPrecondition) {
+		t.Errorf("write with a stale tag: got %v, want ErrPrecondition", err)
+	}
+	if got := mustRead(t, s, "a.txt"); got != "v2--" {
+		t.Errorf("after stale write: content %q, want %q", got, "v2--")
+	}
+	if err := write("a.txt", "v4----", storage.Condition{IfMatch: "*"}); err != nil {
+		t.Errorf("write with If-Match * to an existing file: %v", err)
+	}
+
+	// A failed conditional upload keeps the old file, as a failed Write does.
+	cur := mustETag(t, s, "a.txt")
+	if err := storage.WriteIf(ctx, s, "a.txt", failingReader(), storage.Condition{IfMatch: cur}); !errors.Is(err, errAborted) {
+		t.Errorf("write with the current tag and a failing reader: got %v, want the reader's error", err)
+	}
+	if got := mustRead(t, s, "a.txt"); got != "v4----" {
+		t.Errorf("failed conditional write left %d bytes, want the previous content", len(got))
+	}
+
+	if err := write("missing.txt", "x", storage.Condition{IfMatch: "*"}); !errors.Is(err, storage.ErrPrecondition) {
+		t.Errorf("write with If-Match * to a missing file: got %v, want ErrPrecondition", err)
+	}
+	if _, err := s.Stat(ctx, "missing.txt"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("refused write created the file: Stat err = %v", err)
+	}
+
+	if err := s.Mkdir(ctx, "dir"); err != nil {
+		t.Fatalf("Mkdir: %v", err)
+	}
+	if err := write("dir", "x", storage.Condition{IfMatch: "*"}); !errors.Is(err, storage.ErrPrecondition) {
+		t.Errorf("write with If-Match * to a directory: got %v, want ErrPrecondition", err)
+	}
+}
+
+func testDeleteIf(t *testing.T, s storage.Storage) {
+	requireConditional(t, s)
+	ctx := context.Background()
+	mustWrite(t, s, "a.txt", "v1")
+	old := mustETag(t, s, "a.txt")
+	mustWrite(t, s, "a.txt", "v2-")
+
+	if err := storage.DeleteIf(ctx, s, "a.txt", old); !errors.Is(err, storage.ErrPrecondition) {
+		t.Errorf("delete with a stale tag: got %v, want ErrPrecondition", err)
+	}
+	if err := storage.DeleteIf(ctx, s, "a.txt", mustETag(t, s, "a.txt")); err != nil {
+		t.Fatalf("delete with the current tag: %v", err)
+	}
+	if _, err := s.Stat(ctx, "a.txt"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("Stat after delete: %v, want ErrNotFound", err)
+	}
+
+	if err := storage.DeleteIf(ctx, s, "a.txt", "*"); !errors.Is(err, storage.ErrPrecondition) {
+		t.Errorf("delete of a missing file: got %v, want ErrPrecondition", err)
+	}
+	mustWrite(t, s, "b.txt", "b")
+	if err := storage.DeleteIf(ctx, s, "b.txt", "*"); err != nil {
+		t.Errorf("delete with If-Match *: %v", err)
+	}
+	if err := s.Mkdir(ctx, "dir"); err != nil {
+		t.Fatalf("Mkdir: %v", err)
+	}
+	if err := storage.DeleteIf(ctx, s, "dir", "*"); !errors.Is(err, storage.ErrPrecondition) {
+		t.Errorf("delete of a directory: got %v, want ErrPrecondition", err)
+	}
+}
+
+// testWriteIfConcurrent races writers holding the same precondition:
+// exactly one of them may win.
+func testWriteIfConcurrent(t *testing.T, s storage.Storage) {
+	requireConditional(t, s)
+	ctx := context.Background()
+	const n = 8
+
+	race := func(p string, cond storage.Condition) {
+		t.Helper()
+		var wg sync.WaitGroup
+		errs := make(chan error, n)
+		for i := 0; i < n; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				errs <- storage.WriteIf(ctx, s, p, strings.NewReader(strings.Repeat("w", 10+i)), cond)
+			}(i)
+		}
+		wg.Wait()
+		close(errs)
+
+		won := 0
+		for err := range errs {
+			switch {
+			case err == nil:
+				won++
+			case !errors.Is(err, storage.ErrPrecondition):
+				t.Errorf("WriteIf(%s): %v", p, err)
+			}
+		}
+		if won != 1 {
+			t.Errorf("%d writers to %s succeeded, want 1", won, p)
+		}
+	}
+
+	race("created.txt", storage.Condition{IfNoneMatch: true})
+	mustWrite(t, s, "updated.txt", "original")
+	race("updated.txt", storage.Condition{IfMatch: mustETag(t, s, "updated.txt")})
+}
+
+// testConditionalNotSupported checks that a backend without
+// ConditionalWriter refuses conditional changes rather than checking them
+// with a separate Stat.
+func testConditionalNotSupported(t *testing.T, s storage.Storage) {
+	if _, ok := s.(storage.ConditionalWriter); ok {
+		t.Skip("backend implements ConditionalWriter")
+	}
+	ctx := context.Background()
+	mustWrite(t, s, "a.txt", "v1")
+	etag := mustETag(t, s, "a.txt")
+
+	if err := storage.WriteIf(ctx, s, "a.txt", strings.NewReader("v2"), storage.Condition{IfMatch: etag}); !errors.Is(err, storage.ErrNotSupported) {
+		t.Errorf("WriteIf: got %v, want ErrNotSupported", err)
+	}
+	if err := storage.WriteIf(ctx, s, "b.txt", strings.NewReader("v1"), storage.Condition{IfNoneMatch: true}); !errors.Is(err, storage.ErrNotSupported) {
+		t.Errorf("create-only WriteIf: got %v, want ErrNotSupported", err)
+	}
+	if err := storage.DeleteIf(ctx, s, "a.txt", etag); !errors.Is(err, storage.ErrNotSupported) {
+		t.Errorf("DeleteIf: got %v, want ErrNotSupported", err)
+	}
+	if got := mustRead(t, s, "a.txt"); got != "v1" {
+		t.Errorf("refused changes left %q, want %q", got, "v1")
+	}
+	if _, err := s.Stat(ctx, "b.txt"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("refused create-only write: Stat err = %v, want ErrNotFound", err)
+	}
+}
+
+// requireConditional skips t unless s checks conditions natively.
+// testRecover leaves old files under their aside names, as a replacement
+// cut short would, and expects Recover to put back the one whose target is
+// missing and to remove the one whose replacement is in place.
+func testRecover(t *testing.T, s storage.Storage) {
+	r, ok := s.(storage.Recoverer)
+	if !ok {
+		t.Skip("backend does not implement Recoverer")
+	}
+	ctx := context.Background()
+	mustWrite(t, s, storage.AsideName("dir/lost.txt"), "old")
+	mustWrite(t, s, "dir/sub/kept.txt", "new")
+	mustWrite(t, s, storage.AsideName("dir/sub/kept.txt"), "old")
+
+	n, err := r.Recover(ctx)
+	if err != nil {
+		t.Fatalf("Recover: %v", err)
+	}
+	if n != 1 {
+		t.Errorf("Recover put back %d files, want 1", n)
+	}
+	if got := mustRead(t, s, "dir/lost.txt"); got != "old" {
+		t.Errorf("Read(dir/lost.txt) = %q, want the old content", got)
+	}
+	if got := mustRead(t, s, "dir/sub/kept.txt"); got != "new" {
+		t.Errorf("Read(dir/sub/kept.txt) = %q, want the replacement", got)
+	}
+	for _, p := range []string{storage.AsideName("dir/lost.txt"), storage.AsideName("dir/sub/kept.txt")} {
+		if _, err := s.Stat(ctx, p); !errors.Is(err, storage.ErrNotFound) {
+			t.Errorf("Stat(%q) after Recover: err = %v, want ErrNotFound", p, err)
+		}
+	}
+}
+
+func requireConditional(t *testing.T, s storage.Storage) {
+	t.Helper()
+	if _, ok := s.(storage.ConditionalWriter); !ok {
+		t.Skip("backend does not implement ConditionalWriter")
+	}
+}
+
+func mustWrite(t *testing.T, s storage.Storage, p, content string) {
+	t.Helper()
+	if err := s.Write(context.Background(), p, strings.NewReader(content)); err != nil {
+		t.Fatalf("Write(%q): %v", p, err)
+	}
+}
+
+func mustRead(t *testing.T, s storage.Storage, p string) string {
+	t.Helper()
+	rc, err := s.Read(context.Background(), p)
+	if err != nil {
+		t.Fatalf("Read(%q): %v", p, err)
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatalf("Read(%q): %v", p, err)
+	}
+	return string(data)
+}
@@ -0,0 +1,39 @@
+package storage
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"path"
+	"strings"
+)
+
+// TempPrefix starts the names backends give to files and directories they
+// keep for themselves: the temporary files Write streams into before
+// renaming them over the target, and the parts of multipart uploads.
+// Listings and walks skip such names, and the API refuses paths using them.
+const TempPrefix = ".~upload-"
+
+// IsTemp reports whether a single path element is reserved by TempPrefix.
+func IsTemp(name string) bool {
+	return strings.HasPrefix(name, TempPrefix)
+}
+
+// HasTemp reports whether any element of p is reserved by TempPrefix.
+func HasTemp(p string) bool {
+	for _, elem := range strings.Split(p, "/") {
+		if IsTemp(elem) {
+			return true
+		}
+	}
+	return false
+}
+
+// TempName returns a fresh, unlisted sibling of the cleaned path name for a
+// backend to write into before renaming it over name. A failed upload then
+// leaves only that sibling behind, never a partial file at name, and the
+// backend deletes it again, even when the failure is a cancelled ctx.
+func TempName(name string) string {
+	var b [8]byte
+	rand.Read(b[:])
+	return path.Join(path.Dir(name), TempPrefix+hex.EncodeToString(b[:]))
+}
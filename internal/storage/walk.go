@@ -0,0 +1,63 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"sort"
+)
+
+// SkipDir can be returned by a WalkFunc for a directory to skip its contents.
+var SkipDir = fs.SkipDir
+
+// WalkFunc is called by Walk for each entry below the walked directory.
+// Returning SkipDir for a directory skips everything below it; any other
+// error stops the walk and is returned from Walk.
+type WalkFunc func(info FileInfo) error
+
+// Walker is implemented by backends that can enumerate a directory tree
+// more cheaply than one List call per directory.
+type Walker interface {
+	// Walk calls fn for every file and directory below root, not including
+	// root itself. A directory is always visited before its contents; the
+	// order is otherwise unspecified. Errors are as for List, and the walk
+	// stops with the context's error once ctx is done.
+	Walk(ctx context.Context, root string, fn WalkFunc) error
+}
+
+// Walk visits the tree below root in s. Backends implementing Walker walk
+// natively; for all others each directory is listed in turn, depth first and
+// in name order.
+func Walk(ctx context.Context, s Storage, root string, fn WalkFunc) error {
+	if w, ok := s.(Walker); ok {
+		return w.Walk(ctx, root, fn)
+	}
+	return walkDir(ctx, s, root, fn)
+}
+
+func walkDir(ctx context.Context, s Storage, dir string, fn WalkFunc) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	entries, err := s.List(ctx, dir)
+	if err != nil {
+		return err
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+
+	for _, e := range entries {
+		err := fn(e)
+		if errors.Is(err, SkipDir) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if e.IsDir {
+			if err := walkDir(ctx, s, e.Path, fn); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,590 @@
+package webdav
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+
+	"go-storage-api/internal/storage"
+)
+
+// propfindBody asks only for the properties the backend maps to FileInfo.
+const propfindBody = `<?xml version="1.0" encoding="utf-8"?>
+<D:propfind xmlns:D="DAV:"><D:prop><D:resourcetype/><D:getcontentlength/><D:getlastmodified/><D:getetag/><D:getcontenttype/></D:prop></D:propfind>`
+
+// Options configures the WebDAV backend.
+type Options struct {
+	// URL is the collection all paths are resolved against, e.g.
+	// https://cloud.example.com/remote.php/dav/files/alice/.
+	URL      string
+	User     string
+	Password string
+}
+
+// Storage implements storage.Storage against a WebDAV server (RFC 4918).
+// Listings and metadata come from PROPFIND; content moves via GET/PUT.
+type Storage struct {
+	client   *http.Client
+	base     *url.URL
+	user     string
+	password string
+}
+
+// New creates a WebDAV backend and verifies that the base collection exists.
+func New(ctx context.Context, opts Options) (*Storage, error) {
+	base, err := url.Parse(opts.URL)
+	if err != nil {
+		return nil, fmt.Errorf("parse webdav url: %w", err)
+	}
+	if base.Scheme != "http" && base.Scheme != "https" {
+		return nil, fmt.Errorf("webdav url must be http or https, got %q", opts.URL)
+	}
+	if !strings.HasSuffix(base.Path, "/") {
+		base.Path += "/"
+	}
+
+	s := &Storage{
+		client:   &http.Client{},
+		base:     base,
+		user:     opts.User,
+		password: opts.Password,
+	}
+
+	info, err := s.Stat(ctx, "/")
+	if err != nil {
+		return nil, fmt.Errorf("webdav connect: %w", err)
+	}
+	if !info.IsDir {
+		return nil, fmt.Errorf("webdav url %q is not a collection", opts.URL)
+	}
+	return s, nil
+}
+
+func (s *Storage) List(ctx context.Context, p string) ([]storage.FileInfo, error) {
+	name, err := cleanPath(p)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := s.propfind(ctx, name, "1")
+	if err != nil {
+		return nil, err
+	}
+
+	files := make([]storage.FileInfo, 0, len(entries))
+	for _, e := range entries {
+		if e.name == name {
+			// Depth: 1 includes the collection itself.
+			if !e.info.IsDir {
+				return nil, fmt.Errorf("list %s: not a directory", name)
+			}
+			continue
+		}
+		if storage.IsTemp(e.info.Name) {
+			continue
+		}
+		files = append(files, e.info)
+	}
+	return files, nil
+}
+
+func (s *Storage) Read(ctx context.Context, p string) (io.ReadCloser, error) {
+	name, err := cleanPath(p)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := s.do(ctx, http.MethodGet, s.url(name, false), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, statusError(http.MethodGet, name, resp)
+	}
+	return resp.Body, nil
+}
+
+// ReadRange sends a Range request. Servers that ignore Range answer 200 with
+// the whole body, in which case the leading bytes are discarded locally.
+func (s *Storage) ReadRange(ctx context.Context, p string, offset, length int64) (io.ReadCloser, error) {
+	name, err := cleanPath(p)
+	if err != nil {
+		return nil, err
+	}
+	offset = max(offset, 0)
+
+	// A zero-length HTTP range cannot be expressed; an open-ended range still
+	// confirms the file exists.
+	rng := fmt.Sprintf("bytes=%d-", offset)
+	if length > 0 {
+		rng += strconv.FormatInt(offset+length-1, 10)
+	}
+	resp, err := s.do(ctx, http.MethodGet, s.url(name, false), nil, http.Header{"Range": {rng}})
+	if err != nil {
+		return nil, err
+	}
+
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		return storage.LimitReadCloser(resp.Body, length), nil
+	case http.StatusRequestedRangeNotSatisfiable:
+		resp.Body.Close()
+		return io.NopCloser(strings.NewReader("")), nil
+	case http.StatusOK:
+		if _, err := io.CopyN(io.Discard, resp.Body, offset); err != nil && err != io.EOF {
+			resp.Body.Close()
+			return nil, err
+		}
+		return storage.LimitReadCloser(resp.Body, length), nil
+	}
+	defer resp.Body.Close()
+	return nil, statusError(http.MethodGet, name, resp)
+}
+
+// Write is WriteIf without a condition.
+func (s *Storage) Write(ctx context.Context, p string, r io.Reader) error {
+	return s.WriteIf(ctx, p, r, storage.Condition{})
+}
+
+// WriteIf creates missing parent collections with MKCOL, uploads r with a
+// single streaming PUT to a storage.TempName sibling and MOVEs that over
+// the target. The server checks cond on the MOVE: If-Match becomes an If
+// header tagged with the target's URL (RFC 4918, section 10.4) and
+// If-None-Match becomes Overwrite: F.
+func (s *Storage) WriteIf(ctx context.Context, p string, r io.Reader, cond storage.Condition) error {
+	name, err := cleanPath(p)
+	if err != nil {
+		return err
+	}
+	if name == "" {
+		return storage.ErrPermission
+	}
+
+	if dir := path.Dir(name); dir != "." {
+		if err := s.mkcolAll(ctx, dir); err != nil {
+			return err
+		}
+	}
+
+	header := http.Header{}
+	if cond.IfMatch != "" {
+		header.Set("If", fmt.Sprintf("<%s> ([%s])", s.url(name, false), cond.IfMatch))
+	}
+	if cond.IfNoneMatch {
+		header.Set("Overwrite", "F")
+	}
+
+	tmp := storage.TempName(name)
+	if err := s.put(ctx, tmp, name, r, http.Header{}); err != nil {
+		s.removeTemp(ctx, tmp)
+		return err
+	}
+	if err := s.rename(ctx, "MOVE", tmp, name, false, header); err != nil {
+		s.removeTemp(ctx, tmp)
+		return err
+	}
+	return nil
+}
+
+// DeleteIf deletes a file with If-Match, so the server refuses the DELETE
+// if the file changed since etag was read.
+func (s *Storage) DeleteIf(ctx context.Context, p, etag string) error {
+	name, err := cleanPath(p)
+	if err != nil {
+		return err
+	}
+	if name == "" {
+		return storage.ErrPermission
+	}
+
+	// A DELETE of a collection is recursive, so make sure this is a file
+	// before sending one.
+	info, err := s.Stat(ctx, name)
+	if errors.Is(err, storage.ErrNotFound) || (err == nil && info.IsDir) {
+		return fmt.Errorf("%w: entity tag does not match", storage.ErrPrecondition)
+	}
+	if err != nil {
+		return err
+	}
+
+	header := http.Header{}
+	header.Set("If-Match", etag)
+	resp, err := s.do(ctx, "DELETE", s.url(name, false), nil, header)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusNoContent:
+		return nil
+	case http.StatusNotFound:
+		return fmt.Errorf("%w: entity tag does not match", storage.ErrPrecondition)
+	}
+	return statusError("DELETE", name, resp)
+}
+
+// put streams r to name with header, typed after the extension of target.
+func (s *Storage) put(ctx context.Context, name, target string, r io.Reader, header http.Header) error {
+	if ct := mime.TypeByExtension(path.Ext(target)); ct != "" {
+		header.Set("Content-Type", ct)
+	}
+	// Hide any concrete type so net/http streams the body chunked instead
+	// of trying to rewind or size it.
+	resp, err := s.do(ctx, http.MethodPut, s.url(name, false), io.NopCloser(r), header)
+	if err != nil {
+		return fmt.Errorf("write file: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusCreated, http.StatusNoContent:
+		return nil
+	}
+	return statusError(http.MethodPut, target, resp)
+}
+
+// removeTemp deletes the temporary file of a failed Write, which servers
+// may keep with whatever arrived before the body was cut short.
+func (s *Storage) removeTemp(ctx context.Context, tmp string) {
+	if resp, err := s.do(context.WithoutCancel(ctx), "DELETE", s.url(tmp, false), nil, nil); err == nil {
+		resp.Body.Close()
+	}
+}
+
+// Delete removes a file or an empty collection. WebDAV DELETE on a
+// collection is always recursive, so non-empty collections are refused here
+// to match the other backends.
+func (s *Storage) Delete(ctx context.Context, p string) error {
+	return s.delete(ctx, p, false)
+}
+
+// DeleteAll relies on DELETE of a collection removing all of its members,
+// as RFC 4918 requires.
+func (s *Storage) DeleteAll(ctx context.Context, p string) error {
+	return s.delete(ctx, p, true)
+}
+
+func (s *Storage) delete(ctx context.Context, p string, recursive bool) error {
+	name, err := cleanPath(p)
+	if err != nil {
+		return err
+	}
+	if name == "" {
+		return storage.ErrPermission
+	}
+
+	entries, err := s.propfind(ctx, name, "1")
+	if err != nil {
+		return err
+	}
+	isDir := false
+	for _, e := range entries {
+		if e.name != name && !recursive {
+			return fmt.Errorf("delete %s: %w", name, storage.ErrNotEmpty)
+		}
+		if e.name == name {
+			isDir = e.info.IsDir
+		}
+	}
+
+	resp, err := s.do(ctx, "DELETE", s.url(name, isDir), nil, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusNoContent:
+		return nil
+	}
+	return statusError("DELETE", name, resp)
+}
+
+func (s *Storage) Mkdir(ctx context.Context, p string) error {
+	name, err := cleanPath(p)
+	if err != nil {
+		return err
+	}
+	if name == "" {
+		return storage.ErrPermission
+	}
+
+	if _, err := s.propfind(ctx, name, "0"); err == nil {
+		return fmt.Errorf("mkdir %s: %w", name, storage.ErrExist)
+	} else if !errors.Is(err, storage.ErrNotFound) {
+		return err
+	}
+	return s.mkcolAll(ctx, name)
+}
+
+// Move renames with the WebDAV MOVE method, which servers implement as a
+// rename for files and whole collections alike.
+func (s *Storage) Move(ctx context.Context, from, to string) error {
+	return s.transfer(ctx, "MOVE", from, to)
+}
+
+// Copy duplicates with the WebDAV COPY method. Collections are copied with
+// Depth: infinity, the default.
+func (s *Storage) Copy(ctx context.Context, from, to string) error {
+	return s.transfer(ctx, "COPY", from, to)
+}
+
+func (s *Storage) transfer(ctx context.Context, method, from, to string) error {
+	src, err := cleanPath(from)
+	if err != nil {
+		return err
+	}
+	dst, err := cleanPath(to)
+	if err != nil {
+		return err
+	}
+	if src == "" || dst == "" {
+		return storage.ErrPermission
+	}
+
+	entries, err := s.propfind(ctx, src, "0")
+	if err != nil {
+		return err
+	}
+	isDir := len(entries) > 0 && entries[0].info.IsDir
+
+	if dir := path.Dir(dst); dir != "." {
+		if err := s.mkcolAll(ctx, dir); err != nil {
+			return err
+		}
+	}
+	return s.rename(ctx, method, src, dst, isDir, http.Header{})
+}
+
+// rename sends a MOVE or COPY of src to dst with header, replacing an
+// existing dst unless header sets Overwrite: F.
+func (s *Storage) rename(ctx context.Context, method, src, dst string, isDir bool, header http.Header) error {
+	header.Set("Destination", s.url(dst, isDir))
+	if header.Get("Overwrite") == "" {
+		header.Set("Overwrite", "T")
+	}
+	resp, err := s.do(ctx, method, s.url(src, isDir), nil, header)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusCreated, http.StatusNoContent:
+		return nil
+	}
+	return statusError(method, src, resp)
+}
+
+func (s *Storage) Stat(ctx context.Context, p string) (*storage.FileInfo, error) {
+	name, err := cleanPath(p)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := s.propfind(ctx, name, "0")
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		if e.name == name {
+			return &e.info, nil
+		}
+	}
+	return nil, storage.ErrNotFound
+}
+
+// mkcolAll creates dir and any missing ancestors, top-down. A 405 reply
+// means the collection already exists.
+func (s *Storage) mkcolAll(ctx context.Context, dir string) error {
+	parts := strings.Split(dir, "/")
+	for i := range parts {
+		name := strings.Join(parts[:i+1], "/")
+		resp, err := s.do(ctx, "MKCOL", s.url(name, true), nil, nil)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+
+		switch resp.StatusCode {
+		case http.StatusCreated, http.StatusMethodNotAllowed:
+			continue
+		}
+		return statusError("MKCOL", name, resp)
+	}
+	return nil
+}
+
+// entry is one PROPFIND response mapped to a FileInfo. name is the cleaned
+// path relative to the base collection.
+type entry struct {
+	name string
+	info storage.FileInfo
+}
+
+func (s *Storage) propfind(ctx context.Context, name, depth string) ([]entry, error) {
+	header := http.Header{}
+	header.Set("Depth", depth)
+	header.Set("Content-Type", "application/xml; charset=utf-8")
+
+	resp, err := s.do(ctx, "PROPFIND", s.url(name, false), strings.NewReader(propfindBody), header)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusMultiStatus {
+		return nil, statusError("PROPFIND", name, resp)
+	}
+
+	var ms multistatus
+	if err := xml.NewDecoder(resp.Body).Decode(&ms); err != nil {
+		return nil, fmt.Errorf("decode propfind response: %w", err)
+	}
+
+	entries := make([]entry, 0, len(ms.Responses))
+	for _, r := range ms.Responses {
+		rel, err := s.relative(r.Href)
+		if err != nil {
+			return nil, err
+		}
+		prop, ok := r.okProp()
+		if !ok {
+			continue
+		}
+		info := storage.FileInfo{
+			Name:  path.Base(rel),
+			Path:  rel,
+			Size:  prop.ContentLength,
+			IsDir: prop.ResourceType.Collection != nil,
+		}
+		if rel == "" {
+			info.Name = "/"
+		}
+		if t, err := http.ParseTime(prop.LastModified); err == nil {
+			info.ModTime = t
+		}
+		if !info.IsDir {
+			info.ETag = prop.ETag
+			info.ContentType = prop.ContentType
+		}
+		entries = append(entries, entry{name: rel, info: info})
+	}
+	return entries, nil
+}
+
+func (s *Storage) do(ctx context.Context, method, target string, body io.Reader, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, target, body)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if s.user != "" {
+		req.SetBasicAuth(s.user, s.password)
+	}
+	return s.client.Do(req)
+}
+
+// url returns the absolute URL for a cleaned path. Collections get a
+// trailing slash, which many servers require for MKCOL and DELETE.
+func (s *Storage) url(name string, collection bool) string {
+	u := *s.base
+	u.RawPath = ""
+	u.Path += name
+	if collection && !strings.HasSuffix(u.Path, "/") {
+		u.Path += "/"
+	}
+	return u.String()
+}
+
+// relative maps an href from a multistatus response back to a path relative
+// to the base collection. Servers may send absolute URLs or absolute paths,
+// percent-encoded or not.
+func (s *Storage) relative(href string) (string, error) {
+	u, err := url.Parse(href)
+	if err != nil {
+		return "", fmt.Errorf("parse href %q: %w", href, err)
+	}
+	rel, ok := strings.CutPrefix(u.Path, s.base.Path)
+	if !ok {
+		rel, ok = strings.CutPrefix(u.Path+"/", s.base.Path)
+	}
+	if !ok {
+		return "", fmt.Errorf("href %q is outside %s", href, s.base.Path)
+	}
+	return strings.Trim(rel, "/"), nil
+}
+
+// cleanPath converts an API path into a path relative to the base
+// collection, for url to append.
+func cleanPath(p string) (string, error) {
+	if strings.Contains(p, "..") {
+		return "", storage.ErrPermission
+	}
+	return strings.TrimPrefix(path.Clean("/"+p), "/"), nil
+}
+
+// statusError converts an unexpected HTTP status to a storage error.
+func statusError(method, name string, resp *http.Response) error {
+	switch resp.StatusCode {
+	case http.StatusNotFound, http.StatusGone:
+		return storage.ErrNotFound
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return storage.ErrPermission
+	case http.StatusConflict:
+		// RFC 4918: a missing intermediate collection.
+		return storage.ErrNotFound
+	case http.StatusPreconditionFailed:
+		return fmt.Errorf("%w: %s %s", storage.ErrPrecondition, method, name)
+	}
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	return fmt.Errorf("%s %s: %s: %s", method, name, resp.Status, bytes.TrimSpace(msg))
+}
+
+type multistatus struct {
+	Responses []response `xml:"DAV: response"`
+}
+
+type response struct {
+	Href      string     `xml:"DAV: href"`
+	Propstats []propstat `xml:"DAV: propstat"`
+}
+
+type propstat struct {
+	Prop   prop   `xml:"DAV: prop"`
+	Status string `xml:"DAV: status"`
+}
+
+type prop struct {
+	ResourceType struct {
+		Collection *struct{} `xml:"DAV: collection"`
+	} `xml:"DAV: resourcetype"`
+	ContentLength int64  `xml:"DAV: getcontentlength"`
+	LastModified  string `xml:"DAV: getlastmodified"`
+	ETag          string `xml:"DAV: getetag"`
+	ContentType   string `xml:"DAV: getcontenttype"`
+}
+
+// okProp returns the properties from the 200 propstat. Properties the
+// server does not have are reported in a separate 404 propstat.
+func (r response) okProp() (prop, bool) {
+	for _, ps := range r.Propstats {
+		if strings.Contains(ps.Status, " 200 ") {
+			return ps.Prop, true
+		}
+	}
+	return prop{}, false
+}
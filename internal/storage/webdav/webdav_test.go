@@ -0,0 +1,374 @@
+package webdav
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+
+	"golang.org/x/net/webdav"
+
+	"go-storage-api/internal/storage"
+	"go-storage-api/internal/storage/storagetest"
+)
+
+// davPrefix mimics servers such as Nextcloud that mount the user's files
+// below a fixed path.
+const davPrefix = "/remote.php/dav/files/alice"
+
+// testServer is an httptest WebDAV server backed by a temp directory. It
+// requires basic auth, records the methods it receives and checks If-Match,
+// If-None-Match and entity tags in If headers, which x/net/webdav ignores.
+type testServer struct {
+	*httptest.Server
+	root string
+
+	mu      sync.Mutex
+	methods []string
+
+	// writeMu serializes changes, so a precondition holds until the change
+	// it guards is done.
+	writeMu sync.Mutex
+}
+
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+
+	srv := &testServer{root: t.TempDir()}
+	dav := &webdav.Handler{
+		Prefix:     davPrefix,
+		FileSystem: webdav.Dir(srv.root),
+		LockSystem: webdav.NewMemLS(),
+	}
+	srv.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, ok := r.BasicAuth()
+		if !ok || user != "alice" || pass != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		srv.mu.Lock()
+		srv.methods = append(srv.methods, r.Method)
+		srv.mu.Unlock()
+
+		if r.Method != http.MethodGet && r.Method != http.MethodHead && r.Method != "PROPFIND" {
+			srv.writeMu.Lock()
+			defer srv.writeMu.Unlock()
+			if !srv.preconditions(r) {
+				w.WriteHeader(http.StatusPreconditionFailed)
+				return
+			}
+		}
+		dav.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// ifTag matches an If header with a single tagged entity tag, the only
+// form the client sends.
+var ifTag = regexp.MustCompile(`^<([^>]+)> \(\[([^\]]+)\]\)$`)
+
+// preconditions reports whether the If-Match, If-None-Match and If headers
+// of r hold, using the entity tags x/net/webdav reports in PROPFIND. It
+// removes an If header it checked, since x/net/webdav would look for lock
+// tokens in it.
+func (srv *testServer) preconditions(r *http.Request) bool {
+	if h := r.Header.Get("If"); h != "" {
+		m := ifTag.FindStringSubmatch(h)
+		if m == nil {
+			return false
+		}
+		u, err := url.Parse(m[1])
+		if err != nil || srv.etag(u.Path) != m[2] {
+			return false
+		}
+		r.Header.Del("If")
+	}
+
+	ifMatch, ifNoneMatch := r.Header.Get("If-Match"), r.Header.Get("If-None-Match")
+	etag := srv.etag(r.URL.Path)
+	if ifNoneMatch == "*" && etag != "" {
+		return false
+	}
+	if ifMatch != "" {
+		return etag != "" && (ifMatch == "*" || ifMatch == etag)
+	}
+	return true
+}
+
+// etag returns the entity tag of the file at the URL path p, or "" if
+// there is none.
+func (srv *testServer) etag(p string) string {
+	fi, err := os.Stat(filepath.Join(srv.root, filepath.FromSlash(strings.TrimPrefix(p, davPrefix))))
+	if err != nil {
+		return ""
+	}
+	return fmt.Sprintf(`"%x%x"`, fi.ModTime().UnixNano(), fi.Size())
+}
+
+func (srv *testServer) count(method string) int {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	n := 0
+	for _, m := range srv.methods {
+		if m == method {
+			n++
+		}
+	}
+	return n
+}
+
+func newTestStorage(t *testing.T) (*Storage, *testServer) {
+	t.Helper()
+	srv := newTestServer(t)
+	s, err := New(context.Background(), Options{
+		URL:      srv.URL + davPrefix,
+		User:     "alice",
+		Password: "secret",
+	})
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+	return s, srv
+}
+
+func TestNew_BadCredentials(t *testing.T) {
+	srv := newTestServer(t)
+
+	_, err := New(context.Background(), Options{URL: srv.URL + davPrefix, User: "alice", Password: "wrong"})
+	if !errors.Is(err, storage.ErrPermission) {
+		t.Errorf("expected ErrPermission, got %v", err)
+	}
+}
+
+func TestNew_InvalidURL(t *testing.T) {
+	if _, err := New(context.Background(), Options{URL: "ftp://example.com/"}); err == nil {
+		t.Error("expected error for non-http URL")
+	}
+}
+
+// --- List ---
+
+func TestList(t *testing.T) {
+	s, srv := newTestStorage(t)
+	os.MkdirAll(filepath.Join(srv.root, "docs", "sub"), 0o755)
+	os.WriteFile(filepath.Join(srv.root, "docs", "readme.md"), []byte("hi"), 0o644)
+	os.WriteFile(filepath.Join(srv.root, "docs", "with space.txt"), []byte("x"), 0o644)
+
+	files, err := s.List(context.Background(), "/docs")
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(files) != 3 {
+		t.Fatalf("expected 3 entries, got %d: %+v", len(files), files)
+	}
+
+	byName := map[string]storage.FileInfo{}
+	for _, f := range files {
+		byName[f.Name] = f
+	}
+	if f := byName["readme.md"]; f.Path != "docs/readme.md" || f.Size != 2 || f.IsDir || f.ModTime.IsZero() {
+		t.Errorf("unexpected readme.md entry: %+v", f)
+	}
+	if f := byName["with space.txt"]; f.Path != "docs/with space.txt" {
+		t.Errorf("unexpected entry for escaped name: %+v", f)
+	}
+	if !byName["sub"].IsDir {
+		t.Error("expected sub to be a directory")
+	}
+}
+
+func TestList_Root(t *testing.T) {
+	s, srv := newTestStorage(t)
+	os.WriteFile(filepath.Join(srv.root, "a.txt"), []byte("a"), 0o644)
+
+	files, err := s.List(context.Background(), "/")
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(files) != 1 || files[0].Path != "a.txt" {
+		t.Errorf("unexpected root listing: %+v", files)
+	}
+}
+
+func TestList_NotFound(t *testing.T) {
+	s, _ := newTestStorage(t)
+
+	_, err := s.List(context.Background(), "nonexistent")
+	if !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+// --- Read / Write ---
+
+func TestWriteThenRead(t *testing.T) {
+	s, srv := newTestStorage(t)
+	ctx := context.Background()
+
+	if err := s.Write(ctx, "deep/nested/file.txt", strings.NewReader("content")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(srv.root, "deep", "nested", "file.txt")); err != nil {
+		t.Fatalf("file not on server: %v", err)
+	}
+	if got := srv.count("MKCOL"); got != 2 {
+		t.Errorf("expected 2 MKCOL requests, got %d", got)
+	}
+
+	// Parents now exist; MKCOL answers 405 and the write still succeeds.
+	if err := s.Write(ctx, "deep/nested/file.txt", strings.NewReader("new")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	rc, err := s.Read(ctx, "deep/nested/file.txt")
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	defer rc.Close()
+	data, _ := io.ReadAll(rc)
+	if string(data) != "new" {
+		t.Errorf("expected %q, got %q", "new", string(data))
+	}
+}
+
+func TestRead_NotFound(t *testing.T) {
+	s, _ := newTestStorage(t)
+
+	_, err := s.Read(context.Background(), "missing.txt")
+	if !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+// --- Delete ---
+
+func TestDelete_FileAndEmptyDir(t *testing.T) {
+	s, srv := newTestStorage(t)
+	ctx := context.Background()
+	os.WriteFile(filepath.Join(srv.root, "doomed.txt"), []byte("bye"), 0o644)
+	os.Mkdir(filepath.Join(srv.root, "empty"), 0o755)
+
+	if err := s.Delete(ctx, "doomed.txt"); err != nil {
+		t.Fatalf("Delete file: %v", err)
+	}
+	if err := s.Delete(ctx, "empty"); err != nil {
+		t.Fatalf("Delete dir: %v", err)
+	}
+	if err := s.Delete(ctx, "doomed.txt"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestDelete_NonEmptyDir(t *testing.T) {
+	s, srv := newTestStorage(t)
+	os.MkdirAll(filepath.Join(srv.root, "full"), 0o755)
+	os.WriteFile(filepath.Join(srv.root, "full", "keep.txt"), []byte("x"), 0o644)
+
+	if err := s.Delete(context.Background(), "full"); err == nil {
+		t.Fatal("expected error deleting non-empty directory")
+	}
+	if _, err := os.Stat(filepath.Join(srv.root, "full", "keep.txt")); err != nil {
+		t.Errorf("directory contents were removed: %v", err)
+	}
+}
+
+// --- Stat ---
+
+func TestStat(t *testing.T) {
+	s, srv := newTestStorage(t)
+	ctx := context.Background()
+	os.Mkdir(filepath.Join(srv.root, "mydir"), 0o755)
+	os.WriteFile(filepath.Join(srv.root, "mydir", "info.txt"), []byte("12345"), 0o644)
+
+	fi, err := s.Stat(ctx, "mydir/info.txt")
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+	if fi.Name != "info.txt" || fi.Path != "mydir/info.txt" || fi.Size != 5 || fi.IsDir {
+		t.Errorf("unexpected FileInfo: %+v", fi)
+	}
+	if fi.ETag == "" || !strings.HasPrefix(fi.ContentType, "text/plain") {
+		t.Errorf("expected ETag and ContentType from PROPFIND, got %+v", fi)
+	}
+
+	fi, err = s.Stat(ctx, "mydir")
+	if err != nil {
+		t.Fatalf("Stat dir: %v", err)
+	}
+	if !fi.IsDir || fi.Path != "mydir" {
+		t.Errorf("unexpected FileInfo: %+v", fi)
+	}
+
+	if _, err := s.Stat(ctx, "nope.txt"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+// --- Paths ---
+
+func TestRelative(t *testing.T) {
+	s, _ := newTestStorage(t)
+	base := davPrefix + "/"
+
+	tests := []struct {
+		href string
+		want string
+	}{
+		{base, ""},
+		{davPrefix, ""},
+		{base + "docs/", "docs"},
+		{base + "docs/a%20b.txt", "docs/a b.txt"},
+		{"https://other.example.com" + base + "docs/x.txt", "docs/x.txt"},
+	}
+	for _, tt := range tests {
+		got, err := s.relative(tt.href)
+		if err != nil {
+			t.Errorf("relative(%q): unexpected error: %v", tt.href, err)
+		}
+		if got != tt.want {
+			t.Errorf("relative(%q) = %q, want %q", tt.href, got, tt.want)
+		}
+	}
+
+	if _, err := s.relative("/elsewhere/file.txt"); err == nil {
+		t.Error("expected error for href outside the base collection")
+	}
+}
+
+func TestCleanPath_BlocksTraversal(t *testing.T) {
+	for _, p := range []string{"../etc/passwd", "/../../etc/passwd", "subdir/../../etc"} {
+		if _, err := cleanPath(p); !errors.Is(err, storage.ErrPermission) {
+			t.Errorf("cleanPath(%q): expected ErrPermission, got %v", p, err)
+		}
+	}
+}
+
+// --- Conformance ---
+
+func TestConformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Storage {
+		s, _ := newTestStorage(t)
+		return s
+	})
+}
+
+// --- Interface compliance ---
+
+var (
+	_ storage.Storage           = (*Storage)(nil)
+	_ storage.RangeReader       = (*Storage)(nil)
+	_ storage.Mover             = (*Storage)(nil)
+	_ storage.Copier            = (*Storage)(nil)
+	_ storage.TreeDeleter       = (*Storage)(nil)
+	_ storage.ConditionalWriter = (*Storage)(nil)
+)
@@ -0,0 +1,296 @@
+package upload
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+
+	"go-storage-api/internal/storage"
+)
+
+// CreateSession starts a multipart session to path whose parts may add up
+// to at most maxSize bytes. If dst implements storage.MultipartUploader the
+// session maps to a native upload there and parts are passed straight
+// through; otherwise parts are staged in the store and assembled on
+// completion.
+func (s *Store) CreateSession(ctx context.Context, dst storage.Storage, path string, maxSize int64) (*Info, error) {
+	if maxSize <= 0 {
+		return nil, fmt.Errorf("%w: session size limit must be positive", storage.ErrInvalid)
+	}
+	id, err := newID()
+	if err != nil {
+		return nil, err
+	}
+
+	release, err := s.lock(id)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	info := &Info{ID: id, Path: path, Size: maxSize, Kind: KindSession, Expires: s.now().Add(s.expiry)}
+	mu, native := dst.(storage.MultipartUploader)
+	if native {
+		if info.BackendID, err = mu.CreateMultipart(ctx, path); err != nil {
+			return nil, err
+		}
+	}
+
+	// As for Create, the info file goes first so that Sweep finds, and
+	// aborts, anything left behind by a crash.
+	err = s.save(info)
+	if err == nil {
+		if err = os.Mkdir(s.partsPath(id), 0o700); err != nil {
+			err = fmt.Errorf("create upload: %w", err)
+		}
+	}
+	if err != nil {
+		if native {
+			mu.AbortMultipart(context.WithoutCancel(ctx), path, info.BackendID)
+		}
+		s.remove(id)
+		return nil, err
+	}
+	return info, nil
+}
+
+// PutPart stores part n, between 1 and storage.MaxParts, of a session. size
+// is the exact length of r. Parts of one session may be uploaded in
+// parallel, and uploading a part number again replaces the earlier part.
+// A part that would take the session past its size limit fails with
+// ErrTooLarge before anything is stored.
+func (s *Store) PutPart(ctx context.Context, dst storage.Storage, id string, n int, r io.Reader, size int64) error {
+	release, err := s.share(id)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	if n < 1 || n > storage.MaxParts {
+		return fmt.Errorf("part %d: %w", n, storage.ErrInvalid)
+	}
+	// Until the upload succeeds either the earlier part or the new one may
+	// end up stored, so the larger of the two is counted meanwhile.
+	var info *Info
+	err = s.updateParts(id, func(i *Info) error {
+		counted := max(size, i.Parts[n])
+		if partsTotal(i.Parts)-i.Parts[n]+counted > i.Size {
+			return fmt.Errorf("upload %s: %w", id, ErrTooLarge)
+		}
+		i.Parts[n] = counted
+		info = i
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if info.BackendID != "" {
+		mu, ok := dst.(storage.MultipartUploader)
+		if !ok {
+			return fmt.Errorf("upload %s: backend does not support multipart uploads", id)
+		}
+		err = mu.UploadPart(ctx, info.Path, info.BackendID, n, r, size)
+	} else {
+		err = s.stagePart(id, n, r)
+	}
+	if err != nil {
+		return err
+	}
+
+	return s.updateParts(id, func(i *Info) error {
+		i.Parts[n] = size
+		i.Expires = s.now().Add(s.expiry)
+		return nil
+	})
+}
+
+// updateParts applies fn to the current info of a session and saves it, one
+// caller at a time, so parallel part uploads never lose each other's
+// changes. Nothing is saved if fn fails.
+func (s *Store) updateParts(id string, fn func(*Info) error) error {
+	s.partsMu.Lock()
+	defer s.partsMu.Unlock()
+
+	info, err := s.get(id, KindSession)
+	if err != nil {
+		return err
+	}
+	if info.Parts == nil {
+		info.Parts = map[int]int64{}
+	}
+	if err := fn(info); err != nil {
+		return err
+	}
+	return s.save(info)
+}
+
+// partsTotal adds up the part sizes of a session.
+func partsTotal(parts map[int]int64) int64 {
+	var total int64
+	for _, size := range parts {
+		total += size
+	}
+	return total
+}
+
+// stagePart writes a part through a temporary file and rename, so a part
+// that fails half way is never assembled.
+func (s *Store) stagePart(id string, n int, r io.Reader) error {
+	f, err := os.CreateTemp(s.partsPath(id), "*.tmp")
+	if err != nil {
+		return fmt.Errorf("stage part %d: %w", n, err)
+	}
+	_, err = io.Copy(f, r)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), filepath.Join(s.partsPath(id), strconv.Itoa(n)))
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return fmt.Errorf("stage part %d: %w", n, err)
+	}
+	return nil
+}
+
+// CompleteSession writes the uploaded parts, in ascending part order, to
+// the session's path in dst and removes the session. A failed completion
+// leaves the session in place so it can be retried. A session without
+// parts fails with storage.ErrInvalid, and one whose parts add up to more
+// than its size limit with ErrTooLarge.
+func (s *Store) CompleteSession(ctx context.Context, dst storage.Storage, id string) error {
+	release, err := s.lock(id)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	info, err := s.get(id, KindSession)
+	if err != nil {
+		return err
+	}
+	if partsTotal(info.Parts) > info.Size {
+		return fmt.Errorf("complete upload %s: %w", id, ErrTooLarge)
+	}
+
+	if info.BackendID != "" {
+		mu, ok := dst.(storage.MultipartUploader)
+		if !ok {
+			return fmt.Errorf("upload %s: backend does not support multipart uploads", id)
+		}
+		err = mu.CompleteMultipart(ctx, info.Path, info.BackendID)
+	} else {
+		err = s.assemble(ctx, dst, info)
+	}
+	if err != nil {
+		return err
+	}
+	s.remove(id)
+	return nil
+}
+
+// assemble writes the staged parts of a session to dst as one file.
+func (s *Store) assemble(ctx context.Context, dst storage.Storage, info *Info) error {
+	entries, err := os.ReadDir(s.partsPath(info.ID))
+	if err != nil {
+		return fmt.Errorf("read upload %s: %w", info.ID, err)
+	}
+	var parts []int
+	var total int64
+	for _, e := range entries {
+		n, err := strconv.Atoi(e.Name())
+		if err != nil {
+			continue
+		}
+		fi, err := e.Info()
+		if err != nil {
+			return fmt.Errorf("read upload %s: %w", info.ID, err)
+		}
+		parts = append(parts, n)
+		total += fi.Size()
+	}
+	if len(parts) == 0 {
+		return fmt.Errorf("complete upload %s: no parts uploaded: %w", info.ID, storage.ErrInvalid)
+	}
+	if total > info.Size {
+		return fmt.Errorf("complete upload %s: %w", info.ID, ErrTooLarge)
+	}
+	sort.Ints(parts)
+
+	r := &partsReader{dir: s.partsPath(info.ID), parts: parts}
+	defer r.Close()
+	return dst.Write(ctx, info.Path, r)
+}
+
+// AbortSession ends a session and discards its parts.
+func (s *Store) AbortSession(ctx context.Context, dst storage.Storage, id string) error {
+	release, err := s.lock(id)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	info, err := s.get(id, KindSession)
+	if err != nil {
+		return err
+	}
+	if mu, ok := dst.(storage.MultipartUploader); ok && info.BackendID != "" {
+		err := mu.AbortMultipart(ctx, info.Path, info.BackendID)
+		if err != nil && !errors.Is(err, storage.ErrNotFound) {
+			return err
+		}
+	}
+	s.remove(id)
+	return nil
+}
+
+// partsReader reads staged parts one after the other, opening each only
+// when the previous one is exhausted, so a session with thousands of parts
+// holds a single file open.
+type partsReader struct {
+	dir   string
+	parts []int
+	cur   *os.File
+}
+
+func (r *partsReader) Read(p []byte) (int, error) {
+	for {
+		if r.cur == nil {
+			if len(r.parts) == 0 {
+				return 0, io.EOF
+			}
+			f, err := os.Open(filepath.Join(r.dir, strconv.Itoa(r.parts[0])))
+			if err != nil {
+				return 0, err
+			}
+			r.cur, r.parts = f, r.parts[1:]
+		}
+		n, err := r.cur.Read(p)
+		if err == io.EOF {
+			r.cur.Close()
+			r.cur = nil
+			if n == 0 {
+				continue
+			}
+			err = nil
+		}
+		return n, err
+	}
+}
+
+func (r *partsReader) Close() error {
+	if r.cur != nil {
+		return r.cur.Close()
+	}
+	return nil
+}
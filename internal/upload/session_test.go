@@ -0,0 +1,330 @@
+package upload
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"go-storage-api/internal/storage"
+	"go-storage-api/internal/storage/local"
+	"go-storage-api/internal/storage/memory"
+)
+
+// testSessionSize is the size limit of the sessions tests create.
+const testSessionSize = 1 << 20
+
+func readAll(t *testing.T, s storage.Storage, path string) string {
+	t.Helper()
+	rc, err := s.Read(context.Background(), path)
+	if err != nil {
+		t.Fatalf("Read %s: %v", path, err)
+	}
+	defer rc.Close()
+	data, _ := io.ReadAll(rc)
+	return string(data)
+}
+
+func putPart(t *testing.T, s *Store, dst storage.Storage, id string, n int, data string) {
+	t.Helper()
+	if err := s.PutPart(context.Background(), dst, id, n, strings.NewReader(data), int64(len(data))); err != nil {
+		t.Fatalf("PutPart %d: %v", n, err)
+	}
+}
+
+// --- Staged sessions ---
+
+func TestSession_Staged(t *testing.T) {
+	s := newTestStore(t)
+	dst := memory.New()
+	ctx := context.Background()
+
+	info, err := s.CreateSession(ctx, dst, "docs/a.txt", testSessionSize)
+	if err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+	if info.Kind != KindSession || info.BackendID != "" {
+		t.Errorf("CreateSession = %+v, want a staged session", info)
+	}
+
+	var wg sync.WaitGroup
+	for n := 1; n <= 10; n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			data := fmt.Sprintf("%d,", n)
+			if err := s.PutPart(ctx, dst, info.ID, n, strings.NewReader(data), int64(len(data))); err != nil {
+				t.Errorf("PutPart %d: %v", n, err)
+			}
+		}()
+	}
+	wg.Wait()
+	putPart(t, s, dst, info.ID, 2, "two,")
+
+	if _, err := dst.Stat(ctx, "docs/a.txt"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("Stat before completion error = %v, want ErrNotFound", err)
+	}
+	if err := s.CompleteSession(ctx, dst, info.ID); err != nil {
+		t.Fatalf("CompleteSession: %v", err)
+	}
+	if got, want := readAll(t, dst, "docs/a.txt"), "1,two,3,4,5,6,7,8,9,10,"; got != want {
+		t.Errorf("assembled %q, want %q", got, want)
+	}
+	if _, err := s.Get(info.ID); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("Get after completion error = %v, want ErrNotFound", err)
+	}
+	if entries, _ := os.ReadDir(s.dir); len(entries) != 0 {
+		t.Errorf("upload directory holds %d entries after completion", len(entries))
+	}
+}
+
+func TestSession_Errors(t *testing.T) {
+	s := newTestStore(t)
+	dst := memory.New()
+	ctx := context.Background()
+
+	info, _ := s.CreateSession(ctx, dst, "taken", testSessionSize)
+	for _, n := range []int{0, storage.MaxParts + 1} {
+		if err := s.PutPart(ctx, dst, info.ID, n, strings.NewReader("x"), 1); !errors.Is(err, storage.ErrInvalid) {
+			t.Errorf("PutPart part %d error = %v, want ErrInvalid", n, err)
+		}
+	}
+	if err := s.CompleteSession(ctx, dst, info.ID); !errors.Is(err, storage.ErrInvalid) {
+		t.Errorf("CompleteSession without parts error = %v, want ErrInvalid", err)
+	}
+
+	// A failed completion keeps the session for a retry.
+	dst.Mkdir(ctx, "taken")
+	putPart(t, s, dst, info.ID, 1, "abc")
+	if err := s.CompleteSession(ctx, dst, info.ID); err == nil {
+		t.Fatal("CompleteSession onto a directory succeeded")
+	}
+	if _, err := s.Get(info.ID); err != nil {
+		t.Errorf("Get after failed completion: %v", err)
+	}
+
+	if err := s.AbortSession(ctx, dst, info.ID); err != nil {
+		t.Fatalf("AbortSession: %v", err)
+	}
+	if err := s.PutPart(ctx, dst, info.ID, 1, strings.NewReader("x"), 1); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("PutPart after abort error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestSession_SizeLimit(t *testing.T) {
+	for _, native := range []bool{false, true} {
+		t.Run(fmt.Sprintf("native=%v", native), func(t *testing.T) {
+			s := newTestStore(t)
+			var dst storage.Storage = memory.New()
+			if native {
+				dst, _ = newNativeBackend(t)
+			}
+			ctx := context.Background()
+
+			info, err := s.CreateSession(ctx, dst, "a.txt", 10)
+			if err != nil {
+				t.Fatalf("CreateSession: %v", err)
+			}
+			putPart(t, s, dst, info.ID, 1, "12345")
+			if err := s.PutPart(ctx, dst, info.ID, 2, strings.NewReader("123456"), 6); !errors.Is(err, ErrTooLarge) {
+				t.Errorf("PutPart past the limit error = %v, want ErrTooLarge", err)
+			}
+
+			// A replaced part no longer counts, unless its upload failed: then
+			// the larger of the two parts may be the one stored.
+			putPart(t, s, dst, info.ID, 1, "1")
+			failing := io.MultiReader(strings.NewReader("1234"), iotest.ErrReader(errors.New("connection dropped")))
+			if err := s.PutPart(ctx, dst, info.ID, 1, failing, 9); err == nil {
+				t.Fatal("PutPart with a failing reader succeeded")
+			}
+			if err := s.PutPart(ctx, dst, info.ID, 2, strings.NewReader("12345"), 5); !errors.Is(err, ErrTooLarge) {
+				t.Errorf("PutPart after a failed larger part error = %v, want ErrTooLarge", err)
+			}
+			putPart(t, s, dst, info.ID, 1, "1")
+			putPart(t, s, dst, info.ID, 2, "123456789")
+
+			if err := s.CompleteSession(ctx, dst, info.ID); err != nil {
+				t.Fatalf("CompleteSession: %v", err)
+			}
+			if got := readAll(t, dst, "a.txt"); got != "1123456789" {
+				t.Errorf("assembled %q, want %q", got, "1123456789")
+			}
+		})
+	}
+}
+
+func TestSession_SizeLimitOnCompletion(t *testing.T) {
+	s := newTestStore(t)
+	dst := memory.New()
+	ctx := context.Background()
+
+	info, _ := s.CreateSession(ctx, dst, "a.txt", 10)
+	putPart(t, s, dst, info.ID, 1, "12345")
+
+	// A limit lowered since the parts were uploaded is enforced again.
+	info, _ = s.Get(info.ID)
+	info.Size = 4
+	if err := s.save(info); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.CompleteSession(ctx, dst, info.ID); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("CompleteSession past the limit error = %v, want ErrTooLarge", err)
+	}
+	if _, err := dst.Stat(ctx, "a.txt"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("Stat after refused completion error = %v, want ErrNotFound", err)
+	}
+
+	if _, err := s.CreateSession(ctx, dst, "b.txt", 0); !errors.Is(err, storage.ErrInvalid) {
+		t.Errorf("CreateSession without a limit error = %v, want ErrInvalid", err)
+	}
+}
+
+func TestSession_WrongKind(t *testing.T) {
+	s := newTestStore(t)
+	dst := memory.New()
+	ctx := context.Background()
+
+	tus, _ := s.Create("a.txt", 1, nil)
+	session, _ := s.CreateSession(ctx, dst, "b.txt", testSessionSize)
+
+	checks := map[string]error{
+		"PutPart to tus upload":    s.PutPart(ctx, dst, tus.ID, 1, strings.NewReader("x"), 1),
+		"CompleteSession of tus":   s.CompleteSession(ctx, dst, tus.ID),
+		"AbortSession of tus":      s.AbortSession(ctx, dst, tus.ID),
+		"Commit of session":        s.Commit(ctx, session.ID, dst),
+		"Remove of session":        s.Remove(session.ID),
+		"Append to session upload": func() error { _, err := s.Append(session.ID, 0, strings.NewReader("x")); return err }(),
+	}
+	for name, err := range checks {
+		if !errors.Is(err, storage.ErrNotFound) {
+			t.Errorf("%s error = %v, want ErrNotFound", name, err)
+		}
+	}
+}
+
+func TestSession_Locking(t *testing.T) {
+	s := newTestStore(t)
+	dst := memory.New()
+	ctx := context.Background()
+	info, _ := s.CreateSession(ctx, dst, "a.txt", testSessionSize)
+
+	pr, pw := io.Pipe()
+	done := make(chan error, 1)
+	go func() { done <- s.PutPart(ctx, dst, info.ID, 1, pr, 3) }()
+	pw.Write([]byte("abc")) // returns once the part upload is reading
+
+	// Other parts may be uploaded at the same time; completing or aborting
+	// must wait.
+	putPart(t, s, dst, info.ID, 2, "def")
+	if err := s.CompleteSession(ctx, dst, info.ID); !errors.Is(err, ErrLocked) {
+		t.Errorf("CompleteSession during PutPart error = %v, want ErrLocked", err)
+	}
+	if err := s.AbortSession(ctx, dst, info.ID); !errors.Is(err, ErrLocked) {
+		t.Errorf("AbortSession during PutPart error = %v, want ErrLocked", err)
+	}
+
+	pw.Close()
+	if err := <-done; err != nil {
+		t.Fatalf("PutPart: %v", err)
+	}
+	if err := s.CompleteSession(ctx, dst, info.ID); err != nil {
+		t.Fatalf("CompleteSession: %v", err)
+	}
+	if got := readAll(t, dst, "a.txt"); got != "abcdef" {
+		t.Errorf("assembled %q, want %q", got, "abcdef")
+	}
+}
+
+// --- Native sessions ---
+
+func newNativeBackend(t *testing.T) (*local.Storage, string) {
+	t.Helper()
+	root := t.TempDir()
+	dst, err := local.New(root)
+	if err != nil {
+		t.Fatalf("local.New: %v", err)
+	}
+	return dst, root
+}
+
+// backendParts returns the number of multipart uploads open in a local
+// backend rooted at root.
+func backendParts(t *testing.T, root string) int {
+	t.Helper()
+	entries, err := os.ReadDir(filepath.Join(root, ".~upload-parts"))
+	if errors.Is(err, os.ErrNotExist) {
+		return 0
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(entries)
+}
+
+func TestSession_Native(t *testing.T) {
+	s := newTestStore(t)
+	dst, root := newNativeBackend(t)
+	ctx := context.Background()
+
+	info, err := s.CreateSession(ctx, dst, "docs/a.txt", testSessionSize)
+	if err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+	if info.BackendID == "" {
+		t.Fatal("session on a MultipartUploader has no BackendID")
+	}
+	putPart(t, s, dst, info.ID, 2, "world")
+	putPart(t, s, dst, info.ID, 1, "hello ")
+
+	// Parts go to the backend, not the store.
+	if entries, _ := os.ReadDir(s.partsPath(info.ID)); len(entries) != 0 {
+		t.Errorf("store staged %d parts of a native session", len(entries))
+	}
+	if n := backendParts(t, root); n != 1 {
+		t.Errorf("backend holds %d uploads, want 1", n)
+	}
+
+	if err := s.CompleteSession(ctx, dst, info.ID); err != nil {
+		t.Fatalf("CompleteSession: %v", err)
+	}
+	if got := readAll(t, dst, "docs/a.txt"); got != "hello world" {
+		t.Errorf("assembled %q, want %q", got, "hello world")
+	}
+	if n := backendParts(t, root); n != 0 {
+		t.Errorf("backend holds %d uploads after completion, want 0", n)
+	}
+}
+
+func TestSession_NativeAbortAndSweep(t *testing.T) {
+	s := newTestStore(t)
+	dst, root := newNativeBackend(t)
+	ctx := context.Background()
+	now := time.Now()
+	s.now = func() time.Time { return now }
+
+	aborted, _ := s.CreateSession(ctx, dst, "a.txt", testSessionSize)
+	putPart(t, s, dst, aborted.ID, 1, "abc")
+	if err := s.AbortSession(ctx, dst, aborted.ID); err != nil {
+		t.Fatalf("AbortSession: %v", err)
+	}
+	if n := backendParts(t, root); n != 0 {
+		t.Errorf("backend holds %d uploads after abort, want 0", n)
+	}
+
+	expired, _ := s.CreateSession(ctx, dst, "b.txt", testSessionSize)
+	putPart(t, s, dst, expired.ID, 1, "abc")
+	now = now.Add(2 * time.Hour)
+	if n, err := s.Sweep(ctx, dst); err != nil || n != 1 {
+		t.Fatalf("Sweep = %d, %v; want 1 upload removed", n, err)
+	}
+	if n := backendParts(t, root); n != 0 {
+		t.Errorf("backend holds %d uploads after sweep, want 0", n)
+	}
+}
@@ -0,0 +1,406 @@
+// Package upload keeps the state of resumable uploads on local disk, so an
+// upload interrupted by a dropped connection or a server restart can be
+// continued where it stopped and is only committed to storage once complete.
+//
+// Two kinds of upload are kept: tus uploads, which receive data appended at
+// an offset, and multipart sessions, which receive numbered parts in any
+// order and in parallel.
+package upload
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"go-storage-api/internal/storage"
+)
+
+var (
+	// ErrLocked is returned while another request is writing to the same
+	// upload.
+	ErrLocked = errors.New("upload is locked by another request")
+	// ErrOffset is returned when data is sent for an offset other than the
+	// current end of the upload.
+	ErrOffset = errors.New("upload offset mismatch")
+	// ErrTooLarge is returned when data goes past the declared size of a
+	// tus upload or the size limit of a session.
+	ErrTooLarge = errors.New("data exceeds upload size")
+	// ErrIncomplete is returned when committing an upload that is missing
+	// data.
+	ErrIncomplete = errors.New("upload is incomplete")
+)
+
+// Kinds of upload. Using an upload as the other kind fails with
+// storage.ErrNotFound.
+const (
+	// KindTus is an upload that receives data appended at an offset.
+	KindTus = ""
+	// KindSession is a multipart session that receives numbered parts.
+	KindSession = "session"
+)
+
+// Info describes an upload in progress.
+type Info struct {
+	ID string `json:"id"`
+	// Path is where the file is written in storage once complete.
+	Path string `json:"path"`
+	// Size is the declared length of a tus upload, and the most the parts
+	// of a session may add up to.
+	Size     int64             `json:"size"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+	Expires  time.Time         `json:"expires"`
+	Kind     string            `json:"kind,omitempty"`
+	// BackendID is set for sessions whose parts go straight to a backend
+	// implementing storage.MultipartUploader, and is the backend's ID of
+	// the upload. Other sessions are staged in the store.
+	BackendID string `json:"backendId,omitempty"`
+	// Parts maps the part numbers of a session to the bytes counted
+	// toward Size for them.
+	Parts map[int]int64 `json:"parts,omitempty"`
+
+	// Offset is the number of bytes received so far by a tus upload. It is
+	// the size of the data file, so bytes written before a crash are never
+	// lost or counted twice.
+	Offset int64 `json:"-"`
+}
+
+// Store keeps uploads in a directory: one JSON info file per upload, plus a
+// data file for a tus upload or a directory of parts for a session. Uploads
+// not written to within the expiry are removed.
+type Store struct {
+	dir    string
+	expiry time.Duration
+	now    func() time.Time
+
+	// busy counts the requests using each upload: -1 while one has it
+	// exclusively, otherwise the number of part uploads sharing it.
+	mu   sync.Mutex
+	busy map[string]int
+
+	// partsMu serializes the updates parallel part uploads make to the
+	// part sizes of a session's info file.
+	partsMu sync.Mutex
+}
+
+// New creates a store in dir, creating the directory if needed. Uploads
+// expire after expiry without activity.
+func New(dir string, expiry time.Duration) (*Store, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("create upload directory: %w", err)
+	}
+	return &Store{dir: dir, expiry: expiry, now: time.Now, busy: map[string]int{}}, nil
+}
+
+// Create starts an upload of size bytes to path.
+func (s *Store) Create(path string, size int64, metadata map[string]string) (*Info, error) {
+	if size < 0 {
+		return nil, fmt.Errorf("%w: negative upload size", storage.ErrInvalid)
+	}
+	id, err := newID()
+	if err != nil {
+		return nil, err
+	}
+
+	release, err := s.lock(id)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	// The info file goes first: without a data file the upload counts as
+	// missing, and Sweep removes it.
+	info := &Info{ID: id, Path: path, Size: size, Metadata: metadata, Expires: s.now().Add(s.expiry)}
+	if err := s.save(info); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(s.dataPath(id), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		s.remove(id)
+		return nil, fmt.Errorf("create upload: %w", err)
+	}
+	f.Close()
+	return info, nil
+}
+
+// Get returns an upload of either kind, or storage.ErrNotFound if it does
+// not exist or has expired. Expired uploads stay on disk until Sweep.
+func (s *Store) Get(id string) (*Info, error) {
+	info, err := s.load(id)
+	if err != nil {
+		return nil, err
+	}
+	if s.now().After(info.Expires) {
+		return nil, fmt.Errorf("upload %s expired: %w", id, storage.ErrNotFound)
+	}
+
+	if info.Kind == KindSession {
+		if _, err := os.Stat(s.partsPath(id)); err != nil {
+			return nil, fmt.Errorf("upload %s: %w", id, storage.ErrNotFound)
+		}
+		return info, nil
+	}
+	fi, err := os.Stat(s.dataPath(id))
+	if err != nil {
+		return nil, fmt.Errorf("upload %s: %w", id, storage.ErrNotFound)
+	}
+	info.Offset = fi.Size()
+	return info, nil
+}
+
+// get is Get restricted to one kind of upload.
+func (s *Store) get(id, kind string) (*Info, error) {
+	info, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if info.Kind != kind {
+		return nil, fmt.Errorf("upload %s: %w", id, storage.ErrNotFound)
+	}
+	return info, nil
+}
+
+// load reads an upload's info file, whether or not the upload is usable.
+func (s *Store) load(id string) (*Info, error) {
+	if !validID(id) {
+		return nil, fmt.Errorf("upload %q: %w", id, storage.ErrNotFound)
+	}
+	data, err := os.ReadFile(s.infoPath(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("upload %s: %w", id, storage.ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read upload %s: %w", id, err)
+	}
+
+	var info Info
+	if err := json.Unmarshal(data, &info); err != nil {
+		return nil, fmt.Errorf("read upload %s: %w", id, err)
+	}
+	return &info, nil
+}
+
+// Append writes r to the end of the upload, which must currently be at
+// offset. Everything read from r before an error is kept, so the client can
+// resume from the returned Offset. Sending more than the remaining size
+// stores what fits and fails with ErrTooLarge.
+func (s *Store) Append(id string, offset int64, r io.Reader) (*Info, error) {
+	release, err := s.lock(id)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	info, err := s.get(id, KindTus)
+	if err != nil {
+		return nil, err
+	}
+	if offset != info.Offset {
+		return info, fmt.Errorf("%w: upload is at %d, not %d", ErrOffset, info.Offset, offset)
+	}
+
+	f, err := os.OpenFile(s.dataPath(id), os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		return nil, fmt.Errorf("open upload %s: %w", id, err)
+	}
+	n, copyErr := io.Copy(f, io.LimitReader(r, info.Size-info.Offset))
+	if copyErr == nil && n == info.Size-info.Offset {
+		// Check for data beyond the declared size.
+		var b [1]byte
+		if m, _ := r.Read(b[:]); m > 0 {
+			copyErr = ErrTooLarge
+		}
+	}
+	if err := f.Sync(); err != nil && copyErr == nil {
+		copyErr = err
+	}
+	if err := f.Close(); err != nil && copyErr == nil {
+		copyErr = err
+	}
+	info.Offset += n
+
+	info.Expires = s.now().Add(s.expiry)
+	if err := s.save(info); err != nil && copyErr == nil {
+		copyErr = err
+	}
+	return info, copyErr
+}
+
+// Commit writes a complete upload to its path in dst and removes it from
+// the store. A failed commit leaves the upload in place so it can be
+// retried.
+func (s *Store) Commit(ctx context.Context, id string, dst storage.Storage) error {
+	release, err := s.lock(id)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	info, err := s.get(id, KindTus)
+	if err != nil {
+		return err
+	}
+	if info.Offset != info.Size {
+		return fmt.Errorf("%w: %d of %d bytes received", ErrIncomplete, info.Offset, info.Size)
+	}
+
+	f, err := os.Open(s.dataPath(id))
+	if err != nil {
+		return fmt.Errorf("open upload %s: %w", id, err)
+	}
+	defer f.Close()
+	if err := dst.Write(ctx, info.Path, f); err != nil {
+		return err
+	}
+	s.remove(id)
+	return nil
+}
+
+// Remove deletes a tus upload and its data. Sessions are ended with
+// AbortSession.
+func (s *Store) Remove(id string) error {
+	release, err := s.lock(id)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	if _, err := s.get(id, KindTus); err != nil {
+		return err
+	}
+	s.remove(id)
+	return nil
+}
+
+// Sweep removes every expired upload and returns how many it removed.
+// Sessions whose parts went to dst are aborted there. Uploads that are in
+// use are skipped.
+func (s *Store) Sweep(ctx context.Context, dst storage.Storage) (int, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return 0, fmt.Errorf("read upload directory: %w", err)
+	}
+
+	removed := 0
+	for _, e := range entries {
+		id, ok := strings.CutSuffix(e.Name(), ".json")
+		if !ok || !validID(id) {
+			continue
+		}
+		release, err := s.lock(id)
+		if err != nil {
+			continue
+		}
+		if _, err := s.Get(id); errors.Is(err, storage.ErrNotFound) {
+			// Expired, or left incomplete by a crash.
+			if info, err := s.load(id); err == nil && info.BackendID != "" {
+				if mu, ok := dst.(storage.MultipartUploader); ok {
+					mu.AbortMultipart(ctx, info.Path, info.BackendID)
+				}
+			}
+			s.remove(id)
+			removed++
+		}
+		release()
+	}
+	return removed, nil
+}
+
+// lock marks an upload as in use by one request exclusively. The returned
+// function releases it.
+func (s *Store) lock(id string) (func(), error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.busy[id] != 0 {
+		return nil, ErrLocked
+	}
+	s.busy[id] = -1
+	return func() {
+		s.mu.Lock()
+		delete(s.busy, id)
+		s.mu.Unlock()
+	}, nil
+}
+
+// share marks an upload as in use by a part upload, which may run alongside
+// others but not alongside an exclusive lock.
+func (s *Store) share(id string) (func(), error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.busy[id] < 0 {
+		return nil, ErrLocked
+	}
+	s.busy[id]++
+	return func() {
+		s.mu.Lock()
+		if s.busy[id]--; s.busy[id] == 0 {
+			delete(s.busy, id)
+		}
+		s.mu.Unlock()
+	}, nil
+}
+
+// save writes the info file through a temporary file and rename, so a crash
+// never leaves it half written. Parallel part uploads save the same upload
+// at once, so each uses its own temporary file.
+func (s *Store) save(info *Info) error {
+	data, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(s.dir, info.ID+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("save upload %s: %w", info.ID, err)
+	}
+	_, err = f.Write(data)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), s.infoPath(info.ID))
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return fmt.Errorf("save upload %s: %w", info.ID, err)
+	}
+	return nil
+}
+
+func (s *Store) remove(id string) {
+	os.Remove(s.infoPath(id))
+	os.Remove(s.dataPath(id))
+	os.RemoveAll(s.partsPath(id))
+}
+
+func (s *Store) infoPath(id string) string  { return filepath.Join(s.dir, id+".json") }
+func (s *Store) dataPath(id string) string  { return filepath.Join(s.dir, id+".bin") }
+func (s *Store) partsPath(id string) string { return filepath.Join(s.dir, id+".parts") }
+
+// idLen is the length of an upload ID: 16 random bytes, hex-encoded.
+const idLen = 32
+
+func newID() (string, error) {
+	var b [idLen / 2]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", fmt.Errorf("generate upload id: %w", err)
+	}
+	return hex.EncodeToString(b[:]), nil
+}
+
+// validID reports whether id could have come from newID. IDs arrive in
+// URLs and become file names, so nothing else is accepted.
+func validID(id string) bool {
+	if len(id) != idLen {
+		return false
+	}
+	_, err := hex.DecodeString(id)
+	return err == nil && strings.ToLower(id) == id
+}
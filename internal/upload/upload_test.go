@@ -0,0 +1,271 @@
+package upload
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"go-storage-api/internal/storage"
+	"go-storage-api/internal/storage/memory"
+)
+
+func newTestStore(t *testing.T) *Store {
+	t.Helper()
+	s, err := New(t.TempDir(), time.Hour)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	return s
+}
+
+// --- Create / Get ---
+
+func TestCreateAndGet(t *testing.T) {
+	s := newTestStore(t)
+
+	created, err := s.Create("docs/a.txt", 10, map[string]string{"filename": "a.txt"})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if !validID(created.ID) {
+		t.Errorf("ID %q is not valid", created.ID)
+	}
+
+	info, err := s.Get(created.ID)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if info.Path != "docs/a.txt" || info.Size != 10 || info.Offset != 0 || info.Metadata["filename"] != "a.txt" {
+		t.Errorf("Get = %+v", info)
+	}
+}
+
+func TestGet_Unknown(t *testing.T) {
+	s := newTestStore(t)
+
+	for _, id := range []string{"", "../../etc/passwd", strings.Repeat("0", idLen), strings.Repeat("A", idLen)} {
+		if _, err := s.Get(id); !errors.Is(err, storage.ErrNotFound) {
+			t.Errorf("Get(%q) error = %v, want ErrNotFound", id, err)
+		}
+	}
+}
+
+func TestCreate_NegativeSize(t *testing.T) {
+	s := newTestStore(t)
+	if _, err := s.Create("a.txt", -1, nil); !errors.Is(err, storage.ErrInvalid) {
+		t.Errorf("Create error = %v, want ErrInvalid", err)
+	}
+}
+
+// --- Append ---
+
+func TestAppend(t *testing.T) {
+	s := newTestStore(t)
+	created, _ := s.Create("a.txt", 11, nil)
+
+	info, err := s.Append(created.ID, 0, strings.NewReader("hello "))
+	if err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+	if info.Offset != 6 {
+		t.Errorf("Offset = %d, want 6", info.Offset)
+	}
+
+	if _, err := s.Append(created.ID, 0, strings.NewReader("again")); !errors.Is(err, ErrOffset) {
+		t.Errorf("Append at stale offset error = %v, want ErrOffset", err)
+	}
+
+	info, err = s.Append(created.ID, 6, strings.NewReader("world"))
+	if err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+	if info.Offset != 11 {
+		t.Errorf("Offset = %d, want 11", info.Offset)
+	}
+}
+
+func TestAppend_KeepsDataBeforeError(t *testing.T) {
+	s := newTestStore(t)
+	created, _ := s.Create("a.txt", 100, nil)
+
+	errDropped := errors.New("connection dropped")
+	r := io.MultiReader(strings.NewReader("0123456789"), iotest.ErrReader(errDropped))
+	info, err := s.Append(created.ID, 0, r)
+	if !errors.Is(err, errDropped) {
+		t.Fatalf("Append error = %v, want %v", err, errDropped)
+	}
+	if info.Offset != 10 {
+		t.Errorf("Offset = %d, want 10", info.Offset)
+	}
+	if got, _ := s.Get(created.ID); got.Offset != 10 {
+		t.Errorf("Get Offset = %d, want 10", got.Offset)
+	}
+}
+
+func TestAppend_TooLarge(t *testing.T) {
+	s := newTestStore(t)
+	created, _ := s.Create("a.txt", 4, nil)
+
+	info, err := s.Append(created.ID, 0, strings.NewReader("too much"))
+	if !errors.Is(err, ErrTooLarge) {
+		t.Fatalf("Append error = %v, want ErrTooLarge", err)
+	}
+	if info.Offset != 4 {
+		t.Errorf("Offset = %d, want 4", info.Offset)
+	}
+}
+
+func TestAppend_Locked(t *testing.T) {
+	s := newTestStore(t)
+	created, _ := s.Create("a.txt", 10, nil)
+
+	pr, pw := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		_, err := s.Append(created.ID, 0, pr)
+		done <- err
+	}()
+	pw.Write([]byte("abc")) // returns once the first Append is reading
+
+	if _, err := s.Append(created.ID, 3, strings.NewReader("def")); !errors.Is(err, ErrLocked) {
+		t.Errorf("concurrent Append error = %v, want ErrLocked", err)
+	}
+	if err := s.Remove(created.ID); !errors.Is(err, ErrLocked) {
+		t.Errorf("Remove during Append error = %v, want ErrLocked", err)
+	}
+
+	pw.Close()
+	if err := <-done; err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+}
+
+// --- Commit ---
+
+func TestCommit(t *testing.T) {
+	s := newTestStore(t)
+	dst := memory.New()
+	ctx := context.Background()
+
+	created, _ := s.Create("docs/a.txt", 5, nil)
+	s.Append(created.ID, 0, strings.NewReader("abc"))
+	if err := s.Commit(ctx, created.ID, dst); !errors.Is(err, ErrIncomplete) {
+		t.Fatalf("Commit of incomplete upload error = %v, want ErrIncomplete", err)
+	}
+
+	s.Append(created.ID, 3, strings.NewReader("de"))
+	if err := s.Commit(ctx, created.ID, dst); err != nil {
+		t.Fatalf("Commit: %v", err)
+	}
+
+	rc, err := dst.Read(ctx, "docs/a.txt")
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	defer rc.Close()
+	if data, _ := io.ReadAll(rc); string(data) != "abcde" {
+		t.Errorf("committed %q, want %q", data, "abcde")
+	}
+	if _, err := s.Get(created.ID); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("Get after Commit error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestCommit_FailureKeepsUpload(t *testing.T) {
+	s := newTestStore(t)
+	dst := memory.New()
+	ctx := context.Background()
+	dst.Mkdir(ctx, "taken")
+
+	created, _ := s.Create("taken", 3, nil)
+	s.Append(created.ID, 0, strings.NewReader("abc"))
+	if err := s.Commit(ctx, created.ID, dst); err == nil {
+		t.Fatal("Commit onto a directory succeeded")
+	}
+	if info, err := s.Get(created.ID); err != nil || info.Offset != 3 {
+		t.Errorf("Get after failed Commit = %+v, %v; want the complete upload", info, err)
+	}
+}
+
+// --- Remove / expiry ---
+
+func TestRemove(t *testing.T) {
+	s := newTestStore(t)
+	created, _ := s.Create("a.txt", 10, nil)
+
+	if err := s.Remove(created.ID); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+	if _, err := s.Get(created.ID); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("Get after Remove error = %v, want ErrNotFound", err)
+	}
+	if err := s.Remove(created.ID); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("second Remove error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestExpiry(t *testing.T) {
+	s := newTestStore(t)
+	now := time.Now()
+	s.now = func() time.Time { return now }
+
+	stale, _ := s.Create("stale.txt", 10, nil)
+	active, _ := s.Create("active.txt", 10, nil)
+
+	// Writing to an upload extends its expiry.
+	now = now.Add(50 * time.Minute)
+	if _, err := s.Append(active.ID, 0, strings.NewReader("abc")); err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+
+	now = now.Add(20 * time.Minute)
+	n, err := s.Sweep(context.Background(), memory.New())
+	if err != nil {
+		t.Fatalf("Sweep: %v", err)
+	}
+	if n != 1 {
+		t.Errorf("Sweep removed %d uploads, want 1", n)
+	}
+	if _, err := s.Get(stale.ID); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("Get of expired upload error = %v, want ErrNotFound", err)
+	}
+	if _, err := s.Get(active.ID); err != nil {
+		t.Errorf("Get of active upload: %v", err)
+	}
+
+	entries, _ := os.ReadDir(s.dir)
+	if len(entries) != 2 {
+		t.Errorf("upload directory holds %d files, want 2", len(entries))
+	}
+}
+
+func TestSurvivesRestart(t *testing.T) {
+	dir := t.TempDir()
+	s, _ := New(dir, time.Hour)
+	created, _ := s.Create("a.txt", 6, map[string]string{"filename": "a.txt"})
+	s.Append(created.ID, 0, strings.NewReader("abc"))
+
+	// A crash can leave bytes in the data file that the last Append never
+	// reported; they still count.
+	f, _ := os.OpenFile(filepath.Join(dir, created.ID+".bin"), os.O_WRONLY|os.O_APPEND, 0)
+	f.WriteString("d")
+	f.Close()
+
+	restarted, err := New(dir, time.Hour)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	info, err := restarted.Get(created.ID)
+	if err != nil {
+		t.Fatalf("Get after restart: %v", err)
+	}
+	if info.Offset != 4 || info.Metadata["filename"] != "a.txt" {
+		t.Errorf("Get after restart = %+v", info)
+	}
+}